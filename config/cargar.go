@@ -0,0 +1,247 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Variable con la ruta del archivo de configuracion opcional
+const variableArchivo = "CONFIG_ARCHIVO"
+
+// Archivo .env leido si existe en el directorio de trabajo
+const archivoEnv = ".env"
+
+// ErrorValidacion reune todos los problemas encontrados al cargar la configuracion
+type ErrorValidacion struct {
+	Problemas []string
+}
+
+func (e *ErrorValidacion) Error() string {
+	return "configuracion invalida:\n  - " + strings.Join(e.Problemas, "\n  - ")
+}
+
+// Cargar lee la configuracion de las fuentes descritas en el paquete y la valida
+func Cargar() (Config, error) {
+	cfg := PorDefecto()
+	var problemas []string
+
+	//El .env se lee como mapa: no se copia al entorno del proceso
+	dotenv, err := godotenv.Read(archivoEnv)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		problemas = append(problemas, fmt.Sprintf("%s: %v", archivoEnv, err))
+	}
+	//Las variables vacias se tratan como no definidas
+	buscar := func(nombre string) (string, bool) {
+		if valor, ok := os.LookupEnv(nombre); ok && valor != "" {
+			return valor, true
+		}
+		valor, ok := dotenv[nombre]
+		return valor, ok && valor != ""
+	}
+
+	campos := camposDe(&cfg)
+
+	if ruta, ok := buscar(variableArchivo); ok {
+		problemas = append(problemas, aplicarArchivo(ruta, campos)...)
+	}
+
+	for _, c := range campos {
+		if c.env == "" {
+			continue
+		}
+		if valor, ok := buscar(c.env); ok {
+			if err := c.asignar(valor, true); err != nil {
+				problemas = append(problemas, fmt.Sprintf("%s=%q: %v", c.env, valor, err))
+			}
+		}
+	}
+
+	problemas = append(problemas, cfg.problemas()...)
+	if len(problemas) > 0 {
+		return cfg, &ErrorValidacion{Problemas: problemas}
+	}
+	return cfg, nil
+}
+
+// campo es un valor configurable con su clave en el archivo y su variable de entorno
+type campo struct {
+	clave  string // <seccion>.<campo>
+	env    string
+	unidad time.Duration // Unidad de los enteros en la variable de entorno
+	valor  reflect.Value
+}
+
+var unidades = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// camposDe recorre las secciones de cfg leyendo las etiquetas clave, env y unidad
+func camposDe(cfg *Config) []*campo {
+	var campos []*campo
+	raiz := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < raiz.NumField(); i++ {
+		seccion := raiz.Field(i)
+		nombreSeccion := raiz.Type().Field(i).Tag.Get("clave")
+		for j := 0; j < seccion.NumField(); j++ {
+			etiquetas := seccion.Type().Field(j).Tag
+			campos = append(campos, &campo{
+				clave:  nombreSeccion + "." + etiquetas.Get("clave"),
+				env:    etiquetas.Get("env"),
+				unidad: unidades[etiquetas.Get("unidad")],
+				valor:  seccion.Field(j),
+			})
+		}
+	}
+	return campos
+}
+
+// asignar interpreta el texto segun el tipo del campo. Las listas van separadas por comas
+func (c *campo) asignar(texto string, desdeEnv bool) error {
+	texto = strings.TrimSpace(texto)
+	switch destino := c.valor.Addr().Interface().(type) {
+	case *string:
+		*destino = texto
+	case *int:
+		n, err := strconv.Atoi(texto)
+		if err != nil {
+			return errors.New("se esperaba un numero entero")
+		}
+		*destino = n
+	case *float64:
+		f, err := strconv.ParseFloat(texto, 64)
+		if err != nil {
+			return errors.New("se esperaba un numero")
+		}
+		*destino = f
+	case *bool:
+		b, err := strconv.ParseBool(texto)
+		if err != nil {
+			return errors.New("se esperaba true o false")
+		}
+		*destino = b
+	case *[]string:
+		lista := []string{}
+		for _, elemento := range strings.Split(texto, ",") {
+			if elemento = strings.TrimSpace(elemento); elemento != "" {
+				lista = append(lista, elemento)
+			}
+		}
+		*destino = lista
+	case *time.Duration:
+		//En el entorno el nombre de la variable indica la unidad de los enteros
+		if n, err := strconv.Atoi(texto); err == nil && desdeEnv && c.unidad != 0 {
+			*destino = time.Duration(n) * c.unidad
+			return nil
+		}
+		d, err := time.ParseDuration(texto)
+		if err != nil {
+			return errors.New("se esperaba una duracion como 15s, 10m o 24h")
+		}
+		*destino = d
+	case encoding.TextUnmarshaler:
+		if err := destino.UnmarshalText([]byte(texto)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("tipo no soportado %s", c.valor.Type())
+	}
+	return nil
+}
+
+// aplicarArchivo lee un archivo YAML o TOML con una tabla por seccion
+func aplicarArchivo(ruta string, campos []*campo) []string {
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", variableArchivo, err)}
+	}
+
+	var secciones map[string]any
+	switch strings.ToLower(filepath.Ext(ruta)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contenido, &secciones)
+	case ".toml":
+		err = toml.Unmarshal(contenido, &secciones)
+	default:
+		return []string{fmt.Sprintf("%s: extension no soportada en %s (use .yaml, .yml o .toml)", variableArchivo, ruta)}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", ruta, err)}
+	}
+
+	porClave := make(map[string]*campo, len(campos))
+	for _, c := range campos {
+		porClave[c.clave] = c
+	}
+
+	var problemas []string
+	for _, nombreSeccion := range clavesOrdenadas(secciones) {
+		valores, ok := secciones[nombreSeccion].(map[string]any)
+		if !ok {
+			problemas = append(problemas, fmt.Sprintf("%s: %s debe ser una seccion", ruta, nombreSeccion))
+			continue
+		}
+		for _, nombre := range clavesOrdenadas(valores) {
+			clave := nombreSeccion + "." + nombre
+			c, ok := porClave[clave]
+			if !ok {
+				problemas = append(problemas, fmt.Sprintf("%s: clave desconocida %s", ruta, clave))
+				continue
+			}
+			texto, err := textoArchivo(valores[nombre])
+			if err == nil {
+				err = c.asignar(texto, false)
+			}
+			if err != nil {
+				problemas = append(problemas, fmt.Sprintf("%s: %s: %v", ruta, clave, err))
+			}
+		}
+	}
+	return problemas
+}
+
+// textoArchivo convierte un escalar o una lista de escalares al texto que entiende asignar
+func textoArchivo(valor any) (string, error) {
+	switch v := valor.(type) {
+	case string:
+		return v, nil
+	case []any:
+		elementos := make([]string, 0, len(v))
+		for _, e := range v {
+			texto, err := textoArchivo(e)
+			if err != nil {
+				return "", err
+			}
+			elementos = append(elementos, texto)
+		}
+		return strings.Join(elementos, ","), nil
+	case map[string]any, nil:
+		return "", errors.New("se esperaba un valor")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func clavesOrdenadas(m map[string]any) []string {
+	claves := make([]string, 0, len(m))
+	for clave := range m {
+		claves = append(claves, clave)
+	}
+	sort.Strings(claves)
+	return claves
+}
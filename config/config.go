@@ -0,0 +1,316 @@
+// Package config reune en un solo lugar la configuracion del servicio. Cada valor se
+// toma, de menor a mayor prioridad, de:
+//
+//  1. los valores por defecto de PorDefecto
+//  2. el archivo YAML o TOML indicado en CONFIG_ARCHIVO (segun su extension)
+//  3. el archivo .env del directorio de trabajo, si existe
+//  4. las variables de entorno del proceso
+//
+// Cargar no modifica el entorno y el paquete no tiene efectos al importarse. Los errores
+// de formato y de validacion se devuelven todos juntos en un *ErrorValidacion.
+//
+// En el archivo las claves son <seccion>.<campo> (ver las etiquetas clave) y las
+// duraciones se escriben como en Go ("15s", "24h"). En las variables de entorno las
+// duraciones pueden ser tambien un entero en la unidad que indica su nombre
+package config
+
+import (
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+)
+
+// Config es la configuracion completa del servicio
+type Config struct {
+	Servidor     Servidor     `clave:"servidor"`
+	BaseDatos    BaseDatos    `clave:"base_datos"`
+	JWT          JWT          `clave:"jwt"`
+	Contrasenas  Contrasenas  `clave:"contrasenas"`
+	Login        Login        `clave:"login"`
+	TOTP         TOTP         `clave:"totp"`
+	CORS         CORS         `clave:"cors"`
+	Seguridad    Seguridad    `clave:"seguridad"`
+	Limites      Limites      `clave:"limites"`
+	Idempotencia Idempotencia `clave:"idempotencia"`
+	Trazas       Trazas       `clave:"trazas"`
+	Metricas     Metricas     `clave:"metricas"`
+	Log          Log          `clave:"log"`
+}
+
+// Servidor son el puerto y los limites de tiempo del servidor HTTP y del apagado
+type Servidor struct {
+	Puerto      int           `clave:"puerto" env:"PORT"`
+	Lectura     time.Duration `clave:"tiempo_lectura" env:"SERVIDOR_TIEMPO_LECTURA_SEGUNDOS" unidad:"s"`
+	Cabeceras   time.Duration `clave:"tiempo_cabeceras" env:"SERVIDOR_TIEMPO_CABECERAS_SEGUNDOS" unidad:"s"`
+	Escritura   time.Duration `clave:"tiempo_escritura" env:"SERVIDOR_TIEMPO_ESCRITURA_SEGUNDOS" unidad:"s"`
+	Inactividad time.Duration `clave:"tiempo_inactividad" env:"SERVIDOR_TIEMPO_INACTIVIDAD_SEGUNDOS" unidad:"s"`
+	// Espera antes de dejar de aceptar conexiones, para que el balanceador vea /readyz en 503
+	EsperaApagado time.Duration `clave:"espera_apagado" env:"SERVIDOR_ESPERA_APAGADO_SEGUNDOS" unidad:"s"`
+	// Tiempo maximo para terminar las solicitudes en curso
+	Apagado time.Duration `clave:"tiempo_apagado" env:"SERVIDOR_TIEMPO_APAGADO_SEGUNDOS" unidad:"s"`
+	// IPs o rangos CIDR de los proxies de los que se acepta X-Forwarded-For
+	ProxiesConfiables []string `clave:"proxies_confiables" env:"SERVIDOR_PROXIES_CONFIABLES"`
+}
+
+// BaseDatos es la cadena de conexion y el tamaño y los tiempos del pool
+type BaseDatos struct {
+	Conexion           string        `clave:"conexion" env:"conexion"`
+	MaxConexiones      int           `clave:"max_conexiones" env:"DB_MAX_CONEXIONES"`
+	MinConexiones      int           `clave:"min_conexiones" env:"DB_MIN_CONEXIONES"`
+	IntervaloSalud     time.Duration `clave:"intervalo_salud" env:"DB_INTERVALO_SALUD_SEGUNDOS" unidad:"s"`
+	VidaMaximaConexion time.Duration `clave:"vida_maxima_conexion" env:"DB_VIDA_MAXIMA_CONEXION_MINUTOS" unidad:"m"`
+	TiempoConexion     time.Duration `clave:"tiempo_conexion" env:"DB_TIEMPO_CONEXION_SEGUNDOS" unidad:"s"`
+	TiempoSentencia    time.Duration `clave:"tiempo_maximo_sentencia" env:"DB_TIEMPO_MAXIMO_SENTENCIA_MS" unidad:"ms"`
+}
+
+// JWT son las claves de firma y la vigencia de los tokens
+type JWT struct {
+	DirectorioClaves       string        `clave:"directorio_claves" env:"JWT_DIRECTORIO_CLAVES"`
+	ClaveActiva            string        `clave:"clave_activa" env:"JWT_CLAVE_ACTIVA"`
+	ClaveEfimera           bool          `clave:"clave_efimera" env:"JWT_CLAVE_EFIMERA"`
+	Emisor                 string        `clave:"emisor" env:"JWT_EMISOR"`
+	Audiencia              string        `clave:"audiencia" env:"JWT_AUDIENCIA"`
+	DuracionSesion         time.Duration `clave:"duracion_sesion" env:"JWT_DURACION_SESION_MINUTOS" unidad:"m"`
+	DuracionDesafio2FA     time.Duration `clave:"duracion_desafio_2fa" env:"JWT_DURACION_DESAFIO_2FA_MINUTOS" unidad:"m"`
+	DuracionInscripcion2FA time.Duration `clave:"duracion_inscripcion_2fa" env:"JWT_DURACION_INSCRIPCION_2FA_MINUTOS" unidad:"m"`
+}
+
+// Contrasenas es la politica de contraseñas y el costo de bcrypt
+type Contrasenas struct {
+	LongitudMinima    int  `clave:"longitud_minima" env:"CONTRASENA_LONGITUD_MINIMA"`
+	RequiereMayuscula bool `clave:"requiere_mayuscula" env:"CONTRASENA_REQUIERE_MAYUSCULA"`
+	RequiereMinuscula bool `clave:"requiere_minuscula" env:"CONTRASENA_REQUIERE_MINUSCULA"`
+	RequiereDigito    bool `clave:"requiere_digito" env:"CONTRASENA_REQUIERE_DIGITO"`
+	RequiereSimbolo   bool `clave:"requiere_simbolo" env:"CONTRASENA_REQUIERE_SIMBOLO"`
+	Historial         int  `clave:"historial" env:"CONTRASENA_HISTORIAL"`
+	RechazarComunes   bool `clave:"rechazar_comunes" env:"CONTRASENA_RECHAZAR_COMUNES"`
+	CostoBcrypt       int  `clave:"costo_bcrypt" env:"BCRYPT_COSTO"`
+}
+
+// Login son los umbrales de proteccion contra fuerza bruta
+type Login struct {
+	MaxIntentosUsuario int           `clave:"max_intentos_usuario" env:"LOGIN_MAX_INTENTOS_USUARIO"`
+	MaxIntentosIP      int           `clave:"max_intentos_ip" env:"LOGIN_MAX_INTENTOS_IP"`
+	RetrasoBase        time.Duration `clave:"retraso_base" env:"LOGIN_RETRASO_BASE_MS" unidad:"ms"`
+	RetrasoMaximo      time.Duration `clave:"retraso_maximo" env:"LOGIN_RETRASO_MAXIMO_MS" unidad:"ms"`
+	DuracionBloqueo    time.Duration `clave:"duracion_bloqueo" env:"LOGIN_BLOQUEO_MINUTOS" unidad:"m"`
+	Ventana            time.Duration `clave:"ventana" env:"LOGIN_VENTANA_MINUTOS" unidad:"m"`
+}
+
+// TOTP es el emisor mostrado en la app autenticadora y los roles obligados a usar 2FA
+type TOTP struct {
+	Emisor            string   `clave:"emisor" env:"TOTP_EMISOR"`
+	RolesObligatorios []string `clave:"roles_obligatorios" env:"TOTP_ROLES_OBLIGATORIOS"`
+}
+
+// CORS define que origenes pueden llamar a la API desde el navegador y con que metodos
+// y cabeceras. Sin origenes no se responde a ninguna solicitud de otro origen
+type CORS struct {
+	Origenes           []string      `clave:"origenes" env:"CORS_ORIGENES"`
+	Metodos            []string      `clave:"metodos" env:"CORS_METODOS"`
+	Cabeceras          []string      `clave:"cabeceras" env:"CORS_CABECERAS"`
+	CabecerasExpuestas []string      `clave:"cabeceras_expuestas" env:"CORS_CABECERAS_EXPUESTAS"`
+	Credenciales       bool          `clave:"credenciales" env:"CORS_CREDENCIALES"`
+	MaxAge             time.Duration `clave:"max_age" env:"CORS_MAX_AGE_SEGUNDOS" unidad:"s"`
+}
+
+// Seguridad son las cabeceras de seguridad añadidas a todas las respuestas
+type Seguridad struct {
+	// Vigencia de Strict-Transport-Security; cero la desactiva
+	HSTS            time.Duration `clave:"hsts" env:"SEGURIDAD_HSTS_DIAS" unidad:"d"`
+	HSTSSubdominios bool          `clave:"hsts_subdominios" env:"SEGURIDAD_HSTS_SUBDOMINIOS"`
+	OpcionesMarco   string        `clave:"opciones_marco" env:"SEGURIDAD_OPCIONES_MARCO"` // X-Frame-Options
+}
+
+// Limites son las tasas de solicitudes por cliente: por IP en las rutas publicas y por
+// usuario o clave API en las protegidas. Las rutas listadas en Rutas tienen su propia
+// cubeta; el resto comparte la general del cliente
+type Limites struct {
+	Activo     bool          `clave:"activo" env:"LIMITE_ACTIVO"`
+	PorIP      security.Tasa `clave:"por_ip" env:"LIMITE_POR_IP"`
+	PorUsuario security.Tasa `clave:"por_usuario" env:"LIMITE_POR_USUARIO"`
+	Rutas      LimitesRuta   `clave:"rutas" env:"LIMITE_RUTAS"`
+}
+
+// Idempotencia es el tiempo que se guardan las respuestas de los POST con Idempotency-Key
+// y cuanto puede durar la solicitud que tiene reservada una clave
+type Idempotencia struct {
+	Retencion time.Duration `clave:"retencion" env:"IDEMPOTENCIA_RETENCION_HORAS" unidad:"h"`
+	//Al vencer se cancela el contexto de la solicitud y su transaccion se deshace
+	TiempoMaximo time.Duration `clave:"tiempo_maximo" env:"IDEMPOTENCIA_TIEMPO_MAXIMO_SEGUNDOS" unidad:"s"`
+	//Antiguedad desde la que un reintento toma una reserva sin completar
+	Abandono time.Duration `clave:"abandono" env:"IDEMPOTENCIA_ABANDONO_SEGUNDOS" unidad:"s"`
+}
+
+// Trazas configura la exportacion de OpenTelemetry. El destino OTLP se sigue leyendo de
+// las variables estandar OTEL_EXPORTER_OTLP_* por el propio exportador
+type Trazas struct {
+	Exportador     string  `clave:"exportador" env:"TRAZAS_EXPORTADOR"`
+	Muestreo       float64 `clave:"muestreo" env:"TRAZAS_MUESTREO"`
+	NombreServicio string  `clave:"nombre_servicio" env:"OTEL_SERVICE_NAME"`
+}
+
+// Metricas protege /metrics con un token Bearer si Token no esta vacio
+type Metricas struct {
+	Token string `clave:"token" env:"METRICAS_TOKEN"`
+}
+
+// Log es el nivel minimo de los logs (debug, info, warn o error)
+type Log struct {
+	Nivel slog.Level `clave:"nivel" env:"LOG_NIVEL"`
+}
+
+// PorDefecto devuelve la configuracion usada cuando no se indica otra. La cadena de
+// conexion no tiene valor por defecto
+func PorDefecto() Config {
+	bloqueo := security.ConfigBloqueoPorDefecto()
+	politica := security.PoliticaContrasenaPorDefecto()
+	tokens := security.DuracionTokensPorDefecto()
+
+	return Config{
+		Servidor: Servidor{
+			Puerto:      8080,
+			Lectura:     15 * time.Second,
+			Cabeceras:   5 * time.Second,
+			Escritura:   60 * time.Second,
+			Inactividad: 120 * time.Second,
+			Apagado:     30 * time.Second,
+		},
+		BaseDatos: BaseDatos{
+			MaxConexiones:      20,
+			MinConexiones:      2,
+			IntervaloSalud:     30 * time.Second,
+			VidaMaximaConexion: time.Hour,
+			TiempoConexion:     5 * time.Second,
+			TiempoSentencia:    10 * time.Second,
+		},
+		JWT: JWT{
+			Emisor:                 "ferryapp",
+			Audiencia:              "ferryapp-api",
+			DuracionSesion:         tokens.Sesion,
+			DuracionDesafio2FA:     tokens.Desafio2FA,
+			DuracionInscripcion2FA: tokens.Inscripcion2FA,
+		},
+		Contrasenas: Contrasenas{
+			LongitudMinima:    politica.LongitudMinima,
+			RequiereMayuscula: politica.RequiereMayuscula,
+			RequiereMinuscula: politica.RequiereMinuscula,
+			RequiereDigito:    politica.RequiereDigito,
+			RequiereSimbolo:   politica.RequiereSimbolo,
+			Historial:         politica.Historial,
+			RechazarComunes:   politica.RechazarComunes,
+			CostoBcrypt:       politica.CostoBcrypt,
+		},
+		Login: Login{
+			MaxIntentosUsuario: bloqueo.MaxIntentosUsuario,
+			MaxIntentosIP:      bloqueo.MaxIntentosIP,
+			RetrasoBase:        bloqueo.RetrasoBase,
+			RetrasoMaximo:      bloqueo.RetrasoMaximo,
+			DuracionBloqueo:    bloqueo.DuracionBloqueo,
+			Ventana:            bloqueo.Ventana,
+		},
+		TOTP: TOTP{Emisor: security.ConfigTOTPPorDefecto().Emisor},
+		CORS: CORS{
+			Metodos:            []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			Cabeceras:          []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "X-API-Key", "X-Request-Id"},
+			CabecerasExpuestas: []string{"ETag", "Retry-After", "Content-Disposition", "Idempotency-Replayed", "X-Request-Id", "Deprecation", "Link"},
+			MaxAge:             10 * time.Minute,
+		},
+		Seguridad: Seguridad{
+			HSTS:          365 * 24 * time.Hour,
+			OpcionesMarco: "DENY",
+		},
+		Limites: Limites{
+			Activo:     true,
+			PorIP:      security.Tasa{Solicitudes: 60, Periodo: time.Minute},
+			PorUsuario: security.Tasa{Solicitudes: 300, Periodo: time.Minute},
+			Rutas: LimitesRuta{
+				"POST /api/v2/sesiones":     {Solicitudes: 10, Periodo: time.Minute},
+				"POST /api/v2/sesiones/2fa": {Solicitudes: 10, Periodo: time.Minute},
+				"POST /api/v2/facturas":     {Solicitudes: 30, Periodo: time.Minute},
+				//Rutas obsoletas de la v1, con su propio contador
+				"POST /api/login":           {Solicitudes: 10, Periodo: time.Minute},
+				"POST /api/login/2fa":       {Solicitudes: 10, Periodo: time.Minute},
+				"POST /api/factura/generar": {Solicitudes: 30, Periodo: time.Minute},
+			},
+		},
+		Idempotencia: Idempotencia{
+			Retencion:    24 * time.Hour,
+			TiempoMaximo: 30 * time.Second,
+			Abandono:     time.Minute,
+		},
+		Trazas: Trazas{
+			Exportador:     "ninguno",
+			Muestreo:       1,
+			NombreServicio: "ferryapp",
+		},
+		Log: Log{Nivel: slog.LevelInfo},
+	}
+}
+
+// Politica devuelve la politica de contraseñas que aplican los handlers
+func (c Contrasenas) Politica() security.PoliticaContrasena {
+	return security.PoliticaContrasena{
+		LongitudMinima:    c.LongitudMinima,
+		RequiereMayuscula: c.RequiereMayuscula,
+		RequiereMinuscula: c.RequiereMinuscula,
+		RequiereDigito:    c.RequiereDigito,
+		RequiereSimbolo:   c.RequiereSimbolo,
+		Historial:         c.Historial,
+		RechazarComunes:   c.RechazarComunes,
+		CostoBcrypt:       c.CostoBcrypt,
+	}
+}
+
+// Proxies devuelve los proxies de confianza como rangos; una IP sola es un rango /32 o /128.
+// Los valores invalidos ya los rechaza Validar
+func (s Servidor) Proxies() []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, proxy := range s.ProxiesConfiables {
+		if prefijo, err := prefijoProxy(proxy); err == nil {
+			proxies = append(proxies, prefijo)
+		}
+	}
+	return proxies
+}
+
+func prefijoProxy(texto string) (netip.Prefix, error) {
+	if strings.Contains(texto, "/") {
+		prefijo, err := netip.ParsePrefix(texto)
+		return prefijo.Masked(), err
+	}
+	ip, err := netip.ParseAddr(texto)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// Bloqueo devuelve los umbrales del control de intentos de login
+func (l Login) Bloqueo() security.ConfigBloqueo {
+	return security.ConfigBloqueo{
+		MaxIntentosUsuario: l.MaxIntentosUsuario,
+		MaxIntentosIP:      l.MaxIntentosIP,
+		RetrasoBase:        l.RetrasoBase,
+		RetrasoMaximo:      l.RetrasoMaximo,
+		DuracionBloqueo:    l.DuracionBloqueo,
+		Ventana:            l.Ventana,
+	}
+}
+
+// Tokens devuelve la vigencia de los tokens de sesion y de 2FA
+func (j JWT) Tokens() security.DuracionTokens {
+	return security.DuracionTokens{
+		Sesion:         j.DuracionSesion,
+		Desafio2FA:     j.DuracionDesafio2FA,
+		Inscripcion2FA: j.DuracionInscripcion2FA,
+	}
+}
+
+// Config devuelve la configuracion de la verificacion en dos pasos
+func (t TOTP) Config() security.ConfigTOTP {
+	return security.ConfigTOTP{Emisor: t.Emisor, RolesObligatorios: t.RolesObligatorios}
+}
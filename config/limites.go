@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+)
+
+// LimitesRuta asocia "METODO /patron" (el patron de chi, p. ej. "PUT /api/ferry/actualizar/{matricula}")
+// a su tasa. Se escribe como una lista de METODO /patron=tasa separada por comas, que
+// reemplaza completa a la lista por defecto
+type LimitesRuta map[string]security.Tasa
+
+func (l *LimitesRuta) UnmarshalText(texto []byte) error {
+	limites := LimitesRuta{}
+	for _, entrada := range strings.Split(string(texto), ",") {
+		entrada = strings.TrimSpace(entrada)
+		if entrada == "" {
+			continue
+		}
+		ruta, tasaTexto, ok := strings.Cut(entrada, "=")
+		metodo, patron, okRuta := strings.Cut(strings.TrimSpace(ruta), " ")
+		patron = strings.TrimSpace(patron)
+		if !ok || !okRuta || !strings.HasPrefix(patron, "/") {
+			return fmt.Errorf("limite de ruta invalido %q (use METODO /patron=tasa)", entrada)
+		}
+		var tasa security.Tasa
+		if err := tasa.UnmarshalText([]byte(tasaTexto)); err != nil {
+			return err
+		}
+		limites[strings.ToUpper(metodo)+" "+patron] = tasa
+	}
+	*l = limites
+	return nil
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt solo usa los primeros 72 bytes de la contraseña
+const longitudMaximaContrasena = 72
+
+// Tiempo minimo entre el plazo de una solicitud idempotente y la toma de su reserva
+const margenAbandono = 5 * time.Second
+
+// Validar comprueba que los valores sean coherentes y devuelve todos los problemas juntos
+func (c Config) Validar() error {
+	if problemas := c.problemas(); len(problemas) > 0 {
+		return &ErrorValidacion{Problemas: problemas}
+	}
+	return nil
+}
+
+func (c Config) problemas() []string {
+	var v validador
+
+	//Servidor
+	v.comprobar(c.Servidor.Puerto >= 1 && c.Servidor.Puerto <= 65535, "servidor.puerto debe estar entre 1 y 65535")
+	v.positiva("servidor.tiempo_lectura", c.Servidor.Lectura)
+	v.positiva("servidor.tiempo_cabeceras", c.Servidor.Cabeceras)
+	v.positiva("servidor.tiempo_escritura", c.Servidor.Escritura)
+	v.positiva("servidor.tiempo_inactividad", c.Servidor.Inactividad)
+	v.comprobar(c.Servidor.EsperaApagado >= 0, "servidor.espera_apagado no puede ser negativa")
+	v.positiva("servidor.tiempo_apagado", c.Servidor.Apagado)
+	for _, proxy := range c.Servidor.ProxiesConfiables {
+		_, err := prefijoProxy(proxy)
+		v.comprobar(err == nil, fmt.Sprintf("servidor.proxies_confiables: %q no es una IP ni un rango CIDR", proxy))
+	}
+
+	//Base de datos
+	v.comprobar(c.BaseDatos.Conexion != "", "base_datos.conexion es obligatoria (variable conexion)")
+	v.comprobar(c.BaseDatos.MaxConexiones >= 1, "base_datos.max_conexiones debe ser al menos 1")
+	v.comprobar(c.BaseDatos.MinConexiones >= 0, "base_datos.min_conexiones no puede ser negativo")
+	v.comprobar(c.BaseDatos.MinConexiones <= c.BaseDatos.MaxConexiones,
+		fmt.Sprintf("base_datos.min_conexiones (%d) no puede ser mayor que base_datos.max_conexiones (%d)", c.BaseDatos.MinConexiones, c.BaseDatos.MaxConexiones))
+	v.positiva("base_datos.intervalo_salud", c.BaseDatos.IntervaloSalud)
+	v.positiva("base_datos.vida_maxima_conexion", c.BaseDatos.VidaMaximaConexion)
+	v.positiva("base_datos.tiempo_conexion", c.BaseDatos.TiempoConexion)
+	v.positiva("base_datos.tiempo_maximo_sentencia", c.BaseDatos.TiempoSentencia)
+
+	//JWT
+	//La clave efimera se pierde al reiniciar e invalida todas las sesiones; solo para desarrollo
+	v.comprobar(c.JWT.DirectorioClaves != "" || c.JWT.ClaveEfimera,
+		"jwt.directorio_claves es obligatorio (en desarrollo se puede usar jwt.clave_efimera: true)")
+	v.comprobar(c.JWT.DirectorioClaves == "" || !c.JWT.ClaveEfimera, "jwt.clave_efimera no se puede combinar con jwt.directorio_claves")
+	v.comprobar(c.JWT.ClaveActiva == "" || c.JWT.DirectorioClaves != "", "jwt.clave_activa requiere jwt.directorio_claves")
+	v.comprobar(strings.TrimSpace(c.JWT.Emisor) != "", "jwt.emisor no puede estar vacio")
+	v.comprobar(strings.TrimSpace(c.JWT.Audiencia) != "", "jwt.audiencia no puede estar vacia")
+	v.positiva("jwt.duracion_sesion", c.JWT.DuracionSesion)
+	v.positiva("jwt.duracion_desafio_2fa", c.JWT.DuracionDesafio2FA)
+	v.positiva("jwt.duracion_inscripcion_2fa", c.JWT.DuracionInscripcion2FA)
+
+	//Contraseñas
+	v.comprobar(c.Contrasenas.LongitudMinima >= 1 && c.Contrasenas.LongitudMinima <= longitudMaximaContrasena,
+		fmt.Sprintf("contrasenas.longitud_minima debe estar entre 1 y %d", longitudMaximaContrasena))
+	v.comprobar(c.Contrasenas.Historial >= 0, "contrasenas.historial no puede ser negativo")
+	v.comprobar(c.Contrasenas.CostoBcrypt >= bcrypt.MinCost && c.Contrasenas.CostoBcrypt <= bcrypt.MaxCost,
+		fmt.Sprintf("contrasenas.costo_bcrypt debe estar entre %d y %d", bcrypt.MinCost, bcrypt.MaxCost))
+
+	//Login
+	v.comprobar(c.Login.MaxIntentosUsuario >= 1, "login.max_intentos_usuario debe ser al menos 1")
+	v.comprobar(c.Login.MaxIntentosIP >= 1, "login.max_intentos_ip debe ser al menos 1")
+	v.positiva("login.retraso_base", c.Login.RetrasoBase)
+	v.comprobar(c.Login.RetrasoMaximo >= c.Login.RetrasoBase, "login.retraso_maximo no puede ser menor que login.retraso_base")
+	v.positiva("login.duracion_bloqueo", c.Login.DuracionBloqueo)
+	v.positiva("login.ventana", c.Login.Ventana)
+
+	//TOTP
+	v.comprobar(strings.TrimSpace(c.TOTP.Emisor) != "", "totp.emisor no puede estar vacio")
+
+	//CORS
+	for _, origen := range c.CORS.Origenes {
+		v.comprobar(origenValido(origen), fmt.Sprintf("cors.origenes: %q no es un origen valido (esquema://host[:puerto] o *)", origen))
+		v.comprobar(origen != "*" || !c.CORS.Credenciales, "cors.origenes no puede incluir * si cors.credenciales esta activo")
+	}
+	for _, metodo := range c.CORS.Metodos {
+		v.comprobar(metodosHTTP[metodo], fmt.Sprintf("cors.metodos: metodo %q no soportado", metodo))
+	}
+	for _, cabecera := range append(c.CORS.Cabeceras, c.CORS.CabecerasExpuestas...) {
+		v.comprobar(cabeceraValida(cabecera), fmt.Sprintf("cors: %q no es un nombre de cabecera valido", cabecera))
+	}
+	v.comprobar(c.CORS.MaxAge >= 0, "cors.max_age no puede ser negativo")
+
+	//Cabeceras de seguridad
+	v.comprobar(c.Seguridad.HSTS >= 0, "seguridad.hsts no puede ser negativo")
+	v.comprobar(c.Seguridad.OpcionesMarco == "DENY" || c.Seguridad.OpcionesMarco == "SAMEORIGIN",
+		fmt.Sprintf("seguridad.opciones_marco %q no soportado (use DENY o SAMEORIGIN)", c.Seguridad.OpcionesMarco))
+
+	//Limites de solicitudes
+	v.tasa("limites.por_ip", c.Limites.PorIP)
+	v.tasa("limites.por_usuario", c.Limites.PorUsuario)
+	for _, ruta := range slices.Sorted(maps.Keys(c.Limites.Rutas)) {
+		metodo, _, _ := strings.Cut(ruta, " ")
+		v.comprobar(metodosHTTP[metodo], fmt.Sprintf("limites.rutas: metodo %q no soportado en %q", metodo, ruta))
+		v.tasa("limites.rutas["+ruta+"]", c.Limites.Rutas[ruta])
+	}
+
+	//Idempotencia
+	v.positiva("idempotencia.retencion", c.Idempotencia.Retencion)
+	v.positiva("idempotencia.tiempo_maximo", c.Idempotencia.TiempoMaximo)
+	//El margen cubre el rollback de la solicitud cancelada antes de que otra tome su clave
+	v.comprobar(c.Idempotencia.Abandono >= c.Idempotencia.TiempoMaximo+margenAbandono,
+		fmt.Sprintf("idempotencia.abandono debe superar idempotencia.tiempo_maximo en al menos %s", margenAbandono))
+
+	//Trazas
+	exportador := strings.ToLower(c.Trazas.Exportador)
+	v.comprobar(exportador == "otlp" || exportador == "ninguno",
+		fmt.Sprintf("trazas.exportador %q no soportado (use otlp o ninguno)", c.Trazas.Exportador))
+	v.comprobar(c.Trazas.Muestreo >= 0 && c.Trazas.Muestreo <= 1, "trazas.muestreo debe estar entre 0 y 1")
+	v.comprobar(c.Trazas.NombreServicio != "", "trazas.nombre_servicio no puede estar vacio")
+
+	return v.problemas
+}
+
+// Un origen es * o esquema://host[:puerto], sin ruta, como lo envia el navegador
+func origenValido(origen string) bool {
+	if origen == "*" {
+		return true
+	}
+	u, err := url.Parse(origen)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// Metodos HTTP que sirve la API
+var metodosHTTP = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+}
+
+// Los nombres de cabecera son tokens de RFC 9110: letras, digitos y algunos simbolos
+func cabeceraValida(nombre string) bool {
+	if nombre == "" {
+		return false
+	}
+	for _, c := range nombre {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+type validador struct {
+	problemas []string
+}
+
+func (v *validador) comprobar(ok bool, problema string) {
+	if !ok {
+		v.problemas = append(v.problemas, problema)
+	}
+}
+
+func (v *validador) positiva(clave string, d time.Duration) {
+	v.comprobar(d > 0, clave+" debe ser mayor que cero")
+}
+
+func (v *validador) tasa(clave string, t security.Tasa) {
+	v.comprobar(t.Solicitudes > 0 && t.Periodo > 0, clave+" debe ser una tasa positiva como 60/m")
+}
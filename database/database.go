@@ -3,32 +3,46 @@ package database
 import (
 	"context"
 	"fmt"
-	"os"
+	"strconv"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/joho/godotenv"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConectarBD() (*pgx.Conn, error) {
-
-	if err := godotenv.Load(); err != nil {
-		return nil, fmt.Errorf("error cargando .env: %v", err)
+// ConectarBD crea un pool de conexiones. A diferencia de una unica pgx.Conn, el pool es
+// seguro para uso concurrente y reemplaza las conexiones caidas automaticamente
+func ConectarBD(cfg config.BaseDatos) (*pgxpool.Pool, error) {
+	configPool, err := pgxpool.ParseConfig(cfg.Conexion)
+	if err != nil {
+		return nil, fmt.Errorf("error en la cadena de conexion: %v", err)
 	}
 
-	conexionString := os.Getenv("conexion")
-	if conexionString == "" {
-		return nil, fmt.Errorf("error al obtener el env")
-	}
+	configPool.MaxConns = int32(cfg.MaxConexiones)
+	configPool.MinConns = int32(cfg.MinConexiones)
+	configPool.HealthCheckPeriod = cfg.IntervaloSalud
+	configPool.MaxConnLifetime = cfg.VidaMaximaConexion
+	configPool.ConnConfig.ConnectTimeout = cfg.TiempoConexion
 
-	conn, err := pgx.Connect(context.Background(), conexionString)
+	//Un span por consulta, hijo del span de la solicitud
+	configPool.ConnConfig.Tracer = tracing.TrazadorPgx{}
+
+	//Limite de tiempo por sentencia aplicado por el servidor
+	configPool.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.TiempoSentencia.Milliseconds(), 10)
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), configPool)
 	if err != nil {
 		return nil, fmt.Errorf("error conecntado a la base de datos: %v", err)
 	}
 
-	err = conn.Ping(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), configPool.ConnConfig.ConnectTimeout)
+	defer cancel()
+
+	err = pool.Ping(ctx)
 	if err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("error al hacer ping a la base de datos: %v", err)
 	}
 
-	return conn, nil
+	return pool, nil
 }
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migraciones/*.sql
+var archivosMigraciones embed.FS
+
+// Clave del advisory lock que evita que dos instancias migren a la vez
+const bloqueoMigraciones int64 = 0x66657272796d6967 // "ferrymig"
+
+// Migracion es un par de scripts up/down identificado por su version
+type Migracion struct {
+	Version int
+	Nombre  string
+	Subida  string
+	Bajada  string
+}
+
+// EstadoMigracion indica si una migracion ya fue aplicada y cuando
+type EstadoMigracion struct {
+	Version  int
+	Nombre   string
+	Aplicada *time.Time
+}
+
+// Los archivos tienen la forma 0001_nombre.up.sql y 0001_nombre.down.sql
+var patronMigracion = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// CargarMigraciones lee las migraciones embebidas ordenadas por version
+func CargarMigraciones() ([]Migracion, error) {
+	return leerMigraciones(archivosMigraciones, "migraciones")
+}
+
+func leerMigraciones(sistema fs.FS, dir string) ([]Migracion, error) {
+	entradas, err := fs.ReadDir(sistema, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo migraciones: %v", err)
+	}
+
+	porVersion := make(map[int]*Migracion)
+	for _, entrada := range entradas {
+		partes := patronMigracion.FindStringSubmatch(entrada.Name())
+		if partes == nil {
+			return nil, fmt.Errorf("nombre de migracion invalido: %s", entrada.Name())
+		}
+		version, _ := strconv.Atoi(partes[1])
+
+		contenido, err := fs.ReadFile(sistema, path.Join(dir, entrada.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %v", entrada.Name(), err)
+		}
+
+		m, ok := porVersion[version]
+		if !ok {
+			m = &Migracion{Version: version, Nombre: partes[2]}
+			porVersion[version] = m
+		}
+		if m.Nombre != partes[2] {
+			return nil, fmt.Errorf("la version %d tiene nombres distintos: %s y %s", version, m.Nombre, partes[2])
+		}
+		if partes[3] == "up" {
+			m.Subida = string(contenido)
+		} else {
+			m.Bajada = string(contenido)
+		}
+	}
+
+	migraciones := make([]Migracion, 0, len(porVersion))
+	for _, m := range porVersion {
+		if m.Subida == "" || m.Bajada == "" {
+			return nil, fmt.Errorf("la migracion %d_%s debe tener archivos up y down", m.Version, m.Nombre)
+		}
+		migraciones = append(migraciones, *m)
+	}
+	sort.Slice(migraciones, func(i, j int) bool { return migraciones[i].Version < migraciones[j].Version })
+	return migraciones, nil
+}
+
+// Migrador aplica y revierte las migraciones embebidas, registrando las aplicadas
+// en la tabla schema_migraciones
+type Migrador struct {
+	pool        *pgxpool.Pool
+	migraciones []Migracion
+}
+
+func NuevoMigrador(pool *pgxpool.Pool) (*Migrador, error) {
+	migraciones, err := CargarMigraciones()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrador{pool: pool, migraciones: migraciones}, nil
+}
+
+// UltimaVersion es la version mas reciente incluida en el binario
+func (m *Migrador) UltimaVersion() int {
+	if len(m.migraciones) == 0 {
+		return 0
+	}
+	return m.migraciones[len(m.migraciones)-1].Version
+}
+
+// VersionAplicada es la version mas alta aplicada en la base de datos (0 si ninguna).
+// No toma el bloqueo de migraciones, por lo que sirve para las comprobaciones de salud
+func (m *Migrador) VersionAplicada(ctx context.Context) (int, error) {
+	var version int
+	err := m.pool.QueryRow(ctx, `SELECT COALESCE(max(version), 0) FROM schema_migraciones`).Scan(&version)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+		//La tabla de control aun no existe: nunca se migro
+		return 0, nil
+	}
+	return version, err
+}
+
+// Subir aplica todas las migraciones pendientes y devuelve las versiones aplicadas
+func (m *Migrador) Subir(ctx context.Context) ([]int, error) {
+	return m.IrA(ctx, m.UltimaVersion())
+}
+
+// Bajar revierte las ultimas `pasos` migraciones aplicadas
+func (m *Migrador) Bajar(ctx context.Context, pasos int) ([]int, error) {
+	var revertidas []int
+	err := m.conBloqueo(ctx, func(conn *pgxpool.Conn) error {
+		aplicadas, err := versionesAplicadas(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migraciones) - 1; i >= 0 && len(revertidas) < pasos; i-- {
+			mig := m.migraciones[i]
+			if _, ok := aplicadas[mig.Version]; !ok {
+				continue
+			}
+			if err := revertir(ctx, conn, mig); err != nil {
+				return err
+			}
+			revertidas = append(revertidas, mig.Version)
+		}
+		return nil
+	})
+	return revertidas, err
+}
+
+// IrA deja la base de datos en la version indicada: aplica las pendientes hasta ella
+// y revierte las posteriores. Devuelve las versiones afectadas en el orden ejecutado
+func (m *Migrador) IrA(ctx context.Context, version int) ([]int, error) {
+	if version < 0 || (version > 0 && !m.existe(version)) {
+		return nil, fmt.Errorf("la version %d no existe", version)
+	}
+
+	var afectadas []int
+	err := m.conBloqueo(ctx, func(conn *pgxpool.Conn) error {
+		aplicadas, err := versionesAplicadas(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migraciones) - 1; i >= 0; i-- {
+			mig := m.migraciones[i]
+			if _, ok := aplicadas[mig.Version]; ok && mig.Version > version {
+				if err := revertir(ctx, conn, mig); err != nil {
+					return err
+				}
+				afectadas = append(afectadas, mig.Version)
+			}
+		}
+
+		for _, mig := range m.migraciones {
+			if _, ok := aplicadas[mig.Version]; !ok && mig.Version <= version {
+				if err := aplicar(ctx, conn, mig); err != nil {
+					return err
+				}
+				afectadas = append(afectadas, mig.Version)
+			}
+		}
+		return nil
+	})
+	return afectadas, err
+}
+
+// Estado lista todas las migraciones conocidas indicando cuales estan aplicadas
+func (m *Migrador) Estado(ctx context.Context) ([]EstadoMigracion, error) {
+	var estados []EstadoMigracion
+	err := m.conBloqueo(ctx, func(conn *pgxpool.Conn) error {
+		aplicadas, err := versionesAplicadas(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migraciones {
+			estado := EstadoMigracion{Version: mig.Version, Nombre: mig.Nombre}
+			if fecha, ok := aplicadas[mig.Version]; ok {
+				estado.Aplicada = &fecha
+			}
+			estados = append(estados, estado)
+		}
+		return nil
+	})
+	return estados, err
+}
+
+func (m *Migrador) existe(version int) bool {
+	for _, mig := range m.migraciones {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Toma el advisory lock en una conexion dedicada (el lock es por sesion) y crea la
+// tabla de control si hace falta
+func (m *Migrador) conBloqueo(ctx context.Context, fn func(conn *pgxpool.Conn) error) (err error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error obteniendo conexion: %v", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, bloqueoMigraciones); err != nil {
+		return fmt.Errorf("error tomando el bloqueo de migraciones: %v", err)
+	}
+	defer func() {
+		//Se libera con un contexto propio por si ctx ya fue cancelado
+		liberar, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelar()
+		if _, errLiberar := conn.Exec(liberar, `SELECT pg_advisory_unlock($1)`, bloqueoMigraciones); errLiberar != nil && err == nil {
+			err = fmt.Errorf("error liberando el bloqueo de migraciones: %v", errLiberar)
+		}
+	}()
+
+	_, err = conn.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migraciones (
+			version  INTEGER     PRIMARY KEY,
+			nombre   TEXT        NOT NULL,
+			aplicada TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("error creando schema_migraciones: %v", err)
+	}
+
+	return fn(conn)
+}
+
+func versionesAplicadas(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, aplicada FROM schema_migraciones`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando migraciones aplicadas: %v", err)
+	}
+	defer rows.Close()
+
+	aplicadas := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version int
+			fecha   time.Time
+		)
+		if err := rows.Scan(&version, &fecha); err != nil {
+			return nil, err
+		}
+		aplicadas[version] = fecha
+	}
+	return aplicadas, rows.Err()
+}
+
+// Cada migracion corre en su propia transaccion junto con su registro en schema_migraciones
+func aplicar(ctx context.Context, conn *pgxpool.Conn, mig Migracion) error {
+	return enTransaccion(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Subida); err != nil {
+			return fmt.Errorf("error aplicando %d_%s: %v", mig.Version, mig.Nombre, err)
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO schema_migraciones (version, nombre) VALUES ($1, $2)`, mig.Version, mig.Nombre)
+		return err
+	})
+}
+
+func revertir(ctx context.Context, conn *pgxpool.Conn, mig Migracion) error {
+	return enTransaccion(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Bajada); err != nil {
+			return fmt.Errorf("error revirtiendo %d_%s: %v", mig.Version, mig.Nombre, err)
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM schema_migraciones WHERE version = $1`, mig.Version)
+		return err
+	})
+}
+
+func enTransaccion(ctx context.Context, conn *pgxpool.Conn, fn func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	//Las migraciones no quedan sujetas al limite de tiempo por sentencia del pool
+	if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
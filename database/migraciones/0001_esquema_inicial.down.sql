@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS facturas;
+DROP TABLE IF EXISTS ferrys;
+DROP TABLE IF EXISTS usuarios;
+DROP TABLE IF EXISTS empleados;
+DROP TABLE IF EXISTS empresa;
@@ -0,0 +1,62 @@
+-- Tablas originales de la API: empresas, empleados, usuarios, ferrys y facturas
+
+CREATE TABLE empresa (
+    rif       VARCHAR(20)  PRIMARY KEY,
+    nombre    VARCHAR(150) NOT NULL,
+    email     VARCHAR(150) NOT NULL,
+    direccion TEXT         NOT NULL DEFAULT '',
+    estado    BOOLEAN      NOT NULL DEFAULT true
+);
+
+CREATE TABLE empleados (
+    cedula      VARCHAR(20)  PRIMARY KEY,
+    nombres     VARCHAR(100) NOT NULL,
+    apellidos   VARCHAR(100) NOT NULL,
+    rif_empresa VARCHAR(20)  NOT NULL REFERENCES empresa (rif),
+    email       VARCHAR(150) NOT NULL,
+    cargo       VARCHAR(100) NOT NULL,
+    numero_tlf  VARCHAR(30)  NOT NULL,
+    estado      BOOLEAN      NOT NULL DEFAULT true
+);
+
+CREATE INDEX empleados_rif_empresa_idx ON empleados (rif_empresa);
+
+-- rif_cedula es el RIF de la empresa, la cedula del empleado o el documento del administrador
+CREATE TABLE usuarios (
+    rif_cedula VARCHAR(20)  PRIMARY KEY,
+    usuario    VARCHAR(120) NOT NULL,
+    contrasena TEXT         NOT NULL,
+    tipo       VARCHAR(30)  NOT NULL,
+    estado     BOOLEAN      NOT NULL DEFAULT true,
+    CONSTRAINT usuarios_usuario_key UNIQUE (usuario)
+);
+
+CREATE TABLE ferrys (
+    matricula           VARCHAR(30)  PRIMARY KEY,
+    rif_empresa         VARCHAR(20)  NOT NULL REFERENCES empresa (rif),
+    nombre              VARCHAR(100) NOT NULL,
+    modelo              VARCHAR(100) NOT NULL,
+    capacidad_economica INTEGER      NOT NULL CHECK (capacidad_economica >= 0),
+    capacidad_vip       INTEGER      NOT NULL CHECK (capacidad_vip >= 0),
+    estado              BOOLEAN      NOT NULL DEFAULT false
+);
+
+CREATE INDEX ferrys_rif_empresa_idx ON ferrys (rif_empresa);
+
+-- cedula_empleado y nombre_empleado se guardan tal como se emitieron, sin referencia a empleados
+CREATE TABLE facturas (
+    id_factura        SERIAL       PRIMARY KEY,
+    nombres_viajero   VARCHAR(100) NOT NULL,
+    apellidos_viajero VARCHAR(100) NOT NULL,
+    rif_empresa       VARCHAR(20)  NOT NULL REFERENCES empresa (rif),
+    cedula_empleado   VARCHAR(20)  NOT NULL,
+    nombre_empleado   VARCHAR(200) NOT NULL,
+    id_viaje          VARCHAR(50)  NOT NULL,
+    tipo              VARCHAR(30)  NOT NULL,
+    estado            BOOLEAN      NOT NULL DEFAULT true,
+    nota              TEXT         NOT NULL DEFAULT '',
+    emision           TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    matricula_ferry   VARCHAR(30)  NOT NULL REFERENCES ferrys (matricula)
+);
+
+CREATE INDEX facturas_rif_empresa_idx ON facturas (rif_empresa);
@@ -0,0 +1,11 @@
+-- Bloqueos y desbloqueos por intentos fallidos de inicio de sesion
+CREATE TABLE eventos_seguridad (
+    id      BIGSERIAL    PRIMARY KEY,
+    tipo    VARCHAR(50)  NOT NULL,
+    usuario VARCHAR(120) NOT NULL DEFAULT '',
+    ip      VARCHAR(64)  NOT NULL DEFAULT '',
+    detalle TEXT         NOT NULL DEFAULT '',
+    fecha   TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX eventos_seguridad_fecha_idx ON eventos_seguridad (fecha);
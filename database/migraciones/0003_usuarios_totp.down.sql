@@ -0,0 +1 @@
+DROP TABLE IF EXISTS usuarios_totp;
@@ -0,0 +1,9 @@
+-- Verificacion en dos pasos. codigos_recuperacion guarda hashes SHA-256 de los codigos
+CREATE TABLE usuarios_totp (
+    rif_cedula           VARCHAR(20) PRIMARY KEY REFERENCES usuarios (rif_cedula) ON DELETE CASCADE,
+    secreto              TEXT        NOT NULL,
+    activo               BOOLEAN     NOT NULL DEFAULT false,
+    ultimo_paso          BIGINT      NOT NULL DEFAULT 0,
+    codigos_recuperacion TEXT[]      NOT NULL DEFAULT '{}',
+    creado               TIMESTAMPTZ NOT NULL DEFAULT now()
+);
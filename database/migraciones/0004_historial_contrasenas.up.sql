@@ -0,0 +1,9 @@
+-- Hashes anteriores para impedir la reutilizacion de contraseñas
+CREATE TABLE historial_contrasenas (
+    id         BIGSERIAL   PRIMARY KEY,
+    rif_cedula VARCHAR(20) NOT NULL REFERENCES usuarios (rif_cedula) ON DELETE CASCADE,
+    hash       TEXT        NOT NULL,
+    fecha      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX historial_contrasenas_rif_cedula_idx ON historial_contrasenas (rif_cedula, fecha DESC);
@@ -0,0 +1,17 @@
+-- Claves API por empresa. Solo se guarda el hash SHA-256 del secreto
+CREATE TABLE claves_api (
+    id          SERIAL       PRIMARY KEY,
+    prefijo     VARCHAR(32)  NOT NULL,
+    hash        TEXT         NOT NULL,
+    rif_empresa VARCHAR(20)  NOT NULL REFERENCES empresa (rif),
+    nombre      VARCHAR(100) NOT NULL,
+    alcances    TEXT[]       NOT NULL DEFAULT '{}',
+    expira      TIMESTAMPTZ,
+    revocada    BOOLEAN      NOT NULL DEFAULT false,
+    creada      TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    creada_por  VARCHAR(20)  NOT NULL,
+    ultimo_uso  TIMESTAMPTZ,
+    CONSTRAINT claves_api_prefijo_key UNIQUE (prefijo)
+);
+
+CREATE INDEX claves_api_rif_empresa_idx ON claves_api (rif_empresa);
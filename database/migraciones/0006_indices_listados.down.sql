@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS facturas_cedula_empleado_idx;
+DROP INDEX IF EXISTS facturas_matricula_ferry_idx;
+DROP INDEX IF EXISTS facturas_emision_idx;
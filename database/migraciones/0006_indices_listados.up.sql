@@ -0,0 +1,5 @@
+-- Indices para los filtros y ordenes de los listados paginados
+
+CREATE INDEX facturas_emision_idx ON facturas (emision, id_factura);
+CREATE INDEX facturas_matricula_ferry_idx ON facturas (matricula_ferry);
+CREATE INDEX facturas_cedula_empleado_idx ON facturas (cedula_empleado);
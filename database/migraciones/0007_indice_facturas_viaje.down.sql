@@ -0,0 +1 @@
+DROP INDEX IF EXISTS facturas_id_viaje_idx;
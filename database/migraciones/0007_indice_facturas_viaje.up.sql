@@ -0,0 +1,3 @@
+-- Indice para la busqueda de facturas por viaje (?viaje=)
+
+CREATE INDEX facturas_id_viaje_idx ON facturas (id_viaje);
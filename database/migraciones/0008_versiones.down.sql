@@ -0,0 +1,4 @@
+ALTER TABLE ferrys    DROP COLUMN version;
+ALTER TABLE usuarios  DROP COLUMN version;
+ALTER TABLE empleados DROP COLUMN version;
+ALTER TABLE empresa   DROP COLUMN version;
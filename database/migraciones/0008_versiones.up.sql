@@ -0,0 +1,7 @@
+-- Version por registro para el control de concurrencia optimista (ETag / If-Match).
+-- Cada UPDATE incrementa la version
+
+ALTER TABLE empresa   ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE empleados ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE usuarios  ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE ferrys    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+-- Respuestas guardadas de los POST con Idempotency-Key. alcance identifica al cliente
+-- y la ruta para que dos clientes no compartan claves
+CREATE TABLE solicitudes_idempotentes (
+    alcance        TEXT        NOT NULL,
+    clave          TEXT        NOT NULL,
+    hash_solicitud TEXT        NOT NULL,
+    estado         INTEGER     NOT NULL DEFAULT 0,
+    tipo_contenido TEXT        NOT NULL DEFAULT '',
+    cuerpo         BYTEA,
+    creada         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expira         TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (alcance, clave)
+);
+
+CREATE INDEX solicitudes_idempotentes_expira_idx ON solicitudes_idempotentes (expira);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auditoria;
+DROP FUNCTION IF EXISTS auditoria_solo_agregar();
@@ -0,0 +1,34 @@
+-- Registro de auditoria de todas las modificaciones. Es de solo agregado: cada fila guarda
+-- el hash de la anterior y los triggers impiden modificarlas o borrarlas
+CREATE TABLE auditoria (
+    id             BIGSERIAL   PRIMARY KEY,
+    actor          TEXT        NOT NULL,
+    tipo_actor     TEXT        NOT NULL,
+    accion         TEXT        NOT NULL,
+    entidad        TEXT        NOT NULL,
+    entidad_id     TEXT        NOT NULL,
+    cambios        JSONB,
+    ip             TEXT        NOT NULL DEFAULT '',
+    id_solicitud   TEXT        NOT NULL DEFAULT '',
+    fecha          TIMESTAMPTZ NOT NULL,
+    hash_anterior  TEXT        NOT NULL,
+    hash           TEXT        NOT NULL UNIQUE
+);
+
+CREATE INDEX auditoria_entidad_idx ON auditoria (entidad, entidad_id);
+CREATE INDEX auditoria_actor_idx ON auditoria (actor);
+CREATE INDEX auditoria_fecha_idx ON auditoria (fecha);
+
+CREATE FUNCTION auditoria_solo_agregar() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'el registro de auditoria no se puede modificar ni borrar';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auditoria_sin_cambios
+    BEFORE UPDATE OR DELETE ON auditoria
+    FOR EACH ROW EXECUTE FUNCTION auditoria_solo_agregar();
+
+CREATE TRIGGER auditoria_sin_truncate
+    BEFORE TRUNCATE ON auditoria
+    FOR EACH STATEMENT EXECUTE FUNCTION auditoria_solo_agregar();
@@ -0,0 +1 @@
+ALTER TABLE solicitudes_idempotentes DROP COLUMN reservada;
@@ -0,0 +1,7 @@
+-- Momento en que la solicitud en proceso tomo la clave. Mientras estado = 0 identifica a
+-- quien la tiene; una reserva mas antigua que el tiempo maximo de una solicitud quedo
+-- abandonada y la puede tomar un reintento. Se vacia al completar la solicitud
+
+ALTER TABLE solicitudes_idempotentes ADD COLUMN reservada TIMESTAMPTZ;
+
+UPDATE solicitudes_idempotentes SET reservada = creada WHERE estado = 0;
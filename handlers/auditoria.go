@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Campos cuyo valor nunca se guarda en la auditoria; solo se registra que cambiaron
+var camposOcultos = map[string]bool{"contrasena": true, "secreto": true, "hash": true}
+
+// auditar agrega una entrada al registro de auditoria con el actor de la solicitud y la
+// diferencia entre antes y despues (nil si el registro no existia o no aplica). Se llama
+// con el store de la misma transaccion que guarda el cambio: si la entrada no se puede
+// escribir, el cambio tampoco se confirma
+func auditar(r *http.Request, auditoria store.AuditoriaStore, accion, entidad, entidadID string, antes, despues any) error {
+	registro := models.RegistroAuditoria{
+		Actor:       "anonimo",
+		Accion:      accion,
+		Entidad:     entidad,
+		EntidadID:   entidadID,
+		Cambios:     diferencias(antes, despues),
+		IP:          helpers.IPCliente(r),
+		IDSolicitud: helpers.IDSolicitud(r.Context()),
+		Fecha:       time.Now().UTC(),
+	}
+	if claims := middlewares.UsuarioDesdeContexto(r.Context()); claims != nil {
+		registro.Actor, registro.TipoActor = claims.UsuarioID, claims.TipoUsuario
+		if claims.EsClaveAPI() {
+			registro.Actor = claims.ClaveAPI
+		}
+	}
+
+	if _, err := auditoria.Registrar(r.Context(), registro); err != nil {
+		//Sin %w: el error de la auditoria nunca es culpa del cliente, siempre termina en 500
+		return fmt.Errorf("error registrando auditoria de %s %s: %v", entidad, entidadID, err)
+	}
+	return nil
+}
+
+// diferencias compara los campos JSON de ambos valores y devuelve solo los que cambiaron.
+// La version no se incluye porque cambia en cada modificacion
+func diferencias(antes, despues any) map[string]models.CambioCampo {
+	a, d := camposJSON(antes), camposJSON(despues)
+	cambios := map[string]models.CambioCampo{}
+	for campo, valor := range d {
+		if anterior, ok := a[campo]; !ok || !reflect.DeepEqual(anterior, valor) {
+			cambios[campo] = models.CambioCampo{Antes: a[campo], Despues: valor}
+		}
+	}
+	for campo, valor := range a {
+		if _, ok := d[campo]; !ok {
+			cambios[campo] = models.CambioCampo{Antes: valor}
+		}
+	}
+	delete(cambios, "version")
+
+	for campo, cambio := range cambios {
+		if camposOcultos[campo] {
+			cambios[campo] = models.CambioCampo{Antes: ocultar(cambio.Antes), Despues: ocultar(cambio.Despues)}
+		}
+	}
+	if len(cambios) == 0 {
+		return nil
+	}
+	return cambios
+}
+
+func camposJSON(v any) map[string]any {
+	campos := map[string]any{}
+	if v == nil {
+		return campos
+	}
+	datos, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(datos, &campos)
+	}
+	return campos
+}
+
+func ocultar(v any) any {
+	if v == nil || v == "" {
+		return v
+	}
+	return "[oculto]"
+}
+
+// Listado del registro de auditoria (Solo Admin)
+func ListarAuditoria(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := nuevosParametros(r)
+		filtro := store.FiltroAuditoria{
+			Actor:     p.texto("actor"),
+			Accion:    p.texto("accion"),
+			Entidad:   p.texto("entidad"),
+			EntidadID: p.texto("entidad_id"),
+			Desde:     p.fecha("desde", false),
+			Hasta:     p.fecha("hasta", true),
+		}
+		consulta := p.consulta(store.CamposOrdenAuditoria())
+		if !p.responderInvalidos(w) {
+			return
+		}
+
+		registros, err := st.Auditoria.Listar(r.Context(), filtro, consulta)
+		responderPagina(w, r, registros, err, "Error al consultar la auditoria")
+	}
+}
+
+// Recorre la cadena de hashes de la auditoria para detectar registros alterados (Solo Admin)
+func VerificarAuditoria(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resultado, err := st.Auditoria.Verificar(r.Context())
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error verificando la auditoria", err))
+			return
+		}
+		helpers.ResponderJSON(w, http.StatusOK, resultado)
+	}
+}
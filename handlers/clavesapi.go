@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Veces que se genera una clave nueva si el prefijo ya existe
+const intentosClaveAPI = 3
+
+// Crear una clave API para la empresa del usuario autenticado. La clave completa solo se devuelve aqui
+func CrearClaveAPI(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		var req struct {
+			Nombre       string   `json:"nombre" validar:"requerido,max=100"`
+			Alcances     []string `json:"alcances" validar:"requerido"`
+			ExpiraEnDias int      `json:"expira_en_dias" validar:"min=0"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return
+		}
+
+		if !validarEntrada(w, r, req) {
+			return
+		}
+
+		if invalidos := security.AlcancesInvalidos(req.Alcances); len(invalidos) > 0 {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "Alcances no válidos: "+strings.Join(invalidos, ", ")).ConDetalles(map[string][]string{"alcances_validos": security.AlcancesValidos}))
+			return
+		}
+
+		ahora := time.Now().UTC()
+		clave := models.ClaveAPI{
+			RifEmpresa: claims.UsuarioID,
+			Nombre:     strings.TrimSpace(req.Nombre),
+			Alcances:   req.Alcances,
+			Creada:     ahora,
+		}
+		if req.ExpiraEnDias > 0 {
+			expira := ahora.AddDate(0, 0, req.ExpiraEnDias)
+			clave.Expira = &expira
+		}
+
+		//El prefijo es corto y puede repetirse: si choca con otra clave se genera una nueva
+		var generada security.ClaveAPIGenerada
+		var err error
+		for intento := 1; ; intento++ {
+			if generada, err = security.GenerarClaveAPI(); err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error generando clave API", err))
+				return
+			}
+			clave.Prefijo = generada.Prefijo
+
+			err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+				var err error
+				if clave.ID, err = tx.ClavesAPI.Crear(r.Context(), clave, generada.Hash, claims.UsuarioID); err != nil {
+					return err
+				}
+				return auditar(r, tx.Auditoria, "crear", "clave_api", strconv.Itoa(clave.ID), nil, clave)
+			})
+			if !errors.Is(err, store.ErrDuplicado) || intento == intentosClaveAPI {
+				break
+			}
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrReferencia) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoReferenciaInvalida, "El RIF de empresa no existe"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error guardando clave API", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]interface{}{
+			"mensaje":   "Clave API creada. Guárdela ahora, no se volverá a mostrar",
+			"clave":     generada.Clave,
+			"clave_api": clave,
+		})
+	}
+}
+
+// Listar las claves API de la empresa del usuario autenticado (sin el secreto)
+func ListarClavesAPI(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		claves, err := st.ClavesAPI.Listar(r.Context(), claims.UsuarioID)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error al consultar claves API", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusOK, claves)
+	}
+}
+
+// Revocar una clave API de la empresa del usuario autenticado
+func RevocarClaveAPI(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "ID de clave inválido"))
+			return
+		}
+
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.ClavesAPI.Revocar(r.Context(), id, claims.UsuarioID); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "revocar", "clave_api", strconv.Itoa(id), map[string]bool{"revocada": false}, map[string]bool{"revocada": true})
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrNoEncontrado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Clave API no encontrada"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error revocando clave API", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
+			"mensaje": "Clave API revocada",
+			"id":      id,
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Simula prefijos repetidos: las primeras llamadas a Crear fallan con ErrDuplicado
+type clavesConColision struct {
+	store.ClaveAPIStore
+	colisiones int
+	prefijos   []string
+}
+
+func (c *clavesConColision) Crear(ctx context.Context, clave models.ClaveAPI, hash, creadaPor string) (int, error) {
+	c.prefijos = append(c.prefijos, clave.Prefijo)
+	if c.colisiones > 0 {
+		c.colisiones--
+		return 0, store.ErrDuplicado
+	}
+	return c.ClaveAPIStore.Crear(ctx, clave, hash, creadaPor)
+}
+
+func TestCrearClaveAPIPrefijoRepetido(t *testing.T) {
+	if err := configurarClaves(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := generarToken("J-12345678-4", "empresa", "", security.DuracionTokensPorDefecto().Sesion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cuerpo := `{"nombre":"Kiosco","alcances":["ferrys:leer"]}`
+
+	casos := []struct {
+		nombre     string
+		colisiones int
+		estado     int
+		intentos   int
+	}{
+		{"sin colision", 0, http.StatusCreated, 1},
+		{"reintenta con otro prefijo", intentosClaveAPI - 1, http.StatusCreated, intentosClaveAPI},
+		{"se rinde tras los reintentos", intentosClaveAPI, http.StatusInternalServerError, intentosClaveAPI},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			st := storeConEmpresa(t, "J-12345678-4")
+			claves := &clavesConColision{ClaveAPIStore: st.ClavesAPI, colisiones: c.colisiones}
+			st.ClavesAPI = claves
+
+			h := middlewares.AutenticacionJWT(CrearClaveAPI(st))
+			w := servir(h.ServeHTTP, http.MethodPost, "/claves-api", "/claves-api", cuerpo, map[string]string{"Authorization": "Bearer " + token})
+			if w.Code != c.estado {
+				t.Fatalf("estado %d, se esperaba %d: %s", w.Code, c.estado, w.Body)
+			}
+			if len(claves.prefijos) != c.intentos {
+				t.Fatalf("%d intentos, se esperaban %d", len(claves.prefijos), c.intentos)
+			}
+			for i := 1; i < len(claves.prefijos); i++ {
+				if claves.prefijos[i] == claves.prefijos[i-1] {
+					t.Errorf("el reintento %d uso el mismo prefijo", i)
+				}
+			}
+			if c.estado != http.StatusCreated {
+				return
+			}
+
+			//La clave devuelta es la del ultimo prefijo, el que quedo guardado
+			var creada struct {
+				Clave string `json:"clave"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&creada); err != nil {
+				t.Fatal(err)
+			}
+			prefijo := claves.prefijos[len(claves.prefijos)-1]
+			if !strings.HasPrefix(creada.Clave, "fak_"+prefijo+"_") {
+				t.Errorf("clave %s, se esperaba el prefijo %s", creada.Clave, prefijo)
+			}
+			if _, _, err := st.ClavesAPI.ObtenerPorPrefijo(context.Background(), prefijo); err != nil {
+				t.Errorf("la clave no quedo guardada: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+// Control de concurrencia optimista: los GET devuelven la version del registro en el
+// ETag y los PUT/PATCH deben enviarla en If-Match. Si otro cambio se guardo antes se
+// responde 412 y el cliente debe volver a consultar el registro
+
+func etagVersion(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Responde el registro con su ETag, o 304 si el cliente ya tiene esa version
+func responderConETag(w http.ResponseWriter, r *http.Request, version int, cuerpo interface{}) {
+	etag := etagVersion(version)
+	w.Header().Set("ETag", etag)
+	for _, candidato := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if c := strings.TrimPrefix(strings.TrimSpace(candidato), "W/"); c == etag || c == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	helpers.ResponderJSON(w, http.StatusOK, cuerpo)
+}
+
+// versionIfMatch lee la version esperada de If-Match, que es obligatoria (428 si falta).
+// "*" acepta cualquier version y devuelve 0. Devuelve false si ya se respondio
+func versionIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	valor := strings.TrimSpace(r.Header.Get("If-Match"))
+	if valor == "" {
+		helpers.ResponderError(w, r, helpers.NuevoError(http.StatusPreconditionRequired, helpers.CodigoPrecondicionRequerida,
+			"Debe enviar la cabecera If-Match con el ETag del registro"))
+		return 0, false
+	}
+	if valor == "*" {
+		return 0, true
+	}
+
+	texto := strings.Trim(strings.TrimPrefix(valor, "W/"), `"`)
+	version, err := strconv.Atoi(texto)
+	if err != nil || version <= 0 {
+		//Un ETag que no generamos nunca coincide con la version actual
+		helpers.ResponderError(w, r, helpers.ErrorVersionObsoleta())
+		return 0, false
+	}
+	return version, true
+}
+
+// comprobarVersion responde 412 si la version pedida no es la actual
+func comprobarVersion(w http.ResponseWriter, r *http.Request, esperada, actual int) bool {
+	if esperada != 0 && esperada != actual {
+		helpers.ResponderError(w, r, helpers.ErrorVersionObsoleta())
+		return false
+	}
+	return true
+}
+
+// cuerpoActualizacion arma el registro a guardar a partir del actual: con PUT el cuerpo
+// reemplaza el registro completo y con PATCH se aplica como JSON Merge Patch (RFC 7396)
+func cuerpoActualizacion[T any](w http.ResponseWriter, r *http.Request, actual T) (T, bool) {
+	var resultado T
+	if r.Method != http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&resultado); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return resultado, false
+		}
+		return resultado, true
+	}
+
+	resultado = actual
+	if err := aplicarMergePatch(&resultado, r.Body); err != nil {
+		if errors.Is(err, errParcheInvalido) {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoJSONInvalido, "El parche debe ser un objeto JSON (JSON Merge Patch)"))
+		} else {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+		}
+		return resultado, false
+	}
+	return resultado, true
+}
+
+// aplicarMergePatch aplica el parche sobre destino (puntero a estructura). Los campos
+// en null vuelven a su valor cero
+func aplicarMergePatch(destino interface{}, parche io.Reader) error {
+	original, err := json.Marshal(destino)
+	if err != nil {
+		return err
+	}
+	var documento map[string]interface{}
+	if err := json.Unmarshal(original, &documento); err != nil {
+		return err
+	}
+
+	var cambios map[string]interface{}
+	decoder := json.NewDecoder(parche)
+	decoder.UseNumber()
+	if err := decoder.Decode(&cambios); err != nil || cambios == nil {
+		return errParcheInvalido
+	}
+
+	fusionado, err := json.Marshal(fusionar(documento, cambios))
+	if err != nil {
+		return err
+	}
+
+	reflect.ValueOf(destino).Elem().SetZero()
+	return json.NewDecoder(bytes.NewReader(fusionado)).Decode(destino)
+}
+
+var errParcheInvalido = errors.New("el parche debe ser un objeto JSON")
+
+// fusionar implementa el algoritmo MergePatch de la RFC 7396
+func fusionar(destino, parche map[string]interface{}) map[string]interface{} {
+	if destino == nil {
+		destino = map[string]interface{}{}
+	}
+	for clave, valor := range parche {
+		if valor == nil {
+			delete(destino, clave)
+			continue
+		}
+		if objeto, ok := valor.(map[string]interface{}); ok {
+			anterior, _ := destino[clave].(map[string]interface{})
+			destino[clave] = fusionar(anterior, objeto)
+			continue
+		}
+		destino[clave] = valor
+	}
+	return destino
+}
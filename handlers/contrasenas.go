@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Error de politica con todas las violaciones en los detalles
+func errorPoliticaContrasena(violaciones []security.Violacion) *helpers.ErrorAPI {
+	return helpers.NuevoError(http.StatusBadRequest, helpers.CodigoPoliticaContrasena, "La contraseña no cumple la política de seguridad").ConDetalles(violaciones)
+}
+
+// Valida la contraseña de un usuario nuevo y devuelve su hash bcrypt
+func hashearContrasenaNueva(politica security.PoliticaContrasena, usuario, contrasena string) (string, *helpers.ErrorAPI) {
+	if violaciones := politica.Validar(contrasena, usuario); len(violaciones) > 0 {
+		return "", errorPoliticaContrasena(violaciones)
+	}
+
+	hash, err := politica.Hashear(contrasena)
+	if err != nil {
+		return "", helpers.ErrorInterno("Error procesando contraseña", err)
+	}
+	return hash, nil
+}
+
+// Valida el cambio de contraseña de un usuario existente, incluido que no reutilice
+// la actual ni las ultimas guardadas en el historial, y devuelve el nuevo hash
+func hashearCambioContrasena(ctx context.Context, usuarios store.UsuarioStore, politica security.PoliticaContrasena, rifCedula, usuario, contrasena string) (string, *helpers.ErrorAPI) {
+	actual, err := usuarios.Obtener(ctx, rifCedula)
+	if err != nil {
+		return "", helpers.ErrorStore(err, "Usuario no encontrado")
+	}
+
+	//Si no se esta cambiando el nombre de usuario se valida contra el actual
+	if usuario == "" {
+		usuario = actual.Usuario
+	}
+	violaciones := politica.Validar(contrasena, usuario)
+
+	if politica.Historial > 0 && len(violaciones) == 0 {
+		anteriores := []string{actual.Contrasena}
+
+		hashes, err := usuarios.HistorialContrasenas(ctx, rifCedula, politica.Historial)
+		if err != nil {
+			return "", helpers.ErrorInterno("Error consultando historial de contraseñas", err)
+		}
+		anteriores = append(anteriores, hashes...)
+
+		for _, anterior := range anteriores {
+			if bcrypt.CompareHashAndPassword([]byte(anterior), []byte(contrasena)) == nil {
+				violaciones = append(violaciones, politica.ViolacionReutilizacion())
+				break
+			}
+		}
+	}
+
+	if len(violaciones) > 0 {
+		return "", errorPoliticaContrasena(violaciones)
+	}
+
+	hash, err := politica.Hashear(contrasena)
+	if err != nil {
+		return "", helpers.ErrorInterno("Error procesando contraseña", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashearCambioContrasenaHistorial(t *testing.T) {
+	ctx := context.Background()
+	politica := security.PoliticaContrasenaPorDefecto()
+	politica.Historial, politica.CostoBcrypt = 2, bcrypt.MinCost
+
+	st := store.NuevoMemoria()
+	hash, err := politica.Hashear("Primera-Clave1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Usuarios.Crear(ctx, models.Usuario{Rif_Cedula: "V-12345678", Usuario: "operador", Contrasena: hash, Tipo: "empleado", Estado: true}, politica.Historial); err != nil {
+		t.Fatal(err)
+	}
+	cambiar := func(contrasena string) *helpers.ErrorAPI {
+		t.Helper()
+		hash, errAPI := hashearCambioContrasena(ctx, st.Usuarios, politica, "V-12345678", "", contrasena)
+		if errAPI == nil {
+			if err := st.Usuarios.CambiarContrasena(ctx, "V-12345678", hash, politica.Historial); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return errAPI
+	}
+
+	//Historial de 2: la actual y la anterior no se pueden reutilizar, la tercera si
+	pasos := []struct {
+		contrasena string
+		violacion  string
+	}{
+		{"Primera-Clave1", security.ViolacionReutilizada},
+		{"Segunda-Clave2", ""},
+		{"Segunda-Clave2", security.ViolacionReutilizada},
+		{"Primera-Clave1", security.ViolacionReutilizada},
+		{"Tercera-Clave3", ""},
+		{"Primera-Clave1", ""},
+		{"operador-Clave4", security.ViolacionContieneUsuario},
+	}
+	for i, p := range pasos {
+		errAPI := cambiar(p.contrasena)
+		switch {
+		case p.violacion == "" && errAPI != nil:
+			t.Errorf("paso %d (%s): error inesperado %+v", i+1, p.contrasena, errAPI)
+		case p.violacion != "" && (errAPI == nil || errAPI.Estado != http.StatusBadRequest):
+			t.Errorf("paso %d (%s): se esperaba %s, se obtuvo %+v", i+1, p.contrasena, p.violacion, errAPI)
+		case p.violacion != "":
+			violaciones, _ := errAPI.Detalles.([]security.Violacion)
+			if len(violaciones) != 1 || violaciones[0].Codigo != p.violacion {
+				t.Errorf("paso %d (%s): violaciones %+v, se esperaba %s", i+1, p.contrasena, violaciones, p.violacion)
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Cantidad de codigos de recuperacion entregados al confirmar la inscripcion
+const cantidadCodigosRecuperacion = 10
+
+// Inicia la inscripcion TOTP: genera el secreto y la URI para el codigo QR
+func InscribirTOTP(st store.Store, cfg security.ConfigTOTP) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		usuario, err := st.Usuarios.Obtener(r.Context(), claims.UsuarioID)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
+			return
+		}
+
+		secreto, err := security.GenerarSecretoTOTP()
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error generando secreto", err))
+			return
+		}
+
+		//Solo se reemplaza el secreto si la inscripcion anterior no fue confirmada
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.TOTP.GuardarPendiente(r.Context(), claims.UsuarioID, secreto, time.Now().UTC()); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "inscribir_2fa", "usuario", claims.UsuarioID, nil, nil)
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrDuplicado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "La verificación en dos pasos ya está activa"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error guardando secreto", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
+			"mensaje": "Escanee el código QR y confirme con un código de verificación",
+			"secreto": secreto,
+			"uri":     security.URIProvisionamiento(cfg.Emisor, usuario.Usuario, secreto),
+		})
+	}
+}
+
+// Confirma la inscripcion con un primer codigo valido y entrega los codigos de recuperacion
+func ConfirmarTOTP(st store.Store, intentos *security.ControlIntentos) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		var req struct {
+			Codigo string `json:"codigo"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return
+		}
+
+		//Comparte el contador del segundo factor: adivinar el codigo aqui es igual de peligroso
+		clave := security.ClaveSegundoFactor(claims.UsuarioID)
+		restante, err := intentos.Bloqueado(r.Context(), clave)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error consultando bloqueos", err))
+			return
+		}
+		if restante > 0 {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusTooManyRequests, helpers.CodigoDemasiadosIntentos, "Demasiados intentos fallidos, intente más tarde"))
+			return
+		}
+
+		registro, err := st.TOTP.Obtener(r.Context(), claims.UsuarioID)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "No hay una inscripción pendiente"))
+			return
+		}
+
+		if registro.Activo {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "La verificación en dos pasos ya está activa"))
+			return
+		}
+
+		paso, ok := security.VerificarTOTP(registro.Secreto, req.Codigo, time.Now(), 0)
+		if !ok {
+			if registrarFallo(r, intentos, clave, intentos.Config().MaxIntentosUsuario).NuevoBloqueo {
+				registrarEventoSeguridad(r.Context(), st.Eventos, "bloqueo_2fa", claims.UsuarioID, helpers.IPCliente(r), "")
+			}
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCodigoInvalido, "Código de verificación inválido"))
+			return
+		}
+		reiniciarIntentos(r, intentos, clave)
+
+		codigos, err := security.GenerarCodigosRecuperacion(cantidadCodigosRecuperacion)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error generando códigos de recuperación", err))
+			return
+		}
+
+		hashes := make([]string, len(codigos))
+		for i, codigo := range codigos {
+			hashes[i] = security.HashCodigoRecuperacion(codigo)
+		}
+
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.TOTP.Activar(r.Context(), claims.UsuarioID, paso, hashes); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "activar_2fa", "usuario", claims.UsuarioID, map[string]bool{"dos_factores": false}, map[string]bool{"dos_factores": true})
+		})
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error activando verificación en dos pasos", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
+			"mensaje":              "Verificación en dos pasos activada. Inicie sesión nuevamente",
+			"codigos_recuperacion": codigos,
+		})
+	}
+}
+
+// Desactiva el 2FA del usuario autenticado, salvo que su rol lo tenga obligatorio. Los codigos
+// erroneos cuentan para el mismo bloqueo que el segundo paso del login
+func DesactivarTOTP(st store.Store, intentos *security.ControlIntentos, cfg security.ConfigTOTP) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := middlewares.UsuarioDesdeContexto(r.Context())
+		if claims == nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
+			return
+		}
+
+		if cfg.Obligatorio(claims.TipoUsuario) {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "La verificación en dos pasos es obligatoria para su rol"))
+			return
+		}
+
+		var req struct {
+			Codigo string `json:"codigo"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return
+		}
+
+		clave := security.ClaveSegundoFactor(claims.UsuarioID)
+		restante, err := intentos.Bloqueado(r.Context(), clave)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error consultando bloqueos", err))
+			return
+		}
+		if restante > 0 {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusTooManyRequests, helpers.CodigoDemasiadosIntentos, "Demasiados intentos fallidos, intente más tarde"))
+			return
+		}
+
+		registro, err := st.TOTP.Obtener(r.Context(), claims.UsuarioID)
+		if err != nil && !errors.Is(err, store.ErrNoEncontrado) {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, ""))
+			return
+		}
+		if !registro.Activo {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "La verificación en dos pasos no está activa"))
+			return
+		}
+
+		//Como en el login, el paso aceptado se guarda para que el codigo no se pueda reutilizar
+		valido := false
+		if paso, ok := security.VerificarTOTP(registro.Secreto, req.Codigo, time.Now(), registro.UltimoPaso); ok {
+			avanzo, err := st.TOTP.AvanzarPaso(r.Context(), claims.UsuarioID, paso)
+			valido = err == nil && avanzo
+		}
+		if !valido {
+			if registrarFallo(r, intentos, clave, intentos.Config().MaxIntentosUsuario).NuevoBloqueo {
+				registrarEventoSeguridad(r.Context(), st.Eventos, "bloqueo_2fa", claims.UsuarioID, helpers.IPCliente(r), "")
+			}
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCodigoInvalido, "Código de verificación inválido"))
+			return
+		}
+		reiniciarIntentos(r, intentos, clave)
+
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.TOTP.Eliminar(r.Context(), claims.UsuarioID); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "desactivar_2fa", "usuario", claims.UsuarioID, map[string]bool{"dos_factores": true}, map[string]bool{"dos_factores": false})
+		})
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error desactivando verificación en dos pasos", err))
+			return
+		}
+
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
+			"mensaje": "Verificación en dos pasos desactivada",
+		})
+	}
+}
+
+// Segundo paso del login: cambia el token de desafio y un codigo TOTP (o de recuperacion) por el JWT
+func VerificarSegundoFactor(st store.Store, intentos *security.ControlIntentos, tokens security.DuracionTokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			TokenDesafio       string `json:"token_desafio"`
+			Codigo             string `json:"codigo"`
+			CodigoRecuperacion string `json:"codigo_recuperacion"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return
+		}
+
+		if req.TokenDesafio == "" || (strings.TrimSpace(req.Codigo) == "" && strings.TrimSpace(req.CodigoRecuperacion) == "") {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "Se requiere el token de desafío y un código"))
+			return
+		}
+
+		claims, err := middlewares.ValidarToken(req.TokenDesafio)
+		if err != nil || claims.Proposito != middlewares.PropositoDesafio2FA {
+			metrics.InicioSesion(metrics.SesionCredencialesError)
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token de desafío inválido o expirado"))
+			return
+		}
+
+		clave := security.ClaveSegundoFactor(claims.UsuarioID)
+		restante, err := intentos.Bloqueado(r.Context(), clave)
+		if err != nil {
+			metrics.InicioSesion(metrics.SesionError)
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error consultando bloqueos", err))
+			return
+		}
+		if restante > 0 {
+			metrics.InicioSesion(metrics.SesionBloqueada)
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusTooManyRequests, helpers.CodigoDemasiadosIntentos, "Demasiados intentos fallidos, intente más tarde"))
+			return
+		}
+
+		registro, err := st.TOTP.Obtener(r.Context(), claims.UsuarioID)
+		if err != nil && !errors.Is(err, store.ErrNoEncontrado) {
+			metrics.InicioSesion(metrics.SesionError)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, ""))
+			return
+		}
+		if !registro.Activo {
+			metrics.InicioSesion(metrics.SesionCredencialesError)
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token de desafío inválido o expirado"))
+			return
+		}
+
+		valido := false
+		if strings.TrimSpace(req.Codigo) != "" {
+			if paso, ok := security.VerificarTOTP(registro.Secreto, req.Codigo, time.Now(), registro.UltimoPaso); ok {
+				//Guardar el paso solo si avanza, para que un codigo no se pueda reutilizar
+				avanzo, err := st.TOTP.AvanzarPaso(r.Context(), claims.UsuarioID, paso)
+				valido = err == nil && avanzo
+			}
+		} else {
+			//Los codigos de recuperacion se consumen al usarlos
+			hash := security.HashCodigoRecuperacion(req.CodigoRecuperacion)
+			consumido, err := st.TOTP.ConsumirCodigoRecuperacion(r.Context(), claims.UsuarioID, hash)
+			valido = err == nil && consumido
+		}
+
+		if !valido {
+			metrics.InicioSesion(metrics.SesionCodigo2FAError)
+			if registrarFallo(r, intentos, clave, intentos.Config().MaxIntentosUsuario).NuevoBloqueo {
+				registrarEventoSeguridad(r.Context(), st.Eventos, "bloqueo_2fa", claims.UsuarioID, helpers.IPCliente(r), "")
+			}
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCodigoInvalido, "Código de verificación inválido"))
+			return
+		}
+
+		reiniciarIntentos(r, intentos, clave)
+		metrics.InicioSesion(metrics.SesionExitosa)
+		responderSesion(w, r, claims.UsuarioID, claims.TipoUsuario, tokens.Sesion)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Valor actual del contador de inicios de sesion con el resultado dado, leido de /metrics
+func iniciosSesion(t *testing.T, resultado string) float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	serie := fmt.Sprintf(`ferryapp_inicios_sesion_total{resultado=%q} `, resultado)
+	for _, linea := range strings.Split(w.Body.String(), "\n") {
+		if valor, ok := strings.CutPrefix(linea, serie); ok {
+			v, err := strconv.ParseFloat(valor, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// El segundo paso del login cuenta en las mismas metricas que IniciarSesion
+func TestVerificarSegundoFactorMetricas(t *testing.T) {
+	if err := configurarClaves(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	st := store.NuevoMemoria()
+	if err := st.Usuarios.Crear(ctx, models.Usuario{Rif_Cedula: "V-12345678", Usuario: "operador", Contrasena: "hash", Tipo: "empleado", Estado: true}, 0); err != nil {
+		t.Fatal(err)
+	}
+	secreto, err := security.GenerarSecretoTOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.TOTP.GuardarPendiente(ctx, "V-12345678", secreto, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.TOTP.Activar(ctx, "V-12345678", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	desafio, err := generarToken("V-12345678", "empleado", middlewares.PropositoDesafio2FA, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := security.ConfigBloqueoPorDefecto()
+	cfg.MaxIntentosUsuario, cfg.RetrasoBase, cfg.RetrasoMaximo = 2, 0, 0
+	h := VerificarSegundoFactor(st, security.NuevoControlIntentos(cfg, security.NuevoAlmacenIntentosMemoria()), security.DuracionTokensPorDefecto())
+	verificar := func(token, codigo string) int {
+		cuerpo := fmt.Sprintf(`{"token_desafio":%q,"codigo":%q}`, token, codigo)
+		return servir(h, http.MethodPost, "/login/2fa", "/login/2fa", cuerpo, nil).Code
+	}
+	codigoActual := func() string {
+		c, err := security.CodigoTOTP(secreto, security.PasoTOTP(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	//Un codigo de 6 digitos que no es el del paso actual ni los vecinos
+	incorrecto := func() string {
+		for i := 0; ; i++ {
+			c := fmt.Sprintf("%06d", i)
+			if _, ok := security.VerificarTOTP(secreto, c, time.Now(), 0); !ok {
+				return c
+			}
+		}
+	}()
+
+	pasos := []struct {
+		nombre    string
+		token     string
+		codigo    func() string
+		estado    int
+		resultado string
+	}{
+		{"token de desafio invalido", "no-es-un-token", codigoActual, http.StatusUnauthorized, metrics.SesionCredencialesError},
+		{"codigo correcto", desafio, codigoActual, http.StatusOK, metrics.SesionExitosa},
+		{"codigo incorrecto", desafio, func() string { return incorrecto }, http.StatusUnauthorized, metrics.SesionCodigo2FAError},
+		{"segundo fallo bloquea", desafio, func() string { return incorrecto }, http.StatusUnauthorized, metrics.SesionCodigo2FAError},
+		{"bloqueado", desafio, codigoActual, http.StatusTooManyRequests, metrics.SesionBloqueada},
+	}
+	for _, p := range pasos {
+		antes := iniciosSesion(t, p.resultado)
+		if estado := verificar(p.token, p.codigo()); estado != p.estado {
+			t.Fatalf("%s: estado %d, se esperaba %d", p.nombre, estado, p.estado)
+		}
+		if despues := iniciosSesion(t, p.resultado); despues != antes+1 {
+			t.Errorf("%s: %s paso de %v a %v, se esperaba +1", p.nombre, p.resultado, antes, despues)
+		}
+	}
+}
@@ -2,17 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func RegistrarEmpleado(db *pgx.Conn) http.HandlerFunc {
+func RegistrarEmpleado(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Decodificando el JSON
 
@@ -23,96 +24,57 @@ func RegistrarEmpleado(db *pgx.Conn) http.HandlerFunc {
 
 		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
-			http.Error(w, "Formato JSON invalido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
 		//Validadno campos
-		var CamposVacios []string
-
-		CamposRequeridos := map[string]string{
-			"rif_empresa": request.Empleado.Rif_empresa,
-			"nombres":     request.Empleado.Nombres,
-			"cargo":       request.Empleado.Cargo,
-			"apellidos":   request.Empleado.Apellidos,
-			"email":       request.Empleado.Email,
-			"numero_tlf":  request.Empleado.Numero_tlf,
-			"usuario":     request.Usuario.Usuario,
-			"contrasena":  request.Usuario.Contrasena,
-			"cedula":      request.Empleado.Cedula,
-		}
-
-		//Campos requeridos
-		for field, value := range CamposRequeridos {
-			if strings.TrimSpace(value) == "" {
-				CamposVacios = append(CamposVacios, field)
-			}
-		}
-
-		if len(CamposVacios) > 0 {
-			MensajeError := "Algunos campos estan vacios"
-			http.Error(w, MensajeError, http.StatusBadRequest)
-			return
-		}
-
-		tx, err := db.Begin(r.Context())
-		if err != nil {
-			http.Error(w, "Error iniciando transaccion", http.StatusInternalServerError)
-			return
-		}
-		defer tx.Rollback(r.Context())
-
-		//Validando existencia de Cedula
-		var CedulaExistente string
-		err = db.QueryRow(r.Context(),
-			`SELECT cedula FROM empleados WHERE cedula=$1`, request.Empleado.Cedula).Scan(&CedulaExistente)
-
-		if err == nil {
-			if err == pgx.ErrNoRows {
-				http.Error(w, "Esta cedula ya esta registrada", http.StatusConflict)
-				return
-			} else if err != pgx.ErrNoRows {
-				http.Error(w, "Error verificando Cedula: ", http.StatusInternalServerError)
-				return
-			}
-		}
-
-		// Hash para la contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Usuario.Contrasena), bcrypt.DefaultCost)
-		if err != nil {
-			http.Error(w, "Error procesando contraseña", http.StatusInternalServerError)
+		if !validarEntrada(w, r, request) {
 			return
 		}
-		//Registrando empleado
 
-		_, err = tx.Exec(r.Context(), `INSERT INTO empleados (cedula, nombres, apellidos, rif_empresa, email, cargo, numero_tlf, estado) VALUES ($1, $2, $3, $4, $5, $6, $7,$8 )`, request.Empleado.Cedula, request.Empleado.Nombres, request.Empleado.Apellidos, request.Empleado.Rif_empresa, request.Empleado.Email, request.Empleado.Cargo, request.Empleado.Numero_tlf, true)
-
-		if err != nil {
-			http.Error(w, "Error registradno empleado:"+err.Error(), http.StatusConflict)
+		// Politica y hash para la contraseña
+		hashedPassword, herr := hashearContrasenaNueva(politica, request.Usuario.Usuario, request.Usuario.Contrasena)
+		if herr != nil {
+			helpers.ResponderError(w, r, herr)
 			return
 		}
 
-		//Creando usuario
-
-		_, err = tx.Exec(r.Context(),
-			`INSERT INTO usuarios (rif_cedula, usuario, contrasena, tipo, estado) VALUES ($1, $2, $3, $4, $5)`, request.Empleado.Cedula, request.Usuario.Usuario, string(hashedPassword), "empleado", true)
-
-		if err != nil {
-			http.Error(w, "Error registrando usuario"+err.Error(), http.StatusConflict)
-			return
+		empleado := request.Empleado
+		empleado.Estado = true
+		usuario := models.Usuario{
+			Rif_Cedula: request.Empleado.Cedula,
+			Usuario:    request.Usuario.Usuario,
+			Contrasena: hashedPassword,
+			Tipo:       "empleado",
+			Estado:     true,
 		}
 
-		err = tx.Commit(r.Context())
+		//Registrando empleado y usuario, con su auditoria en la misma transaccion
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Empleados.Crear(r.Context(), empleado, usuario, politica.Historial); err != nil {
+				return err
+			}
+			if err := auditar(r, tx.Auditoria, "crear", "empleado", empleado.Cedula, nil, empleado); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "crear", "usuario", usuario.Rif_Cedula, nil, usuario)
+		})
 		if err != nil {
-			http.Error(w, "Error guardadno cambios", http.StatusInternalServerError)
+			switch {
+			case errors.Is(err, store.ErrDuplicado):
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "La cedula o el usuario ya estan registrados"))
+			case errors.Is(err, store.ErrReferencia):
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoReferenciaInvalida, "La empresa indicada no existe"))
+			default:
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error registrando empleado", err))
+			}
 			return
 		}
 
 		//Respuesta exitosa
 
-		w.Header().Set("Content-Type", "aplication/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]string{
 			"mensaje": "Registro exitoso",
 			"Cedula":  request.Empleado.Cedula,
 			"Empresa": request.Empleado.Rif_empresa,
@@ -122,80 +84,110 @@ func RegistrarEmpleado(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
-func EditarEmpleado(db *pgx.Conn) http.HandlerFunc {
+func EditarEmpleado(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Obteniendo Cedula de la URL
 		CedulaParam := chi.URLParam(r, "cedula")
 
-		//Decodificando el body
-		var empleado models.Empleados
-		err := json.NewDecoder(r.Body).Decode(&empleado)
+		version, ok := versionIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		actual, err := st.Empleados.Obtener(r.Context(), CedulaParam)
 		if err != nil {
-			http.Error(w, "Formato JSON invalido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empleado no encontrado"))
+			return
+		}
+		if !comprobarVersion(w, r, version, actual.Version) {
 			return
 		}
 
-		//Actulizar empleado
-		_, err = db.Exec(r.Context(),
-			`UPDATE empleados SET nombres=$1 ,apellidos=$2, email=$3, cargo=$4 ,numero_tlf=$5 WHERE cedula=$6`, empleado.Nombres, empleado.Apellidos, empleado.Email, empleado.Cargo, empleado.Numero_tlf, CedulaParam)
+		//PUT reemplaza los datos, PATCH solo los enviados
+		empleado, ok := cuerpoActualizacion(w, r, actual)
+		if !ok {
+			return
+		}
+
+		//La cedula y la empresa no se modifican y el estado tiene su propia ruta
+		empleado.Cedula, empleado.Rif_empresa, empleado.Estado = actual.Cedula, actual.Rif_empresa, actual.Estado
+		if !validarEntrada(w, r, empleado, "cedula", "rif_empresa") {
+			return
+		}
 
+		//Actulizar empleado
+		var nueva int
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			var err error
+			if nueva, err = tx.Empleados.Actualizar(r.Context(), empleado, actual.Version); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "actualizar", "empleado", empleado.Cedula, actual, empleado)
+		})
 		if err != nil {
-			http.Error(w, "Error actulizando:"+err.Error(), http.StatusInternalServerError)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empleado no encontrado"))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
+		w.Header().Set("ETag", etagVersion(nueva))
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": "Empleado actulizado",
 		})
 	}
 }
 
-func EstadoEmpleado(db *pgx.Conn) http.HandlerFunc {
+// Obtener empleado
+func ObtenerEmpleado(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cedula := chi.URLParam(r, "cedula")
+
+		empleado, err := st.Empleados.Obtener(r.Context(), cedula)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empleado no encontrado"))
+			return
+		}
+
+		responderConETag(w, r, empleado.Version, empleado)
+	}
+}
+
+func EstadoEmpleado(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Obteniendo la CEDULA de la URL
 		CedulaParam := chi.URLParam(r, "cedula")
-		estadoParam := strings.Split(r.URL.Path, "/")[3]
 
 		//Estado
-		var estado bool
-		switch estadoParam {
-		case "activar":
-			estado = true
-		case "desactivar":
-			estado = false
-		default:
-			http.Error(w, "Accion no valida", http.StatusBadRequest)
+		estado, estadoParam, ok := estadoSolicitado(w, r)
+		if !ok {
 			return
-
 		}
 
-		//Verificando existencia
-		var CedulaExistente string
-		err := db.QueryRow(r.Context(),
-			`SELECT cedula FROM empleados WHERE cedula=$1`, CedulaParam).Scan(&CedulaExistente)
-
+		//Estado anterior para la auditoria
+		actual, err := st.Empleados.Obtener(r.Context(), CedulaParam)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				http.Error(w, "Empleado no encontrado", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Error interno", http.StatusInternalServerError)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empleado no encontrado"))
 			return
 		}
 
 		//Actulizar
-		_, err = db.Exec(r.Context(),
-			`UPDATE empleados SET estado= $1 WHERE cedula=$2`, estado, CedulaParam)
-
+		nuevo := actual
+		nuevo.Estado = estado
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Empleados.CambiarEstado(r.Context(), CedulaParam, estado); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, estadoParam, "empleado", CedulaParam, actual, nuevo)
+		})
 		if err != nil {
-			http.Error(w, "Error actulizando:"+err.Error(), http.StatusInternalServerError)
+			if errors.Is(err, store.ErrNoEncontrado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Empleado no encontrado"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error interno", err))
 			return
 		}
 
-		w.Header().Set("Contet-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje":       fmt.Sprintf("Empleado con la cedula %s ,%s correctamente", CedulaParam, estadoParam),
 			"Estado actual": fmt.Sprintf("%t", estado),
 		})
@@ -1,19 +1,19 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func RegistrarEmpresa(db *pgx.Conn) http.HandlerFunc {
+func RegistrarEmpresa(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Decodificando el JSON
 		var request struct {
@@ -23,71 +23,54 @@ func RegistrarEmpresa(db *pgx.Conn) http.HandlerFunc {
 
 		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
-			http.Error(w, "Formato JSON invalido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
 		//Validando campos
-
-		if request.Empresa.RIF == "" || request.Empresa.Nombre == "" || request.Empresa.Email == "" || request.Usuario.Usuario == "" || request.Usuario.Contrasena == "" {
-			http.Error(w, "Todos los campos son requeridos", http.StatusBadRequest)
-			return
-		}
-
-		tx, err := db.Begin(r.Context())
-		if err != nil {
-			http.Error(w, "Error iniciando transaccion", http.StatusInternalServerError)
+		if !validarEntrada(w, r, request) {
 			return
 		}
-		defer tx.Rollback(r.Context())
-
-		//Validando existencia
-		var rifExistente string
-		err = tx.QueryRow(r.Context(),
-			`SELECT rif FROM empresa WHERE rif=$1`, request.Empresa.RIF).Scan(&rifExistente)
 
-		if err == nil {
-			http.Error(w, `{"error": "Este RIF ya esta registrado"}`, http.StatusConflict)
+		// Politica y hash para la contraseña
+		hashedPassword, herr := hashearContrasenaNueva(politica, request.Usuario.Usuario, request.Usuario.Contrasena)
+		if herr != nil {
+			helpers.ResponderError(w, r, herr)
 			return
 		}
 
-		// Hash para la contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Usuario.Contrasena), bcrypt.DefaultCost)
-		if err != nil {
-			http.Error(w, "Error procesando contraseña", http.StatusInternalServerError)
-			return
+		empresa := request.Empresa
+		empresa.Estado = true
+		usuario := models.Usuario{
+			Rif_Cedula: request.Empresa.RIF,
+			Usuario:    request.Usuario.Usuario,
+			Contrasena: hashedPassword,
+			Tipo:       "empresa",
+			Estado:     true,
 		}
 
-		//Insertar  empresa
-		_, err = tx.Exec(r.Context(),
-			`INSERT INTO empresa (rif, nombre, email, direccion, estado) VALUES ($1, $2, $3, $4, $5)`, request.Empresa.RIF, request.Empresa.Nombre, request.Empresa.Email, request.Empresa.Direccion, true)
-
-		if err != nil {
-			//Error RIF
-			http.Error(w, "Error registrando empresa: "+err.Error(), http.StatusConflict)
-			return
-		}
-
-		//Insertar usuario
-		_, err = tx.Exec(r.Context(),
-			`INSERT INTO usuarios (rif_cedula, usuario, contrasena, tipo, estado) VALUES ($1, $2, $3, $4, $5)`, request.Empresa.RIF, request.Usuario.Usuario, string(hashedPassword), "empresa", true)
-
-		if err != nil {
-			http.Error(w, "Error registrando usuario"+err.Error(), http.StatusConflict)
-			return
-		}
-
-		err = tx.Commit(r.Context())
+		//Insertar empresa y usuario, con su auditoria en la misma transaccion
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Empresas.Crear(r.Context(), empresa, usuario, politica.Historial); err != nil {
+				return err
+			}
+			if err := auditar(r, tx.Auditoria, "crear", "empresa", empresa.RIF, nil, empresa); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "crear", "usuario", usuario.Rif_Cedula, nil, usuario)
+		})
 		if err != nil {
-			http.Error(w, "Error guardando cambios", http.StatusInternalServerError)
+			if errors.Is(err, store.ErrDuplicado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "El RIF o el usuario ya estan registrados"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error registrando empresa", err))
 			return
 		}
 
 		//Respuesta exitosa
 
-		w.Header().Set("Content-Type", "aplication/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]string{
 			"mensaje": "Registro exitoso",
 			"rif":     request.Empresa.RIF,
 			"usuario": request.Usuario.Usuario,
@@ -95,95 +78,96 @@ func RegistrarEmpresa(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
-func EditarEmpresas(db *pgx.Conn) http.HandlerFunc {
+func EditarEmpresas(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Obteniendo el RIF de la url
 		rifParam := chi.URLParam(r, "rif")
 
-		//Decodificando el body
-		var empresa models.Empresa
-		err := json.NewDecoder(r.Body).Decode(&empresa)
+		version, ok := versionIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		actual, err := st.Empresas.Obtener(r.Context(), rifParam)
 		if err != nil {
-			http.Error(w, "Formato JSON invalido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empresa no encontrada"))
+			return
+		}
+		if !comprobarVersion(w, r, version, actual.Version) {
 			return
 		}
 
-		//Verificando existencia
-		var rifExistente string
-		err = db.QueryRow(r.Context(),
-			`SELECT rif FROM empresa WHERE rif=$1`, rifParam).Scan(&rifExistente)
+		//PUT reemplaza los datos, PATCH solo los enviados
+		empresa, ok := cuerpoActualizacion(w, r, actual)
+		if !ok {
+			return
+		}
 
-		if err != nil {
-			if err == pgx.ErrNoRows {
-				http.Error(w, "Empresa no encontrada", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Error interno", http.StatusInternalServerError)
+		//El RIF no se modifica y el estado tiene su propia ruta
+		empresa.RIF, empresa.Estado = actual.RIF, actual.Estado
+		if !validarEntrada(w, r, empresa, "rif") {
 			return
 		}
 
 		//Actulizar empresa
-		_, err = db.Exec(r.Context(),
-			`UPDATE empresa SET nombre= $1, email= $2, direccion= $3 WHERE rif=$4`, empresa.Nombre, empresa.Email, empresa.Direccion, rifParam)
-
+		var nueva int
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			var err error
+			if nueva, err = tx.Empresas.Actualizar(r.Context(), empresa, actual.Version); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "actualizar", "empresa", empresa.RIF, actual, empresa)
+		})
 		if err != nil {
-			http.Error(w, "Error actulizando:"+err.Error(), http.StatusInternalServerError)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empresa no encontrada"))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
+		w.Header().Set("ETag", etagVersion(nueva))
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": "Empresa actulizada",
 		})
 
 	}
 }
 
-func EstadoEmpresa(db *pgx.Conn) http.HandlerFunc {
+func EstadoEmpresa(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Obteniendo el RIF de la url
 		rifParam := chi.URLParam(r, "rif")
-		estadoParam := chi.URLParam(r, "accion")
 
 		//Estado
-		var estado bool
-		switch estadoParam {
-		case "activar":
-			estado = true
-		case "desactivar":
-			estado = false
-		default:
-			http.Error(w, "Accion no valida", http.StatusBadRequest)
+		estado, estadoParam, ok := estadoSolicitado(w, r)
+		if !ok {
 			return
-
 		}
 
-		//Verificando existencia
-		var rifExistente string
-		err := db.QueryRow(r.Context(),
-			`SELECT rif FROM empresa WHERE rif=$1`, rifParam).Scan(&rifExistente)
-
+		//Estado anterior para la auditoria
+		actual, err := st.Empresas.Obtener(r.Context(), rifParam)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				http.Error(w, "Empresa no encontrada", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Error interno", http.StatusInternalServerError)
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empresa no encontrada"))
 			return
 		}
 
 		//Actulizar
-		_, err = db.Exec(r.Context(),
-			`UPDATE empresa SET estado= $1 WHERE rif=$2`, estado, rifParam)
-
+		nuevo := actual
+		nuevo.Estado = estado
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Empresas.CambiarEstado(r.Context(), rifParam, estado); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, estadoParam, "empresa", rifParam, actual, nuevo)
+		})
 		if err != nil {
-			http.Error(w, "Error actulizando:"+err.Error(), http.StatusInternalServerError)
+			if errors.Is(err, store.ErrNoEncontrado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Empresa no encontrada"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error interno", err))
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": fmt.Sprintf("Empresa %s correctamente", estadoParam),
 			"rif":     rifParam,
 			"estado":  fmt.Sprintf("%t", estado),
@@ -193,70 +177,57 @@ func EstadoEmpresa(db *pgx.Conn) http.HandlerFunc {
 
 //Obtener empleado por empresa
 
-func EmpleadosPorEmpresa(db *pgx.Conn) http.HandlerFunc {
+func EmpleadosPorEmpresa(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifEmpresa := chi.URLParam(r, "rif")
 
-		rows, err := db.Query(r.Context(),
-			`SELECT cedula, nombres, apellidos, rif_empresa, email, cargo, estado, numero_tlf 
-             FROM empleados WHERE rif_empresa = $1`, rifEmpresa)
-		if err != nil {
-			http.Error(w, "Error al buscar empleados: "+err.Error(), http.StatusInternalServerError)
+		p := nuevosParametros(r)
+		filtro := store.FiltroEmpleados{
+			RifEmpresa: rifEmpresa,
+			Estado:     p.booleano("estado"),
+			Texto:      p.texto("q"),
+		}
+		consulta := p.consulta(store.CamposOrdenEmpleados())
+		if !p.responderInvalidos(w) {
 			return
 		}
-		defer rows.Close()
 
-		var empleados []models.Empleados
-		for rows.Next() {
-			var emp models.Empleados
-			if err := rows.Scan(&emp.Cedula, &emp.Nombres, &emp.Apellidos, &emp.Rif_empresa, &emp.Email, &emp.Cargo, &emp.Estado, &emp.Numero_tlf); err != nil {
-				http.Error(w, "Error escaneando empleado: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-			empleados = append(empleados, emp)
-		}
+		empleados, err := st.Empleados.Listar(r.Context(), filtro, consulta)
+		responderPagina(w, r, empleados, err, "Error al buscar empleados")
+	}
+}
 
-		if err = rows.Err(); err != nil {
-			http.Error(w, "Error en las filas: "+err.Error(), http.StatusInternalServerError)
+// Listado de empresas (Solo Admin)
+func ListarEmpresas(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := nuevosParametros(r)
+		filtro := store.FiltroEmpresas{
+			Estado: p.booleano("estado"),
+			Texto:  p.texto("q"),
+		}
+		consulta := p.consulta(store.CamposOrdenEmpresas())
+		if !p.responderInvalidos(w) {
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(empleados)
+		empresas, err := st.Empresas.Listar(r.Context(), filtro, consulta)
+		responderPagina(w, r, empresas, err, "Error al buscar empresas")
 	}
 }
 
 //Funciones especficas
 
 // Obtener empresa
-func ObtenerEmpresa(db *pgx.Conn) http.HandlerFunc {
+func ObtenerEmpresa(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rif := chi.URLParam(r, "rif")
 
-		var Empresa models.Empresa
-		err := db.QueryRow(context.Background(),
-			`SELECT rif, nombre, email, direccion,estado 
-			 FROM empresa
-			 WHERE 	rif = $1`,
-			rif,
-		).Scan(&Empresa.RIF, &Empresa.Nombre, &Empresa.Email, &Empresa.Direccion, &Empresa.Estado)
-
+		empresa, err := st.Empresas.Obtener(r.Context(), rif)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				responderError(w, &HandlerError{
-					Code:    http.StatusNotFound,
-					Message: "Empresa no encontrada",
-				})
-				return
-			}
-
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error al consultar la base de datos",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Empresa no encontrada"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, Empresa)
+		responderConETag(w, r, empresa.Version, empresa)
 	}
 }
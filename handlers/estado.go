@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/go-chi/chi/v5"
+)
+
+// estadoSolicitado lee el estado pedido para un registro. En la v1 llega como accion en la
+// ruta (activar/desactivar) y en la v2 en el cuerpo, {"activo": true}. Devuelve tambien la
+// accion equivalente, que es la que se registra en la auditoria, y false si ya se respondio
+func estadoSolicitado(w http.ResponseWriter, r *http.Request) (bool, string, bool) {
+	accion := chi.URLParam(r, "accion")
+	if accion == "" {
+		var req struct {
+			Activo *bool `json:"activo"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+			return false, "", false
+		}
+		if req.Activo == nil {
+			helpers.ResponderError(w, r, helpers.ErrorValidacion("Los datos enviados no son válidos", []helpers.DetalleCampo{
+				{Campo: "activo", Mensaje: "Campo requerido"},
+			}))
+			return false, "", false
+		}
+		accion = "desactivar"
+		if *req.Activo {
+			accion = "activar"
+		}
+	}
+
+	switch accion {
+	case "activar":
+		return true, accion, true
+	case "desactivar":
+		return false, accion, true
+	default:
+		helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "Acción no válida. Use activar o desactivar"))
+		return false, "", false
+	}
+}
@@ -1,33 +1,42 @@
 package handlers
 
 import (
-	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
 )
 
-func CrearFactura(db *pgx.Conn) http.HandlerFunc {
+func CrearFactura(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Decodificar el JSON de entrada
 		var factura models.Factura
 		err := json.NewDecoder(r.Body).Decode(&factura)
 		if err != nil {
-			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
-		// Validar campos obligatorios
-		if factura.NombresViajero == "" || factura.ApellidosViajero == "" ||
-			factura.RIFEmpresa == "" || factura.CedulaEmpleado == "" ||
-			factura.NombreEmpleado == "" || factura.IDViaje == "" ||
-			factura.Tipo == "" || factura.MatriculaFerry == "" {
-			http.Error(w, "Todos los campos obligatorios son requeridos", http.StatusBadRequest)
+		// Validar campos obligatorios y formatos
+		if !validarEntrada(w, r, factura) {
+			return
+		}
+
+		// Las claves API solo pueden facturar a nombre de su propia empresa
+		if claims := middlewares.UsuarioDesdeContexto(r.Context()); claims != nil && claims.EsClaveAPI() && factura.RIFEmpresa != claims.RifCedula {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "La clave API no pertenece a esta empresa"))
 			return
 		}
 
@@ -37,215 +46,239 @@ func CrearFactura(db *pgx.Conn) http.HandlerFunc {
 			factura.Emision = time.Now().UTC() // Fecha actual si no se proporciona
 		}
 
-		tx, err := db.Begin(r.Context())
-		if err != nil {
-			http.Error(w, "Error iniciando transacción", http.StatusInternalServerError)
-			return
-		}
-		defer tx.Rollback(r.Context())
-
-		// Insertar nueva factura
-		var idFactura int
-		err = tx.QueryRow(r.Context(),
-			`INSERT INTO facturas (
-				nombres_viajero, 
-				apellidos_viajero, 
-				rif_empresa, 
-				cedula_empleado, 
-				nombre_empleado, 
-				id_viaje, 
-				tipo, 
-				estado, 
-				nota, 
-				emision, 
-				matricula_ferry
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-			RETURNING id_factura`,
-			factura.NombresViajero,
-			factura.ApellidosViajero,
-			factura.RIFEmpresa,
-			factura.CedulaEmpleado,
-			factura.NombreEmpleado,
-			factura.IDViaje,
-			factura.Tipo,
-			factura.Estado,
-			factura.Nota,
-			factura.Emision,
-			factura.MatriculaFerry,
-		).Scan(&idFactura)
-
+		// Insertar nueva factura y su auditoria en la misma transaccion
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			var err error
+			if factura.IDFactura, err = tx.Facturas.Crear(r.Context(), factura); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "crear", "factura", strconv.Itoa(factura.IDFactura), nil, factura)
+		})
 		if err != nil {
-			http.Error(w, "Error creando factura: "+err.Error(), http.StatusInternalServerError)
+			if errors.Is(err, store.ErrReferencia) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoReferenciaInvalida, "La empresa o el ferry indicados no existen"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error creando factura", err))
 			return
 		}
 
-		err = tx.Commit(r.Context())
-		if err != nil {
-			http.Error(w, "Error guardando cambios", http.StatusInternalServerError)
-			return
-		}
+		metrics.FacturaEmitida(factura)
 
 		// Respuesta exitosa
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]interface{}{
 			"mensaje":    "Factura creada exitosamente",
-			"id_factura": idFactura,
+			"id_factura": factura.IDFactura,
 		})
 	}
 }
 
-func ObtenerFactura(db *pgx.Conn) http.HandlerFunc {
+func ObtenerFactura(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idFactura := chi.URLParam(r, "id")
-
-		var factura models.Factura
-		err := db.QueryRow(context.Background(),
-			`SELECT 
-				id_factura,
-				nombres_viajero,
-				apellidos_viajero,
-				rif_empresa,
-				cedula_empleado,
-				nombre_empleado,
-				id_viaje,
-				tipo,
-				estado,
-				nota,
-				emision,
-				matricula_ferry
-			FROM facturas
-			WHERE id_factura = $1`,
-			idFactura,
-		).Scan(
-			&factura.IDFactura,
-			&factura.NombresViajero,
-			&factura.ApellidosViajero,
-			&factura.RIFEmpresa,
-			&factura.CedulaEmpleado,
-			&factura.NombreEmpleado,
-			&factura.IDViaje,
-			&factura.Tipo,
-			&factura.Estado,
-			&factura.Nota,
-			&factura.Emision,
-			&factura.MatriculaFerry,
-		)
+		idFactura, ok := idFacturaURL(w, r)
+		if !ok {
+			return
+		}
 
+		factura, err := st.Facturas.Obtener(r.Context(), idFactura)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				http.Error(w, "Factura no encontrada", http.StatusNotFound)
+			if errors.Is(err, store.ErrNoEncontrado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Factura no encontrada"))
 				return
 			}
-			http.Error(w, "Error al consultar la base de datos", http.StatusInternalServerError)
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error al consultar la base de datos", err))
+			return
+		}
+
+		if claims := middlewares.UsuarioDesdeContexto(r.Context()); claims != nil && claims.EsClaveAPI() && factura.RIFEmpresa != claims.RifCedula {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Factura no encontrada"))
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(factura)
+		helpers.ResponderJSON(w, http.StatusOK, factura)
 	}
 }
 
-func ObtenerFacturasPorEmpresa(db *pgx.Conn) http.HandlerFunc {
+// Listado de facturas. Los administradores ven todas (filtrables con ?rif_empresa=);
+// empresas, empleados y claves API solo las de su empresa
+func ListarFacturas(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rifEmpresa := r.Context().Value("rif_empresa").(string)
-
-		rows, err := db.Query(r.Context(),
-			`SELECT
-                id_factura,
-                nombres_viajero,
-                apellidos_viajero,
-                rif_empresa,
-                cedula_empleado,
-                nombre_empleado,
-                id_viaje,
-                tipo,
-                estado,
-                nota,
-                emision,
-                matricula_ferry
-            FROM facturas
-            WHERE rif_empresa = $1`,
-			rifEmpresa,
-		)
+		p := nuevosParametros(r)
+		filtro := filtroFacturas(p)
+		consulta := p.consulta(store.CamposOrdenFacturas())
+		if !p.responderInvalidos(w) || !limitarAEmpresa(w, r, st, &filtro) {
+			return
+		}
+
+		facturas, err := st.Facturas.Listar(r.Context(), filtro, consulta)
+		responderPagina(w, r, facturas, err, "Error al consultar las facturas")
+	}
+}
+
+// Exporta en CSV todas las facturas que cumplen los filtros del listado (sin paginar)
+func ExportarFacturas(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := nuevosParametros(r)
+		filtro := filtroFacturas(p)
+		consulta := p.consulta(store.CamposOrdenFacturas())
+		if !p.responderInvalidos(w) || !limitarAEmpresa(w, r, st, &filtro) {
+			return
+		}
+		consulta.Limite, consulta.Desplazamiento, consulta.Cursor = store.LimiteMaximo, 0, ""
+
+		//La primera pagina se pide antes de escribir para poder responder errores en JSON
+		pagina, err := st.Facturas.Listar(r.Context(), filtro, consulta)
 		if err != nil {
-			http.Error(w, "Error al consultar las facturas: "+err.Error(), http.StatusInternalServerError)
+			responderPagina(w, r, pagina, err, "Error al consultar las facturas")
 			return
 		}
-		defer rows.Close()
-
-		var facturas []models.Factura
-		for rows.Next() {
-			var factura models.Factura
-			err := rows.Scan(
-				&factura.IDFactura,
-				&factura.NombresViajero,
-				&factura.ApellidosViajero,
-				&factura.RIFEmpresa,
-				&factura.CedulaEmpleado,
-				&factura.NombreEmpleado,
-				&factura.IDViaje,
-				&factura.Tipo,
-				&factura.Estado,
-				&factura.Nota,
-				&factura.Emision,
-				&factura.MatriculaFerry,
-			)
-			if err != nil {
-				http.Error(w, "Error al escanear factura: "+err.Error(), http.StatusInternalServerError)
-				return
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="facturas.csv"`)
+		w.WriteHeader(http.StatusOK)
+
+		salida := csv.NewWriter(w)
+		salida.Write([]string{
+			"id_factura", "emision", "rif_empresa", "id_viaje", "matricula_ferry", "tipo", "estado",
+			"nombres_viajero", "apellidos_viajero", "cedula_empleado", "nombre_empleado", "nota",
+		})
+		for {
+			for _, f := range pagina.Elementos {
+				salida.Write(celdasCSV(
+					strconv.Itoa(f.IDFactura), f.Emision.UTC().Format(time.RFC3339), f.RIFEmpresa, f.IDViaje,
+					f.MatriculaFerry, f.Tipo, strconv.FormatBool(f.Estado), f.NombresViajero, f.ApellidosViajero,
+					f.CedulaEmpleado, f.NombreEmpleado, f.Nota,
+				))
+			}
+			if pagina.SiguienteCursor == "" {
+				break
+			}
+			consulta.Cursor = pagina.SiguienteCursor
+			if pagina, err = st.Facturas.Listar(r.Context(), filtro, consulta); err != nil {
+				//Ya se enviaron las cabeceras: solo queda cortar el archivo y dejarlo en el log
+				helpers.Logger(r.Context()).Error("Error exportando facturas", slog.Any("error", err))
+				break
 			}
-			facturas = append(facturas, factura)
 		}
+		salida.Flush()
+	}
+}
+
+// Filtros del listado y la exportacion de facturas:
+// ?desde=&hasta=&viaje=&ferry=&empleado=&tipo=&estado=&q=(nombre del viajero)&rif_empresa=
+func filtroFacturas(p *parametrosListado) store.FiltroFacturas {
+	return store.FiltroFacturas{
+		RifEmpresa:     p.texto("rif_empresa"),
+		Estado:         p.booleano("estado"),
+		Desde:          p.fecha("desde", false),
+		Hasta:          p.fecha("hasta", true),
+		IDViaje:        p.texto("viaje"),
+		MatriculaFerry: p.texto("ferry"),
+		CedulaEmpleado: p.texto("empleado"),
+		Tipo:           p.texto("tipo"),
+		Texto:          p.texto("q"),
+	}
+}
+
+// Restringe el filtro a la empresa del solicitante; false si ya se respondio un error
+func limitarAEmpresa(w http.ResponseWriter, r *http.Request, st store.Store, filtro *store.FiltroFacturas) bool {
+	rifEmpresa, herr := empresaDelSolicitante(r, st)
+	if herr != nil {
+		helpers.ResponderError(w, r, herr)
+		return false
+	}
+	if rifEmpresa != "" {
+		filtro.RifEmpresa = rifEmpresa
+	}
+	return true
+}
+
+// Evita que las hojas de calculo interpreten como formula los textos que escriben los usuarios
+func celdasCSV(valores ...string) []string {
+	for i, v := range valores {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			valores[i] = "'" + v
+		}
+	}
+	return valores
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(facturas)
+// Empresa a la que queda limitado el solicitante; "" para administradores (sin limite)
+func empresaDelSolicitante(r *http.Request, st store.Store) (string, *helpers.ErrorAPI) {
+	claims := middlewares.UsuarioDesdeContexto(r.Context())
+	switch {
+	case claims == nil:
+		return "", helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario")
+	case claims.EsClaveAPI():
+		return claims.RifCedula, nil
+	case claims.TipoUsuario == "Administrador":
+		return "", nil
+	case claims.TipoUsuario == "empresa":
+		return claims.UsuarioID, nil
+	case claims.TipoUsuario == "empleado":
+		empleado, err := st.Empleados.Obtener(r.Context(), claims.UsuarioID)
+		if err != nil {
+			if errors.Is(err, store.ErrNoEncontrado) {
+				return "", helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "El empleado no pertenece a ninguna empresa")
+			}
+			return "", helpers.ErrorInterno("Error al consultar el empleado", err)
+		}
+		return empleado.Rif_empresa, nil
+	default:
+		return "", helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "No tiene acceso a las facturas")
 	}
 }
 
-func CambiarEstadoFactura(db *pgx.Conn) http.HandlerFunc {
+func CambiarEstadoFactura(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idFactura := chi.URLParam(r, "id")
-		accion := chi.URLParam(r, "accion")
-
-		var estado bool
-		switch accion {
-		case "activar":
-			estado = true
-		case "desactivar":
-			estado = false
-		default:
-			http.Error(w, "Acción no válida. Use 'activar' o 'desactivar'", http.StatusBadRequest)
+		idFactura, ok := idFacturaURL(w, r)
+		if !ok {
 			return
 		}
 
-		// Verificar existencia
-		var existe bool
-		err := db.QueryRow(r.Context(),
-			`SELECT EXISTS(SELECT 1 FROM facturas WHERE id_factura = $1)`,
-			idFactura).Scan(&existe)
+		estado, accion, ok := estadoSolicitado(w, r)
+		if !ok {
+			return
+		}
 
-		if err != nil || !existe {
-			http.Error(w, "Factura no encontrada", http.StatusNotFound)
+		// Estado anterior para la auditoria
+		actual, err := st.Facturas.Obtener(r.Context(), idFactura)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Factura no encontrada"))
 			return
 		}
 
 		// Actualizar estado
-		_, err = db.Exec(r.Context(),
-			`UPDATE facturas SET estado = $1 WHERE id_factura = $2`,
-			estado, idFactura)
-
+		nueva := actual
+		nueva.Estado = estado
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Facturas.CambiarEstado(r.Context(), idFactura, estado); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, accion, "factura", strconv.Itoa(idFactura), actual, nueva)
+		})
 		if err != nil {
-			http.Error(w, "Error actualizando estado: "+err.Error(), http.StatusInternalServerError)
+			if errors.Is(err, store.ErrNoEncontrado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Factura no encontrada"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error actualizando estado", err))
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
 			"mensaje":    fmt.Sprintf("Factura %sd correctamente", accion),
 			"id_factura": idFactura,
 			"estado":     estado,
 		})
 	}
 }
+
+// Lee el id numerico de la factura de la URL; responde 400 si no es valido
+func idFacturaURL(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "Id de factura invalido"))
+		return 0, false
+	}
+	return id, true
+}
@@ -1,135 +1,52 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // Registrar
-func RegistrarFerry(db *pgx.Conn) http.HandlerFunc {
+func RegistrarFerry(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ferry models.Ferry
 		err := json.NewDecoder(r.Body).Decode(&ferry)
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON inválido",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
-		// Validación de campos obligatorios
-		if ferry.Matricula == "" || ferry.RifEmpresa == "" || ferry.Nombre == "" || ferry.Modelo == "" {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Matrícula, RIF empresa, nombre y modelo son requeridos",
-			})
+		// Validación de campos obligatorios y capacidades
+		if !validarEntrada(w, r, ferry) {
 			return
 		}
 
-		// Validar capacidades
-		if ferry.CapacidadEconomica <= 0 || ferry.CapacidadVIP <= 0 {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Las capacidades deben ser mayores a cero",
-			})
-			return
-		}
-
-		tx, err := db.Begin(r.Context())
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error iniciando transacción",
-			})
-			return
-		}
-		defer tx.Rollback(r.Context())
-
-		// Verificar existencia previa
-		var existe bool
-		err = tx.QueryRow(r.Context(),
-			`SELECT EXISTS(SELECT 1 FROM ferrys WHERE matricula = $1)`,
-			ferry.Matricula,
-		).Scan(&existe)
-
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error verificando ferry: " + err.Error(),
-			})
-			return
-		}
-
-		if existe {
-			responderError(w, &HandlerError{
-				Code:    http.StatusConflict,
-				Message: "La matrícula ya está registrada",
-			})
-			return
-		}
-
-		// Insertar ferry
-		_, err = tx.Exec(r.Context(),
-			`INSERT INTO ferrys (
-				matricula, 
-				rif_empresa, 
-				nombre, 
-				modelo, 
-				capacidad_economica, 
-				capacidad_vip, 
-				estado
-			) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-			ferry.Matricula,
-			ferry.RifEmpresa,
-			ferry.Nombre,
-			ferry.Modelo,
-			ferry.CapacidadEconomica,
-			ferry.CapacidadVIP,
-			ferry.Estado,
-		)
-
+		// Insertar ferry y su auditoria en la misma transaccion
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Ferrys.Crear(r.Context(), ferry); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "crear", "ferry", ferry.Matricula, nil, ferry)
+		})
 		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				switch pgErr.Code {
-				case "23503":
-					responderError(w, &HandlerError{
-						Code:    http.StatusBadRequest,
-						Message: "El RIF de empresa no existe",
-					})
-					return
-				case "23505":
-					responderError(w, &HandlerError{
-						Code:    http.StatusConflict,
-						Message: "Matrícula duplicada",
-					})
-					return
-				}
+			switch {
+			case errors.Is(err, store.ErrReferencia):
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoReferenciaInvalida, "El RIF de empresa no existe"))
+			case errors.Is(err, store.ErrDuplicado):
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "La matrícula ya está registrada"))
+			default:
+				helpers.ResponderError(w, r, helpers.ErrorStore(err, ""))
 			}
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error registrando ferry: " + err.Error(),
-			})
 			return
 		}
 
-		if err := tx.Commit(r.Context()); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error guardando cambios: " + err.Error(),
-			})
-			return
-		}
-
-		responderJSON(w, http.StatusCreated, map[string]string{
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]string{
 			"mensaje":   "Ferry registrado exitosamente",
 			"matricula": ferry.Matricula,
 		})
@@ -137,177 +54,94 @@ func RegistrarFerry(db *pgx.Conn) http.HandlerFunc {
 }
 
 // EditarFerry actualiza los datos de un ferry existente
-func EditarFerry(db *pgx.Conn) http.HandlerFunc {
+func EditarFerry(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		matricula := chi.URLParam(r, "matricula")
 
-		var ferry models.Ferry
-		err := json.NewDecoder(r.Body).Decode(&ferry)
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON inválido",
-			})
+		version, ok := versionIfMatch(w, r)
+		if !ok {
 			return
 		}
 
-		// Validar capacidades si están presentes
-		if ferry.CapacidadEconomica < 0 || ferry.CapacidadVIP < 0 {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Las capacidades no pueden ser negativas",
-			})
-			return
-		}
-
-		tx, err := db.Begin(r.Context())
+		actual, err := st.Ferrys.Obtener(r.Context(), matricula)
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error iniciando transacción",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Ferry no encontrado"))
 			return
 		}
-		defer tx.Rollback(r.Context())
-
-		// Verificar existencia
-		var existe bool
-		err = tx.QueryRow(r.Context(),
-			`SELECT EXISTS(SELECT 1 FROM ferrys WHERE matricula = $1)`,
-			matricula,
-		).Scan(&existe)
-
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error verificando ferry: " + err.Error(),
-			})
+		if !comprobarVersion(w, r, version, actual.Version) {
 			return
 		}
 
-		if !existe {
-			responderError(w, &HandlerError{
-				Code:    http.StatusNotFound,
-				Message: "Ferry no encontrado",
-			})
+		// PUT reemplaza el ferry completo, PATCH solo los campos enviados
+		ferry, ok := cuerpoActualizacion(w, r, actual)
+		if !ok {
 			return
 		}
 
-		// Actualizar campos permitidos (excluyendo matrícula y rif_empresa)
-		_, err = tx.Exec(r.Context(),
-			`UPDATE ferrys SET 
-				nombre = $1,
-				modelo = $2,
-				capacidad_economica = $3,
-				capacidad_vip = $4,
-				estado = $5
-			WHERE matricula = $6`,
-			ferry.Nombre,
-			ferry.Modelo,
-			ferry.CapacidadEconomica,
-			ferry.CapacidadVIP,
-			ferry.Estado,
-			matricula,
-		)
-
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error actualizando ferry: " + err.Error(),
-			})
+		// La matrícula y el rif_empresa no se pueden modificar
+		ferry.Matricula, ferry.RifEmpresa = actual.Matricula, actual.RifEmpresa
+		if !validarEntrada(w, r, ferry, "matricula", "rif_empresa") {
 			return
 		}
 
-		if err := tx.Commit(r.Context()); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error guardando cambios: " + err.Error(),
-			})
+		var nueva int
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			var err error
+			if nueva, err = tx.Ferrys.Actualizar(r.Context(), ferry, actual.Version); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "actualizar", "ferry", ferry.Matricula, actual, ferry)
+		})
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Ferry no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, map[string]string{
+		w.Header().Set("ETag", etagVersion(nueva))
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje":   "Ferry actualizado exitosamente",
 			"matricula": matricula,
 		})
 	}
 }
 
-// ObtenerFerry recupera un ferry por su matrícula
-func ObtenerFerry(db *pgx.Conn) http.HandlerFunc {
+// ObtenerFerry recupera un ferry por su matrícula. Las claves API solo ven los de su empresa
+func ObtenerFerry(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		matricula := chi.URLParam(r, "matricula")
 
-		var ferry models.Ferry
-		err := db.QueryRow(context.Background(),
-			`SELECT 
-				matricula, 
-				rif_empresa, 
-				nombre, 
-				modelo, 
-				capacidad_economica, 
-				capacidad_vip, 
-				estado 
-			FROM ferrys WHERE matricula = $1`,
-			matricula,
-		).Scan(
-			&ferry.Matricula,
-			&ferry.RifEmpresa,
-			&ferry.Nombre,
-			&ferry.Modelo,
-			&ferry.CapacidadEconomica,
-			&ferry.CapacidadVIP,
-			&ferry.Estado,
-		)
-
+		ferry, err := st.Ferrys.Obtener(r.Context(), matricula)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				responderError(w, &HandlerError{
-					Code:    http.StatusNotFound,
-					Message: "Ferry no encontrado",
-				})
-				return
-			}
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error en base de datos: " + err.Error(),
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Ferry no encontrado"))
+			return
+		}
+
+		if claims := middlewares.UsuarioDesdeContexto(r.Context()); claims != nil && claims.EsClaveAPI() && ferry.RifEmpresa != claims.RifCedula {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusNotFound, helpers.CodigoNoEncontrado, "Ferry no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, ferry)
+		responderConETag(w, r, ferry.Version, ferry)
 	}
 }
 
-func ObtenerFerrysPorEmpresa(db *pgx.Conn) http.HandlerFunc {
+func ObtenerFerrysPorEmpresa(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifEmpresa := chi.URLParam(r, "rif")
 
-		rows, err := db.Query(r.Context(),
-			`SELECT matricula, rif_empresa, nombre, modelo, capacidad_economica, capacidad_vip, estado
-             FROM ferrys WHERE rif_empresa = $1`, rifEmpresa)
-		if err != nil {
-			responderError(w, &HandlerError{http.StatusInternalServerError, "Error al buscar ferris"})
-			return
+		p := nuevosParametros(r)
+		filtro := store.FiltroFerrys{
+			RifEmpresa: rifEmpresa,
+			Estado:     p.booleano("estado"),
+			Texto:      p.texto("q"),
 		}
-		defer rows.Close()
-
-		var ferrys []models.Ferry
-		for rows.Next() {
-			var f models.Ferry
-			if err := rows.Scan(&f.Matricula, &f.RifEmpresa, &f.Nombre, &f.Modelo, &f.CapacidadEconomica, &f.CapacidadVIP, &f.Estado); err != nil {
-				responderError(w, &HandlerError{http.StatusInternalServerError, "Error escaneando ferry"})
-				return
-			}
-			ferrys = append(ferrys, f)
-		}
-
-		if err = rows.Err(); err != nil {
-			responderError(w, &HandlerError{http.StatusInternalServerError, "Error en las filas de ferris"})
+		consulta := p.consulta(store.CamposOrdenFerrys())
+		if !p.responderInvalidos(w) {
 			return
 		}
 
-		responderJSON(w, http.StatusOK, ferrys)
+		ferrys, err := st.Ferrys.Listar(r.Context(), filtro, consulta)
+		responderPagina(w, r, ferrys, err, "Error al buscar ferris")
 	}
 }
 
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// servir monta el handler en un router con el patron dado para que chi resuelva los
+// parametros de la URL y devuelve la respuesta grabada
+func servir(h http.HandlerFunc, metodo, patron, ruta, cuerpo string, cabeceras map[string]string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Method(metodo, patron, h)
+
+	solicitud := httptest.NewRequest(metodo, ruta, strings.NewReader(cuerpo))
+	for nombre, valor := range cabeceras {
+		solicitud.Header.Set(nombre, valor)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, solicitud)
+	return w
+}
+
+// Codigo del sobre de error de la respuesta
+func codigoError(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var cuerpo struct {
+		Error struct {
+			Codigo string `json:"codigo"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&cuerpo); err != nil {
+		t.Fatal(err)
+	}
+	return cuerpo.Error.Codigo
+}
+
+// Store en memoria con una empresa registrada
+func storeConEmpresa(t *testing.T, rif string) store.Store {
+	t.Helper()
+	st := store.NuevoMemoria()
+	empresa := models.Empresa{RIF: rif, Nombre: "Naviera", Email: "naviera@ejemplo.com", Estado: true}
+	usuario := models.Usuario{Rif_Cedula: rif, Usuario: "naviera", Contrasena: "hash", Tipo: "empresa", Estado: true}
+	if err := st.Empresas.Crear(context.Background(), empresa, usuario, 0); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestRegistrarFerry(t *testing.T) {
+	const ferry = `{"matricula":"FB-01","rif_empresa":"%s","nombre":"Lilia","modelo":"Catamaran","capacidad_economica":300,"capacidad_vip":20,"estado":true}`
+
+	casos := []struct {
+		nombre string
+		cuerpo string
+		estado int
+		codigo string
+	}{
+		{"valido", strings.Replace(ferry, "%s", "J-12345678-4", 1), http.StatusCreated, ""},
+		{"empresa inexistente", strings.Replace(ferry, "%s", "J-87654321-3", 1), http.StatusBadRequest, helpers.CodigoReferenciaInvalida},
+		{"campos invalidos", `{"matricula":"FB-01","rif_empresa":"J-12345678-4"}`, http.StatusBadRequest, helpers.CodigoValidacion},
+		{"json invalido", `{"matricula":`, http.StatusBadRequest, helpers.CodigoJSONInvalido},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			st := storeConEmpresa(t, "J-12345678-4")
+			w := servir(RegistrarFerry(st), http.MethodPost, "/ferrys", "/ferrys", c.cuerpo, nil)
+			if w.Code != c.estado {
+				t.Fatalf("estado %d, se esperaba %d: %s", w.Code, c.estado, w.Body)
+			}
+			if c.codigo != "" {
+				if codigo := codigoError(t, w); codigo != c.codigo {
+					t.Errorf("codigo %q, se esperaba %q", codigo, c.codigo)
+				}
+				return
+			}
+			if _, err := st.Ferrys.Obtener(context.Background(), "FB-01"); err != nil {
+				t.Errorf("el ferry no quedo guardado: %v", err)
+			}
+			if pagina, err := st.Auditoria.Listar(context.Background(), store.FiltroAuditoria{}, store.Consulta{Limite: 10}); err != nil || pagina.Total != 1 {
+				t.Errorf("auditoria %+v (%v), se esperaba una entrada", pagina, err)
+			}
+		})
+	}
+}
+
+func TestEditarFerryVersion(t *testing.T) {
+	ctx := context.Background()
+	st := storeConEmpresa(t, "J-12345678-4")
+	err := st.Ferrys.Crear(ctx, models.Ferry{Matricula: "FB-01", RifEmpresa: "J-12345678-4", Nombre: "Lilia", Modelo: "Catamaran",
+		CapacidadEconomica: 300, CapacidadVIP: 20, Estado: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obtener := servir(ObtenerFerry(st), http.MethodGet, "/ferrys/{matricula}", "/ferrys/FB-01", "", nil)
+	etag := obtener.Header().Get("ETag")
+	if obtener.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("GET: estado %d, ETag %q", obtener.Code, etag)
+	}
+	if w := servir(ObtenerFerry(st), http.MethodGet, "/ferrys/{matricula}", "/ferrys/FB-01", "", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("GET con If-None-Match: estado %d, se esperaba 304", w.Code)
+	}
+
+	patch := func(cabeceras map[string]string) *httptest.ResponseRecorder {
+		return servir(EditarFerry(st), http.MethodPatch, "/ferrys/{matricula}", "/ferrys/FB-01", `{"nombre":"Lilia II"}`, cabeceras)
+	}
+	if w := patch(nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH sin If-Match: estado %d, se esperaba 428", w.Code)
+	}
+	w := patch(map[string]string{"If-Match": etag})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PATCH: estado %d, ETag %q: %s", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+	if w := patch(map[string]string{"If-Match": etag}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH con version obsoleta: estado %d, se esperaba 412", w.Code)
+	}
+
+	ferry, err := st.Ferrys.Obtener(ctx, "FB-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ferry.Nombre != "Lilia II" || ferry.Modelo != "Catamaran" {
+		t.Errorf("el PATCH no conservo los demas campos: %+v", ferry)
+	}
+
+	if w := servir(ObtenerFerry(st), http.MethodGet, "/ferrys/{matricula}", "/ferrys/XX-99", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET inexistente: estado %d, se esperaba 404", w.Code)
+	}
+}
@@ -1,114 +1,286 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func IniciarSesion(db *pgx.Conn) http.HandlerFunc {
+func IniciarSesion(st store.Store, intentos *security.ControlIntentos, totp security.ConfigTOTP, tokens security.DuracionTokens, politica security.PoliticaContrasena) http.HandlerFunc {
+	//Hash usado para comparar cuando el usuario no existe, asi el tiempo de respuesta
+	//no revela si el nombre de usuario esta registrado. Usa el mismo costo que los reales
+	hashFicticio := sync.OnceValue(func() []byte {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("contrasena-ficticia"), politica.CostoBcrypt)
+		return hash
+	})
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request struct {
-			Usuario models.Usuario `json:"usuario"`
-		}
-
-		//Enviar errores como JSON
-		sendError := func(status int, message string) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(status)
-			json.NewEncoder(w).Encode(map[string]string{"error": message})
+			Usuario struct {
+				Usuario    string `json:"usuario" validar:"requerido"`
+				Contrasena string `json:"contrasena" validar:"requerido"`
+			} `json:"usuario"`
 		}
 
 		//Decodificador JSON
 
 		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
-			http.Error(w, "Formato JSON invalido", http.StatusBadRequest)
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
 		//Validar campos vacios
-		var CamposVacios []string
-
-		CamposRequeridos := map[string]string{
-			"usuario":    request.Usuario.Usuario,
-			"contrasena": request.Usuario.Contrasena,
+		if !validarEntrada(w, r, request) {
+			return
 		}
 
-		for field, value := range CamposRequeridos {
-			if strings.TrimSpace(value) == "" {
-				CamposVacios = append(CamposVacios, field)
-			}
-		}
+		//Verificar bloqueo por usuario o IP
+		ip := helpers.IPCliente(r)
+		claveUsuario := security.ClaveUsuario(request.Usuario.Usuario)
+		claveIP := security.ClaveIP(ip)
 
-		if len(CamposVacios) > 0 {
-			sendError(http.StatusBadRequest, "Campos vacíos: "+strings.Join(CamposVacios, ", "))
+		restante, err := intentos.Bloqueado(r.Context(), claveUsuario, claveIP)
+		if err != nil {
+			metrics.InicioSesion(metrics.SesionError)
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error consultando bloqueos", err))
 			return
 		}
-		var (
-			usuarioID      string
-			contrasenaHash string
-			tipoUsuario    string
-			estado         bool
-		)
+		if restante > 0 {
+			metrics.InicioSesion(metrics.SesionBloqueada)
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(restante.Seconds()))))
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusTooManyRequests, helpers.CodigoDemasiadosIntentos, "Demasiados intentos fallidos, intente más tarde"))
+			return
+		}
+
+		//Registrar fallo, aplicar retraso progresivo y responder siempre lo mismo
+		credencialesInvalidas := func() {
+			metrics.InicioSesion(metrics.SesionCredencialesError)
+			cfg := intentos.Config()
+			resUsuario := registrarFallo(r, intentos, claveUsuario, cfg.MaxIntentosUsuario)
+			resIP := registrarFallo(r, intentos, claveIP, cfg.MaxIntentosIP)
+
+			if resUsuario.NuevoBloqueo {
+				registrarEventoSeguridad(r.Context(), st.Eventos, "bloqueo_usuario", request.Usuario.Usuario, ip, "")
+			}
+			if resIP.NuevoBloqueo {
+				registrarEventoSeguridad(r.Context(), st.Eventos, "bloqueo_ip", request.Usuario.Usuario, ip, "")
+			}
 
-		err = db.QueryRow(r.Context(), `SELECT rif_cedula, contrasena, tipo,estado FROM usuarios WHERE usuario = $1`, request.Usuario.Usuario).Scan(&usuarioID, &contrasenaHash, &tipoUsuario, &estado)
+			esperar(r.Context(), max(resUsuario.Retraso, resIP.Retraso))
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCredencialesInvalidas, "Credenciales inválidas"))
+		}
 
+		usuario, err := st.Usuarios.ObtenerPorUsuario(r.Context(), request.Usuario.Usuario)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				sendError(http.StatusUnauthorized, "Credenciales inválidas")
+			if errors.Is(err, store.ErrNoEncontrado) {
+				bcrypt.CompareHashAndPassword(hashFicticio(), []byte(request.Usuario.Contrasena))
+				credencialesInvalidas()
 			} else {
-				sendError(http.StatusInternalServerError, "Error al buscar usuario: "+err.Error())
+				metrics.InicioSesion(metrics.SesionError)
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error al buscar usuario", err))
 			}
 			return
 		}
+		usuarioID, tipoUsuario := usuario.Rif_Cedula, usuario.Tipo
 
-		//Verificar estado
+		//Verificar contraseña
 
-		if !estado { // Si estado es false
-			sendError(http.StatusUnauthorized, "Cuenta inactiva")
+		if err := bcrypt.CompareHashAndPassword([]byte(usuario.Contrasena), []byte(request.Usuario.Contrasena)); err != nil {
+			credencialesInvalidas()
 			return
 		}
-		//Verificar contraseña
 
-		if err := bcrypt.CompareHashAndPassword([]byte(contrasenaHash), []byte(request.Usuario.Contrasena)); err != nil {
-			sendError(http.StatusUnauthorized, "Credenciales inválidas")
+		reiniciarIntentos(r, intentos, claveUsuario)
+
+		//Verificar estado (despues de la contraseña para no revelar que la cuenta existe)
+
+		if !usuario.Estado { // Si estado es false
+			metrics.InicioSesion(metrics.SesionCuentaInactiva)
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCuentaInactiva, "Cuenta inactiva"))
 			return
 		}
 
-		//Generar JWT
-		claims := &middlewares.Claims{
-			UsuarioID:   usuarioID,
-			TipoUsuario: tipoUsuario,
+		//Segundo factor: si esta activo se devuelve un token de desafio en lugar del JWT
+		segundoFactor, err := st.TOTP.Obtener(r.Context(), usuarioID)
+		if err != nil && !errors.Is(err, store.ErrNoEncontrado) {
+			metrics.InicioSesion(metrics.SesionError)
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error verificando segundo factor", err))
+			return
+		}
 
-			RegisteredClaims: jwt.RegisteredClaims{
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			},
+		if segundoFactor.Activo {
+			tokenDesafio, err := generarToken(usuarioID, tipoUsuario, middlewares.PropositoDesafio2FA, tokens.Desafio2FA)
+			if err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error al generar token", err))
+				return
+			}
+			metrics.InicioSesion(metrics.SesionRequiere2FA)
+			helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
+				"mensaje":       "Ingrese el código de verificación",
+				"requiere_2fa":  true,
+				"token_desafio": tokenDesafio,
+			})
+			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenStr, err := token.SignedString(middlewares.JWTSecret)
+		//Rol obligado a usar 2FA sin inscripcion: solo se permite inscribirlo
+		if totp.Obligatorio(tipoUsuario) {
+			tokenInscripcion, err := generarToken(usuarioID, tipoUsuario, middlewares.PropositoInscripcion2FA, tokens.Inscripcion2FA)
+			if err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error al generar token", err))
+				return
+			}
+			metrics.InicioSesion(metrics.SesionRequiereInscribir)
+			helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
+				"mensaje":                  "Debe configurar la verificación en dos pasos antes de continuar",
+				"requiere_inscripcion_2fa": true,
+				"token":                    tokenInscripcion,
+			})
+			return
+		}
+
+		metrics.InicioSesion(metrics.SesionExitosa)
+		responderSesion(w, r, usuarioID, tipoUsuario, tokens.Sesion)
+	}
+}
+
+// Genera un JWT firmado. Los tokens restringidos llevan un proposito; el emisor y la
+// audiencia configurados los agrega FirmarToken
+func generarToken(usuarioID, tipoUsuario, proposito string, duracion time.Duration) (string, error) {
+	claims := &middlewares.Claims{
+		UsuarioID:   usuarioID,
+		TipoUsuario: tipoUsuario,
+		Proposito:   proposito,
+
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duracion)),
+		},
+	}
+
+	return middlewares.FirmarToken(claims)
+}
+
+// Genera el JWT de sesion y responde con los datos del usuario
+func responderSesion(w http.ResponseWriter, r *http.Request, usuarioID, tipoUsuario string, duracion time.Duration) {
+	tokenStr, err := generarToken(usuarioID, tipoUsuario, "", duracion)
+	if err != nil {
+		helpers.ResponderError(w, r, helpers.ErrorInterno("Error al generar token", err))
+		return
+	}
+
+	//Respuesta extiosa
+	helpers.ResponderJSON(w, http.StatusOK, map[string]string{
+		"mensaje":    "Autenticación exitosa",
+		"token":      tokenStr,
+		"tipo":       tipoUsuario,
+		"rif_cedula": usuarioID,
+	})
+}
+
+// Desbloquear un usuario bloqueado por intentos fallidos (Solo Admin)
+func DesbloquearUsuario(st store.Store, intentos *security.ControlIntentos) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rifCedula := chi.URLParam(r, "rif_cedula")
+
+		registro, err := st.Usuarios.Obtener(r.Context(), rifCedula)
 		if err != nil {
-			sendError(http.StatusInternalServerError, "Error al generar token: "+err.Error())
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
+			return
+		}
+		usuario := registro.Usuario
+
+		//El desbloqueo no toca la base: se audita antes para no aplicarlo sin registro
+		if err := auditar(r, st.Auditoria, "desbloquear", "usuario", rifCedula, nil, nil); err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, ""))
 			return
 		}
+		//Opcionalmente liberar tambien una IP (?ip=...)
+		claves := []string{security.ClaveUsuario(usuario)}
+		ip := r.URL.Query().Get("ip")
+		if ip != "" {
+			claves = append(claves, security.ClaveIP(ip))
+		}
+		for _, clave := range claves {
+			if err := intentos.Reiniciar(r.Context(), clave); err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error desbloqueando usuario", err))
+				return
+			}
+		}
 
-		//Respuesta extiosa
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"mensaje":    "Autenticación exitosa",
-			"token":      tokenStr,
-			"tipo":       tipoUsuario,
-			"rif_cedula": usuarioID,
+		detalle := ""
+		if claims := middlewares.UsuarioDesdeContexto(r.Context()); claims != nil {
+			detalle = "desbloqueado por " + claims.UsuarioID
+		}
+		registrarEventoSeguridad(r.Context(), st.Eventos, "desbloqueo", usuario, ip, detalle)
+
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
+			"mensaje": "Usuario desbloqueado exitosamente",
+			"usuario": usuario,
 		})
+	}
+}
+
+// Registra un evento de seguridad (bloqueos, desbloqueos). Si falla solo se deja en el log
+// para no interrumpir el flujo de autenticacion
+func registrarEventoSeguridad(ctx context.Context, eventos store.EventoSeguridadStore, tipo, usuario, ip, detalle string) {
+	helpers.Logger(ctx).Warn("Evento de seguridad", slog.String("tipo", tipo), slog.String("usuario", usuario),
+		slog.String("ip", ip), slog.String("detalle", detalle))
+
+	err := eventos.Registrar(ctx, models.EventoSeguridad{
+		Tipo:    tipo,
+		Usuario: usuario,
+		IP:      ip,
+		Detalle: detalle,
+		Fecha:   time.Now().UTC(),
+	})
+	if err != nil {
+		helpers.Logger(ctx).Error("Error registrando evento de seguridad", slog.Any("error", err))
+	}
+}
 
+// Suma un fallo al control de intentos. Si el almacen falla se deja en el log y se aplica
+// el retraso maximo: la respuesta al cliente ya es un error
+func registrarFallo(r *http.Request, intentos *security.ControlIntentos, clave string, maxIntentos int) security.ResultadoFallo {
+	resultado, err := intentos.RegistrarFallo(r.Context(), clave, maxIntentos)
+	if err != nil {
+		helpers.Logger(r.Context()).Error("Error registrando intento fallido", slog.Any("error", err))
+	}
+	return resultado
+}
+
+// Borra los fallos de la clave tras un acierto. Si falla solo se deja en el log
+func reiniciarIntentos(r *http.Request, intentos *security.ControlIntentos, clave string) {
+	if err := intentos.Reiniciar(r.Context(), clave); err != nil {
+		helpers.Logger(r.Context()).Error("Error reiniciando intentos fallidos", slog.Any("error", err))
+	}
+}
+
+// Espera el tiempo indicado o hasta que el cliente cancele la solicitud
+func esperar(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
 	}
 }
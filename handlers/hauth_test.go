@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Las claves JWT son globales del paquete middlewares: se configuran una sola vez
+var configurarClaves = sync.OnceValue(func() error {
+	claves, err := security.ConjuntoClavesEfimero()
+	if err != nil {
+		return err
+	}
+	middlewares.ConfigurarClavesJWT(claves, "ferryapp", "ferryapp-api")
+	return nil
+})
+
+func TestIniciarSesion(t *testing.T) {
+	if err := configurarClaves(); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("Clave-Segura-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.NuevoMemoria()
+	ctx := context.Background()
+	for _, u := range []models.Usuario{
+		{Rif_Cedula: "V-12345678", Usuario: "operador", Contrasena: string(hash), Tipo: "empleado", Estado: true},
+		{Rif_Cedula: "V-87654321", Usuario: "inactivo", Contrasena: string(hash), Tipo: "empleado"},
+	} {
+		if err := st.Usuarios.Crear(ctx, u, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Sin retraso para no alargar la prueba; dos fallos bloquean al usuario
+	cfg := security.ConfigBloqueoPorDefecto()
+	cfg.MaxIntentosUsuario, cfg.RetrasoBase, cfg.RetrasoMaximo = 2, 0, 0
+	intentos := security.NuevoControlIntentos(cfg, security.NuevoAlmacenIntentosMemoria())
+	politica := security.PoliticaContrasena{CostoBcrypt: bcrypt.MinCost}
+	h := IniciarSesion(st, intentos, security.ConfigTOTPPorDefecto(), security.DuracionTokensPorDefecto(), politica)
+
+	login := func(usuario, contrasena string) (int, string) {
+		cuerpo, _ := json.Marshal(map[string]any{"usuario": map[string]string{"usuario": usuario, "contrasena": contrasena}})
+		w := servir(h, http.MethodPost, "/login", "/login", string(cuerpo), nil)
+		if w.Code == http.StatusOK {
+			var respuesta struct {
+				Token string `json:"token"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&respuesta); err != nil || respuesta.Token == "" {
+				t.Fatalf("respuesta sin token (%v)", err)
+			}
+			return w.Code, ""
+		}
+		return w.Code, codigoError(t, w)
+	}
+
+	casos := []struct {
+		nombre              string
+		usuario, contrasena string
+		estado              int
+		codigo              string
+	}{
+		{"credenciales validas", "operador", "Clave-Segura-1", http.StatusOK, ""},
+		{"usuario inexistente", "fantasma", "Clave-Segura-1", http.StatusUnauthorized, helpers.CodigoCredencialesInvalidas},
+		{"cuenta inactiva", "inactivo", "Clave-Segura-1", http.StatusUnauthorized, helpers.CodigoCuentaInactiva},
+		{"contrasena incorrecta", "operador", "otra", http.StatusUnauthorized, helpers.CodigoCredencialesInvalidas},
+		{"segundo fallo bloquea", "operador", "otra", http.StatusUnauthorized, helpers.CodigoCredencialesInvalidas},
+		{"bloqueado aun con la contrasena correcta", "operador", "Clave-Segura-1", http.StatusTooManyRequests, helpers.CodigoDemasiadosIntentos},
+	}
+	for _, c := range casos {
+		estado, codigo := login(c.usuario, c.contrasena)
+		if estado != c.estado || codigo != c.codigo {
+			t.Errorf("%s: estado %d codigo %q, se esperaba %d %q", c.nombre, estado, codigo, c.estado, c.codigo)
+		}
+	}
+
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+)
+
+// Publica las claves de verificacion de tokens (/.well-known/jwks.json)
+func JWKS(claves *security.ConjuntoClaves) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		helpers.ResponderJSON(w, http.StatusOK, claves.JWKS())
+	}
+}
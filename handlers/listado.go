@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// parametrosListado lee los parametros comunes a todos los listados:
+//
+//	?limite=20&desplazamiento=40      paginacion por desplazamiento
+//	?limite=20&cursor=<siguiente>     paginacion por cursor (tiene prioridad)
+//	?orden=nombre | ?orden=-nombre    campo de orden, con "-" para descendente
+//	?estado=true&q=texto              filtros de estado y busqueda de texto
+//
+// Los errores se acumulan en detalles para responderlos todos juntos
+type parametrosListado struct {
+	r        *http.Request
+	detalles []helpers.DetalleCampo
+}
+
+func nuevosParametros(r *http.Request) *parametrosListado {
+	return &parametrosListado{r: r}
+}
+
+func (p *parametrosListado) invalido(campo, mensaje string) {
+	p.detalles = append(p.detalles, helpers.DetalleCampo{Campo: campo, Mensaje: mensaje})
+}
+
+func (p *parametrosListado) texto(nombre string) string {
+	return strings.TrimSpace(p.r.URL.Query().Get(nombre))
+}
+
+func (p *parametrosListado) entero(nombre string, minimo, maximo int) int {
+	valor := p.texto(nombre)
+	if valor == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(valor)
+	if err != nil || n < minimo || n > maximo {
+		p.invalido(nombre, "Debe ser un entero entre "+strconv.Itoa(minimo)+" y "+strconv.Itoa(maximo))
+		return 0
+	}
+	return n
+}
+
+func (p *parametrosListado) booleano(nombre string) *bool {
+	valor := p.texto(nombre)
+	if valor == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(valor)
+	if err != nil {
+		p.invalido(nombre, "Debe ser true o false")
+		return nil
+	}
+	return &b
+}
+
+// fecha acepta RFC 3339 o AAAA-MM-DD. Con finDeDia, una fecha sin hora se toma como
+// el inicio del dia siguiente para que el rango "hasta" incluya ese dia completo
+func (p *parametrosListado) fecha(nombre string, finDeDia bool) *time.Time {
+	valor := p.texto(nombre)
+	if valor == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return &t
+	}
+	t, err := time.Parse(time.DateOnly, valor)
+	if err != nil {
+		p.invalido(nombre, "Debe ser una fecha AAAA-MM-DD o RFC 3339")
+		return nil
+	}
+	if finDeDia {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t
+}
+
+// consulta arma la paginacion y el orden; campos son los nombres ordenables del listado
+func (p *parametrosListado) consulta(campos []string) store.Consulta {
+	c := store.Consulta{
+		Limite:         p.entero("limite", 1, store.LimiteMaximo),
+		Desplazamiento: p.entero("desplazamiento", 0, 1<<31-1),
+		Cursor:         p.texto("cursor"),
+	}
+
+	orden := p.texto("orden")
+	if strings.HasPrefix(orden, "-") {
+		orden, c.Descendente = orden[1:], true
+	}
+	if orden != "" && !slices.Contains(campos, orden) {
+		p.invalido("orden", "Campos válidos: "+strings.Join(campos, ", "))
+	}
+	c.Orden = orden
+	return c
+}
+
+// responderInvalidos responde los errores de parametros acumulados; false si hubo alguno
+func (p *parametrosListado) responderInvalidos(w http.ResponseWriter) bool {
+	if len(p.detalles) == 0 {
+		return true
+	}
+	helpers.ResponderError(w, p.r, helpers.ErrorValidacion("Parámetros de listado inválidos", p.detalles))
+	return false
+}
+
+// Responde una pagina del store traduciendo los errores de cursor y orden a un 400
+func responderPagina[T any](w http.ResponseWriter, r *http.Request, pagina store.Pagina[T], err error, mensaje string) {
+	switch {
+	case err == nil:
+		helpers.ResponderJSON(w, http.StatusOK, pagina)
+	case errors.Is(err, store.ErrCursorInvalido):
+		helpers.ResponderError(w, r, helpers.ErrorValidacion("Parámetros de listado inválidos", []helpers.DetalleCampo{
+			{Campo: "cursor", Mensaje: "El cursor no es válido para este orden"},
+		}))
+	case errors.Is(err, store.ErrOrdenInvalido):
+		helpers.ResponderError(w, r, helpers.ErrorValidacion("Parámetros de listado inválidos", []helpers.DetalleCampo{
+			{Campo: "orden", Mensaje: "Campo de orden no válido"},
+		}))
+	default:
+		helpers.ResponderError(w, r, helpers.ErrorInterno(mensaje, err))
+	}
+}
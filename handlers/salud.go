@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+// Tiempo maximo de las comprobaciones de /readyz
+const tiempoComprobacion = 2 * time.Second
+
+// ComprobacionesPreparado son las dependencias que /readyz consulta
+type ComprobacionesPreparado struct {
+	// Ping a la base de datos
+	Ping func(ctx context.Context) error
+	// Version de migracion aplicada en la base de datos y la que espera el binario
+	VersionAplicada func(ctx context.Context) (int, error)
+	VersionEsperada int
+	// Se activa al empezar el apagado para que el balanceador deje de enviar trafico
+	Apagando *atomic.Bool
+}
+
+// Salud (/healthz) solo indica que el proceso responde; no consulta dependencias para
+// que un fallo de la base de datos no provoque reinicios
+func Salud() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{"estado": "ok"})
+	}
+}
+
+// Preparado (/readyz) responde 503 mientras el servicio no pueda atender solicitudes:
+// durante el apagado, sin base de datos o con migraciones pendientes
+func Preparado(c ComprobacionesPreparado) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), tiempoComprobacion)
+		defer cancel()
+
+		preparado := true
+		comprobaciones := map[string]interface{}{}
+
+		if c.Apagando != nil && c.Apagando.Load() {
+			preparado = false
+			comprobaciones["servidor"] = "apagando"
+		}
+
+		if err := c.Ping(ctx); err != nil {
+			preparado = false
+			comprobaciones["base_datos"] = "sin conexion"
+			helpers.Logger(r.Context()).Warn("Readiness: base de datos no disponible", "error", err)
+		} else {
+			comprobaciones["base_datos"] = "ok"
+
+			aplicada, err := c.VersionAplicada(ctx)
+			migraciones := map[string]interface{}{"aplicada": aplicada, "esperada": c.VersionEsperada}
+			switch {
+			case err != nil:
+				preparado = false
+				migraciones["estado"] = "error consultando"
+				helpers.Logger(r.Context()).Warn("Readiness: error consultando migraciones", "error", err)
+			case aplicada < c.VersionEsperada:
+				preparado = false
+				migraciones["estado"] = "pendientes"
+			default:
+				migraciones["estado"] = "ok"
+			}
+			comprobaciones["migraciones"] = migraciones
+		}
+
+		estado, codigo := "ok", http.StatusOK
+		if !preparado {
+			estado, codigo = "no_preparado", http.StatusServiceUnavailable
+		}
+		helpers.ResponderJSON(w, codigo, map[string]interface{}{
+			"estado":         estado,
+			"comprobaciones": comprobaciones,
+		})
+	}
+}
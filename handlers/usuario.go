@@ -1,86 +1,74 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strings"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
 	"github.com/go-chi/chi/v5"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Esta funcion solo sera usada para administradores, el resto de tipo de usuarios seran creados junto a sus datos relacionados (Empresa/Empleado)
 
-// Custom error type para manejo especifico de errores
-type HandlerError struct {
-	Code    int
-	Message string
-}
-
-func (e *HandlerError) Error() string {
-	return e.Message
-}
-
 // Funcion para agregar nuevos usuarios
-func RegistrarUsuario(db *pgx.Conn) http.HandlerFunc {
+func RegistrarUsuario(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			RifCedula  string `json:"rif_cedula"`
-			Usuario    string `json:"usuario"`
-			Contrasena string `json:"contrasena"`
-			Tipo       string `json:"tipo"`
+			RifCedula  string `json:"rif_cedula" validar:"requerido,rif_cedula"`
+			Usuario    string `json:"usuario" validar:"requerido,min=4,max=120"`
+			Contrasena string `json:"contrasena" validar:"requerido"`
+			Tipo       string `json:"tipo" validar:"requerido,uno_de=Administrador|empresa|empleado"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON invalido",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
 		//Validacion
-		if req.RifCedula == "" || req.Usuario == "" || req.Contrasena == "" || req.Tipo == "" {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Todos los campos son requeridos",
-			})
+		if !validarEntrada(w, r, req) {
 			return
 		}
 
-		//Hash de contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Contrasena), bcrypt.DefaultCost)
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error procesando credenciales",
-			})
+		//Politica y hash de contraseña
+		hashedPassword, herr := hashearContrasenaNueva(politica, req.Usuario, req.Contrasena)
+		if herr != nil {
+			helpers.ResponderError(w, r, herr)
 			return
 		}
 
 		usuario := models.Usuario{
 			Rif_Cedula: req.RifCedula,
 			Usuario:    req.Usuario,
-			Contrasena: string(hashedPassword),
+			Contrasena: hashedPassword,
 			Tipo:       req.Tipo,
 			Estado:     true,
 		}
 
-		if err := RegistrarUsuarioTx(r.Context(), db, usuario); err != nil {
-			responderError(w, err.(*HandlerError))
+		err := st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Usuarios.Crear(r.Context(), usuario, politica.Historial); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "crear", "usuario", usuario.Rif_Cedula, nil, usuario)
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrDuplicado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "El usuario o identifacion ya eisten"))
+				return
+			}
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, ""))
 			return
 		}
 
-		responderJSON(w, http.StatusCreated, map[string]string{
+		helpers.ResponderJSON(w, http.StatusCreated, map[string]string{
 			"mensaje": "Usuario registrado exitosamente",
 		})
 
@@ -88,270 +76,116 @@ func RegistrarUsuario(db *pgx.Conn) http.HandlerFunc {
 
 }
 
-//Funcion de transaccion
-
-func RegistrarUsuarioTx(ctx context.Context, db *pgx.Conn, usuario models.Usuario) error {
-	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error iniciando transaccion",
-		}
-	}
-
-	defer tx.Rollback(ctx)
-
-	_, err = tx.Exec(ctx,
-		`INSERT INTO usuarios (rif_cedula, usuario, contrasena, tipo, estado)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		usuario.Rif_Cedula,
-		usuario.Usuario,
-		usuario.Contrasena,
-		usuario.Tipo,
-		usuario.Estado,
-	)
-
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return &HandlerError{
-				Code:    http.StatusConflict,
-				Message: "El usuario o identifacion ya eisten",
-			}
-		}
-
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error al guardar en base de datos",
-		}
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error confirmando transaccion",
-		}
-	}
-	return nil
-
-}
-
-// Modificar usuarios (Sin contraseñas)
-func EditarUsuario(db *pgx.Conn) http.HandlerFunc {
+// Modificar usuario y/o contraseña. Solo cambia los campos enviados, por lo que sirve
+// tanto para PUT como para PATCH
+func EditarUsuario(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifCedula := chi.URLParam(r, "rif_cedula")
 
+		version, ok := versionIfMatch(w, r)
+		if !ok {
+			return
+		}
+
 		var req struct {
-			Usuario    string `json:"usuario"`
+			Usuario    string `json:"usuario" validar:"min=4,max=120"`
 			Contrasena string `json:"contrasena"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON invalido",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
 
 		//Validar que al menos un campo sea modificado
 		if req.Usuario == "" && req.Contrasena == "" {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Debe proporcionar al menos un campo para actulizar",
-			})
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion, "Debe proporcionar al menos un campo para actulizar"))
 			return
 		}
 
 		//Validar longitud del usuario
-		if req.Usuario != "" && (len(req.Usuario) < 4 || len(req.Usuario) > 120) {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "El usuario debe tener entre 4 y 120 caracteres",
-			})
+		if !validarActualizacion(w, r, req) {
+			return
+		}
+
+		//Datos anteriores para la auditoria
+		actual, err := st.Usuarios.Obtener(r.Context(), rifCedula)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
 		var hashedPassword string
 		if req.Contrasena != "" {
-			if len(req.Contrasena) < 8 {
-				responderError(w, &HandlerError{
-					Code:    http.StatusBadRequest,
-					Message: "La contraseña debe tener minimo 8 caracteres",
-				})
+			hash, herr := hashearCambioContrasena(r.Context(), st.Usuarios, politica, rifCedula, req.Usuario, req.Contrasena)
+			if herr != nil {
+				helpers.ResponderError(w, r, herr)
 				return
 			}
-
-			hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Contrasena), bcrypt.DefaultCost)
-			if err != nil {
-				responderError(w, &HandlerError{
-					Code:    http.StatusInternalServerError,
-					Message: "Error procesando contraseña",
-				})
+			hashedPassword = hash
+		}
+		nuevo := actual
+		if req.Usuario != "" {
+			nuevo.Usuario = req.Usuario
+		}
+		if hashedPassword != "" {
+			nuevo.Contrasena = hashedPassword
+		}
+		var nueva int
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			var err error
+			if nueva, err = tx.Usuarios.Actualizar(r.Context(), rifCedula, req.Usuario, hashedPassword, politica.Historial, version); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "actualizar", "usuario", rifCedula, actual, nuevo)
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrDuplicado) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoConflicto, "El nombre de usuario ya existe"))
 				return
 			}
-			hashedPassword = string(hashedBytes)
-		}
-		if err := EditarUsuarioTx(r.Context(), db, rifCedula, req.Usuario, hashedPassword); err != nil {
-			responderError(w, err.(*HandlerError))
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, map[string]string{
+		w.Header().Set("ETag", etagVersion(nueva))
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": "Usuario actulizado exitosamente",
 		})
 	}
 }
 
-// Funcion de transaccion
-func EditarUsuarioTx(
-	ctx context.Context,
-	db *pgx.Conn,
-	rifCedula string,
-	nuevoUsuario string,
-	nuevaContrasena string,
-) error {
-	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error iniciando transacción",
-		}
-	}
-	defer tx.Rollback(ctx)
-
-	// Construcción dinámica de la consulta
-	query := "UPDATE usuarios SET"
-	params := []interface{}{}
-	paramIndex := 1
-
-	updates := []string{}
-
-	if nuevoUsuario != "" {
-		updates = append(updates, fmt.Sprintf("usuario = $%d", paramIndex))
-		params = append(params, nuevoUsuario)
-		paramIndex++
-	}
-
-	if nuevaContrasena != "" {
-		updates = append(updates, fmt.Sprintf("contrasena = $%d", paramIndex))
-		params = append(params, nuevaContrasena)
-		paramIndex++
-	}
-
-	if len(updates) == 0 {
-		return &HandlerError{
-			Code:    http.StatusBadRequest,
-			Message: "No se proporcionaron campos para actualizar",
-		}
-	}
-
-	// Agregar condición WHERE
-	query += " " + strings.Join(updates, ", ") + fmt.Sprintf(" WHERE rif_cedula = $%d", paramIndex)
-	params = append(params, rifCedula)
-
-	// Ejecutar la actualización
-	result, err := tx.Exec(ctx, query, params...)
-	if err != nil {
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error ejecutando actualización: " + err.Error(),
-		}
-	}
-
-	// Verificar si se actualizó algún registro
-	if result.RowsAffected() == 0 {
-		return &HandlerError{
-			Code:    http.StatusNotFound,
-			Message: "Usuario no encontrado",
-		}
-	}
-
-	// Confirmar transacción
-	if err := tx.Commit(ctx); err != nil {
-		return &HandlerError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error confirmando cambios: " + err.Error(),
-		}
-	}
-
-	return nil
-}
-
 // Funcion para modificar el estado del usuario (Activado/Desactivado)
-func EstadoUsuario(db *pgx.Conn) http.HandlerFunc {
+func EstadoUsuario(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifCedula := chi.URLParam(r, "rif_cedula")
-		accion := chi.URLParam(r, "accion")
-
-		var estado bool
-		switch accion {
-		case "activar":
-			estado = true
-		case "desactivar":
-			estado = false
-		default:
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Acción no válida. Use /activar o /desactivar",
-			})
-			return
-		}
-
-		// Verificar existencia del usuario
-		var existe bool
-		err := db.QueryRow(r.Context(),
-			`SELECT EXISTS(SELECT 1 FROM usuarios WHERE rif_cedula = $1)`,
-			rifCedula).Scan(&existe)
-
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error verificando usuario" + err.Error(),
-			})
-			return
-		}
 
-		if !existe {
-			responderError(w, &HandlerError{
-				Code:    http.StatusNotFound,
-				Message: "Usuario no encontrado",
-			})
+		estado, accion, ok := estadoSolicitado(w, r)
+		if !ok {
 			return
 		}
 
-		// Actualización con transacción
-		tx, err := db.Begin(r.Context())
+		//Estado anterior para la auditoria
+		actual, err := st.Usuarios.Obtener(r.Context(), rifCedula)
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error iniciando transacción",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
-		defer tx.Rollback(r.Context())
-
-		_, err = tx.Exec(r.Context(),
-			`UPDATE usuarios SET estado = $1 WHERE rif_cedula = $2`,
-			estado, rifCedula)
 
+		nuevo := actual
+		nuevo.Estado = estado
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Usuarios.CambiarEstado(r.Context(), rifCedula, estado); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, accion, "usuario", rifCedula, actual, nuevo)
+		})
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error actualizando estado: " + err.Error(),
-			})
-			return
-		}
-
-		if err := tx.Commit(r.Context()); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error confirmando cambios",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, map[string]interface{}{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]interface{}{
 			"mensaje": fmt.Sprintf("Usuario %s %s", rifCedula, accion),
 			"estado":  estado,
 			"accion":  accion,
@@ -362,203 +196,147 @@ func EstadoUsuario(db *pgx.Conn) http.HandlerFunc {
 // Funciones para consumos especificos
 
 // Obtener usuarios
-func ObtenerUsuario(db *pgx.Conn) http.HandlerFunc {
+func ObtenerUsuario(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifCedula := chi.URLParam(r, "rif_cedula")
 
-		var usuario models.Usuario
-		err := db.QueryRow(context.Background(),
-			`SELECT rif_cedula, usuario, tipo, estado 
-			 FROM usuarios 
-			 WHERE rif_cedula = $1`,
-			rifCedula,
-		).Scan(&usuario.Rif_Cedula, &usuario.Usuario, &usuario.Tipo, &usuario.Estado)
-
+		usuario, err := st.Usuarios.Obtener(r.Context(), rifCedula)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				responderError(w, &HandlerError{
-					Code:    http.StatusNotFound,
-					Message: "Usuario no encontrado",
-				})
-				return
-			}
-
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error al consultar la base de datos",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
-
-		responderJSON(w, http.StatusOK, usuario)
+		//El hash nunca sale del servidor
+		responderConETag(w, r, usuario.Version, usuario.Publico())
 	}
 }
 
 // Cambio de contraseña (Solo Admin)
-func CambiarContrasena(db *pgx.Conn) http.HandlerFunc {
+func CambiarContrasena(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rifCedula := chi.URLParam(r, "rif_cedula")
 
 		var req struct {
-			NuevaContrasena string `json:"nuevaContrasena"`
+			NuevaContrasena string `json:"nuevaContrasena" validar:"requerido"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON inválido",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
-
-		// Validar longitud mínima
-		if len(req.NuevaContrasena) < 8 {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "La contraseña debe tener al menos 8 caracteres",
-			})
+		if !validarEntrada(w, r, req) {
 			return
 		}
 
-		// Hash de la nueva contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NuevaContrasena), bcrypt.DefaultCost)
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error procesando contraseña",
-			})
+		// Politica, historial y hash de la nueva contraseña
+		hashedPassword, herr := hashearCambioContrasena(r.Context(), st.Usuarios, politica, rifCedula, "", req.NuevaContrasena)
+		if herr != nil {
+			helpers.ResponderError(w, r, herr)
 			return
 		}
 
 		// Actualizar en la base de datos
-		_, err = db.Exec(context.Background(),
-			`UPDATE usuarios SET contrasena = $1 WHERE rif_cedula = $2`,
-			string(hashedPassword), rifCedula)
-
+		err := st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Usuarios.CambiarContrasena(r.Context(), rifCedula, hashedPassword, politica.Historial); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "restablecer_contrasena", "usuario", rifCedula, nil, nil)
+		})
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error al actualizar contraseña",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, map[string]string{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": "Contraseña actualizada exitosamente",
 		})
 	}
 }
 
 // Cambio de contraseña personal
-func CambiarContrasenaPersonal(db *pgx.Conn) http.HandlerFunc {
+func CambiarContrasenaPersonal(st store.Store, politica security.PoliticaContrasena) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Obtener el ID del usuario del token JWT
 		claims := middlewares.UsuarioDesdeContexto(r.Context())
 		if claims == nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusUnauthorized,
-				Message: "No se pudo verificar la identidad del usuario",
-			})
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "No se pudo verificar la identidad del usuario"))
 			return
 		}
 
 		userId := claims.UsuarioID
 
 		var req struct {
-			ContrasenaActual string `json:"contrasenaActual"`
-			NuevaContrasena  string `json:"nuevaContrasena"`
+			ContrasenaActual string `json:"contrasenaActual" validar:"requerido"`
+			NuevaContrasena  string `json:"nuevaContrasena" validar:"requerido"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "Formato JSON inválido",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
 			return
 		}
-
-		// Validar longitud mínima
-		if len(req.NuevaContrasena) < 8 {
-			responderError(w, &HandlerError{
-				Code:    http.StatusBadRequest,
-				Message: "La nueva contraseña debe tener al menos 8 caracteres",
-			})
+		if !validarEntrada(w, r, req) {
 			return
 		}
 
-		// Obtener contraseña actual de la base de datos
-		var contrasenaActual string
-		err := db.QueryRow(context.Background(),
-			`SELECT contrasena FROM usuarios WHERE rif_cedula = $1`,
-			userId).Scan(&contrasenaActual)
-
+		// Obtener contraseña actual
+		actual, err := st.Usuarios.Obtener(r.Context(), userId)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				responderError(w, &HandlerError{
-					Code:    http.StatusNotFound,
-					Message: "Usuario no encontrado",
-				})
-				return
-			}
-
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error al consultar la base de datos",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
 		// Verificar contraseña actual
-		if err := bcrypt.CompareHashAndPassword([]byte(contrasenaActual), []byte(req.ContrasenaActual)); err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusUnauthorized,
-				Message: "Contraseña actual incorrecta",
-			})
+		if err := bcrypt.CompareHashAndPassword([]byte(actual.Contrasena), []byte(req.ContrasenaActual)); err != nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoCredencialesInvalidas, "Contraseña actual incorrecta"))
 			return
 		}
 
-		// Hash de la nueva contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NuevaContrasena), bcrypt.DefaultCost)
-		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error procesando contraseña",
-			})
+		// Politica, historial y hash de la nueva contraseña
+		hashedPassword, herr := hashearCambioContrasena(r.Context(), st.Usuarios, politica, userId, "", req.NuevaContrasena)
+		if herr != nil {
+			helpers.ResponderError(w, r, herr)
 			return
 		}
 
 		// Actualizar contraseña
-		_, err = db.Exec(context.Background(),
-			`UPDATE usuarios SET contrasena = $1 WHERE rif_cedula = $2`,
-			string(hashedPassword), userId)
-
+		err = st.EnTransaccion(r.Context(), func(tx store.Store) error {
+			if err := tx.Usuarios.CambiarContrasena(r.Context(), userId, hashedPassword, politica.Historial); err != nil {
+				return err
+			}
+			return auditar(r, tx.Auditoria, "cambiar_contrasena", "usuario", userId, nil, nil)
+		})
 		if err != nil {
-			responderError(w, &HandlerError{
-				Code:    http.StatusInternalServerError,
-				Message: "Error al actualizar contraseña",
-			})
+			helpers.ResponderError(w, r, helpers.ErrorStore(err, "Usuario no encontrado"))
 			return
 		}
 
-		responderJSON(w, http.StatusOK, map[string]string{
+		helpers.ResponderJSON(w, http.StatusOK, map[string]string{
 			"mensaje": "Contraseña actualizada exitosamente",
 		})
 	}
 }
 
-// Helper para respuesta
-func responderError(w http.ResponseWriter, err *HandlerError) {
-	responderJSON(w, err.Code, map[string]string{
-		"error": err.Message,
-	})
-}
-
-func responderJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+// Listado de usuarios (Solo Admin). Nunca incluye el hash de la contraseña
+func ListarUsuarios(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := nuevosParametros(r)
+		filtro := store.FiltroUsuarios{
+			Tipo:   p.texto("tipo"),
+			Estado: p.booleano("estado"),
+			Texto:  p.texto("q"),
+		}
+		consulta := p.consulta(store.CamposOrdenUsuarios())
+		if !p.responderInvalidos(w) {
+			return
+		}
 
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error escribiendo respuesta JSON: %v", err)
-		http.Error(w, "Error generando respuesta", http.StatusInternalServerError)
+		usuarios, err := st.Usuarios.Listar(r.Context(), filtro, consulta)
+		publicos := store.Pagina[models.UsuarioPublico]{
+			Elementos: make([]models.UsuarioPublico, 0, len(usuarios.Elementos)),
+			Total:     usuarios.Total, SiguienteCursor: usuarios.SiguienteCursor,
+		}
+		for _, u := range usuarios.Elementos {
+			publicos.Elementos = append(publicos.Elementos, u.Publico())
+		}
+		responderPagina(w, r, publicos, err, "Error al buscar usuarios")
 	}
 }
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/validation"
+)
+
+// Valida el cuerpo segun sus etiquetas `validar` y, si hay violaciones, responde un 400
+// con todas ellas. Devuelve false cuando ya se respondio
+func validarEntrada(w http.ResponseWriter, r *http.Request, v interface{}, omitir ...string) bool {
+	return responderViolaciones(w, r, validation.Validar(v, omitir...))
+}
+
+// Igual que validarEntrada pero para actualizaciones parciales
+func validarActualizacion(w http.ResponseWriter, r *http.Request, v interface{}, omitir ...string) bool {
+	return responderViolaciones(w, r, validation.ValidarParcial(v, omitir...))
+}
+
+func responderViolaciones(w http.ResponseWriter, r *http.Request, violaciones []validation.Violacion) bool {
+	if len(violaciones) == 0 {
+		return true
+	}
+	campos := make([]helpers.DetalleCampo, len(violaciones))
+	for i, v := range violaciones {
+		campos[i] = helpers.DetalleCampo{Campo: v.Campo, Mensaje: v.Mensaje}
+	}
+	helpers.ResponderError(w, r, helpers.ErrorValidacion("Los datos enviados no son válidos", campos))
+	return false
+}
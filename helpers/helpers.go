@@ -1,32 +1,143 @@
+// Package helpers concentra el formato de las respuestas de la API. Todos los errores
+// salen con el mismo sobre JSON:
+//
+//	{"error": {"codigo": "no_encontrado", "mensaje": "...", "detalles": ..., "id_solicitud": "..."}}
 package helpers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Codigos estables para que los clientes no dependan del texto del mensaje
+const (
+	CodigoJSONInvalido          = "json_invalido"
+	CodigoValidacion            = "validacion"
+	CodigoPoliticaContrasena    = "politica_contrasena"
+	CodigoNoAutenticado         = "no_autenticado"
+	CodigoCredencialesInvalidas = "credenciales_invalidas"
+	CodigoCuentaInactiva        = "cuenta_inactiva"
+	CodigoCodigoInvalido        = "codigo_verificacion_invalido"
+	CodigoProhibido             = "prohibido"
+	CodigoNoEncontrado          = "no_encontrado"
+	CodigoMetodoNoPermitido     = "metodo_no_permitido"
+	CodigoConflicto             = "conflicto"
+	CodigoPrecondicionRequerida = "precondicion_requerida"
+	CodigoVersionObsoleta       = "version_obsoleta"
+	CodigoReferenciaInvalida    = "referencia_invalida"
+	CodigoRestriccion           = "restriccion_violada"
+	CodigoDemasiadosIntentos    = "demasiados_intentos"
+	CodigoLimiteExcedido        = "limite_excedido"
+	CodigoIdempotenciaConflicto = "idempotencia_conflicto"
+	CodigoSolicitudEnProceso    = "solicitud_en_proceso"
+	CodigoInterno               = "error_interno"
 )
 
-type HandlerError struct {
-	Code    int
-	Message string
+// ErrorAPI es el unico tipo de error que los handlers devuelven al cliente
+type ErrorAPI struct {
+	Estado   int         `json:"-"`
+	Codigo   string      `json:"codigo"`
+	Mensaje  string      `json:"mensaje"`
+	Detalles interface{} `json:"detalles,omitempty"`
+
+	//Causa interna; se registra en el log pero nunca se envia al cliente
+	causa error
+}
+
+func (e *ErrorAPI) Error() string {
+	return e.Mensaje
+}
+
+// DetalleCampo describe un error de validacion en un campo concreto
+type DetalleCampo struct {
+	Campo   string `json:"campo"`
+	Mensaje string `json:"mensaje"`
+}
+
+func NuevoError(estado int, codigo, mensaje string) *ErrorAPI {
+	return &ErrorAPI{Estado: estado, Codigo: codigo, Mensaje: mensaje}
+}
+
+// ConDetalles agrega informacion adicional al error
+func (e *ErrorAPI) ConDetalles(detalles interface{}) *ErrorAPI {
+	e.Detalles = detalles
+	return e
+}
+
+// ErrorValidacion agrupa los errores por campo en un 400
+func ErrorValidacion(mensaje string, campos []DetalleCampo) *ErrorAPI {
+	return NuevoError(http.StatusBadRequest, CodigoValidacion, mensaje).ConDetalles(campos)
+}
+
+// ErrorJSONInvalido es la respuesta comun cuando el cuerpo no se puede decodificar
+func ErrorJSONInvalido() *ErrorAPI {
+	return NuevoError(http.StatusBadRequest, CodigoJSONInvalido, "Formato JSON inválido")
 }
 
-func (e *HandlerError) Error() string {
-	return e.Message
+// ErrorVersionObsoleta es el 412 cuando If-Match no coincide con la version actual
+func ErrorVersionObsoleta() *ErrorAPI {
+	return NuevoError(http.StatusPreconditionFailed, CodigoVersionObsoleta, "El registro fue modificado por otra solicitud, vuelva a consultarlo")
 }
 
-func responderError(w http.ResponseWriter, err *HandlerError) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(err.Code)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": err.Message,
-	})
+// ErrorInterno responde un mensaje generico, para no filtrar detalles de la base de datos
+// al cliente. La causa se registra en el log de la solicitud al responder
+func ErrorInterno(mensaje string, causa error) *ErrorAPI {
+	err := NuevoError(http.StatusInternalServerError, CodigoInterno, mensaje)
+	err.causa = causa
+	return err
 }
 
-func responderJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+// ErrorStore traduce los errores del store (y por tanto los codigos 23503, 23505 y 23514
+// de Postgres) a errores de la API. noEncontrado es el mensaje para ErrNoEncontrado
+func ErrorStore(err error, noEncontrado string) *ErrorAPI {
+	switch {
+	case errors.Is(err, store.ErrNoEncontrado):
+		return NuevoError(http.StatusNotFound, CodigoNoEncontrado, noEncontrado)
+	case errors.Is(err, store.ErrDuplicado):
+		return NuevoError(http.StatusConflict, CodigoConflicto, "El registro ya existe")
+	case errors.Is(err, store.ErrVersion):
+		return ErrorVersionObsoleta()
+	case errors.Is(err, store.ErrReferencia):
+		return NuevoError(http.StatusBadRequest, CodigoReferenciaInvalida, "El registro hace referencia a datos inexistentes")
+	case errors.Is(err, store.ErrRestriccion):
+		return NuevoError(http.StatusBadRequest, CodigoRestriccion, "Los datos no cumplen las restricciones del registro")
+	default:
+		return ErrorInterno("Error al consultar la base de datos", err)
+	}
+}
+
+// ResponderError escribe el error con el sobre comun, incluido el id de la solicitud
+func ResponderError(w http.ResponseWriter, r *http.Request, err *ErrorAPI) {
+	cuerpo := struct {
+		*ErrorAPI
+		IDSolicitud string `json:"id_solicitud,omitempty"`
+	}{ErrorAPI: err}
+	if r != nil {
+		cuerpo.IDSolicitud = IDSolicitud(r.Context())
+		if err.causa != nil {
+			Logger(r.Context()).Error(err.Mensaje, slog.String("codigo", err.Codigo), slog.Any("error", err.causa))
+		}
+	}
+	ResponderJSON(w, err.Estado, map[string]interface{}{"error": cuerpo})
+}
+
+func ResponderJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error escribiendo respuesta JSON: %v", err)
+		slog.Warn("Error escribiendo respuesta JSON", slog.Any("error", err))
 	}
 }
+
+// NoEncontrado y MetodoNoPermitido reemplazan las respuestas en texto plano del router
+func NoEncontrado(w http.ResponseWriter, r *http.Request) {
+	ResponderError(w, r, NuevoError(http.StatusNotFound, CodigoNoEncontrado, "Ruta no encontrada"))
+}
+
+func MetodoNoPermitido(w http.ResponseWriter, r *http.Request) {
+	ResponderError(w, r, NuevoError(http.StatusMethodNotAllowed, CodigoMetodoNoPermitido, "Método no permitido"))
+}
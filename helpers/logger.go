@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+const (
+	loggerContextKey     claveContexto = "logger"
+	usuarioLogContextKey claveContexto = "usuario_log"
+)
+
+// NuevoLogger crea el logger JSON de la aplicacion con el nivel minimo indicado
+func NuevoLogger(salida io.Writer, nivel slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(salida, &slog.HandlerOptions{Level: nivel}))
+}
+
+// ConLogger guarda en el contexto el logger de la solicitud
+func ConLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// Logger devuelve el logger de la solicitud (con su id, metodo y ruta) o el global
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// usuarioLog es donde la autenticacion anota al usuario para el log de acceso, que se
+// escribe en un middleware externo que no ve el contexto de los internos
+type usuarioLog struct {
+	mu      sync.Mutex
+	usuario string
+}
+
+// ConUsuarioLog prepara el contexto para anotar el usuario; la funcion devuelta lo lee
+func ConUsuarioLog(ctx context.Context) (context.Context, func() string) {
+	u := &usuarioLog{}
+	return context.WithValue(ctx, usuarioLogContextKey, u), func() string {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return u.usuario
+	}
+}
+
+// AnotarUsuario registra el usuario autenticado de la solicitud en su log de acceso
+func AnotarUsuario(ctx context.Context, usuario string) {
+	if u, ok := ctx.Value(usuarioLogContextKey).(*usuarioLog); ok {
+		u.mu.Lock()
+		u.usuario = usuario
+		u.mu.Unlock()
+	}
+}
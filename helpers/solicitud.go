@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+type claveContexto string
+
+const (
+	idSolicitudContextKey claveContexto = "id_solicitud"
+	ipClienteContextKey   claveContexto = "ip_cliente"
+)
+
+// ConIDSolicitud guarda el id de la solicitud en el contexto
+func ConIDSolicitud(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idSolicitudContextKey, id)
+}
+
+// IDSolicitud devuelve el id de la solicitud o "" si no se asigno
+func IDSolicitud(ctx context.Context) string {
+	id, _ := ctx.Value(idSolicitudContextKey).(string)
+	return id
+}
+
+// NuevoIDSolicitud genera un id aleatorio de 16 bytes en hexadecimal
+func NuevoIDSolicitud() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ConIPCliente guarda en el contexto la IP del cliente resuelta a partir de los proxies
+// de confianza
+func ConIPCliente(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipClienteContextKey, ip)
+}
+
+// IPCliente devuelve la IP del cliente: la resuelta por el middleware ClienteReal o, sin
+// el, la IP remota de la conexion sin el puerto
+func IPCliente(r *http.Request) string {
+	if ip, ok := r.Context().Value(ipClienteContextKey).(string); ok {
+		return ip
+	}
+	return IPRemota(r)
+}
+
+// IPRemota es la IP de la conexion sin el puerto, que detras de un proxy es la del proxy
+func IPRemota(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
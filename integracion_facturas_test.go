@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Cada solicitante solo ve las facturas de su empresa; el administrador ve todas
+func TestIntegracionFacturasPorEmpresa(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	casos := []struct {
+		rol, ruta string
+		rifs      []string
+	}{
+		{rolAdmin, "/api/v2/facturas", []string{rifEmpresa, rifOtraEmpresa}},
+		{rolAdmin, "/api/v2/facturas?rif_empresa=" + rifOtraEmpresa, []string{rifOtraEmpresa}},
+		{rolEmpresa, "/api/v2/facturas", []string{rifEmpresa}},
+		{rolEmpresa, "/api/v2/facturas?rif_empresa=" + rifOtraEmpresa, []string{rifEmpresa}},
+		{rolOtraEmpresa, "/api/v2/facturas", []string{rifOtraEmpresa}},
+		{rolEmpleado, "/api/v2/facturas", []string{rifEmpresa}},
+	}
+	for _, c := range casos {
+		w := e.como(t, c.rol, "GET", c.ruta, nil)
+		esperarEstado(t, w, http.StatusOK)
+		var rifs []string
+		for _, f := range leerJSON[store.Pagina[models.Factura]](t, w).Elementos {
+			rifs = append(rifs, f.RIFEmpresa)
+		}
+		if fmt.Sprint(rifs) != fmt.Sprint(c.rifs) {
+			t.Errorf("%s como %s: facturas de %v, se esperaban de %v", c.ruta, c.rol, rifs, c.rifs)
+		}
+	}
+}
+
+// Las claves API solo operan con su alcance, sobre su empresa y mientras no esten revocadas
+func TestIntegracionClavesAPI(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	w := e.como(t, rolEmpresa, "POST", "/api/v2/claves-api", map[string]any{
+		"nombre": "Kiosco", "alcances": []string{security.AlcanceFacturasCrear, security.AlcanceFacturasLeer},
+	})
+	esperarEstado(t, w, http.StatusCreated)
+	creada := leerJSON[struct {
+		Clave    string          `json:"clave"`
+		ClaveAPI models.ClaveAPI `json:"clave_api"`
+	}](t, w)
+	soloLectura := crearClaveAPI(t, e, rifEmpresa, security.AlcanceFacturasLeer)
+
+	conClave := func(clave, metodo, ruta string, cuerpo any) *httptest.ResponseRecorder {
+		t.Helper()
+		return e.pedir(t, solicitud{metodo: metodo, ruta: ruta, cuerpo: cuerpo, cabeceras: map[string]string{"X-API-Key": clave}})
+	}
+
+	esperarEstado(t, conClave(creada.Clave, "POST", "/api/v2/facturas", facturaNueva(rifEmpresa, matriculaFerry, "K-1")), http.StatusCreated)
+	esperarEstado(t, conClave(creada.Clave, "POST", "/api/v2/facturas", facturaNueva(rifOtraEmpresa, matriculaOtra, "K-1")), http.StatusForbidden)
+	esperarEstado(t, conClave(soloLectura, "POST", "/api/v2/facturas", facturaNueva(rifEmpresa, matriculaFerry, "K-2")), http.StatusForbidden)
+
+	esperarEstado(t, conClave(soloLectura, "GET", "/api/v2/facturas/1", nil), http.StatusOK)
+	//La factura de otra empresa no existe para la clave
+	esperarEstado(t, conClave(soloLectura, "GET", "/api/v2/facturas/2", nil), http.StatusNotFound)
+	w = conClave(soloLectura, "GET", "/api/v2/facturas", nil)
+	esperarEstado(t, w, http.StatusOK)
+	if pagina := leerJSON[store.Pagina[models.Factura]](t, w); pagina.Total != 2 {
+		t.Errorf("la clave deberia ver las 2 facturas de su empresa: %+v", pagina)
+	}
+
+	//ferrys:leer permite consultar los ferrys de su empresa y nada mas
+	lecturaFerrys := crearClaveAPI(t, e, rifEmpresa, security.AlcanceFerrysLeer)
+	esperarEstado(t, conClave(lecturaFerrys, "GET", "/api/v2/ferrys/"+matriculaFerry, nil), http.StatusOK)
+	esperarEstado(t, conClave(lecturaFerrys, "GET", "/api/ferry/buscar/"+matriculaFerry, nil), http.StatusOK)
+	esperarEstado(t, conClave(lecturaFerrys, "GET", "/api/v2/ferrys/"+matriculaOtra, nil), http.StatusNotFound)
+	esperarEstado(t, conClave(soloLectura, "GET", "/api/v2/ferrys/"+matriculaFerry, nil), http.StatusForbidden)
+	esperarEstado(t, conClave(lecturaFerrys, "GET", "/api/v2/facturas", nil), http.StatusForbidden)
+
+	//Las claves no sirven en rutas que solo aceptan JWT
+	esperarEstado(t, conClave(creada.Clave, "GET", "/api/v2/empresas/"+rifEmpresa, nil), http.StatusUnauthorized)
+	esperarEstado(t, conClave("fk_invalida", "GET", "/api/v2/facturas", nil), http.StatusUnauthorized)
+
+	//Otra empresa no puede revocarla
+	esperarEstado(t, e.como(t, rolOtraEmpresa, "DELETE", fmt.Sprintf("/api/v2/claves-api/%d", creada.ClaveAPI.ID), nil), http.StatusNotFound)
+	esperarEstado(t, e.como(t, rolEmpresa, "DELETE", fmt.Sprintf("/api/v2/claves-api/%d", creada.ClaveAPI.ID), nil), http.StatusOK)
+	esperarEstado(t, conClave(creada.Clave, "GET", "/api/v2/facturas", nil), http.StatusUnauthorized)
+
+	//La auditoria registra la clave como actor
+	auditoria := leerJSON[store.Pagina[models.RegistroAuditoria]](t, e.como(t, rolAdmin, "GET", "/api/v2/auditoria?entidad=factura", nil))
+	if len(auditoria.Elementos) == 0 || auditoria.Elementos[0].TipoActor != middlewares.TipoClaveAPI {
+		t.Errorf("la factura creada con clave API no quedo auditada a su nombre: %+v", auditoria)
+	}
+}
+
+// Facturas creadas en paralelo: todas se guardan con ids distintos y la cadena de
+// auditoria sigue siendo valida
+func TestIntegracionFacturasConcurrentes(t *testing.T) {
+	e := nuevoEntorno(t)
+	const cantidad = 40
+
+	respuestas := enParalelo(t, e, cantidad, func(i int) solicitud {
+		return solicitud{metodo: "POST", ruta: "/api/v2/facturas", token: e.tokens[rolEmpleado],
+			cuerpo: facturaNueva(rifEmpresa, matriculaFerry, fmt.Sprintf("C-%d", i))}
+	})
+
+	ids := map[int]bool{}
+	for _, w := range respuestas {
+		if w.Code != http.StatusCreated {
+			t.Fatalf("estado %d: %s", w.Code, w.Body.String())
+		}
+		var creada struct {
+			ID int `json:"id_factura"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &creada)
+		if ids[creada.ID] {
+			t.Errorf("id %d repetido", creada.ID)
+		}
+		ids[creada.ID] = true
+	}
+
+	w := e.como(t, rolEmpresa, "GET", "/api/v2/facturas?limite=100", nil)
+	esperarEstado(t, w, http.StatusOK)
+	pagina := leerJSON[store.Pagina[models.Factura]](t, w)
+	if pagina.Total != cantidad+1 {
+		t.Errorf("total %d, se esperaban %d facturas de la empresa", pagina.Total, cantidad+1)
+	}
+	viajes := map[string]bool{}
+	for _, f := range pagina.Elementos {
+		viajes[f.IDViaje] = true
+	}
+	for i := range cantidad {
+		if !viajes[fmt.Sprintf("C-%d", i)] {
+			t.Errorf("falta la factura del viaje C-%d", i)
+		}
+	}
+
+	verificacion, err := e.st.Auditoria.Verificar(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verificacion.Valida || verificacion.Registros != cantidad {
+		t.Errorf("cadena de auditoria: %+v, se esperaban %d registros validos", verificacion, cantidad)
+	}
+}
+
+// La misma Idempotency-Key enviada a la vez crea una sola factura; el resto son repeticiones
+// de la respuesta o 409 si la primera sigue en proceso
+func TestIntegracionIdempotenciaConcurrente(t *testing.T) {
+	e := nuevoEntorno(t)
+	const cantidad = 10
+	cuerpo := facturaNueva(rifEmpresa, matriculaFerry, "I-1")
+	cabeceras := map[string]string{middlewares.CabeceraIdempotencia: "venta-I-1"}
+
+	respuestas := enParalelo(t, e, cantidad, func(int) solicitud {
+		return solicitud{metodo: "POST", ruta: "/api/v2/facturas", token: e.tokens[rolEmpleado], cuerpo: cuerpo, cabeceras: cabeceras}
+	})
+
+	originales, ids := 0, map[string]bool{}
+	for _, w := range respuestas {
+		switch {
+		case w.Code == http.StatusCreated && w.Header().Get(middlewares.CabeceraRespuestaRepetida) == "":
+			originales++
+			ids[w.Body.String()] = true
+		case w.Code == http.StatusCreated:
+			ids[w.Body.String()] = true
+		case w.Code == http.StatusConflict:
+		default:
+			t.Errorf("estado %d inesperado: %s", w.Code, w.Body.String())
+		}
+	}
+	if originales != 1 || len(ids) != 1 {
+		t.Errorf("%d respuestas originales y %d cuerpos distintos, se esperaba uno de cada", originales, len(ids))
+	}
+
+	w := e.como(t, rolEmpresa, "GET", "/api/v2/facturas?viaje=I-1", nil)
+	if pagina := leerJSON[store.Pagina[models.Factura]](t, w); pagina.Total != 1 {
+		t.Errorf("se crearon %d facturas con la misma clave", pagina.Total)
+	}
+
+	//Terminada la primera, la repeticion devuelve la misma respuesta
+	w = e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/facturas", token: e.tokens[rolEmpleado], cuerpo: cuerpo, cabeceras: cabeceras})
+	esperarEstado(t, w, http.StatusCreated)
+	if w.Header().Get(middlewares.CabeceraRespuestaRepetida) != "true" || !ids[w.Body.String()] {
+		t.Errorf("la repeticion no devolvio la respuesta guardada: %s", w.Body.String())
+	}
+	//Y con otro cuerpo la clave no se puede reutilizar
+	otro := facturaNueva(rifEmpresa, matriculaFerry, "I-2")
+	w = e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/facturas", token: e.tokens[rolEmpleado], cuerpo: otro, cabeceras: cabeceras})
+	esperarEstado(t, w, http.StatusUnprocessableEntity)
+}
+
+// Una reserva sin completar mas antigua que el abandono la toma un reintento con el
+// mismo cuerpo, y la solicitud original ya no puede completarla ni liberarla
+func TestIntegracionIdempotenciaReservaAbandonada(t *testing.T) {
+	e := nuevoEntorno(t)
+	ctx := context.Background()
+	idem := e.st.Idempotencia
+	ahora := time.Now().UTC().Truncate(time.Microsecond)
+	original := ahora.Add(-2 * time.Minute)
+	reserva := func(hash string, reservada time.Time) models.SolicitudIdempotente {
+		return models.SolicitudIdempotente{Alcance: "prueba POST /api/v2/facturas", Clave: "venta-1", HashSolicitud: hash,
+			Creada: reservada, Expira: reservada.Add(24 * time.Hour), Reservada: reservada}
+	}
+	reservar := func(registro models.SolicitudIdempotente, abandonadaAntes time.Time) (models.SolicitudIdempotente, bool) {
+		t.Helper()
+		existente, ok, err := idem.Reservar(ctx, registro, abandonadaAntes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return existente, ok
+	}
+
+	if _, ok := reservar(reserva("h1", original), time.Time{}); !ok {
+		t.Fatal("no se pudo hacer la reserva original")
+	}
+	if _, ok := reservar(reserva("h1", ahora), ahora.Add(-5*time.Minute)); ok {
+		t.Error("se tomo una reserva todavia vigente")
+	}
+	if _, ok := reservar(reserva("h2", ahora), ahora.Add(-time.Minute)); ok {
+		t.Error("se tomo una reserva abandonada con otro cuerpo")
+	}
+	if _, ok := reservar(reserva("h1", ahora), ahora.Add(-time.Minute)); !ok {
+		t.Fatal("no se tomo la reserva abandonada")
+	}
+
+	if err := idem.Completar(ctx, "prueba POST /api/v2/facturas", "venta-1", original, http.StatusCreated, "", nil); !errors.Is(err, store.ErrNoEncontrado) {
+		t.Errorf("la solicitud original completo la reserva tomada: %v", err)
+	}
+	if err := idem.Liberar(ctx, "prueba POST /api/v2/facturas", "venta-1", original); err != nil {
+		t.Fatal(err)
+	}
+	//Si la hubiera borrado, esta reserva con la misma hora la volveria a tomar
+	if _, ok := reservar(reserva("h1", ahora), ahora.Add(-time.Minute)); ok {
+		t.Error("la solicitud original libero la reserva tomada")
+	}
+
+	if err := idem.Completar(ctx, "prueba POST /api/v2/facturas", "venta-1", ahora, http.StatusCreated, "application/json", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	//Una respuesta guardada nunca se toma, por antigua que sea la reserva
+	if existente, ok := reservar(reserva("h1", ahora.Add(time.Hour)), ahora.Add(time.Hour)); ok || existente.Estado != http.StatusCreated {
+		t.Errorf("se tomo una solicitud ya completada: %+v", existente)
+	}
+}
+
+// Ediciones simultaneas con el mismo If-Match: solo una se aplica, el resto recibe 412
+func TestIntegracionEdicionesConcurrentes(t *testing.T) {
+	e := nuevoEntorno(t)
+	const cantidad = 10
+
+	respuestas := enParalelo(t, e, cantidad, func(i int) solicitud {
+		return solicitud{metodo: "PATCH", ruta: "/api/v2/ferrys/" + matriculaFerry, token: e.tokens[rolEmpresa],
+			cuerpo: fmt.Sprintf(`{"capacidad_vip":%d}`, 10+i), cabeceras: map[string]string{"If-Match": `"1"`}}
+	})
+
+	estados := map[int]int{}
+	for _, w := range respuestas {
+		estados[w.Code]++
+	}
+	if estados[http.StatusOK] != 1 || estados[http.StatusPreconditionFailed] != cantidad-1 {
+		t.Errorf("estados %v, se esperaba un 200 y %d 412", estados, cantidad-1)
+	}
+
+	ferry, err := e.st.Ferrys.Obtener(context.Background(), matriculaFerry)
+	if err != nil || ferry.Version != 2 {
+		t.Errorf("version %d tras una sola edicion aplicada (%v)", ferry.Version, err)
+	}
+}
+
+// enParalelo envia n solicitudes a la vez y devuelve las respuestas en orden
+func enParalelo(t *testing.T, e *entorno, n int, armar func(i int) solicitud) []*httptest.ResponseRecorder {
+	t.Helper()
+	respuestas := make([]*httptest.ResponseRecorder, n)
+	errores := make([]error, n)
+	var inicio, fin sync.WaitGroup
+	inicio.Add(1)
+	for i := range n {
+		s := armar(i)
+		fin.Add(1)
+		go func() {
+			defer fin.Done()
+			inicio.Wait()
+			respuestas[i], errores[i] = e.servir(s)
+		}()
+	}
+	inicio.Done()
+	fin.Wait()
+
+	if err := errors.Join(errores...); err != nil {
+		t.Fatal(err)
+	}
+	return respuestas
+}
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/openapi"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/jackc/pgx/v5"
+)
+
+// casoRuta prueba una operacion de la v2 y sus rutas equivalentes de la v1, cada una
+// sobre una base recien sembrada. Las de la v1 deben responder igual y marcarse obsoletas
+type casoRuta struct {
+	nombre string
+	rol    string // Token con el que se llama ("" sin token)
+	solicitud
+	v1        []solicitud // Solo metodo, ruta y cuerpo; el token y las cabeceras son los del caso
+	estado    int
+	preparar  func(t *testing.T, e *entorno)
+	comprobar func(t *testing.T, e *entorno, w *httptest.ResponseRecorder)
+}
+
+func (c casoRuta) probar(t *testing.T) {
+	ejecutar := func(t *testing.T, s solicitud) *httptest.ResponseRecorder {
+		e := nuevoEntorno(t)
+		if c.preparar != nil {
+			c.preparar(t, e)
+		}
+		s.token, s.cabeceras = e.tokens[c.rol], c.cabeceras
+		w := e.pedir(t, s)
+		esperarEstado(t, w, c.estado)
+		if c.comprobar != nil {
+			c.comprobar(t, e, w)
+		}
+		return w
+	}
+
+	t.Run(c.metodo+" "+c.ruta, func(t *testing.T) {
+		ejecutar(t, c.solicitud)
+	})
+	for _, anterior := range c.v1 {
+		t.Run(anterior.metodo+" "+anterior.ruta, func(t *testing.T) {
+			w := ejecutar(t, anterior)
+			if w.Header().Get("Deprecation") == "" || !strings.Contains(w.Header().Get("Link"), `rel="successor-version"`) {
+				t.Errorf("la ruta de la v1 no se marca como obsoleta: Deprecation=%q Link=%q",
+					w.Header().Get("Deprecation"), w.Header().Get("Link"))
+			}
+		})
+	}
+}
+
+func TestIntegracionRutas(t *testing.T) {
+	ifMatch := map[string]string{"If-Match": `"1"`}
+	login := map[string]any{"usuario": map[string]string{"usuario": usuarioAdmin, "contrasena": contrasenaPrueba}}
+	empresa := models.Empresa{RIF: rifEmpresa, Nombre: "Naviera del Caribe C.A.", Email: "ventas@naviera.com", Direccion: "Puerto La Cruz"}
+	empleado := models.Empleados{Nombres: "Ana Maria", Apellidos: "Rivas", Email: "ana.rivas@naviera.com", Cargo: "Supervisora", Numero_tlf: "0414-7654321"}
+	ferry := models.Ferry{Nombre: "Lucero del Alba", Modelo: "Catamaran", CapacidadEconomica: 280, CapacidadVIP: 60, Estado: true}
+	nuevaEmpresa := map[string]any{
+		"empresa": models.Empresa{RIF: "J-29876543-7", Nombre: "Naviera de Margarita", Email: "info@margarita.com"},
+		"usuario": map[string]string{"usuario": "margarita", "contrasena": contrasenaPrueba},
+	}
+	nuevoEmpleado := map[string]any{
+		"empleado": models.Empleados{Cedula: "V-21000000", Nombres: "Jose", Apellidos: "Lara", Rif_empresa: rifEmpresa,
+			Email: "jose@naviera.com", Cargo: "Taquillero", Numero_tlf: "0412-1234567"},
+		"usuario": map[string]string{"usuario": "taquilla2", "contrasena": contrasenaPrueba},
+	}
+	nuevoFerry := models.Ferry{Matricula: "AMV-5555", RifEmpresa: rifEmpresa, Nombre: "Brisa", Modelo: "Ro-Pax", CapacidadEconomica: 200, CapacidadVIP: 10}
+	nuevaClave := map[string]any{"nombre": "Kiosco muelle", "alcances": []string{security.AlcanceFacturasCrear}}
+	activo := func(v bool) map[string]bool { return map[string]bool{"activo": v} }
+	crearClave := func(t *testing.T, e *entorno) {
+		crearClaveAPI(t, e, rifEmpresa, security.AlcanceFacturasLeer)
+	}
+
+	casos := []casoRuta{
+		// Infraestructura
+		{nombre: "prueba", solicitud: solicitud{metodo: "GET", ruta: "/test"}, estado: http.StatusOK},
+		{nombre: "liveness", solicitud: solicitud{metodo: "GET", ruta: "/healthz"}, estado: http.StatusOK},
+		{nombre: "readiness", solicitud: solicitud{metodo: "GET", ruta: "/readyz"}, estado: http.StatusOK},
+		{nombre: "jwks", solicitud: solicitud{metodo: "GET", ruta: "/.well-known/jwks.json"}, estado: http.StatusOK},
+		{nombre: "metricas", solicitud: solicitud{metodo: "GET", ruta: "/metrics"}, estado: http.StatusOK},
+		{nombre: "openapi", solicitud: solicitud{metodo: "GET", ruta: "/openapi.json"}, estado: http.StatusOK},
+		{nombre: "docs", solicitud: solicitud{metodo: "GET", ruta: "/docs"}, estado: http.StatusOK},
+
+		// Sesiones y verificacion en dos pasos
+		{
+			nombre: "iniciar sesion", solicitud: solicitud{metodo: "POST", ruta: "/api/v2/sesiones", cuerpo: login},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/login", cuerpo: login}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				sesion := leerJSON[map[string]string](t, w)
+				if sesion["tipo"] != "Administrador" || sesion["rif_cedula"] != rifAdmin || sesion["token"] == "" {
+					t.Errorf("sesion inesperada: %v", sesion)
+				}
+			},
+		},
+		{
+			//Sin 2FA activo el token de desafio no sirve
+			nombre: "segundo factor", solicitud: solicitud{metodo: "POST", ruta: "/api/v2/sesiones/2fa"},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/login/2fa"}},
+			estado: http.StatusUnauthorized,
+		},
+		{
+			nombre: "inscribir 2fa", rol: rolEmpresa, solicitud: solicitud{metodo: "POST", ruta: "/api/v2/dos-factores"},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/2fa/inscribir"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if inscripcion := leerJSON[map[string]string](t, w); inscripcion["secreto"] == "" || !strings.HasPrefix(inscripcion["uri"], "otpauth://") {
+					t.Errorf("inscripcion inesperada: %v", inscripcion)
+				}
+			},
+		},
+		{
+			nombre: "confirmar 2fa sin inscripcion", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "POST", ruta: "/api/v2/dos-factores/confirmacion", cuerpo: map[string]string{"codigo": "123456"}},
+			v1:        []solicitud{{metodo: "POST", ruta: "/api/2fa/confirmar", cuerpo: map[string]string{"codigo": "123456"}}},
+			estado:    http.StatusNotFound,
+		},
+		{
+			nombre: "desactivar 2fa inactivo", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "DELETE", ruta: "/api/v2/dos-factores", cuerpo: map[string]string{"codigo": "123456"}},
+			v1:        []solicitud{{metodo: "POST", ruta: "/api/2fa/desactivar", cuerpo: map[string]string{"codigo": "123456"}}},
+			estado:    http.StatusNotFound,
+		},
+
+		// Facturas
+		{
+			nombre: "crear factura", rol: rolEmpleado,
+			solicitud: solicitud{metodo: "POST", ruta: "/api/v2/facturas", cuerpo: facturaNueva(rifEmpresa, matriculaFerry, "V-2")},
+			v1:        []solicitud{{metodo: "POST", ruta: "/api/factura/generar", cuerpo: facturaNueva(rifEmpresa, matriculaFerry, "V-2")}},
+			estado:    http.StatusCreated,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				id := leerJSON[struct {
+					ID int `json:"id_factura"`
+				}](t, w).ID
+				factura, err := e.st.Facturas.Obtener(context.Background(), id)
+				if err != nil || factura.IDViaje != "V-2" || !factura.Estado {
+					t.Errorf("factura %d no guardada: %+v, %v", id, factura, err)
+				}
+			},
+		},
+		{
+			nombre: "listar facturas de la empresa", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/facturas"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/facturas"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				pagina := leerJSON[store.Pagina[models.Factura]](t, w)
+				if pagina.Total != 1 || pagina.Elementos[0].RIFEmpresa != rifEmpresa {
+					t.Errorf("se esperaba solo la factura de la empresa: %+v", pagina)
+				}
+			},
+		},
+		{
+			nombre: "exportar facturas", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/facturas/exportacion"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/facturas/exportar"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if lineas := strings.Count(w.Body.String(), "\n"); !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") || lineas != 3 {
+					t.Errorf("CSV inesperado (%s, %d lineas):\n%s", w.Header().Get("Content-Type"), lineas, w.Body.String())
+				}
+			},
+		},
+		{
+			nombre: "obtener factura", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/facturas/1"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/factura/obtener/1"}},
+			estado: http.StatusOK,
+		},
+		{
+			nombre: "anular factura", rol: rolAdmin, solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/facturas/1/estado", cuerpo: activo(false)},
+			v1:     []solicitud{{metodo: "PUT", ruta: "/api/factura/1/estado/desactivar"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if factura, _ := e.st.Facturas.Obtener(context.Background(), 1); factura.Estado {
+					t.Error("la factura sigue activa")
+				}
+			},
+		},
+
+		// Empresas
+		{
+			nombre: "obtener empresa", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/empresas/" + rifEmpresa},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/empresas/buscar/" + rifEmpresa}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if etag := w.Header().Get("ETag"); etag != `"1"` {
+					t.Errorf("ETag %s, se esperaba \"1\"", etag)
+				}
+			},
+		},
+		{
+			nombre: "reemplazar empresa", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/empresas/" + rifEmpresa, cuerpo: empresa, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/empresas/actualizar/" + rifEmpresa, cuerpo: empresa}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				guardada, _ := e.st.Empresas.Obtener(context.Background(), rifEmpresa)
+				if w.Header().Get("ETag") != `"2"` || guardada.Email != empresa.Email || !guardada.Estado {
+					t.Errorf("empresa no actualizada (ETag %s): %+v", w.Header().Get("ETag"), guardada)
+				}
+			},
+		},
+		{
+			nombre: "parchear empresa", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PATCH", ruta: "/api/v2/empresas/" + rifEmpresa, cuerpo: `{"direccion":"Guanta"}`, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PATCH", ruta: "/api/empresas/actualizar/" + rifEmpresa, cuerpo: `{"direccion":"Guanta"}`}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if guardada, _ := e.st.Empresas.Obtener(context.Background(), rifEmpresa); guardada.Direccion != "Guanta" || guardada.Nombre != "Naviera del Caribe" {
+					t.Errorf("el parche no se aplico solo a la direccion: %+v", guardada)
+				}
+			},
+		},
+		{
+			nombre: "desactivar empresa", rol: rolAdmin,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/empresas/" + rifEmpresa + "/estado", cuerpo: activo(false)},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/empresas/" + rifEmpresa + "/desactivar"}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if guardada, _ := e.st.Empresas.Obtener(context.Background(), rifEmpresa); guardada.Estado {
+					t.Error("la empresa sigue activa")
+				}
+			},
+		},
+		{
+			nombre: "empleados de la empresa", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/empresas/" + rifEmpresa + "/empleados"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/empresas/" + rifEmpresa + "/empleados"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if pagina := leerJSON[store.Pagina[models.Empleados]](t, w); pagina.Total != 1 || pagina.Elementos[0].Cedula != cedulaEmpleado {
+					t.Errorf("empleados inesperados: %+v", pagina)
+				}
+			},
+		},
+		{
+			nombre: "ferrys de la empresa", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/empresas/" + rifEmpresa + "/ferrys"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/empresas/" + rifEmpresa + "/ferrys"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if pagina := leerJSON[store.Pagina[models.Ferry]](t, w); pagina.Total != 1 || pagina.Elementos[0].Matricula != matriculaFerry {
+					t.Errorf("ferrys inesperados: %+v", pagina)
+				}
+			},
+		},
+		{
+			nombre: "listar empresas", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/empresas"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/empresas"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if pagina := leerJSON[store.Pagina[models.Empresa]](t, w); pagina.Total != 2 {
+					t.Errorf("se esperaban 2 empresas: %+v", pagina)
+				}
+			},
+		},
+		{
+			nombre: "registrar empresa", rol: rolAdmin, solicitud: solicitud{metodo: "POST", ruta: "/api/v2/empresas", cuerpo: nuevaEmpresa},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/empresas/registrar", cuerpo: nuevaEmpresa}},
+			estado: http.StatusCreated,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				usuario, err := e.st.Usuarios.ObtenerPorUsuario(context.Background(), "margarita")
+				if err != nil || usuario.Rif_Cedula != "J-29876543-7" || usuario.Tipo != "empresa" {
+					t.Errorf("usuario de la empresa no creado: %+v, %v", usuario, err)
+				}
+			},
+		},
+
+		// Empleados
+		{
+			nombre: "registrar empleado", rol: rolEmpresa, solicitud: solicitud{metodo: "POST", ruta: "/api/v2/empleados", cuerpo: nuevoEmpleado},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/empleado/registrar", cuerpo: nuevoEmpleado}},
+			estado: http.StatusCreated,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if _, err := e.st.Empleados.Obtener(context.Background(), "V-21000000"); err != nil {
+					t.Errorf("empleado no creado: %v", err)
+				}
+			},
+		},
+		{
+			nombre: "obtener empleado", rol: rolEmpleado, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/empleados/" + cedulaEmpleado},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/empleado/buscar/" + cedulaEmpleado}},
+			estado: http.StatusOK,
+		},
+		{
+			nombre: "reemplazar empleado", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/empleados/" + cedulaEmpleado, cuerpo: empleado, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/empleado/actualizar/" + cedulaEmpleado, cuerpo: empleado}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				//La cedula y la empresa no se modifican aunque el cuerpo no las traiga
+				guardado, _ := e.st.Empleados.Obtener(context.Background(), cedulaEmpleado)
+				if guardado.Cargo != "Supervisora" || guardado.Rif_empresa != rifEmpresa {
+					t.Errorf("empleado no actualizado: %+v", guardado)
+				}
+			},
+		},
+		{
+			nombre: "parchear empleado", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PATCH", ruta: "/api/v2/empleados/" + cedulaEmpleado, cuerpo: `{"cargo":"Gerente"}`, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PATCH", ruta: "/api/empleado/actualizar/" + cedulaEmpleado, cuerpo: `{"cargo":"Gerente"}`}},
+			estado:    http.StatusOK,
+		},
+		{
+			nombre: "desactivar empleado", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/empleados/" + cedulaEmpleado + "/estado", cuerpo: activo(false)},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/empleado/desactivar/" + cedulaEmpleado}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if guardado, _ := e.st.Empleados.Obtener(context.Background(), cedulaEmpleado); guardado.Estado {
+					t.Error("el empleado sigue activo")
+				}
+			},
+		},
+		{
+			nombre: "activar empleado", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/empleados/" + cedulaEmpleado + "/estado", cuerpo: activo(true)},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/empleado/activar/" + cedulaEmpleado}},
+			estado:    http.StatusOK,
+			preparar: func(t *testing.T, e *entorno) {
+				if err := e.st.Empleados.CambiarEstado(context.Background(), cedulaEmpleado, false); err != nil {
+					t.Fatal(err)
+				}
+			},
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if guardado, _ := e.st.Empleados.Obtener(context.Background(), cedulaEmpleado); !guardado.Estado {
+					t.Error("el empleado sigue inactivo")
+				}
+			},
+		},
+
+		// Ferrys
+		{
+			nombre: "registrar ferry", rol: rolEmpresa, solicitud: solicitud{metodo: "POST", ruta: "/api/v2/ferrys", cuerpo: nuevoFerry},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/ferry/registrar", cuerpo: nuevoFerry}},
+			estado: http.StatusCreated,
+		},
+		{
+			nombre: "obtener ferry", rol: rolEmpleado, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/ferrys/" + matriculaFerry},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/ferry/buscar/" + matriculaFerry}},
+			estado: http.StatusOK,
+		},
+		{
+			nombre: "reemplazar ferry", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/ferrys/" + matriculaFerry, cuerpo: ferry, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/ferry/actualizar/" + matriculaFerry, cuerpo: ferry}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				guardado, _ := e.st.Ferrys.Obtener(context.Background(), matriculaFerry)
+				if guardado.CapacidadVIP != 60 || guardado.RifEmpresa != rifEmpresa {
+					t.Errorf("ferry no actualizado: %+v", guardado)
+				}
+			},
+		},
+		{
+			nombre: "parchear ferry", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PATCH", ruta: "/api/v2/ferrys/" + matriculaFerry, cuerpo: `{"capacidad_vip":45}`, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PATCH", ruta: "/api/ferry/actualizar/" + matriculaFerry, cuerpo: `{"capacidad_vip":45}`}},
+			estado:    http.StatusOK,
+		},
+
+		// Usuarios
+		{
+			nombre: "cambiar contrasena propia", rol: rolEmpresa,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/usuarios/yo/contrasena",
+				cuerpo: map[string]string{"contrasenaActual": contrasenaPrueba, "nuevaContrasena": "Muelle-Norte-2025"}},
+			v1: []solicitud{{metodo: "PUT", ruta: "/api/usuarios/" + rifEmpresa + "/contrasena-personal",
+				cuerpo: map[string]string{"contrasenaActual": contrasenaPrueba, "nuevaContrasena": "Muelle-Norte-2025"}}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				esperarEstado(t, e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/sesiones",
+					cuerpo: map[string]any{"usuario": map[string]string{"usuario": usuarioEmpresa, "contrasena": "Muelle-Norte-2025"}}}), http.StatusOK)
+			},
+		},
+		{
+			nombre: "obtener usuario", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/usuarios/" + rifEmpresa},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/usuario/" + rifEmpresa}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				usuario := leerJSON[map[string]any](t, w)
+				if _, expuesto := usuario["contrasena"]; usuario["usuario"] != usuarioEmpresa || expuesto {
+					t.Errorf("usuario inesperado o con hash expuesto: %v", usuario)
+				}
+			},
+		},
+		{
+			nombre: "reemplazar usuario", rol: rolAdmin,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/usuarios/" + rifEmpresa, cuerpo: map[string]string{"usuario": "naviera_caribe"}, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/usuario/" + rifEmpresa, cuerpo: map[string]string{"usuario": "naviera_caribe"}}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if _, err := e.st.Usuarios.ObtenerPorUsuario(context.Background(), "naviera_caribe"); err != nil {
+					t.Errorf("usuario no renombrado: %v", err)
+				}
+			},
+		},
+		{
+			nombre: "parchear usuario", rol: rolAdmin,
+			solicitud: solicitud{metodo: "PATCH", ruta: "/api/v2/usuarios/" + rifEmpresa, cuerpo: map[string]string{"contrasena": "Muelle-Norte-2025"}, cabeceras: ifMatch},
+			v1:        []solicitud{{metodo: "PATCH", ruta: "/api/usuario/" + rifEmpresa, cuerpo: map[string]string{"contrasena": "Muelle-Norte-2025"}}},
+			estado:    http.StatusOK,
+		},
+		{
+			nombre: "listar usuarios", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/usuarios"},
+			v1:     []solicitud{{metodo: "GET", ruta: "/api/usuarios"}},
+			estado: http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				pagina := leerJSON[store.Pagina[map[string]any]](t, w)
+				if pagina.Total != 4 {
+					t.Errorf("se esperaban 4 usuarios: %+v", pagina)
+				}
+				for _, u := range pagina.Elementos {
+					if _, expuesto := u["contrasena"]; expuesto {
+						t.Errorf("el listado expone el hash de %v", u["usuario"])
+					}
+				}
+			},
+		},
+		{
+			nombre: "registrar usuario", rol: rolAdmin,
+			solicitud: solicitud{metodo: "POST", ruta: "/api/v2/usuarios",
+				cuerpo: map[string]string{"rif_cedula": "V-11000000", "usuario": "supervisor", "contrasena": contrasenaPrueba, "tipo": "Administrador"}},
+			v1: []solicitud{{metodo: "POST", ruta: "/api/usuario/registrar",
+				cuerpo: map[string]string{"rif_cedula": "V-11000000", "usuario": "supervisor", "contrasena": contrasenaPrueba, "tipo": "Administrador"}}},
+			estado: http.StatusCreated,
+		},
+		{
+			nombre: "desactivar usuario", rol: rolAdmin,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/usuarios/" + rifEmpresa + "/estado", cuerpo: activo(false)},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/usuarios/" + rifEmpresa + "/desactivar"}},
+			estado:    http.StatusOK,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				w = e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/sesiones",
+					cuerpo: map[string]any{"usuario": map[string]string{"usuario": usuarioEmpresa, "contrasena": contrasenaPrueba}}})
+				esperarEstado(t, w, http.StatusUnauthorized)
+			},
+		},
+		{
+			nombre: "restablecer contrasena", rol: rolAdmin,
+			solicitud: solicitud{metodo: "PUT", ruta: "/api/v2/usuarios/" + rifEmpresa + "/contrasena", cuerpo: map[string]string{"nuevaContrasena": "Muelle-Norte-2025"}},
+			v1:        []solicitud{{metodo: "PUT", ruta: "/api/usuario/" + rifEmpresa + "/cambiar-contrasena", cuerpo: map[string]string{"nuevaContrasena": "Muelle-Norte-2025"}}},
+			estado:    http.StatusOK,
+		},
+		{
+			nombre: "desbloquear usuario", rol: rolAdmin, solicitud: solicitud{metodo: "DELETE", ruta: "/api/v2/usuarios/" + rifEmpresa + "/bloqueo"},
+			v1:     []solicitud{{metodo: "PUT", ruta: "/api/usuarios/" + rifEmpresa + "/desbloquear"}},
+			estado: http.StatusOK,
+		},
+
+		// Claves API
+		{
+			nombre: "crear clave api", rol: rolEmpresa, solicitud: solicitud{metodo: "POST", ruta: "/api/v2/claves-api", cuerpo: nuevaClave},
+			v1:     []solicitud{{metodo: "POST", ruta: "/api/claves-api", cuerpo: nuevaClave}},
+			estado: http.StatusCreated,
+		},
+		{
+			nombre: "listar claves api", rol: rolEmpresa, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/claves-api"},
+			v1:       []solicitud{{metodo: "GET", ruta: "/api/claves-api"}},
+			estado:   http.StatusOK,
+			preparar: crearClave,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if claves := leerJSON[[]models.ClaveAPI](t, w); len(claves) != 1 {
+					t.Errorf("se esperaba una clave: %+v", claves)
+				}
+			},
+		},
+		{
+			nombre: "revocar clave api", rol: rolEmpresa, solicitud: solicitud{metodo: "DELETE", ruta: "/api/v2/claves-api/1"},
+			v1:       []solicitud{{metodo: "DELETE", ruta: "/api/claves-api/1"}},
+			estado:   http.StatusOK,
+			preparar: crearClave,
+		},
+
+		// Auditoria
+		{
+			nombre: "listar auditoria", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/auditoria"},
+			v1:       []solicitud{{metodo: "GET", ruta: "/api/auditoria"}},
+			estado:   http.StatusOK,
+			preparar: desactivarEmpleado,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if pagina := leerJSON[store.Pagina[models.RegistroAuditoria]](t, w); pagina.Total != 1 || pagina.Elementos[0].Accion != "desactivar" {
+					t.Errorf("auditoria inesperada: %+v", pagina)
+				}
+			},
+		},
+		{
+			nombre: "verificar auditoria", rol: rolAdmin, solicitud: solicitud{metodo: "GET", ruta: "/api/v2/auditoria/verificacion"},
+			v1:       []solicitud{{metodo: "GET", ruta: "/api/auditoria/verificar"}},
+			estado:   http.StatusOK,
+			preparar: desactivarEmpleado,
+			comprobar: func(t *testing.T, e *entorno, w *httptest.ResponseRecorder) {
+				if verificacion := leerJSON[store.VerificacionAuditoria](t, w); !verificacion.Valida || verificacion.Registros != 1 {
+					t.Errorf("verificacion inesperada: %+v", verificacion)
+				}
+			},
+		},
+	}
+
+	//El token de desafio se firma aqui porque necesita las claves de TestMain
+	for i := range casos {
+		if casos[i].ruta == "/api/v2/sesiones/2fa" {
+			desafio := map[string]string{"token_desafio": firmarToken(t, rifEmpresa, "empresa", middlewares.PropositoDesafio2FA), "codigo": "123456"}
+			casos[i].cuerpo, casos[i].v1[0].cuerpo = desafio, desafio
+		}
+	}
+
+	for _, c := range casos {
+		t.Run(c.nombre, c.probar)
+	}
+}
+
+// desactivarEmpleado deja un registro en la auditoria pasando por la API
+func desactivarEmpleado(t *testing.T, e *entorno) {
+	t.Helper()
+	w := e.como(t, rolEmpresa, "PUT", "/api/v2/empleados/"+cedulaEmpleado+"/estado", map[string]bool{"activo": false})
+	esperarEstado(t, w, http.StatusOK)
+}
+
+// crearClaveAPI guarda una clave para la empresa y devuelve la clave completa
+func crearClaveAPI(t *testing.T, e *entorno, rif string, alcances ...string) string {
+	t.Helper()
+	generada, err := security.GenerarClaveAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clave := models.ClaveAPI{Prefijo: generada.Prefijo, RifEmpresa: rif, Nombre: "Prueba", Alcances: alcances, Creada: time.Now().UTC()}
+	if _, err := e.st.ClavesAPI.Crear(context.Background(), clave, generada.Hash, rif); err != nil {
+		t.Fatal(err)
+	}
+	return generada.Clave
+}
+
+// Sin token las rutas protegidas responden 401, y con el rol equivocado 403
+func TestIntegracionAutorizacion(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	soloAdmin := []solicitud{
+		{metodo: "GET", ruta: "/api/v2/empresas"},
+		{metodo: "POST", ruta: "/api/v2/empresas", cuerpo: "{}"},
+		{metodo: "GET", ruta: "/api/v2/usuarios"},
+		{metodo: "POST", ruta: "/api/v2/usuarios", cuerpo: "{}"},
+		{metodo: "PUT", ruta: "/api/v2/usuarios/" + rifEmpresa + "/estado", cuerpo: `{"activo":false}`},
+		{metodo: "PUT", ruta: "/api/v2/usuarios/" + rifEmpresa + "/contrasena", cuerpo: "{}"},
+		{metodo: "DELETE", ruta: "/api/v2/usuarios/" + rifEmpresa + "/bloqueo"},
+		{metodo: "GET", ruta: "/api/v2/auditoria"},
+		{metodo: "GET", ruta: "/api/v2/auditoria/verificacion"},
+	}
+	soloEmpresa := []solicitud{
+		{metodo: "POST", ruta: "/api/v2/claves-api", cuerpo: "{}"},
+		{metodo: "GET", ruta: "/api/v2/claves-api"},
+		{metodo: "DELETE", ruta: "/api/v2/claves-api/1"},
+	}
+
+	for _, s := range soloAdmin {
+		for _, rol := range []string{rolEmpresa, rolEmpleado} {
+			s.token = e.tokens[rol]
+			if w := e.pedir(t, s); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s como %s: estado %d, se esperaba 403", s.metodo, s.ruta, rol, w.Code)
+			}
+		}
+	}
+	for _, s := range soloEmpresa {
+		for _, rol := range []string{rolAdmin, rolEmpleado} {
+			s.token = e.tokens[rol]
+			if w := e.pedir(t, s); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s como %s: estado %d, se esperaba 403", s.metodo, s.ruta, rol, w.Code)
+			}
+		}
+	}
+
+	//Toda operacion con seguridad en el documento OpenAPI exige credenciales
+	publicas := map[string]bool{}
+	for _, ruta := range []string{
+		"GET /test", "GET /healthz", "GET /readyz", "GET /.well-known/jwks.json", "GET /metrics",
+		"GET /openapi.json", "GET /docs", "POST /api/v2/sesiones", "POST /api/v2/sesiones/2fa",
+		"POST /api/login", "POST /api/login/2fa",
+	} {
+		publicas[ruta] = true
+	}
+	for _, operacion := range openapi.Construir().Operaciones() {
+		if publicas[operacion] {
+			continue
+		}
+		metodo, patron, _ := strings.Cut(operacion, " ")
+		ruta := strings.NewReplacer("{rif}", rifEmpresa, "{cedula}", cedulaEmpleado, "{matricula}", matriculaFerry,
+			"{rif_cedula}", rifEmpresa, "{id}", "1", "{accion}", "activar").Replace(patron)
+		if w := e.pedir(t, solicitud{metodo: metodo, ruta: ruta, cuerpo: "{}"}); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s sin token: estado %d, se esperaba 401", operacion, w.Code)
+		}
+	}
+}
+
+// El registro de una empresa crea empresa y usuario en una transaccion: si el usuario
+// ya existe no queda la empresa a medias
+func TestIntegracionRegistroTransaccional(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	w := e.como(t, rolAdmin, "POST", "/api/v2/empresas", map[string]any{
+		"empresa": models.Empresa{RIF: "J-29876543-7", Nombre: "Naviera de Margarita", Email: "info@margarita.com"},
+		"usuario": map[string]string{"usuario": usuarioEmpresa, "contrasena": contrasenaPrueba},
+	})
+	esperarEstado(t, w, http.StatusConflict)
+	if _, err := e.st.Empresas.Obtener(context.Background(), "J-29876543-7"); err == nil {
+		t.Error("la empresa se guardo aunque fallo la creacion del usuario")
+	}
+
+	//Lo mismo con el empleado, y ademas con una empresa inexistente
+	w = e.como(t, rolEmpresa, "POST", "/api/v2/empleados", map[string]any{
+		"empleado": models.Empleados{Cedula: "V-21000000", Nombres: "Jose", Apellidos: "Lara", Rif_empresa: "G-20000001-5",
+			Email: "jose@naviera.com", Cargo: "Taquillero", Numero_tlf: "0412-1234567"},
+		"usuario": map[string]string{"usuario": "taquilla2", "contrasena": contrasenaPrueba},
+	})
+	esperarEstado(t, w, http.StatusBadRequest)
+	if _, err := e.st.Usuarios.ObtenerPorUsuario(context.Background(), "taquilla2"); err == nil {
+		t.Error("el usuario se guardo aunque fallo la creacion del empleado")
+	}
+}
+
+// La auditoria se escribe en la transaccion del cambio: si no se puede registrar, el cambio
+// no se guarda y la solicitud falla
+func TestIntegracionAuditoriaTransaccional(t *testing.T) {
+	e := nuevoEntorno(t)
+	ctx := context.Background()
+
+	conexion, err := pgx.Connect(ctx, e.cfg.BaseDatos.Conexion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conexion.Close(ctx)
+	if _, err := conexion.Exec(ctx, `ALTER TABLE auditoria ADD CONSTRAINT prueba_sin_ferrys CHECK (entidad <> 'ferry')`); err != nil {
+		t.Fatal(err)
+	}
+
+	ferry := models.Ferry{Matricula: "AMV-5555", RifEmpresa: rifEmpresa, Nombre: "Brisa", Modelo: "Ro-Pax", CapacidadEconomica: 200, CapacidadVIP: 10}
+	esperarEstado(t, e.como(t, rolEmpresa, "POST", "/api/v2/ferrys", ferry), http.StatusInternalServerError)
+	if _, err := e.st.Ferrys.Obtener(ctx, ferry.Matricula); err == nil {
+		t.Error("el ferry se guardo sin su registro de auditoria")
+	}
+
+	w := e.pedir(t, solicitud{metodo: "PATCH", ruta: "/api/v2/ferrys/" + matriculaFerry, token: e.tokens[rolEmpresa],
+		cuerpo: `{"capacidad_vip":50}`, cabeceras: map[string]string{"If-Match": `"1"`}})
+	esperarEstado(t, w, http.StatusInternalServerError)
+	if actual, err := e.st.Ferrys.Obtener(ctx, matriculaFerry); err != nil || actual.Version != 1 {
+		t.Errorf("la edicion se aplico sin su registro de auditoria (version %d, %v)", actual.Version, err)
+	}
+}
+
+// Concurrencia optimista: una version obsoleta o sin If-Match no sobrescribe cambios
+func TestIntegracionVersiones(t *testing.T) {
+	e := nuevoEntorno(t)
+	ruta := "/api/v2/ferrys/" + matriculaFerry
+	parche := `{"capacidad_vip":50}`
+
+	esperarEstado(t, e.pedir(t, solicitud{metodo: "PATCH", ruta: ruta, token: e.tokens[rolEmpresa], cuerpo: parche}), http.StatusPreconditionRequired)
+	w := e.pedir(t, solicitud{metodo: "PATCH", ruta: ruta, token: e.tokens[rolEmpresa], cuerpo: parche, cabeceras: map[string]string{"If-Match": `"1"`}})
+	esperarEstado(t, w, http.StatusOK)
+	w = e.pedir(t, solicitud{metodo: "PATCH", ruta: ruta, token: e.tokens[rolEmpresa], cuerpo: parche, cabeceras: map[string]string{"If-Match": `"1"`}})
+	esperarEstado(t, w, http.StatusPreconditionFailed)
+
+	w = e.pedir(t, solicitud{metodo: "GET", ruta: ruta, token: e.tokens[rolEmpresa], cabeceras: map[string]string{"If-None-Match": `"2"`}})
+	esperarEstado(t, w, http.StatusNotModified)
+}
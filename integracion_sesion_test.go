@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// iniciarSesion llama a POST /api/v2/sesiones
+func (e *entorno) iniciarSesion(t *testing.T, usuario, contrasena string) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/sesiones",
+		cuerpo: map[string]any{"usuario": map[string]string{"usuario": usuario, "contrasena": contrasena}}})
+}
+
+// Cada rol inicia sesion y el token obtenido sirve en una ruta protegida
+func TestIntegracionSesionPorRol(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	roles := []struct{ usuario, tipo, rifCedula string }{
+		{usuarioAdmin, "Administrador", rifAdmin},
+		{usuarioEmpresa, "empresa", rifEmpresa},
+		{usuarioEmpleado, "empleado", cedulaEmpleado},
+	}
+	for _, rol := range roles {
+		t.Run(rol.tipo, func(t *testing.T) {
+			w := e.iniciarSesion(t, rol.usuario, contrasenaPrueba)
+			esperarEstado(t, w, http.StatusOK)
+			sesion := leerJSON[map[string]string](t, w)
+			if sesion["tipo"] != rol.tipo || sesion["rif_cedula"] != rol.rifCedula {
+				t.Fatalf("sesion inesperada: %v", sesion)
+			}
+
+			w = e.pedir(t, solicitud{metodo: "GET", ruta: "/api/v2/usuarios/" + rol.rifCedula, token: sesion["token"]})
+			esperarEstado(t, w, http.StatusOK)
+		})
+	}
+
+	w := e.iniciarSesion(t, usuarioEmpresa, "Otra-Contrasena-1")
+	esperarEstado(t, w, http.StatusUnauthorized)
+	if codigo := codigoError(t, w); codigo != helpers.CodigoCredencialesInvalidas {
+		t.Errorf("codigo %s, se esperaba %s", codigo, helpers.CodigoCredencialesInvalidas)
+	}
+	//Un usuario inexistente responde igual que una contraseña incorrecta
+	w = e.iniciarSesion(t, "nadie", contrasenaPrueba)
+	esperarEstado(t, w, http.StatusUnauthorized)
+	if codigo := codigoError(t, w); codigo != helpers.CodigoCredencialesInvalidas {
+		t.Errorf("codigo %s, se esperaba %s", codigo, helpers.CodigoCredencialesInvalidas)
+	}
+}
+
+// Tras los intentos fallidos permitidos el usuario queda bloqueado hasta que un administrador lo libera
+func TestIntegracionBloqueoLogin(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	for range e.cfg.Login.MaxIntentosUsuario {
+		esperarEstado(t, e.iniciarSesion(t, usuarioEmpresa, "Otra-Contrasena-1"), http.StatusUnauthorized)
+	}
+
+	//Bloqueado incluso con la contraseña correcta
+	w := e.iniciarSesion(t, usuarioEmpresa, contrasenaPrueba)
+	esperarEstado(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("falta Retry-After en la respuesta 429")
+	}
+
+	esperarEstado(t, e.como(t, rolAdmin, "DELETE", "/api/v2/usuarios/"+rifEmpresa+"/bloqueo", nil), http.StatusOK)
+	esperarEstado(t, e.iniciarSesion(t, usuarioEmpresa, contrasenaPrueba), http.StatusOK)
+}
+
+// Detras de un proxy de confianza el bloqueo por IP usa la del cliente en X-Forwarded-For,
+// no la del proxy, que comparten todos los clientes
+func TestIntegracionBloqueoIPDetrasDeProxy(t *testing.T) {
+	//httptest usa 192.0.2.1 como IP de la conexion
+	e := nuevoEntorno(t, func(cfg *config.Config) {
+		cfg.Servidor.ProxiesConfiables = []string{"192.0.2.0/24"}
+		cfg.Login.MaxIntentosIP, cfg.Login.MaxIntentosUsuario = 3, 100
+	})
+	desde := func(ip, usuario string) *httptest.ResponseRecorder {
+		t.Helper()
+		return e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/sesiones", cabeceras: map[string]string{"X-Forwarded-For": ip},
+			cuerpo: map[string]any{"usuario": map[string]string{"usuario": usuario, "contrasena": "Otra-Contrasena-1"}}})
+	}
+
+	for i := range e.cfg.Login.MaxIntentosIP {
+		esperarEstado(t, desde("203.0.113.7", fmt.Sprintf("nadie%d", i)), http.StatusUnauthorized)
+	}
+	esperarEstado(t, desde("203.0.113.7", usuarioEmpresa), http.StatusTooManyRequests)
+	//Otro cliente detras del mismo proxy no queda bloqueado
+	esperarEstado(t, desde("203.0.113.8", usuarioEmpresa), http.StatusUnauthorized)
+}
+
+func TestIntegracionCuentaInactiva(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	esperarEstado(t, e.como(t, rolAdmin, "PUT", "/api/v2/usuarios/"+cedulaEmpleado+"/estado", map[string]bool{"activo": false}), http.StatusOK)
+
+	w := e.iniciarSesion(t, usuarioEmpleado, contrasenaPrueba)
+	esperarEstado(t, w, http.StatusUnauthorized)
+	if codigo := codigoError(t, w); codigo != helpers.CodigoCuentaInactiva {
+		t.Errorf("codigo %s, se esperaba %s", codigo, helpers.CodigoCuentaInactiva)
+	}
+	//Con una contraseña incorrecta no se revela que la cuenta esta inactiva
+	w = e.iniciarSesion(t, usuarioEmpleado, "Otra-Contrasena-1")
+	if codigo := codigoError(t, w); codigo != helpers.CodigoCredencialesInvalidas {
+		t.Errorf("codigo %s, se esperaba %s", codigo, helpers.CodigoCredencialesInvalidas)
+	}
+}
+
+// Inscripcion, inicio de sesion con segundo factor, codigos de un solo uso y desactivacion
+func TestIntegracionDosFactores(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	secreto, paso, recuperacion := e.inscribir2FA(t, rolEmpresa)
+
+	//Ya inscrito no se puede volver a inscribir
+	esperarEstado(t, e.como(t, rolEmpresa, "POST", "/api/v2/dos-factores", nil), http.StatusConflict)
+
+	desafio := func() string {
+		t.Helper()
+		w := e.iniciarSesion(t, usuarioEmpresa, contrasenaPrueba)
+		esperarEstado(t, w, http.StatusOK)
+		respuesta := leerJSON[map[string]any](t, w)
+		if respuesta["requiere_2fa"] != true || respuesta["token"] != nil {
+			t.Fatalf("se esperaba el desafio 2FA: %v", respuesta)
+		}
+		return respuesta["token_desafio"].(string)
+	}
+	segundoFactor := func(cuerpo map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		return e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/sesiones/2fa", cuerpo: cuerpo})
+	}
+
+	//El token de desafio no sirve como sesion
+	esperarEstado(t, e.pedir(t, solicitud{metodo: "GET", ruta: "/api/v2/usuarios/" + rifEmpresa, token: desafio()}), http.StatusUnauthorized)
+
+	//El codigo usado al confirmar no se puede reutilizar
+	w := segundoFactor(map[string]string{"token_desafio": desafio(), "codigo": codigoTOTP(t, secreto, paso)})
+	esperarEstado(t, w, http.StatusUnauthorized)
+
+	w = segundoFactor(map[string]string{"token_desafio": desafio(), "codigo_recuperacion": recuperacion[0]})
+	esperarEstado(t, w, http.StatusOK)
+	sesion := leerJSON[map[string]string](t, w)["token"]
+
+	//Los codigos de recuperacion se consumen
+	esperarEstado(t, segundoFactor(map[string]string{"token_desafio": desafio(), "codigo_recuperacion": recuperacion[0]}), http.StatusUnauthorized)
+
+	//Tampoco sirve para desactivar el 2FA
+	w = e.pedir(t, solicitud{metodo: "DELETE", ruta: "/api/v2/dos-factores", token: sesion, cuerpo: map[string]string{"codigo": codigoTOTP(t, secreto, paso)}})
+	esperarEstado(t, w, http.StatusUnauthorized)
+	w = e.pedir(t, solicitud{metodo: "DELETE", ruta: "/api/v2/dos-factores", token: sesion, cuerpo: map[string]string{"codigo": codigoTOTP(t, secreto, paso+1)}})
+	esperarEstado(t, w, http.StatusOK)
+
+	w = e.iniciarSesion(t, usuarioEmpresa, contrasenaPrueba)
+	esperarEstado(t, w, http.StatusOK)
+	if leerJSON[map[string]any](t, w)["token"] == nil {
+		t.Error("sin 2FA el inicio de sesion debe devolver el token directamente")
+	}
+}
+
+// Los codigos erroneos al desactivar el 2FA cuentan para el bloqueo del segundo factor
+func TestIntegracionDesactivarDosFactoresBloqueo(t *testing.T) {
+	e := nuevoEntorno(t)
+	secreto, paso, _ := e.inscribir2FA(t, rolEmpresa)
+
+	for range e.cfg.Login.MaxIntentosUsuario {
+		esperarEstado(t, e.como(t, rolEmpresa, "DELETE", "/api/v2/dos-factores", map[string]string{"codigo": "000000"}), http.StatusUnauthorized)
+	}
+	//Bloqueado incluso con un codigo valido
+	w := e.como(t, rolEmpresa, "DELETE", "/api/v2/dos-factores", map[string]string{"codigo": codigoTOTP(t, secreto, paso+1)})
+	esperarEstado(t, w, http.StatusTooManyRequests)
+}
+
+// Los codigos erroneos al confirmar la inscripcion tambien cuentan para el bloqueo
+func TestIntegracionConfirmarDosFactoresBloqueo(t *testing.T) {
+	e := nuevoEntorno(t)
+	w := e.como(t, rolEmpresa, "POST", "/api/v2/dos-factores", nil)
+	esperarEstado(t, w, http.StatusOK)
+	secreto := leerJSON[map[string]string](t, w)["secreto"]
+
+	for range e.cfg.Login.MaxIntentosUsuario {
+		esperarEstado(t, e.como(t, rolEmpresa, "POST", "/api/v2/dos-factores/confirmacion", map[string]string{"codigo": "000000"}), http.StatusUnauthorized)
+	}
+	//Bloqueado incluso con un codigo valido
+	w = e.como(t, rolEmpresa, "POST", "/api/v2/dos-factores/confirmacion", map[string]string{"codigo": codigoTOTP(t, secreto, security.PasoTOTP(time.Now()))})
+	esperarEstado(t, w, http.StatusTooManyRequests)
+}
+
+// inscribir2FA activa el 2FA del rol y devuelve el secreto, el paso usado al confirmar y
+// los codigos de recuperacion
+func (e *entorno) inscribir2FA(t *testing.T, rol string) (string, int64, []string) {
+	t.Helper()
+	w := e.como(t, rol, "POST", "/api/v2/dos-factores", nil)
+	esperarEstado(t, w, http.StatusOK)
+	secreto := leerJSON[map[string]string](t, w)["secreto"]
+
+	paso := security.PasoTOTP(time.Now())
+	w = e.como(t, rol, "POST", "/api/v2/dos-factores/confirmacion", map[string]string{"codigo": codigoTOTP(t, secreto, paso)})
+	esperarEstado(t, w, http.StatusOK)
+	recuperacion := leerJSON[struct {
+		Codigos []string `json:"codigos_recuperacion"`
+	}](t, w).Codigos
+	if len(recuperacion) == 0 {
+		t.Fatal("no se entregaron codigos de recuperacion")
+	}
+	return secreto, paso, recuperacion
+}
+
+// Un rol con 2FA obligatorio solo recibe un token de inscripcion, que no vale para el resto de la API
+func TestIntegracionDosFactoresObligatorio(t *testing.T) {
+	e := nuevoEntorno(t, func(cfg *config.Config) {
+		cfg.TOTP.RolesObligatorios = []string{"Administrador"}
+	})
+
+	w := e.iniciarSesion(t, usuarioAdmin, contrasenaPrueba)
+	esperarEstado(t, w, http.StatusOK)
+	respuesta := leerJSON[map[string]any](t, w)
+	if respuesta["requiere_inscripcion_2fa"] != true {
+		t.Fatalf("se esperaba la inscripcion obligatoria: %v", respuesta)
+	}
+	inscripcion := respuesta["token"].(string)
+
+	esperarEstado(t, e.pedir(t, solicitud{metodo: "GET", ruta: "/api/v2/empresas", token: inscripcion}), http.StatusUnauthorized)
+	w = e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/dos-factores", token: inscripcion})
+	esperarEstado(t, w, http.StatusOK)
+	secreto := leerJSON[map[string]string](t, w)["secreto"]
+
+	w = e.pedir(t, solicitud{metodo: "POST", ruta: "/api/v2/dos-factores/confirmacion", token: inscripcion,
+		cuerpo: map[string]string{"codigo": codigoTOTP(t, secreto, security.PasoTOTP(time.Now()))}})
+	esperarEstado(t, w, http.StatusOK)
+
+	//Con el rol obligado no se puede desactivar
+	esperarEstado(t, e.como(t, rolAdmin, "DELETE", "/api/v2/dos-factores", map[string]string{"codigo": "123456"}), http.StatusForbidden)
+}
+
+// Tokens que no deben aceptarse: expirados, firmados con otra clave, restringidos o mal formados
+func TestIntegracionTokensInvalidos(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	expirado, err := middlewares.FirmarToken(&middlewares.Claims{
+		UsuarioID: rifAdmin, TipoUsuario: "Administrador",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ajenas, err := security.ConjuntoClavesEfimero()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ajeno, err := ajenas.Firmar(&middlewares.Claims{
+		UsuarioID: rifAdmin, TipoUsuario: "Administrador",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Firmados con la clave correcta pero para otro emisor o audiencia
+	jwtPruebas := e.cfg.JWT
+	conRegistrados := func(emisor, audiencia string) string {
+		t.Helper()
+		token, err := clavesPruebas.Firmar(&middlewares.Claims{
+			UsuarioID: rifAdmin, TipoUsuario: "Administrador",
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: emisor, Audience: jwt.ClaimStrings{audiencia},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	casos := map[string]string{
+		"expirado":        "Bearer " + expirado,
+		"otra clave":      "Bearer " + ajeno,
+		"otro emisor":     "Bearer " + conRegistrados("otro-servicio", jwtPruebas.Audiencia),
+		"otra audiencia":  "Bearer " + conRegistrados(jwtPruebas.Emisor, "otro-servicio"),
+		"sin emisor":      "Bearer " + conRegistrados("", jwtPruebas.Audiencia),
+		"desafio 2fa":     "Bearer " + firmarToken(t, rifAdmin, "Administrador", middlewares.PropositoDesafio2FA),
+		"inscripcion 2fa": "Bearer " + firmarToken(t, rifAdmin, "Administrador", middlewares.PropositoInscripcion2FA),
+		"sin Bearer":      e.tokens[rolAdmin],
+		"alterado":        "Bearer " + e.tokens[rolAdmin][:len(e.tokens[rolAdmin])-4] + "AAAA",
+		"basura":          "Bearer abc.def.ghi",
+	}
+	for nombre, autorizacion := range casos {
+		t.Run(nombre, func(t *testing.T) {
+			w := e.pedir(t, solicitud{metodo: "GET", ruta: "/api/v2/empresas", cabeceras: map[string]string{"Authorization": autorizacion}})
+			esperarEstado(t, w, http.StatusUnauthorized)
+			if codigo := codigoError(t, w); codigo != helpers.CodigoNoAutenticado {
+				t.Errorf("codigo %s, se esperaba %s", codigo, helpers.CodigoNoAutenticado)
+			}
+		})
+	}
+
+	//Un token valido de otro usuario no da permisos de administrador
+	w := e.pedir(t, solicitud{metodo: "GET", ruta: "/api/v2/empresas", token: e.tokens[rolEmpresa]})
+	esperarEstado(t, w, http.StatusForbidden)
+}
+
+func codigoTOTP(t *testing.T, secreto string, paso int64) string {
+	t.Helper()
+	codigo, err := security.CodigoTOTP(secreto, paso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codigo
+}
@@ -0,0 +1,512 @@
+package main
+
+// Pruebas de integracion: cada prueba recibe una base PostgreSQL propia, copiada de una
+// plantilla con todas las migraciones, y ejercita el router completo con httptest.
+//
+// La base se obtiene de una de estas formas, en orden:
+//   - PRUEBAS_DATABASE_URL: servidor existente (URL postgres://...). El usuario debe poder
+//     crear bases; se crean y eliminan bases ferry_prueba_* en ese servidor.
+//   - initdb y pg_ctl de PRUEBAS_POSTGRES_BIN, del PATH o de /usr/lib/postgresql/*/bin: se
+//     arranca un servidor desechable en un directorio temporal, solo por socket Unix.
+//
+// Si no hay ninguna, las pruebas de integracion fallan: un "go test ./..." en verde debe
+// significar que se ejecutaron. Para omitirlas a proposito (por ejemplo en una maquina sin
+// PostgreSQL) se define PRUEBAS_SIN_POSTGRES=1 y el resto se ejecuta igual.
+// Requiere PostgreSQL 13 o superior.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/database"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/handlers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/openapi"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Datos sembrados en cada base de prueba
+const (
+	contrasenaPrueba = "Travesia-Segura-2024"
+
+	rifAdmin       = "V-10000000"
+	rifEmpresa     = "J-12345678-4"
+	rifOtraEmpresa = "J-87654321-3"
+	cedulaEmpleado = "V-20000000"
+	matriculaFerry = "AMV-1234"
+	matriculaOtra  = "AMV-9876"
+
+	usuarioAdmin       = "admin"
+	usuarioEmpresa     = "naviera"
+	usuarioOtraEmpresa = "otra_naviera"
+	usuarioEmpleado    = "taquilla"
+)
+
+// Roles con los que se firman los tokens de las pruebas
+const (
+	rolAdmin       = "admin"
+	rolEmpresa     = "empresa"
+	rolOtraEmpresa = "otra_empresa"
+	rolEmpleado    = "empleado"
+)
+
+var (
+	servidorPruebas *postgresPruebas
+	//Motivo por el que no se pudo iniciar PostgreSQL
+	errPostgres error
+	//Claves de firma compartidas: middlewares las guarda en una variable del paquete
+	clavesPruebas *security.ConjuntoClaves
+	//Rutas ("METODO /patron") que alguna prueba de integracion alcanzo
+	rutasEjercitadas sync.Map
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	var err error
+	if clavesPruebas, err = security.ConjuntoClavesEfimero(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	jwtPruebas := config.PorDefecto().JWT
+	middlewares.ConfigurarClavesJWT(clavesPruebas, jwtPruebas.Emisor, jwtPruebas.Audiencia)
+
+	servidorPruebas, errPostgres = iniciarPostgres()
+
+	codigo := m.Run()
+
+	if servidorPruebas != nil {
+		//Con la suite completa, cada ruta debe haberse probado al menos una vez
+		if codigo == 0 && flag.Lookup("test.run").Value.String() == "" {
+			if faltantes := rutasSinEjercitar(); len(faltantes) > 0 {
+				fmt.Fprintf(os.Stderr, "rutas sin prueba de integracion:\n  %s\n", strings.Join(faltantes, "\n  "))
+				codigo = 1
+			}
+		}
+		servidorPruebas.detener()
+	}
+	os.Exit(codigo)
+}
+
+func rutasSinEjercitar() []string {
+	var faltantes []string
+	for _, ruta := range openapi.Construir().Operaciones() {
+		if _, ok := rutasEjercitadas.Load(ruta); !ok {
+			faltantes = append(faltantes, ruta)
+		}
+	}
+	return faltantes
+}
+
+// postgresPruebas es el servidor de las pruebas y la plantilla ya migrada
+type postgresPruebas struct {
+	url       string // Base de mantenimiento, para crear y eliminar las de prueba
+	admin     *pgxpool.Pool
+	plantilla string
+	creadas   atomic.Int64
+	parar     func()
+}
+
+func iniciarPostgres() (*postgresPruebas, error) {
+	url, parar, err := servidorPostgres()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err == nil {
+		err = admin.Ping(ctx)
+	}
+	if err != nil {
+		parar()
+		return nil, fmt.Errorf("no se pudo conectar a %s: %w", url, err)
+	}
+
+	p := &postgresPruebas{url: url, admin: admin, parar: parar, plantilla: fmt.Sprintf("ferry_prueba_%d_plantilla", os.Getpid())}
+	if err := p.crearPlantilla(ctx); err != nil {
+		p.detener()
+		return nil, err
+	}
+	return p, nil
+}
+
+// La plantilla se migra una sola vez; cada prueba la copia con CREATE DATABASE ... TEMPLATE
+func (p *postgresPruebas) crearPlantilla(ctx context.Context) error {
+	if _, err := p.admin.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{p.plantilla}.Sanitize()); err != nil {
+		return fmt.Errorf("error creando la base plantilla: %w", err)
+	}
+
+	pool, err := pgxpool.New(ctx, p.urlBase(p.plantilla))
+	if err != nil {
+		return err
+	}
+	//La plantilla no puede tener conexiones abiertas al copiarla
+	defer pool.Close()
+
+	migrador, err := database.NuevoMigrador(pool)
+	if err != nil {
+		return err
+	}
+	if _, err := migrador.Subir(ctx); err != nil {
+		return fmt.Errorf("error migrando la plantilla: %w", err)
+	}
+	return nil
+}
+
+// nuevaBase crea una base copiada de la plantilla y la elimina al terminar la prueba
+func (p *postgresPruebas) nuevaBase(t *testing.T) string {
+	t.Helper()
+	nombre := fmt.Sprintf("ferry_prueba_%d_%d", os.Getpid(), p.creadas.Add(1))
+	_, err := p.admin.Exec(context.Background(),
+		"CREATE DATABASE "+pgx.Identifier{nombre}.Sanitize()+" TEMPLATE "+pgx.Identifier{p.plantilla}.Sanitize())
+	if err != nil {
+		t.Fatalf("error creando la base de prueba: %v", err)
+	}
+	t.Cleanup(func() {
+		//FORCE cierra las conexiones que el pool aun no haya terminado de cerrar
+		if _, err := p.admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+pgx.Identifier{nombre}.Sanitize()+" WITH (FORCE)"); err != nil {
+			t.Errorf("error eliminando %s: %v", nombre, err)
+		}
+	})
+	return p.urlBase(nombre)
+}
+
+// URL de otra base del mismo servidor
+func (p *postgresPruebas) urlBase(nombre string) string {
+	u, _ := url.Parse(p.url)
+	u.Path = "/" + nombre
+	return u.String()
+}
+
+func (p *postgresPruebas) detener() {
+	ctx := context.Background()
+	p.admin.Exec(ctx, "DROP DATABASE IF EXISTS "+pgx.Identifier{p.plantilla}.Sanitize())
+	p.admin.Close()
+	p.parar()
+}
+
+// servidorPostgres devuelve la URL de la base de mantenimiento y como detener el servidor
+func servidorPostgres() (string, func(), error) {
+	if url := os.Getenv("PRUEBAS_DATABASE_URL"); url != "" {
+		return url, func() {}, nil
+	}
+
+	initdb, pgCtl, err := binariosPostgres()
+	if err != nil {
+		return "", nil, err
+	}
+	if os.Geteuid() == 0 {
+		return "", nil, errors.New("PostgreSQL no se ejecuta como root; use PRUEBAS_DATABASE_URL")
+	}
+
+	//Ruta corta: el socket Unix no admite rutas largas
+	dir, err := os.MkdirTemp("", "ferrypg")
+	if err != nil {
+		return "", nil, err
+	}
+	datos := filepath.Join(dir, "datos")
+
+	salida, err := exec.Command(initdb, "-D", datos, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-locale", "-N").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v\n%s", err, salida)
+	}
+
+	//Sin TCP ni fsync: solo el socket del directorio temporal
+	opciones := fmt.Sprintf("-k %s -c listen_addresses='' -F", dir)
+	salida, err = exec.Command(pgCtl, "-D", datos, "-l", filepath.Join(dir, "postgres.log"), "-o", opciones, "-w", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v\n%s", err, salida)
+	}
+
+	parar := func() {
+		exec.Command(pgCtl, "-D", datos, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return "postgres://postgres@/postgres?sslmode=disable&host=" + url.QueryEscape(dir), parar, nil
+}
+
+func binariosPostgres() (string, string, error) {
+	dirs := []string{os.Getenv("PRUEBAS_POSTGRES_BIN")}
+	//Debian y Ubuntu no agregan los binarios del servidor al PATH
+	instalados, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	slices.Reverse(instalados)
+	dirs = append(dirs, instalados...)
+
+	buscar := func(nombre string) (string, bool) {
+		for _, dir := range dirs {
+			if dir == "" {
+				continue
+			}
+			if ruta := filepath.Join(dir, nombre); esEjecutable(ruta) {
+				return ruta, true
+			}
+		}
+		ruta, err := exec.LookPath(nombre)
+		return ruta, err == nil
+	}
+
+	initdb, ok := buscar("initdb")
+	if !ok {
+		return "", "", errors.New("no se encontro initdb; instale PostgreSQL o defina PRUEBAS_DATABASE_URL")
+	}
+	pgCtl, ok := buscar("pg_ctl")
+	if !ok {
+		return "", "", errors.New("no se encontro pg_ctl")
+	}
+	return initdb, pgCtl, nil
+}
+
+func esEjecutable(ruta string) bool {
+	info, err := os.Stat(ruta)
+	return err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+// entorno es el router completo sobre una base de prueba ya sembrada
+type entorno struct {
+	h      http.Handler
+	st     store.Store
+	cfg    config.Config
+	tokens map[string]string
+}
+
+// nuevoEntorno crea la base, arma el router y siembra los datos comunes. Los ajustes
+// modifican la configuracion de prueba antes de armar el router
+func nuevoEntorno(t *testing.T, ajustes ...func(*config.Config)) *entorno {
+	t.Helper()
+	if servidorPruebas == nil {
+		if os.Getenv("PRUEBAS_SIN_POSTGRES") == "1" {
+			t.Skip("PRUEBAS_SIN_POSTGRES=1: pruebas de integracion omitidas")
+		}
+		t.Fatalf("sin PostgreSQL para pruebas de integracion: %v (ver integracion_test.go; PRUEBAS_SIN_POSTGRES=1 las omite)", errPostgres)
+	}
+
+	cfg := config.PorDefecto()
+	cfg.BaseDatos.Conexion = servidorPruebas.nuevaBase(t)
+	cfg.BaseDatos.MinConexiones = 0
+	//Los limites por ruta se prueban aparte; bcrypt y los retrasos al minimo para ir rapido
+	cfg.Limites.Activo = false
+	cfg.Contrasenas.CostoBcrypt = bcrypt.MinCost
+	cfg.Login.RetrasoBase, cfg.Login.RetrasoMaximo = time.Millisecond, time.Millisecond
+	for _, ajuste := range ajustes {
+		ajuste(&cfg)
+	}
+
+	pool, err := database.ConectarBD(cfg.BaseDatos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	migrador, err := database.NuevoMigrador(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &entorno{st: store.NuevoPostgres(pool), cfg: cfg}
+	e.h = nuevoRouter(dependencias{
+		cfg:       cfg,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		st:        e.st,
+		clavesJWT: clavesPruebas,
+		preparado: handlers.ComprobacionesPreparado{
+			Ping:            pool.Ping,
+			VersionAplicada: migrador.VersionAplicada,
+			VersionEsperada: migrador.UltimaVersion(),
+			Apagando:        &atomic.Bool{},
+		},
+	})
+	e.sembrar(t)
+	return e
+}
+
+// sembrar crea el administrador, dos empresas con su usuario, un empleado, un ferry por
+// empresa y una factura por empresa (ids 1 y 2)
+func (e *entorno) sembrar(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	politica := e.cfg.Contrasenas.Politica()
+	hash, err := politica.Hashear(contrasenaPrueba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usuario := func(rifCedula, nombre, tipo string) models.Usuario {
+		return models.Usuario{Rif_Cedula: rifCedula, Usuario: nombre, Contrasena: hash, Tipo: tipo, Estado: true}
+	}
+
+	pasos := []error{
+		e.st.Usuarios.Crear(ctx, usuario(rifAdmin, usuarioAdmin, "Administrador"), politica.Historial),
+		e.st.Empresas.Crear(ctx, models.Empresa{RIF: rifEmpresa, Nombre: "Naviera del Caribe", Email: "contacto@naviera.com", Estado: true},
+			usuario(rifEmpresa, usuarioEmpresa, "empresa"), politica.Historial),
+		e.st.Empresas.Crear(ctx, models.Empresa{RIF: rifOtraEmpresa, Nombre: "Ferris de Oriente", Email: "info@oriente.com", Estado: true},
+			usuario(rifOtraEmpresa, usuarioOtraEmpresa, "empresa"), politica.Historial),
+		e.st.Empleados.Crear(ctx, models.Empleados{Cedula: cedulaEmpleado, Nombres: "Ana", Apellidos: "Rivas", Rif_empresa: rifEmpresa,
+			Email: "ana@naviera.com", Cargo: "Taquillera", Numero_tlf: "0414-1234567", Estado: true},
+			usuario(cedulaEmpleado, usuarioEmpleado, "empleado"), politica.Historial),
+		e.st.Ferrys.Crear(ctx, models.Ferry{Matricula: matriculaFerry, RifEmpresa: rifEmpresa, Nombre: "Lucero", Modelo: "Catamaran",
+			CapacidadEconomica: 300, CapacidadVIP: 40, Estado: true}),
+		e.st.Ferrys.Crear(ctx, models.Ferry{Matricula: matriculaOtra, RifEmpresa: rifOtraEmpresa, Nombre: "Estrella", Modelo: "Ro-Ro",
+			CapacidadEconomica: 500, CapacidadVIP: 20, Estado: true}),
+	}
+	for _, err := range pasos {
+		if err != nil {
+			t.Fatalf("error sembrando datos: %v", err)
+		}
+	}
+	for _, f := range []models.Factura{facturaNueva(rifEmpresa, matriculaFerry, "V-1"), facturaNueva(rifOtraEmpresa, matriculaOtra, "O-1")} {
+		f.Estado, f.Emision = true, time.Now().UTC()
+		if _, err := e.st.Facturas.Crear(ctx, f); err != nil {
+			t.Fatalf("error sembrando facturas: %v", err)
+		}
+	}
+
+	e.tokens = map[string]string{
+		rolAdmin:       firmarToken(t, rifAdmin, "Administrador", ""),
+		rolEmpresa:     firmarToken(t, rifEmpresa, "empresa", ""),
+		rolOtraEmpresa: firmarToken(t, rifOtraEmpresa, "empresa", ""),
+		rolEmpleado:    firmarToken(t, cedulaEmpleado, "empleado", ""),
+	}
+}
+
+// facturaNueva es un cuerpo valido para POST /api/v2/facturas
+func facturaNueva(rifEmpresa, matricula, viaje string) models.Factura {
+	return models.Factura{
+		NombresViajero: "Luis", ApellidosViajero: "Perez", RIFEmpresa: rifEmpresa, CedulaEmpleado: cedulaEmpleado,
+		NombreEmpleado: "Ana Rivas", IDViaje: viaje, Tipo: "economica", MatriculaFerry: matricula,
+	}
+}
+
+// firmarToken firma un JWT de sesion como el de POST /api/v2/sesiones
+func firmarToken(t *testing.T, usuarioID, tipo, proposito string) string {
+	t.Helper()
+	token, err := middlewares.FirmarToken(&middlewares.Claims{
+		UsuarioID:        usuarioID,
+		TipoUsuario:      tipo,
+		Proposito:        proposito,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// solicitud describe una llamada a la API. cuerpo puede ser un string con el JSON tal
+// cual o un valor a serializar
+type solicitud struct {
+	metodo    string
+	ruta      string
+	token     string
+	cuerpo    any
+	cabeceras map[string]string
+}
+
+// pedir envia la solicitud al router
+func (e *entorno) pedir(t *testing.T, s solicitud) *httptest.ResponseRecorder {
+	t.Helper()
+	w, err := e.servir(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// servir es pedir sin *testing.T, para las solicitudes enviadas desde otras goroutines.
+// Anota la ruta alcanzada para la comprobacion de cobertura de TestMain
+func (e *entorno) servir(s solicitud) (*httptest.ResponseRecorder, error) {
+	var cuerpo io.Reader = http.NoBody
+	switch c := s.cuerpo.(type) {
+	case nil:
+	case string:
+		cuerpo = strings.NewReader(c)
+	default:
+		datos, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		cuerpo = bytes.NewReader(datos)
+	}
+
+	r := httptest.NewRequest(s.metodo, s.ruta, cuerpo)
+	r.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		r.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	for nombre, valor := range s.cabeceras {
+		r.Header.Set(nombre, valor)
+	}
+
+	//Con un contexto de rutas propio chi lo reutiliza y se puede leer el patron al final
+	rctx := chi.NewRouteContext()
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	e.h.ServeHTTP(w, r)
+
+	if patron := rctx.RoutePattern(); patron != "" {
+		rutasEjercitadas.Store(s.metodo+" "+patron, true)
+	}
+	return w, nil
+}
+
+// como pide con el token del rol indicado
+func (e *entorno) como(t *testing.T, rol, metodo, ruta string, cuerpo any) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.pedir(t, solicitud{metodo: metodo, ruta: ruta, token: e.tokens[rol], cuerpo: cuerpo})
+}
+
+// esperarEstado falla si la respuesta no tiene el estado indicado, mostrando el cuerpo
+func esperarEstado(t *testing.T, w *httptest.ResponseRecorder, estado int) {
+	t.Helper()
+	if w.Code != estado {
+		t.Fatalf("estado %d, se esperaba %d: %s", w.Code, estado, w.Body.String())
+	}
+}
+
+// leerJSON decodifica el cuerpo de la respuesta
+func leerJSON[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("respuesta no es JSON valido: %v: %s", err, w.Body.String())
+	}
+	return v
+}
+
+// codigoError devuelve el codigo del sobre de error de la respuesta
+func codigoError(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	return leerJSON[struct {
+		Error struct {
+			Codigo string `json:"codigo"`
+		} `json:"error"`
+	}](t, w).Error.Codigo
+}
@@ -2,110 +2,165 @@ package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/database"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/handlers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
 	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
-	"github.com/go-chi/chi/v5"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/tracing"
 )
 
 func main() {
-	conn, err := database.ConectarBD()
-	if err != nil {
-		log.Fatal("Error al conectar:", err)
-		return
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(ejecutarMigrate(os.Args[2:]))
 	}
-	defer conn.Close(context.Background())
-
-	r := chi.NewRouter()
-
-	//Middleware de logging
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("Solicitud recibida: %s %s", r.Method, r.URL.Path)
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("Solicitud recibida: %s %s", r.Method, r.URL.Path)
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	//Ruta publica
-	r.Get("/test", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("¡Funciona!"))
-	})
 
-	r.Post("/api/login", handlers.IniciarSesion(conn))
-
-	//Grupo de rutas protegidas
-	r.Group(func(r chi.Router) {
-		//Middleware JWT
-		r.Use(middlewares.AutenticacionJWT)
-
-		//Rutas para todos los autenticados
-		//Put
-		r.Put("/api/empresas/actualizar/{rif}", handlers.EditarEmpresas(conn))
-		r.Put("/api/empresas/{rif}/{accion}", handlers.EstadoEmpresa(conn))
-
-		r.Put("/api/empleado/actualizar/{cedula}", handlers.EditarEmpleado(conn))
-		r.Put("/api/empleado/activar/{cedula}", handlers.EstadoEmpleado(conn))
-		r.Put("/api/empleado/desactivar/{cedula}", handlers.EstadoEmpleado(conn))
-		r.Put("/api/usuario/{rif_cedula}", handlers.EditarUsuario(conn))
-
-		//Get
-		r.Get("/api/usuario/{rif_cedula}", handlers.ObtenerUsuario(conn))
-		r.Put("/api/usuarios/{rif_cedula}/contrasena-personal", handlers.CambiarContrasenaPersonal(conn))
-		r.Get("/api/empresas/{rif}/empleados", handlers.EmpleadosPorEmpresa(conn))
-		//Ferry
-		r.Post("/api/ferry/registrar", handlers.RegistrarFerry(conn))
-		r.Put("/api/ferry/actualizar/{matricula}", handlers.EditarFerry(conn))
-		r.Get("/api/ferry/buscar/{matricula}", handlers.ObtenerFerry(conn))
-
-		r.Get("/api/empresas/buscar/{rif}", handlers.ObtenerEmpresa(conn))
-		r.Post("/api/empleado/registrar", handlers.RegistrarEmpleado(conn))
-
-		r.Get("/api/empresas/{rif}/ferrys", handlers.ObtenerFerrysPorEmpresa(conn))
-
-		r.Post("/api/factura/generar", handlers.CrearFactura(conn))
-		r.Get("/api/factura/obtener/{id}", handlers.ObtenerFactura(conn))
-		r.Put("/api/factura/{id}/estado/{accion}", handlers.CambiarEstadoFactura(conn))
+	//Configuracion de archivo, .env y entorno; se informan todos los problemas juntos
+	cfg, err := config.Cargar()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-		//Subgrupo solo para administradores
-		r.Group(func(r chi.Router) {
-			r.Use(middlewares.SoloAdmin)
+	//Logs en JSON; log.Printf de otros paquetes tambien pasa por este logger
+	logger := helpers.NuevoLogger(os.Stdout, cfg.Log.Nivel)
+	slog.SetDefault(logger)
 
-			//Rutas de administradores
-			//Post
-			r.Post("/api/empresas/registrar", handlers.RegistrarEmpresa(conn))
+	if err := ejecutarServidor(cfg, logger); err != nil {
+		fatal("Error del servidor", err)
+	}
+	slog.Info("Servidor detenido")
+}
 
-			r.Post("/api/usuario/registrar", handlers.RegistrarUsuario(conn))
+// ejecutarServidor atiende solicitudes hasta recibir SIGINT o SIGTERM. Devuelve al
+// terminar de apagarse para que se ejecuten los cierres diferidos
+func ejecutarServidor(cfg config.Config, logger *slog.Logger) error {
+	//SIGINT/SIGTERM cancelan ctx: se drenan las solicitudes y se detienen los trabajos
+	ctx, detener := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer detener()
+	var trabajos sync.WaitGroup
 
-			r.Put("/api/usuarios/{rif_cedula}/{accion}", handlers.EstadoUsuario(conn))
-			r.Put("/api/usuario/{rif_cedula}/cambiar-contrasena", handlers.CambiarContrasena(conn))
+	//Trazas de OpenTelemetry (desactivadas salvo con el exportador otlp)
+	apagarTrazas, err := tracing.Configurar(ctx, cfg.Trazas)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctxTrazas, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := apagarTrazas(ctxTrazas); err != nil {
+			slog.Error("Error enviando trazas pendientes", slog.Any("error", err))
+		}
+	}()
+
+	pool, err := database.ConectarBD(cfg.BaseDatos)
+	if err != nil {
+		return fmt.Errorf("error al conectar: %w", err)
+	}
+	defer pool.Close()
 
-		})
+	//Acceso a datos
+	st := store.NuevoPostgres(pool)
+	if err := metrics.Registrar(metrics.NuevoColectorPool(pool)); err != nil {
+		return fmt.Errorf("error registrando metricas del pool: %w", err)
+	}
+	migrador, err := database.NuevoMigrador(pool)
+	if err != nil {
+		return err
+	}
 
+	//Claves de firma de JWT (RS256/EdDSA con rotacion por kid). La clave efimera solo se
+	//usa si se pide explicitamente, para desarrollo
+	var clavesJWT *security.ConjuntoClaves
+	if cfg.JWT.ClaveEfimera {
+		slog.Warn("jwt.clave_efimera activo: las sesiones no sobreviven a un reinicio, no usar en produccion")
+		clavesJWT, err = security.ConjuntoClavesEfimero()
+	} else {
+		clavesJWT, err = security.CargarConjuntoClaves(cfg.JWT.DirectorioClaves, cfg.JWT.ClaveActiva)
+	}
+	if err != nil {
+		return fmt.Errorf("error cargando claves JWT: %w", err)
+	}
+	middlewares.ConfigurarClavesJWT(clavesJWT, cfg.JWT.Emisor, cfg.JWT.Audiencia)
+
+	//SIGHUP recarga las claves para rotarlas sin reiniciar
+	recarga := make(chan os.Signal, 1)
+	signal.Notify(recarga, syscall.SIGHUP)
+	trabajos.Add(1)
+	go func() {
+		defer trabajos.Done()
+		defer signal.Stop(recarga)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-recarga:
+				if err := clavesJWT.Recargar(); err != nil {
+					slog.Error("Error recargando claves JWT", slog.Any("error", err))
+					continue
+				}
+				slog.Info("Claves JWT recargadas")
+			}
+		}
+	}()
+
+	//Las respuestas guardadas de los POST con Idempotency-Key se purgan cada hora
+	trabajos.Add(1)
+	go func() {
+		defer trabajos.Done()
+		purga := time.NewTicker(time.Hour)
+		defer purga.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-purga.C:
+				if _, err := st.Idempotencia.Purgar(ctx, time.Now().UTC()); err != nil {
+					slog.Error("Error purgando claves de idempotencia", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+
+	apagando := &atomic.Bool{}
+	r := nuevoRouter(dependencias{
+		cfg:       cfg,
+		logger:    logger,
+		st:        st,
+		clavesJWT: clavesJWT,
+		preparado: handlers.ComprobacionesPreparado{
+			Ping:            pool.Ping,
+			VersionAplicada: migrador.VersionAplicada,
+			VersionEsperada: migrador.UltimaVersion(),
+			Apagando:        apagando,
+		},
 	})
 
-	//Server log
-
-	// Router
+	// Servidor: al recibir la señal /readyz pasa a 503 y se drenan las solicitudes
+	err = servir(ctx, cfg.Servidor, r, func() { apagando.Store(true) })
 
-	// Servidor
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	log.Printf("Servidor escuchando en puerto %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	//Los trabajos en segundo plano terminan con ctx; se espera a que lo hagan
+	detener()
+	trabajos.Wait()
+	return err
+}
 
+// fatal registra el error y termina el proceso
+func fatal(mensaje string, err error) {
+	slog.Error(mensaje, slog.Any("error", err))
+	os.Exit(1)
 }
 
 ///Nota 1: Todo el codigo sera refactorizado y mejorado en algun momento.
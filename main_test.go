@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/handlers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/openapi"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// routerPrueba arma el router completo sobre el store en memoria
+func routerPrueba(t *testing.T) *chi.Mux {
+	t.Helper()
+	claves, err := security.ConjuntoClavesEfimero()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nuevoRouter(dependencias{
+		cfg:       config.PorDefecto(),
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		st:        store.NuevoMemoria(),
+		clavesJWT: claves,
+		preparado: handlers.ComprobacionesPreparado{
+			Ping:            func(context.Context) error { return nil },
+			VersionAplicada: func(context.Context) (int, error) { return 0, nil },
+		},
+	})
+}
+
+// Cada ruta del router debe estar en el documento OpenAPI y viceversa
+func TestRutasDocumentadas(t *testing.T) {
+	var rutas []string
+	err := chi.Walk(routerPrueba(t), func(metodo, ruta string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		rutas = append(rutas, metodo+" "+ruta)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(rutas)
+
+	documentadas := openapi.Construir().Operaciones()
+	for _, ruta := range rutas {
+		if _, ok := slices.BinarySearch(documentadas, ruta); !ok {
+			t.Errorf("%s no esta documentada en openapi/rutas.go", ruta)
+		}
+	}
+	for _, ruta := range documentadas {
+		if _, ok := slices.BinarySearch(rutas, ruta); !ok {
+			t.Errorf("%s esta documentada pero no existe en el router", ruta)
+		}
+	}
+}
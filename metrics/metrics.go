@@ -0,0 +1,113 @@
+// Package metrics define las metricas de Prometheus del servicio: trafico HTTP por ruta,
+// estado del pool de conexiones, inicios de sesion y metricas de negocio (facturas y
+// asientos vendidos). Se exponen con Handler en /metrics
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const espacio = "ferryapp"
+
+// Resultados de IniciarSesion y VerificarSegundoFactor
+const (
+	SesionExitosa           = "exito"
+	SesionCredencialesError = "credenciales_invalidas"
+	SesionBloqueada         = "bloqueado"
+	SesionCuentaInactiva    = "cuenta_inactiva"
+	SesionRequiere2FA       = "requiere_2fa"
+	SesionCodigo2FAError    = "codigo_2fa_invalido"
+	SesionRequiereInscribir = "requiere_inscripcion_2fa"
+	SesionError             = "error"
+)
+
+var registro = prometheus.NewRegistry()
+
+var (
+	solicitudesHTTP = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "http_solicitudes_total",
+		Help:      "Solicitudes HTTP atendidas por metodo, patron de ruta y estado.",
+	}, []string{"metodo", "ruta", "estado"})
+
+	duracionHTTP = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: espacio,
+		Name:      "http_duracion_segundos",
+		Help:      "Duracion de las solicitudes HTTP por metodo y patron de ruta.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"metodo", "ruta"})
+
+	iniciosSesion = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "inicios_sesion_total",
+		Help:      "Intentos de inicio de sesion por resultado.",
+	}, []string{"resultado"})
+
+	facturasEmitidas = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "facturas_emitidas_total",
+		Help:      "Facturas emitidas por empresa.",
+	}, []string{"rif_empresa"})
+
+	asientosVendidos = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "asientos_vendidos_total",
+		Help:      "Asientos vendidos por viaje y tipo de asiento.",
+	}, []string{"id_viaje", "tipo"})
+)
+
+func init() {
+	registro.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		solicitudesHTTP, duracionHTTP, iniciosSesion, facturasEmitidas, asientosVendidos,
+	)
+}
+
+// Registrar agrega un colector propio (p. ej. el del pool de conexiones)
+func Registrar(c prometheus.Collector) error {
+	return registro.Register(c)
+}
+
+// Handler expone las metricas en el formato de texto de Prometheus. Si token no esta
+// vacio se exige en la cabecera Authorization: Bearer <token>
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(registro, promhttp.HandlerOpts{Registry: registro})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enviado := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(enviado), []byte(token)) != 1 {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token de metricas requerido"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ObservarSolicitud registra una solicitud HTTP atendida
+func ObservarSolicitud(metodo, ruta string, estado int, segundos float64) {
+	solicitudesHTTP.WithLabelValues(metodo, ruta, strconv.Itoa(estado)).Inc()
+	duracionHTTP.WithLabelValues(metodo, ruta).Observe(segundos)
+}
+
+// InicioSesion cuenta un intento de inicio de sesion con su resultado
+func InicioSesion(resultado string) {
+	iniciosSesion.WithLabelValues(resultado).Inc()
+}
+
+// FacturaEmitida cuenta la factura y el asiento vendido en su viaje
+func FacturaEmitida(factura models.Factura) {
+	facturasEmitidas.WithLabelValues(factura.RIFEmpresa).Inc()
+	asientosVendidos.WithLabelValues(factura.IDViaje, strings.ToLower(factura.Tipo)).Inc()
+}
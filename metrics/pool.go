@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// colectorPool lee las estadisticas del pool de pgx en cada consulta de /metrics
+type colectorPool struct {
+	pool *pgxpool.Pool
+
+	adquiridas        *prometheus.Desc
+	inactivas         *prometheus.Desc
+	totales           *prometheus.Desc
+	maximas           *prometheus.Desc
+	adquisiciones     *prometheus.Desc
+	esperas           *prometheus.Desc
+	esperaSegundos    *prometheus.Desc
+	canceladas        *prometheus.Desc
+	creadas           *prometheus.Desc
+	cerradasInactivas *prometheus.Desc
+}
+
+// NuevoColectorPool crea el colector de las estadisticas del pool de conexiones
+func NuevoColectorPool(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(nombre, ayuda string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(espacio, "pgx_pool", nombre), ayuda, nil, nil)
+	}
+	return &colectorPool{
+		pool:              pool,
+		adquiridas:        desc("conexiones_adquiridas", "Conexiones en uso."),
+		inactivas:         desc("conexiones_inactivas", "Conexiones abiertas sin uso."),
+		totales:           desc("conexiones_totales", "Conexiones abiertas."),
+		maximas:           desc("conexiones_maximas", "Tamaño maximo del pool."),
+		adquisiciones:     desc("adquisiciones_total", "Conexiones tomadas del pool."),
+		esperas:           desc("esperas_total", "Adquisiciones que tuvieron que esperar una conexion libre."),
+		esperaSegundos:    desc("espera_segundos_total", "Tiempo total esperando conexiones."),
+		canceladas:        desc("adquisiciones_canceladas_total", "Adquisiciones canceladas por el contexto."),
+		creadas:           desc("conexiones_creadas_total", "Conexiones nuevas abiertas."),
+		cerradasInactivas: desc("conexiones_cerradas_inactividad_total", "Conexiones cerradas por inactividad."),
+	}
+}
+
+func (c *colectorPool) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *colectorPool) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	contador := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.adquiridas, float64(s.AcquiredConns()))
+	gauge(c.inactivas, float64(s.IdleConns()))
+	gauge(c.totales, float64(s.TotalConns()))
+	gauge(c.maximas, float64(s.MaxConns()))
+	contador(c.adquisiciones, float64(s.AcquireCount()))
+	contador(c.esperas, float64(s.EmptyAcquireCount()))
+	contador(c.esperaSegundos, s.AcquireDuration().Seconds())
+	contador(c.canceladas, float64(s.CanceledAcquireCount()))
+	contador(c.creadas, float64(s.NewConnsCount()))
+	contador(c.cerradasInactivas, float64(s.MaxIdleDestroyCount()))
+}
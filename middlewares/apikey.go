@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Tipo de usuario asignado a las solicitudes autenticadas con clave API
+const TipoClaveAPI = "ClaveAPI"
+
+// EsClaveAPI indica si los claims provienen de una clave API y no de un inicio de sesion
+func (c *Claims) EsClaveAPI() bool {
+	return c.TipoUsuario == TipoClaveAPI
+}
+
+// Middleware que acepta una clave API (cabecera X-API-Key) o, si no se envia, un JWT
+func AutenticacionJWTOClaveAPI(claves store.ClaveAPIStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		jwtHandler := AutenticacionJWT(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clave := strings.TrimSpace(r.Header.Get("X-API-Key"))
+			if clave == "" {
+				jwtHandler.ServeHTTP(w, r)
+				return
+			}
+
+			prefijo, ok := security.PrefijoClaveAPI(clave)
+			if !ok {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Clave API invalida"))
+				return
+			}
+
+			registro, hash, err := claves.ObtenerPorPrefijo(r.Context(), prefijo)
+			if err != nil {
+				if !errors.Is(err, store.ErrNoEncontrado) {
+					helpers.Logger(r.Context()).Error("Error consultando clave API", slog.Any("error", err))
+				}
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Clave API invalida"))
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(hash), []byte(security.HashClaveAPI(clave))) != 1 {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Clave API invalida"))
+				return
+			}
+
+			if registro.Revocada || (registro.Expira != nil && time.Now().After(*registro.Expira)) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Clave API revocada o expirada"))
+				return
+			}
+
+			//Registrar ultimo uso sin bloquear la solicitud si falla
+			if err := claves.RegistrarUso(r.Context(), registro.ID, time.Now().UTC()); err != nil {
+				helpers.Logger(r.Context()).Warn("Error actualizando uso de clave API", slog.Any("error", err))
+			}
+
+			claims := &Claims{
+				UsuarioID:   registro.RifEmpresa,
+				TipoUsuario: TipoClaveAPI,
+				RifCedula:   registro.RifEmpresa,
+				Alcances:    registro.Alcances,
+				ClaveAPI:    prefijo,
+			}
+
+			helpers.AnotarUsuario(r.Context(), TipoClaveAPI+":"+prefijo)
+			ctx := context.WithValue(r.Context(), usuarioContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequiereAlcance exige que las claves API tengan el alcance indicado.
+// Los usuarios con sesion JWT no se ven afectados
+func RequiereAlcance(alcance string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := UsuarioDesdeContexto(r.Context())
+			if claims == nil {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token de autorizacion requerido"))
+				return
+			}
+			if claims.EsClaveAPI() && !slices.Contains(claims.Alcances, alcance) {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "La clave API no tiene el alcance "+alcance))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,27 +2,36 @@ package middlewares
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/joho/godotenv"
 )
 
-var JWTSecret = []byte(os.Getenv("JWTSecret"))
+// Conjunto de claves con el que se firman y verifican los tokens, y el emisor y la
+// audiencia que llevan. Se configuran desde main
+var (
+	clavesJWT    *security.ConjuntoClaves
+	emisorJWT    string
+	audienciaJWT string
+)
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		panic("Error cargando archivo .env")
-	}
+func ConfigurarClavesJWT(claves *security.ConjuntoClaves, emisor, audiencia string) {
+	clavesJWT, emisorJWT, audienciaJWT = claves, emisor, audiencia
+}
 
-	JWTSecret := os.Getenv("JWTSecret")
-	if JWTSecret == "" {
-		panic("JWT_SECRET no esta configurado en las .env")
+// FirmarToken firma los claims con la clave activa del conjunto, con el emisor y la audiencia configurados
+func FirmarToken(claims *Claims) (string, error) {
+	if clavesJWT == nil {
+		return "", errors.New("claves JWT no configuradas")
 	}
-
+	claims.Issuer = emisorJWT
+	claims.Audience = jwt.ClaimStrings{audienciaJWT}
+	return clavesJWT.Firmar(claims)
 }
 
 type contextKey string
@@ -32,10 +41,22 @@ const (
 	usuarioContextKey contextKey = "usuario"
 )
 
+// Propositos de tokens restringidos. Un token de sesion normal no lleva proposito
+const (
+	//Token intermedio entre la contraseña y el codigo TOTP
+	PropositoDesafio2FA = "desafio_2fa"
+	//Token que solo permite inscribir 2FA (rol obligado que aun no lo tiene)
+	PropositoInscripcion2FA = "inscripcion_2fa"
+)
+
 type Claims struct {
 	UsuarioID   string `json:"usuario_id"`
 	TipoUsuario string `json:"tipo_usuario"`
 	RifCedula   string `json:"rif_cedula"`
+	Proposito   string `json:"proposito,omitempty"`
+	//Solo para solicitudes autenticadas con clave API
+	Alcances []string `json:"-"`
+	ClaveAPI string   `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -49,43 +70,70 @@ func UsuarioDesdeContexto(ctx context.Context) *Claims {
 
 // Middleware de autenticacion JWT
 func AutenticacionJWT(next http.Handler) http.Handler {
+	return autenticar(next, "")
+}
+
+// Middleware para las rutas de inscripcion 2FA: acepta tambien tokens restringidos a inscripcion
+func AutenticacionInscripcion2FA(next http.Handler) http.Handler {
+	return autenticar(next, "", PropositoInscripcion2FA)
+}
+
+func autenticar(next http.Handler, propositos ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			responderError(w, http.StatusUnauthorized, "Token de autorizacion requerido")
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token de autorizacion requerido"))
 			return
 		}
 
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			responderError(w, http.StatusUnauthorized, "Formato de token invalido")
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Formato de token invalido"))
 			return
 		}
 
 		tokenStr := tokenParts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return JWTSecret, nil
-		})
+		claims, err := ValidarToken(tokenStr)
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token invalido o expirado"))
+			return
+		}
 
-		if err != nil || !token.Valid {
-			responderError(w, http.StatusUnauthorized, "Token invalido o expirado")
+		if !slices.Contains(propositos, claims.Proposito) {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnauthorized, helpers.CodigoNoAutenticado, "Token no valido para esta ruta"))
 			return
 		}
 
+		helpers.AnotarUsuario(r.Context(), claims.UsuarioID)
 		ctx := context.WithValue(r.Context(), usuarioContextKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// ValidarToken verifica la firma, expiracion, emisor y audiencia de un token y devuelve sus claims
+func ValidarToken(tokenStr string) (*Claims, error) {
+	if clavesJWT == nil {
+		return nil, errors.New("claves JWT no configuradas")
+	}
+
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenStr, claims, clavesJWT.FuncionClave,
+		jwt.WithValidMethods(clavesJWT.Metodos()), jwt.WithIssuer(emisorJWT), jwt.WithAudience(audienciaJWT))
+
+	if err != nil || !token.Valid {
+		return nil, errors.New("token invalido o expirado")
+	}
+	return claims, nil
+}
+
 //Middleware  de autorizacion para administradores
 
 func SoloAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims := UsuarioDesdeContexto(r.Context())
 		if claims == nil || claims.TipoUsuario != "Administrador" {
-			responderError(w, http.StatusForbidden, "Acceso restringido a administradores")
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "Acceso restringido a administradores"))
 
 			return
 		}
@@ -96,19 +144,11 @@ func SoloAdmin(next http.Handler) http.Handler {
 func SoloEmpresa(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims := UsuarioDesdeContexto(r.Context())
-		if claims == nil || claims.TipoUsuario != "Empresa" {
-			responderError(w, http.StatusForbidden, "Acceso restringido a Empresas")
+		if claims == nil || !strings.EqualFold(claims.TipoUsuario, "Empresa") {
+			helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "Acceso restringido a Empresas"))
 
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
-
-func responderError(w http.ResponseWriter, status int, mensaje string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": mensaje,
-	})
-}
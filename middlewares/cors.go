@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+// CORS permite que el frontend de otro origen llame a la API. Responde los preflight
+// (OPTIONS con Access-Control-Request-Method) sin llegar al router, para que no los
+// rechace la autenticacion, y añade las cabeceras CORS a las respuestas de origenes
+// permitidos. Las solicitudes sin Origin no se modifican
+func CORS(cfg config.CORS) func(http.Handler) http.Handler {
+	comodin := slices.Contains(cfg.Origenes, "*")
+	metodos := strings.Join(cfg.Metodos, ", ")
+	cabeceras := strings.Join(cfg.Cabeceras, ", ")
+	expuestas := strings.Join(cfg.CabecerasExpuestas, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	permitido := func(origen string) bool {
+		return comodin || slices.ContainsFunc(cfg.Origenes, func(o string) bool { return strings.EqualFold(o, origen) })
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origen := r.Header.Get("Origin")
+			if origen == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			//La respuesta depende del origen: las caches no deben mezclarlas
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if !permitido(origen) {
+				if preflight {
+					helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "Origen no permitido"))
+					return
+				}
+				//Sin cabeceras CORS el navegador no entrega la respuesta al script
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			//Con credenciales el navegador exige el origen exacto en lugar de *
+			if comodin && !cfg.Credenciales {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origen)
+			}
+			if cfg.Credenciales {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				if !slices.Contains(cfg.Metodos, r.Header.Get("Access-Control-Request-Method")) {
+					helpers.ResponderError(w, r, helpers.NuevoError(http.StatusForbidden, helpers.CodigoProhibido, "Método no permitido para solicitudes de otro origen"))
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Methods", metodos)
+				if cabeceras != "" {
+					w.Header().Set("Access-Control-Allow-Headers", cabeceras)
+				}
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if expuestas != "" {
+				w.Header().Set("Access-Control-Expose-Headers", expuestas)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
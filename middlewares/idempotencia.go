@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Cabeceras de la clave de idempotencia y de las respuestas repetidas
+const (
+	CabeceraIdempotencia      = "Idempotency-Key"
+	CabeceraRespuestaRepetida = "Idempotency-Replayed"
+)
+
+// Tamaño maximo del cuerpo que se acepta en un POST idempotente
+const maxCuerpoIdempotente = 1 << 20
+
+// Veces que se intenta guardar una respuesta antes de dejar la reserva sin completar
+const intentosCompletar = 3
+
+// Idempotencia permite reintentar un POST con la cabecera Idempotency-Key sin repetir
+// sus efectos: la primera respuesta se guarda durante la retencion y los reintentos con
+// el mismo cuerpo la reciben de nuevo. Un cuerpo distinto con la misma clave se rechaza.
+// Mientras la primera se procesa los reintentos reciben 409. Su contexto vence tras
+// cfg.TiempoMaximo, asi que una reserva mas antigua que cfg.Abandono ya no tiene
+// transaccion en curso y el reintento la toma. Sin la cabecera la solicitud se procesa normalmente
+func Idempotencia(solicitudes store.IdempotenciaStore, cfg config.Idempotencia) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clave := r.Header.Get(CabeceraIdempotencia)
+			if clave == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(clave) > 255 {
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusBadRequest, helpers.CodigoValidacion,
+					"La cabecera Idempotency-Key no puede superar 255 caracteres"))
+				return
+			}
+
+			cuerpo, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCuerpoIdempotente))
+			if err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorJSONInvalido())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(cuerpo))
+			hash := sha256.Sum256(cuerpo)
+
+			//Postgres guarda microsegundos: la reserva se compara luego con el valor guardado
+			ahora := time.Now().UTC().Truncate(time.Microsecond)
+			alcance := alcanceIdempotencia(r)
+			existente, reservada, err := solicitudes.Reservar(r.Context(), models.SolicitudIdempotente{
+				Alcance:       alcance,
+				Clave:         clave,
+				HashSolicitud: hex.EncodeToString(hash[:]),
+				Creada:        ahora,
+				Expira:        ahora.Add(cfg.Retencion),
+				Reservada:     ahora,
+			}, ahora.Add(-cfg.Abandono))
+			if err != nil {
+				helpers.ResponderError(w, r, helpers.ErrorInterno("Error al procesar la solicitud", err))
+				return
+			}
+
+			if !reservada {
+				switch {
+				case existente.HashSolicitud != hex.EncodeToString(hash[:]):
+					helpers.ResponderError(w, r, helpers.NuevoError(http.StatusUnprocessableEntity, helpers.CodigoIdempotenciaConflicto,
+						"La clave de idempotencia ya se uso con una solicitud distinta"))
+				case existente.Estado == 0:
+					helpers.ResponderError(w, r, helpers.NuevoError(http.StatusConflict, helpers.CodigoSolicitudEnProceso,
+						"Una solicitud con la misma clave de idempotencia todavia se esta procesando"))
+				default:
+					if existente.TipoContenido != "" {
+						w.Header().Set("Content-Type", existente.TipoContenido)
+					}
+					w.Header().Set(CabeceraRespuestaRepetida, "true")
+					w.WriteHeader(existente.Estado)
+					w.Write(existente.Cuerpo)
+				}
+				return
+			}
+
+			grabadora := &respuestaGrabada{ResponseWriter: w, estado: http.StatusOK}
+			liberar := true
+			defer func() {
+				//Se libera la clave si el handler fallo para que el reintento se procese
+				if liberar {
+					liberarIdempotencia(r, solicitudes, alcance, clave, ahora)
+				}
+			}()
+
+			//El plazo cuenta desde la reserva: al vencer la transaccion del handler se deshace
+			ctx, cancel := context.WithDeadline(r.Context(), ahora.Add(cfg.TiempoMaximo))
+			defer cancel()
+			next.ServeHTTP(grabadora, r.WithContext(ctx))
+
+			//Los errores del servidor no se guardan: el cliente puede reintentar
+			if grabadora.estado >= http.StatusInternalServerError {
+				return
+			}
+			//Los efectos del handler ya se confirmaron: liberar la clave permitiria repetirlos.
+			//Si no se puede guardar la respuesta la reserva queda hasta su abandono
+			liberar = false
+			err = completarIdempotencia(r, solicitudes, alcance, clave, ahora, grabadora)
+			if errors.Is(err, store.ErrNoEncontrado) {
+				//La reserva supero el abandono y un reintento la tomo
+				helpers.Logger(r.Context()).Warn("Reserva de idempotencia tomada por otra solicitud", slog.String("clave", clave))
+				return
+			}
+			if err != nil {
+				helpers.Logger(r.Context()).Error("Error guardando respuesta idempotente", slog.String("clave", clave), slog.Any("error", err))
+			}
+		})
+	}
+}
+
+// Las claves son propias de cada usuario o clave API y de cada ruta
+func alcanceIdempotencia(r *http.Request) string {
+	identidad := "anonimo"
+	if claims := UsuarioDesdeContexto(r.Context()); claims != nil {
+		identidad = claims.TipoUsuario + ":" + claims.UsuarioID
+		if claims.EsClaveAPI() {
+			identidad = TipoClaveAPI + ":" + claims.ClaveAPI
+		}
+	}
+	return identidad + " " + r.Method + " " + r.URL.Path
+}
+
+// Guarda la respuesta con unos pocos reintentos ante errores transitorios del store
+func completarIdempotencia(r *http.Request, solicitudes store.IdempotenciaStore, alcance, clave string, reservada time.Time, grabadora *respuestaGrabada) error {
+	ctx := context.WithoutCancel(r.Context())
+	var err error
+	for intento := range intentosCompletar {
+		if intento > 0 {
+			time.Sleep(time.Duration(intento) * 100 * time.Millisecond)
+		}
+		err = solicitudes.Completar(ctx, alcance, clave, reservada,
+			grabadora.estado, grabadora.Header().Get("Content-Type"), grabadora.cuerpo.Bytes())
+		if err == nil || errors.Is(err, store.ErrNoEncontrado) {
+			return err
+		}
+	}
+	return err
+}
+
+func liberarIdempotencia(r *http.Request, solicitudes store.IdempotenciaStore, alcance, clave string, reservada time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := solicitudes.Liberar(ctx, alcance, clave, reservada); err != nil {
+		helpers.Logger(r.Context()).Error("Error liberando clave de idempotencia", slog.String("clave", clave), slog.Any("error", err))
+	}
+}
+
+// respuestaGrabada escribe la respuesta al cliente y guarda una copia del estado y cuerpo
+type respuestaGrabada struct {
+	http.ResponseWriter
+	estado  int
+	escrito bool
+	cuerpo  bytes.Buffer
+}
+
+func (g *respuestaGrabada) WriteHeader(estado int) {
+	if !g.escrito {
+		g.estado = estado
+		g.escrito = true
+	}
+	g.ResponseWriter.WriteHeader(estado)
+}
+
+func (g *respuestaGrabada) Write(b []byte) (int, error) {
+	if !g.escrito {
+		g.WriteHeader(http.StatusOK)
+	}
+	g.cuerpo.Write(b)
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *respuestaGrabada) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Una reserva sin completar mas antigua que el abandono la toma el reintento; las
+// recientes, o con otro cuerpo, se siguen rechazando. El handler corre con el plazo maximo
+func TestIdempotenciaReservaAbandonada(t *testing.T) {
+	const cuerpo = `{"viaje":"I-1"}`
+	cfg := config.Idempotencia{Retencion: 24 * time.Hour, TiempoMaximo: 30 * time.Second, Abandono: time.Minute}
+	hashCuerpo := func(c string) string {
+		suma := sha256.Sum256([]byte(c))
+		return hex.EncodeToString(suma[:])
+	}
+
+	casos := []struct {
+		nombre       string
+		antiguedad   time.Duration
+		cuerpoPrevio string
+		estado       int
+		atendida     bool
+	}{
+		{"reserva reciente", time.Second, cuerpo, http.StatusConflict, false},
+		{"reserva abandonada", 2 * cfg.Abandono, cuerpo, http.StatusCreated, true},
+		{"abandonada con otro cuerpo", 2 * cfg.Abandono, `{"viaje":"I-2"}`, http.StatusUnprocessableEntity, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			ctx := context.Background()
+			solicitudes := store.NuevoMemoria().Idempotencia
+			reservada := time.Now().UTC().Add(-c.antiguedad)
+			_, ok, err := solicitudes.Reservar(ctx, models.SolicitudIdempotente{
+				Alcance: "anonimo POST /facturas", Clave: "venta-1", HashSolicitud: hashCuerpo(c.cuerpoPrevio),
+				Creada: reservada, Expira: reservada.Add(24 * time.Hour), Reservada: reservada,
+			}, time.Time{})
+			if err != nil || !ok {
+				t.Fatalf("reserva previa: %v %v", ok, err)
+			}
+
+			atendida := false
+			var plazo time.Time
+			h := Idempotencia(solicitudes, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atendida = true
+				plazo, _ = r.Context().Deadline()
+				w.WriteHeader(http.StatusCreated)
+			}))
+			solicitud := httptest.NewRequest(http.MethodPost, "/facturas", strings.NewReader(cuerpo))
+			solicitud.Header.Set(CabeceraIdempotencia, "venta-1")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, solicitud)
+			limite := time.Now().Add(cfg.TiempoMaximo)
+
+			if w.Code != c.estado || atendida != c.atendida {
+				t.Fatalf("estado %d atendida %v, se esperaba %d %v", w.Code, atendida, c.estado, c.atendida)
+			}
+			if !c.atendida {
+				return
+			}
+			if plazo.IsZero() || plazo.After(limite) {
+				t.Errorf("plazo del handler %v, se esperaba a lo sumo %v", plazo, limite)
+			}
+			//La solicitud original ya no puede completar ni liberar la reserva tomada
+			err = solicitudes.Completar(ctx, "anonimo POST /facturas", "venta-1", reservada, http.StatusCreated, "", nil)
+			if !errors.Is(err, store.ErrNoEncontrado) {
+				t.Errorf("Completar de la reserva tomada: %v, se esperaba ErrNoEncontrado", err)
+			}
+			existente, ok, err := solicitudes.Reservar(ctx, models.SolicitudIdempotente{
+				Alcance: "anonimo POST /facturas", Clave: "venta-1", HashSolicitud: hashCuerpo(cuerpo), Creada: time.Now().UTC(),
+			}, time.Now().UTC())
+			if err != nil || ok || existente.Estado != http.StatusCreated {
+				t.Errorf("la respuesta del reintento no quedo guardada: %+v %v %v", existente, ok, err)
+			}
+		})
+	}
+}
+
+// Store cuyo Completar siempre falla, como una base de datos caida tras el commit
+type idempotenciaSinCompletar struct {
+	store.IdempotenciaStore
+	completar, liberar int
+}
+
+func (s *idempotenciaSinCompletar) Completar(context.Context, string, string, time.Time, int, string, []byte) error {
+	s.completar++
+	return errors.New("conexion perdida")
+}
+
+func (s *idempotenciaSinCompletar) Liberar(ctx context.Context, alcance, clave string, reservada time.Time) error {
+	s.liberar++
+	return s.IdempotenciaStore.Liberar(ctx, alcance, clave, reservada)
+}
+
+// Tras una respuesta que no es 5xx la reserva no se libera aunque no se pueda guardar:
+// el reintento recibe 409 en vez de repetir los efectos
+func TestIdempotenciaNoLiberaTrasExito(t *testing.T) {
+	solicitudes := &idempotenciaSinCompletar{IdempotenciaStore: store.NuevoMemoria().Idempotencia}
+	cfg := config.Idempotencia{Retencion: 24 * time.Hour, TiempoMaximo: 30 * time.Second, Abandono: time.Minute}
+	atendidas := 0
+	h := Idempotencia(solicitudes, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atendidas++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	pedir := func() int {
+		solicitud := httptest.NewRequest(http.MethodPost, "/facturas", strings.NewReader(`{"viaje":"I-1"}`))
+		solicitud.Header.Set(CabeceraIdempotencia, "venta-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, solicitud)
+		return w.Code
+	}
+
+	if estado := pedir(); estado != http.StatusCreated {
+		t.Fatalf("primera solicitud: %d", estado)
+	}
+	if solicitudes.completar != intentosCompletar || solicitudes.liberar != 0 {
+		t.Errorf("Completar %d veces y Liberar %d, se esperaba %d y 0", solicitudes.completar, solicitudes.liberar, intentosCompletar)
+	}
+	if estado := pedir(); estado != http.StatusConflict || atendidas != 1 {
+		t.Errorf("reintento: %d con %d solicitudes atendidas, se esperaba 409 y 1", estado, atendidas)
+	}
+}
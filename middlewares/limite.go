@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/go-chi/chi/v5"
+)
+
+// LimitePorIP limita las solicitudes de cada IP. Para rutas publicas. La IP es la que
+// resuelve ClienteReal, la misma del bloqueo del login: detras de un proxy de confianza
+// cada cliente tiene su cubeta en lugar de compartir la del proxy
+func LimitePorIP(almacen security.AlmacenLimites, cfg config.Limites) func(http.Handler) http.Handler {
+	return limitarTasa(almacen, cfg, cfg.PorIP, func(r *http.Request) string {
+		return security.ClaveIP(helpers.IPCliente(r))
+	})
+}
+
+// LimitePorUsuario limita las solicitudes de cada usuario o clave API. Debe ir despues
+// de la autenticacion; sin claims se limita por IP
+func LimitePorUsuario(almacen security.AlmacenLimites, cfg config.Limites) func(http.Handler) http.Handler {
+	return limitarTasa(almacen, cfg, cfg.PorUsuario, func(r *http.Request) string {
+		claims := UsuarioDesdeContexto(r.Context())
+		switch {
+		case claims == nil:
+			return security.ClaveIP(helpers.IPCliente(r))
+		case claims.EsClaveAPI():
+			return "clave_api:" + claims.ClaveAPI
+		default:
+			return "usuario:" + claims.UsuarioID
+		}
+	})
+}
+
+// Aplica la tasa de la ruta si tiene una propia o la general del cliente. Se registra con
+// r.With o dentro de r.Group para que chi ya haya resuelto el patron de la ruta
+func limitarTasa(almacen security.AlmacenLimites, cfg config.Limites, general security.Tasa, identificar func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Activo {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clave, tasa := identificar(r), general
+			ruta := r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+			if propia, ok := cfg.Rutas[ruta]; ok {
+				clave, tasa = ruta+"|"+clave, propia
+			}
+
+			resultado, err := almacen.Tomar(r.Context(), clave, tasa)
+			if err != nil {
+				//Si el almacen compartido falla se deja pasar la solicitud
+				helpers.Logger(r.Context()).Error("Error consultando limite de solicitudes", slog.Any("error", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !resultado.Permitido {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(resultado.Espera.Seconds()))))
+				helpers.ResponderError(w, r, helpers.NuevoError(http.StatusTooManyRequests, helpers.CodigoLimiteExcedido, "Demasiadas solicitudes, intente más tarde"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/go-chi/chi/v5"
+)
+
+// Detras de un proxy de confianza cada cliente consume su propia cubeta
+func TestLimitePorIPDetrasDeProxy(t *testing.T) {
+	cfg := config.Limites{Activo: true, PorIP: security.Tasa{Solicitudes: 2, Periodo: time.Minute}}
+	r := chi.NewRouter()
+	r.Use(ClienteReal([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+	r.With(LimitePorIP(security.NuevoLimitadorMemoria(), cfg)).Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	pedir := func(cliente string) int {
+		solicitud := httptest.NewRequest(http.MethodGet, "/", nil)
+		solicitud.RemoteAddr = "10.0.0.1:4000"
+		solicitud.Header.Set("X-Forwarded-For", cliente)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, solicitud)
+		return w.Code
+	}
+
+	for range cfg.PorIP.Solicitudes {
+		if estado := pedir("203.0.113.7"); estado != http.StatusOK {
+			t.Fatalf("estado %d dentro del limite", estado)
+		}
+	}
+	if estado := pedir("203.0.113.7"); estado != http.StatusTooManyRequests {
+		t.Errorf("estado %d, se esperaba 429 al superar el limite", estado)
+	}
+	if estado := pedir("203.0.113.8"); estado != http.StatusOK {
+		t.Errorf("estado %d: otro cliente detras del mismo proxy no deberia estar limitado", estado)
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
+	"github.com/go-chi/chi/v5"
+)
+
+// Metricas mide las solicitudes por patron de ruta de chi (p. ej. /api/ferry/buscar/{matricula})
+// para no crear una serie por cada valor de los parametros. Las rutas inexistentes se
+// agrupan en "sin_ruta"
+func Metricas(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		respuesta := &respuestaMedida{ResponseWriter: w}
+		defer func() {
+			ruta := "sin_ruta"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				ruta = rctx.RoutePattern()
+			}
+			estado := respuesta.estado
+			if estado == 0 {
+				estado = http.StatusOK
+			}
+			metrics.ObservarSolicitud(r.Method, ruta, estado, time.Since(inicio).Seconds())
+		}()
+
+		next.ServeHTTP(respuesta, r)
+	})
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Obsoleta marca las respuestas de una ruta de la v1 como obsoletas desde la fecha indicada
+// (cabecera Deprecation, RFC 9745) y enlaza la ruta que la reemplaza. sucesora es el patron
+// de la v2; sus {parametros} se completan con los de la solicitud
+func Obsoleta(desde time.Time, sucesora string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(desde.Unix(), 10)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ruta := sucesora
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				for i, clave := range rctx.URLParams.Keys {
+					ruta = strings.ReplaceAll(ruta, "{"+clave+"}", rctx.URLParams.Values[i])
+				}
+			}
+
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Add("Link", "<"+ruta+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RegistroAcceso deja una linea de log por solicitud con su estado, duracion, bytes
+// enviados y usuario, y pone en el contexto un logger con el id de la solicitud para los
+// handlers. Tambien recupera los panics para responder 500 en lugar de cortar la conexion.
+// Debe ir despues de IDSolicitud y de Trazas
+func RegistroAcceso(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inicio := time.Now()
+			solicitud := logger.With(
+				slog.String("id_solicitud", helpers.IDSolicitud(r.Context())),
+				slog.String("metodo", r.Method),
+				slog.String("ruta", r.URL.Path),
+			)
+			//Con trazas activas o un traceparent recibido los logs llevan el id de la traza
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				solicitud = solicitud.With(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+			}
+			ctx, usuario := helpers.ConUsuarioLog(helpers.ConLogger(r.Context(), solicitud))
+			respuesta := &respuestaMedida{ResponseWriter: w}
+
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					solicitud.Error("Panic atendiendo la solicitud", slog.Any("panic", p), slog.String("pila", string(debug.Stack())))
+					if respuesta.estado == 0 {
+						helpers.ResponderError(respuesta, r, helpers.NuevoError(http.StatusInternalServerError, helpers.CodigoInterno, "Error interno del servidor"))
+					}
+				}
+
+				estado := respuesta.estado
+				if estado == 0 {
+					estado = http.StatusOK
+				}
+				nivel := slog.LevelInfo
+				switch {
+				case estado >= http.StatusInternalServerError:
+					nivel = slog.LevelError
+				case estado >= http.StatusBadRequest:
+					nivel = slog.LevelWarn
+				}
+				solicitud.LogAttrs(r.Context(), nivel, "Solicitud atendida",
+					slog.Int("estado", estado),
+					slog.Float64("duracion_ms", float64(time.Since(inicio).Microseconds())/1000),
+					slog.Int64("bytes", respuesta.bytes),
+					slog.String("usuario", usuario()),
+					slog.String("ip", helpers.IPCliente(r)),
+				)
+			}()
+
+			next.ServeHTTP(respuesta, r.WithContext(ctx))
+		})
+	}
+}
+
+// respuestaMedida cuenta el estado y los bytes escritos de la respuesta
+type respuestaMedida struct {
+	http.ResponseWriter
+	estado int
+	bytes  int64
+}
+
+func (m *respuestaMedida) WriteHeader(estado int) {
+	if m.estado == 0 {
+		m.estado = estado
+	}
+	m.ResponseWriter.WriteHeader(estado)
+}
+
+func (m *respuestaMedida) Write(b []byte) (int, error) {
+	if m.estado == 0 {
+		m.estado = http.StatusOK
+	}
+	n, err := m.ResponseWriter.Write(b)
+	m.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap permite a http.ResponseController llegar al writer original (Flush, plazos)
+func (m *respuestaMedida) Unwrap() http.ResponseWriter {
+	return m.ResponseWriter
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+)
+
+// CabecerasSeguridad añade a todas las respuestas las cabeceras de seguridad estandar.
+// La API solo devuelve JSON y descargas, por lo que no necesita cargar recursos ni
+// mostrarse dentro de un marco
+func CabecerasSeguridad(cfg config.Seguridad) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.HSTS > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTS.Seconds()))
+		if cfg.HSTSSubdominios {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	//frame-ancestors reemplaza a X-Frame-Options en los navegadores actuales
+	marcos := "'none'"
+	if cfg.OpcionesMarco == "SAMEORIGIN" {
+		marcos = "'self'"
+	}
+	csp := "default-src 'none'; frame-ancestors " + marcos
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			if hsts != "" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", cfg.OpcionesMarco)
+			h.Set("Referrer-Policy", "no-referrer")
+			h.Set("Content-Security-Policy", csp)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+// Cabecera con la que se recibe y se devuelve el id de la solicitud
+const CabeceraIDSolicitud = "X-Request-Id"
+
+// Solo se reutilizan ids recibidos con un formato seguro para logs y cabeceras
+var patronIDSolicitud = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// IDSolicitud asigna un id a cada solicitud (o reutiliza el del cliente/proxy) y lo
+// devuelve en la respuesta, para poder relacionar errores reportados con los logs
+func IDSolicitud(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(CabeceraIDSolicitud)
+		if !patronIDSolicitud.MatchString(id) {
+			id = helpers.NuevoIDSolicitud()
+		}
+		w.Header().Set(CabeceraIDSolicitud, id)
+		next.ServeHTTP(w, r.WithContext(helpers.ConIDSolicitud(r.Context(), id)))
+	})
+}
+
+// ClienteReal resuelve la IP del cliente que usan los logs, los limites de solicitudes y el
+// bloqueo del login. X-Forwarded-For solo se lee si la conexion viene de un proxy de
+// confianza, y de derecha a izquierda: la primera IP que no es de un proxy de confianza
+// es la del cliente. Sin proxies se usa siempre la IP de la conexion. Debe ir antes que
+// cualquier middleware que use helpers.IPCliente
+func ClienteReal(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	confiable := func(ip netip.Addr) bool {
+		return slices.ContainsFunc(proxies, func(p netip.Prefix) bool { return p.Contains(ip) })
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ipReenviada(helpers.IPRemota(r), r.Header.Values("X-Forwarded-For"), confiable)
+			next.ServeHTTP(w, r.WithContext(helpers.ConIPCliente(r.Context(), ip)))
+		})
+	}
+}
+
+func ipReenviada(remota string, reenviada []string, confiable func(netip.Addr) bool) string {
+	ip, err := netip.ParseAddr(remota)
+	if err != nil || !confiable(ip.Unmap()) {
+		return remota
+	}
+
+	//Cada proxy agrega la IP de quien le envio la solicitud al final de la lista
+	var saltos []string
+	for _, cabecera := range reenviada {
+		saltos = append(saltos, strings.Split(cabecera, ",")...)
+	}
+	cliente := remota
+	for i := len(saltos) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(saltos[i]))
+		if err != nil {
+			break
+		}
+		cliente = ip.Unmap().String()
+		if !confiable(ip.Unmap()) {
+			break
+		}
+	}
+	return cliente
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+func TestClienteReal(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.5/32")}
+	casos := []struct {
+		nombre    string
+		proxies   []netip.Prefix
+		remota    string
+		reenviada []string
+		ip        string
+	}{
+		{"sin proxies se ignora la cabecera", nil, "10.0.0.1:4000", []string{"203.0.113.7"}, "10.0.0.1"},
+		{"conexion directa de un cliente", proxies, "198.51.100.2:4000", []string{"203.0.113.7"}, "198.51.100.2"},
+		{"un proxy de confianza", proxies, "10.0.0.1:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"cadena de proxies", proxies, "10.0.0.1:4000", []string{"203.0.113.7, 192.168.1.5"}, "203.0.113.7"},
+		{"varias cabeceras", proxies, "10.0.0.1:4000", []string{"203.0.113.7", "10.2.3.4"}, "203.0.113.7"},
+		//El cliente puede inventar las IPs de la izquierda, no la que agrego el proxy
+		{"IP falsificada por el cliente", proxies, "10.0.0.1:4000", []string{"1.1.1.1, 203.0.113.7"}, "203.0.113.7"},
+		{"solo proxies", proxies, "10.0.0.1:4000", []string{"10.9.9.9"}, "10.9.9.9"},
+		{"sin cabecera", proxies, "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"valor invalido", proxies, "10.0.0.1:4000", []string{"no-es-ip, 10.9.9.9"}, "10.9.9.9"},
+		{"IPv4 en IPv6", proxies, "[::ffff:10.0.0.1]:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			var ip string
+			h := ClienteReal(c.proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip = helpers.IPCliente(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = c.remota
+			for _, valor := range c.reenviada {
+				r.Header.Add("X-Forwarded-For", valor)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if ip != c.ip {
+				t.Errorf("IP %q, se esperaba %q", ip, c.ip)
+			}
+		})
+	}
+}
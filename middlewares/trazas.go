@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trazas abre un span por solicitud continuando la traza recibida en traceparent. El
+// nombre del span usa el patron de ruta de chi, que solo se conoce despues de enrutar
+func Trazas(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(helpers.IPCliente(r)),
+			),
+		)
+		defer span.End()
+
+		respuesta := &respuestaMedida{ResponseWriter: w}
+		next.ServeHTTP(respuesta, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+		estado := respuesta.estado
+		if estado == 0 {
+			estado = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(estado))
+		if estado >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(estado))
+		}
+	})
+}
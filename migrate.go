@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/database"
+)
+
+const usoMigrate = `Uso: %s migrate <comando>
+
+Comandos:
+  up            aplica todas las migraciones pendientes
+  down [n]      revierte las ultimas n migraciones (por defecto 1)
+  status        muestra las migraciones y si estan aplicadas
+  to <version>  sube o baja hasta la version indicada (0 revierte todo)
+`
+
+// Subcomando migrate: administra el esquema con las migraciones embebidas en el binario
+func ejecutarMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usoMigrate, os.Args[0])
+		return 2
+	}
+
+	cfg, err := config.Cargar()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	pool, err := database.ConectarBD(cfg.BaseDatos)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error al conectar:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	migrador, err := database.NuevoMigrador(pool)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	var afectadas []int
+	switch args[0] {
+	case "up":
+		afectadas, err = migrador.Subir(ctx)
+	case "down":
+		pasos := 1
+		if len(args) > 1 {
+			if pasos, err = strconv.Atoi(args[1]); err != nil || pasos <= 0 {
+				fmt.Fprintln(os.Stderr, "n debe ser un entero positivo")
+				return 2
+			}
+		}
+		afectadas, err = migrador.Bajar(ctx, pasos)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, usoMigrate, os.Args[0])
+			return 2
+		}
+		version, errVersion := strconv.Atoi(args[1])
+		if errVersion != nil {
+			fmt.Fprintln(os.Stderr, "version invalida:", args[1])
+			return 2
+		}
+		afectadas, err = migrador.IrA(ctx, version)
+	case "status":
+		estados, err := migrador.Estado(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, e := range estados {
+			aplicada := "pendiente"
+			if e.Aplicada != nil {
+				aplicada = "aplicada " + e.Aplicada.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s %s\n", e.Version, e.Nombre, aplicada)
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, usoMigrate, os.Args[0])
+		return 2
+	}
+
+	//Aunque falle se informan las migraciones que si se ejecutaron
+	for _, v := range afectadas {
+		fmt.Printf("migracion %04d ejecutada\n", v)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if len(afectadas) == 0 {
+		fmt.Println("Sin cambios")
+	}
+	return 0
+}
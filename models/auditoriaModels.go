@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RegistroAuditoria es una entrada del registro de auditoria. Cada entrada guarda el hash
+// de la anterior, por lo que modificar o borrar una rompe la cadena
+type RegistroAuditoria struct {
+	ID           int                    `json:"id"`
+	Actor        string                 `json:"actor"`
+	TipoActor    string                 `json:"tipo_actor"`
+	Accion       string                 `json:"accion"`
+	Entidad      string                 `json:"entidad"`
+	EntidadID    string                 `json:"entidad_id"`
+	Cambios      map[string]CambioCampo `json:"cambios,omitempty"`
+	IP           string                 `json:"ip"`
+	IDSolicitud  string                 `json:"id_solicitud"`
+	Fecha        time.Time              `json:"fecha"`
+	HashAnterior string                 `json:"hash_anterior"`
+	Hash         string                 `json:"hash"`
+}
+
+// CambioCampo es el valor de un campo antes y despues del cambio (nil si no existia)
+type CambioCampo struct {
+	Antes   any `json:"antes"`
+	Despues any `json:"despues"`
+}
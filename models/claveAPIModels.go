@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type ClaveAPI struct {
+	ID         int        `json:"id"`
+	Prefijo    string     `json:"prefijo"`
+	RifEmpresa string     `json:"rif_empresa"`
+	Nombre     string     `json:"nombre"`
+	Alcances   []string   `json:"alcances"`
+	Expira     *time.Time `json:"expira,omitempty"`
+	Revocada   bool       `json:"revocada"`
+	Creada     time.Time  `json:"creada"`
+	UltimoUso  *time.Time `json:"ultimo_uso,omitempty"`
+}
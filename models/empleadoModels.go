@@ -1,12 +1,13 @@
 package models
 
 type Empleados struct {
-	Cedula      string `json:"cedula"`
-	Nombres     string `json:"nombres"`
-	Apellidos   string `json:"apellidos"`
-	Rif_empresa string `json:"rif_empresa"`
-	Email       string `json:"email"`
-	Cargo       string `json:"cargo"`
+	Cedula      string `json:"cedula" validar:"requerido,cedula"`
+	Nombres     string `json:"nombres" validar:"requerido,max=100"`
+	Apellidos   string `json:"apellidos" validar:"requerido,max=100"`
+	Rif_empresa string `json:"rif_empresa" validar:"requerido,rif"`
+	Email       string `json:"email" validar:"requerido,email,max=150"`
+	Cargo       string `json:"cargo" validar:"requerido,max=100"`
 	Estado      bool   `json:"estado"`
-	Numero_tlf  string `json:"numero_tlf"`
+	Numero_tlf  string `json:"numero_tlf" validar:"requerido,telefono"`
+	Version     int    `json:"version"`
 }
@@ -1,9 +1,10 @@
 package models
 
 type Empresa struct {
-	RIF       string `json:"rif"`
-	Nombre    string `json:"nombre"`
-	Email     string `json:"email"`
+	RIF       string `json:"rif" validar:"requerido,rif"`
+	Nombre    string `json:"nombre" validar:"requerido,max=150"`
+	Email     string `json:"email" validar:"requerido,email,max=150"`
 	Direccion string `json:"direccion"`
 	Estado    bool   `json:"estado"`
+	Version   int    `json:"version"`
 }
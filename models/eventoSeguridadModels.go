@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type EventoSeguridad struct {
+	Tipo    string    `json:"tipo"`
+	Usuario string    `json:"usuario"`
+	IP      string    `json:"ip"`
+	Detalle string    `json:"detalle"`
+	Fecha   time.Time `json:"fecha"`
+}
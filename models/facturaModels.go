@@ -4,15 +4,15 @@ import "time"
 
 type Factura struct {
 	IDFactura        int       `json:"id_factura"`
-	NombresViajero   string    `json:"nombres_viajero"`
-	ApellidosViajero string    `json:"apellidos_viajero"`
-	RIFEmpresa       string    `json:"rif_empresa"`
-	CedulaEmpleado   string    `json:"cedula_empleado"`
-	NombreEmpleado   string    `json:"nombre_empleado"`
-	IDViaje          string    `json:"id_viaje"`
-	Tipo             string    `json:"tipo"`
+	NombresViajero   string    `json:"nombres_viajero" validar:"requerido,max=100"`
+	ApellidosViajero string    `json:"apellidos_viajero" validar:"requerido,max=100"`
+	RIFEmpresa       string    `json:"rif_empresa" validar:"requerido,rif"`
+	CedulaEmpleado   string    `json:"cedula_empleado" validar:"requerido,cedula"`
+	NombreEmpleado   string    `json:"nombre_empleado" validar:"requerido,max=200"`
+	IDViaje          string    `json:"id_viaje" validar:"requerido,max=50"`
+	Tipo             string    `json:"tipo" validar:"requerido,uno_de=economica|vip"`
 	Estado           bool      `json:"estado"`
 	Nota             string    `json:"nota,omitempty"`
 	Emision          time.Time `json:"emision"`
-	MatriculaFerry   string    `json:"matricula_ferry"`
+	MatriculaFerry   string    `json:"matricula_ferry" validar:"requerido,max=30"`
 }
@@ -1,11 +1,12 @@
 package models
 
 type Ferry struct {
-	Matricula          string `json:"matricula"`
-	RifEmpresa         string `json:"rif_empresa"`
-	Nombre             string `json:"nombre"`
-	Modelo             string `json:"modelo"`
-	CapacidadEconomica int    `json:"capacidad_economica"`
-	CapacidadVIP       int    `json:"capacidad_vip"`
+	Matricula          string `json:"matricula" validar:"requerido,max=30"`
+	RifEmpresa         string `json:"rif_empresa" validar:"requerido,rif"`
+	Nombre             string `json:"nombre" validar:"requerido,max=100"`
+	Modelo             string `json:"modelo" validar:"requerido,max=100"`
+	CapacidadEconomica int    `json:"capacidad_economica" validar:"requerido,min=1"`
+	CapacidadVIP       int    `json:"capacidad_vip" validar:"requerido,min=1"`
 	Estado             bool   `json:"estado"`
+	Version            int    `json:"version"`
 }
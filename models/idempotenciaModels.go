@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SolicitudIdempotente guarda la respuesta de un POST identificado por Idempotency-Key.
+// Estado 0 indica que la solicitud original todavia se esta procesando
+type SolicitudIdempotente struct {
+	Alcance       string
+	Clave         string
+	HashSolicitud string
+	Estado        int
+	TipoContenido string
+	Cuerpo        []byte
+	Creada        time.Time
+	Expira        time.Time
+	// Momento de la reserva mientras Estado es 0; identifica a la solicitud que la tiene
+	Reservada time.Time
+}
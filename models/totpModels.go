@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type TOTP struct {
+	RifCedula           string    `json:"rif_cedula"`
+	Secreto             string    `json:"-"`
+	Activo              bool      `json:"activo"`
+	UltimoPaso          int64     `json:"-"`
+	CodigosRecuperacion []string  `json:"-"`
+	Creado              time.Time `json:"creado"`
+}
@@ -1,9 +1,24 @@
 package models
 
 type Usuario struct {
+	Rif_Cedula string `json:"rif_cedula" validar:"rif_cedula"`
+	Usuario    string `json:"usuario" validar:"requerido,min=4,max=120"`
+	Contrasena string `json:"contrasena" validar:"requerido"`
+	Tipo       string `json:"tipo" validar:"uno_de=Administrador|empresa|empleado"`
+	Estado     bool   `json:"estado"`
+	Version    int    `json:"version"`
+}
+
+// UsuarioPublico es el usuario tal como lo devuelve la API: sin el hash de la contraseña
+type UsuarioPublico struct {
 	Rif_Cedula string `json:"rif_cedula"`
 	Usuario    string `json:"usuario"`
-	Contrasena string `json:"contrasena"`
 	Tipo       string `json:"tipo"`
 	Estado     bool   `json:"estado"`
+	Version    int    `json:"version"`
+}
+
+// Publico descarta el hash de la contraseña
+func (u Usuario) Publico() UsuarioPublico {
+	return UsuarioPublico{Rif_Cedula: u.Rif_Cedula, Usuario: u.Usuario, Tipo: u.Tipo, Estado: u.Estado, Version: u.Version}
 }
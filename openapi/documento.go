@@ -0,0 +1,290 @@
+// Package openapi describe la API en un documento OpenAPI 3.0. Las operaciones se
+// declaran en rutas.go y los esquemas se generan de los modelos a partir de sus
+// etiquetas json y validar, por lo que cambiar un modelo actualiza el documento. Se
+// sirve en /openapi.json y con Redoc en /docs
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+const versionAPI = "2.0.0"
+
+// Documento es la raiz del documento OpenAPI
+type Documento struct {
+	OpenAPI     string                           `json:"openapi"`
+	Info        Info                             `json:"info"`
+	Etiquetas   []Etiqueta                       `json:"tags,omitempty"`
+	Rutas       map[string]map[string]*Operacion `json:"paths"`
+	Componentes Componentes                      `json:"components"`
+}
+
+type Info struct {
+	Titulo      string `json:"title"`
+	Descripcion string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Etiqueta struct {
+	Nombre      string `json:"name"`
+	Descripcion string `json:"description,omitempty"`
+}
+
+type Componentes struct {
+	Esquemas   map[string]*Esquema         `json:"schemas"`
+	Respuestas map[string]*Respuesta       `json:"responses"`
+	Seguridad  map[string]EsquemaSeguridad `json:"securitySchemes"`
+}
+
+type EsquemaSeguridad struct {
+	Tipo        string `json:"type"`
+	Esquema     string `json:"scheme,omitempty"`
+	Formato     string `json:"bearerFormat,omitempty"`
+	Nombre      string `json:"name,omitempty"`
+	En          string `json:"in,omitempty"`
+	Descripcion string `json:"description,omitempty"`
+}
+
+// Requisito de seguridad: esquemas que deben cumplirse juntos. Una lista de requisitos
+// se cumple con cualquiera de ellos
+type Requisito map[string][]string
+
+type Operacion struct {
+	Etiquetas   []string              `json:"tags,omitempty"`
+	Resumen     string                `json:"summary"`
+	Descripcion string                `json:"description,omitempty"`
+	ID          string                `json:"operationId"`
+	Parametros  []Parametro           `json:"parameters,omitempty"`
+	Cuerpo      *Cuerpo               `json:"requestBody,omitempty"`
+	Respuestas  map[string]*Respuesta `json:"responses"`
+	Seguridad   []Requisito           `json:"security,omitempty"`
+	Obsoleta    bool                  `json:"deprecated,omitempty"`
+}
+
+type Parametro struct {
+	Nombre      string   `json:"name"`
+	En          string   `json:"in"`
+	Descripcion string   `json:"description,omitempty"`
+	Requerido   bool     `json:"required,omitempty"`
+	Esquema     *Esquema `json:"schema"`
+}
+
+type Cuerpo struct {
+	Requerido bool                 `json:"required"`
+	Contenido map[string]TipoMedio `json:"content"`
+}
+
+type Respuesta struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Descripcion string               `json:"description,omitempty"`
+	Cabeceras   map[string]Cabecera  `json:"headers,omitempty"`
+	Contenido   map[string]TipoMedio `json:"content,omitempty"`
+}
+
+type Cabecera struct {
+	Descripcion string   `json:"description,omitempty"`
+	Esquema     *Esquema `json:"schema"`
+}
+
+type TipoMedio struct {
+	Esquema *Esquema `json:"schema"`
+}
+
+// Construir arma el documento completo. Entra en panico si una ruta se declara dos veces
+func Construir() *Documento {
+	g := &generador{
+		doc: &Documento{
+			OpenAPI: "3.0.3",
+			Info: Info{
+				Titulo:      "FerryApp API",
+				Descripcion: descripcionAPI,
+				Version:     versionAPI,
+			},
+			Etiquetas: etiquetas,
+			Rutas:     map[string]map[string]*Operacion{},
+		},
+		esquemas: map[string]*Esquema{},
+	}
+	g.componentes()
+	declararRutas(g)
+	g.doc.Componentes.Esquemas = g.esquemas
+	return g.doc
+}
+
+// Operaciones devuelve "METODO /ruta" de todas las operaciones documentadas, ordenadas
+func (d *Documento) Operaciones() []string {
+	var operaciones []string
+	for ruta, metodos := range d.Rutas {
+		for metodo := range metodos {
+			operaciones = append(operaciones, strings.ToUpper(metodo)+" "+ruta)
+		}
+	}
+	sort.Strings(operaciones)
+	return operaciones
+}
+
+type generador struct {
+	doc      *Documento
+	esquemas map[string]*Esquema
+}
+
+var parametroRuta = regexp.MustCompile(`\{([^}]+)\}`)
+
+// operacion registra la operacion y completa lo comun: parametros de la ruta, id y las
+// respuestas de error de autenticacion y limites que aplican a todas las protegidas
+func (g *generador) operacion(metodo, ruta string, op *Operacion) {
+	metodos := g.doc.Rutas[ruta]
+	if metodos == nil {
+		metodos = map[string]*Operacion{}
+		g.doc.Rutas[ruta] = metodos
+	}
+	clave := strings.ToLower(metodo)
+	if _, existe := metodos[clave]; existe {
+		panic("openapi: operacion duplicada " + metodo + " " + ruta)
+	}
+
+	var deRuta []Parametro
+	for _, m := range parametroRuta.FindAllStringSubmatch(ruta, -1) {
+		p := Parametro{Nombre: m[1], En: "path", Requerido: true, Esquema: &Esquema{Tipo: "string"}}
+		if base, ok := parametrosRuta[m[1]]; ok {
+			p.Descripcion, p.Esquema = base.Descripcion, base.Esquema
+		}
+		deRuta = append(deRuta, p)
+	}
+	op.Parametros = append(deRuta, op.Parametros...)
+
+	if op.ID == "" {
+		op.ID = idOperacion(metodo, ruta)
+	}
+	if len(op.Seguridad) > 0 && len(op.Seguridad[0]) > 0 {
+		g.errores(op, http.StatusUnauthorized, http.StatusTooManyRequests)
+	}
+	g.errores(op, http.StatusInternalServerError)
+	metodos[clave] = op
+}
+
+// recurso registra la operacion de la v2 y, marcadas como obsoletas, las rutas de la v1
+// que atiende el mismo handler ("METODO /ruta"). Las copias se toman antes de registrar la
+// v2, asi que lo que se cambie despues en op solo aplica a la v2
+func (g *generador) recurso(metodo, ruta string, op *Operacion, anteriores ...string) {
+	for _, anterior := range anteriores {
+		metodoV1, rutaV1, _ := strings.Cut(anterior, " ")
+		v1 := *op
+		v1.Obsoleta = true
+		v1.Descripcion = strings.TrimSpace("Obsoleta: use " + metodo + " " + ruta + ". " + op.Descripcion)
+		g.operacion(metodoV1, rutaV1, &v1)
+	}
+	g.operacion(metodo, ruta, op)
+}
+
+// errores añade a la operacion las respuestas de error comunes por su estado HTTP
+func (g *generador) errores(op *Operacion, estados ...int) {
+	for _, estado := range estados {
+		nombre, ok := respuestasError[estado]
+		if !ok {
+			panic("openapi: respuesta de error no declarada para " + strconv.Itoa(estado))
+		}
+		op.Respuestas[strconv.Itoa(estado)] = &Respuesta{Ref: "#/components/responses/" + nombre.componente}
+	}
+}
+
+// esquema de un valor de ejemplo del tipo a describir
+func (g *generador) esquema(v any) *Esquema {
+	return g.esquemaDe(reflect.TypeOf(v))
+}
+
+// json describe un cuerpo de solicitud JSON con la forma de v
+func (g *generador) json(v any) *Cuerpo {
+	return &Cuerpo{Requerido: true, Contenido: map[string]TipoMedio{"application/json": {Esquema: g.esquema(v)}}}
+}
+
+// respuesta JSON con la forma de v
+func (g *generador) respuesta(descripcion string, v any) *Respuesta {
+	return &Respuesta{
+		Descripcion: descripcion,
+		Contenido:   map[string]TipoMedio{"application/json": {Esquema: g.esquema(v)}},
+	}
+}
+
+// Id estable a partir del metodo y la ruta: PUT /api/v2/empresas/{rif}/estado es
+// put_api_v2_empresas_rif_estado
+func idOperacion(metodo, ruta string) string {
+	limpio := strings.NewReplacer("{", "", "}", "", "-", "_", ".", "").Replace(ruta)
+	partes := strings.FieldsFunc(limpio, func(r rune) bool { return r == '/' })
+	return strings.ToLower(metodo) + "_" + strings.Join(partes, "_")
+}
+
+// Respuestas de error comunes, todas con el sobre de helpers
+var respuestasError = map[int]struct {
+	componente  string
+	descripcion string
+	codigos     []string
+}{
+	http.StatusBadRequest: {"SolicitudInvalida", "Cuerpo o parametros invalidos. En errores de validacion, detalles lista los campos",
+		[]string{helpers.CodigoJSONInvalido, helpers.CodigoValidacion, helpers.CodigoPoliticaContrasena, helpers.CodigoReferenciaInvalida, helpers.CodigoRestriccion}},
+	http.StatusUnauthorized: {"NoAutenticado", "Falta el token o la clave API, o no son validos",
+		[]string{helpers.CodigoNoAutenticado, helpers.CodigoCredencialesInvalidas, helpers.CodigoCodigoInvalido}},
+	http.StatusForbidden: {"Prohibido", "El usuario o la clave API no tienen permiso para la operacion",
+		[]string{helpers.CodigoProhibido, helpers.CodigoCuentaInactiva}},
+	http.StatusNotFound: {"NoEncontrado", "El registro no existe",
+		[]string{helpers.CodigoNoEncontrado}},
+	http.StatusConflict: {"Conflicto", "El registro ya existe, o la Idempotency-Key se reutilizo con otro cuerpo o sigue en proceso",
+		[]string{helpers.CodigoConflicto, helpers.CodigoIdempotenciaConflicto, helpers.CodigoSolicitudEnProceso}},
+	http.StatusPreconditionFailed: {"VersionObsoleta", "If-Match no coincide con la version actual del registro",
+		[]string{helpers.CodigoVersionObsoleta}},
+	http.StatusPreconditionRequired: {"PrecondicionRequerida", "Falta la cabecera If-Match",
+		[]string{helpers.CodigoPrecondicionRequerida}},
+	http.StatusTooManyRequests: {"LimiteExcedido", "Demasiadas solicitudes o intentos fallidos; Retry-After indica los segundos de espera",
+		[]string{helpers.CodigoLimiteExcedido, helpers.CodigoDemasiadosIntentos}},
+	http.StatusInternalServerError: {"ErrorInterno", "Error inesperado; id_solicitud permite ubicarlo en los logs",
+		[]string{helpers.CodigoInterno}},
+}
+
+// Sobre de error de helpers.ResponderError
+type sobreError struct {
+	Error struct {
+		Codigo      string `json:"codigo" validar:"requerido" doc:"Codigo estable del error"`
+		Mensaje     string `json:"mensaje" validar:"requerido" doc:"Descripcion para mostrar al usuario"`
+		Detalles    any    `json:"detalles,omitempty" doc:"Informacion adicional; en validaciones, lista de {campo, mensaje}"`
+		IDSolicitud string `json:"id_solicitud,omitempty" doc:"Id de la solicitud (X-Request-Id)"`
+	} `json:"error" validar:"requerido"`
+}
+
+func (g *generador) componentes() {
+	g.esquemas["Error"] = g.objeto(reflect.TypeOf(sobreError{}))
+
+	respuestas := map[string]*Respuesta{}
+	for _, r := range respuestasError {
+		sobre := &Esquema{Ref: "#/components/schemas/Error", Descripcion: "Codigos: " + strings.Join(r.codigos, ", ")}
+		respuesta := &Respuesta{Descripcion: r.descripcion, Contenido: map[string]TipoMedio{"application/json": {Esquema: sobre}}}
+		if r.componente == "LimiteExcedido" {
+			respuesta.Cabeceras = map[string]Cabecera{"Retry-After": {Descripcion: "Segundos hasta poder reintentar", Esquema: &Esquema{Tipo: "integer"}}}
+		}
+		respuestas[r.componente] = respuesta
+	}
+
+	g.doc.Componentes = Componentes{
+		Respuestas: respuestas,
+		Seguridad: map[string]EsquemaSeguridad{
+			esquemaJWT: {
+				Tipo: "http", Esquema: "bearer", Formato: "JWT",
+				Descripcion: "Token de sesion de POST /api/v2/sesiones. Las claves publicas estan en /.well-known/jwks.json",
+			},
+			esquemaClaveAPI: {
+				Tipo: "apiKey", Nombre: "X-API-Key", En: "header",
+				Descripcion: "Clave API de una empresa (POST /api/v2/claves-api), limitada a sus alcances",
+			},
+			esquemaMetricas: {
+				Tipo: "http", Esquema: "bearer",
+				Descripcion: "metricas.token, solo si esta configurado",
+			},
+		},
+	}
+}
@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Esquema es un Schema Object de OpenAPI 3.0
+type Esquema struct {
+	Ref            string              `json:"$ref,omitempty"`
+	Tipo           string              `json:"type,omitempty"`
+	Formato        string              `json:"format,omitempty"`
+	Descripcion    string              `json:"description,omitempty"`
+	Propiedades    map[string]*Esquema `json:"properties,omitempty"`
+	Requeridos     []string            `json:"required,omitempty"`
+	Elementos      *Esquema            `json:"items,omitempty"`
+	Adicionales    *Esquema            `json:"additionalProperties,omitempty"`
+	UnoDe          []*Esquema          `json:"oneOf,omitempty"`
+	Enum           []string            `json:"enum,omitempty"`
+	Patron         string              `json:"pattern,omitempty"`
+	LongitudMinima *int                `json:"minLength,omitempty"`
+	LongitudMaxima *int                `json:"maxLength,omitempty"`
+	Minimo         *int                `json:"minimum,omitempty"`
+	Maximo         *int                `json:"maximum,omitempty"`
+	Nulable        bool                `json:"nullable,omitempty"`
+	Ejemplo        any                 `json:"example,omitempty"`
+}
+
+var tipoTiempo = reflect.TypeOf(time.Time{})
+
+// Formatos de la etiqueta validar (ver el paquete validation) expresados en el esquema
+var formatosValidar = map[string]Esquema{
+	"email":      {Formato: "email", Ejemplo: "contacto@ferry.com"},
+	"rif":        {Patron: `^[JGVE]-?\d{8}-?\d$`, Ejemplo: "J-12345678-4", Descripcion: "RIF con digito verificador"},
+	"cedula":     {Patron: `^([VE]-?)?\d{6,9}$`, Ejemplo: "V-12345678"},
+	"rif_cedula": {Descripcion: "RIF (J-12345678-4) o cédula (V-12345678)"},
+	"telefono":   {Ejemplo: "0414-1234567", Descripcion: "Teléfono venezolano nacional o internacional"},
+}
+
+// esquemaDe genera el esquema de un tipo Go a partir de sus etiquetas json y validar. Las
+// estructuras con nombre se registran en componentes y se referencian con $ref; las
+// anonimas (cuerpos propios de un handler) se describen en linea
+func (g *generador) esquemaDe(t reflect.Type) *Esquema {
+	switch {
+	case t == tipoTiempo:
+		return &Esquema{Tipo: "string", Formato: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		e := *g.esquemaDe(t.Elem())
+		if e.Ref != "" {
+			return &e
+		}
+		e.Nulable = true
+		return &e
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Esquema{Tipo: "string"}
+	case reflect.Bool:
+		return &Esquema{Tipo: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Esquema{Tipo: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Esquema{Tipo: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Esquema{Tipo: "array", Elementos: g.esquemaDe(t.Elem())}
+	case reflect.Map:
+		return &Esquema{Tipo: "object", Adicionales: g.esquemaDe(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objeto(t)
+		}
+		nombre := nombreComponente(t)
+		if _, ok := g.esquemas[nombre]; !ok {
+			//Se reserva antes de generar para cortar tipos recursivos
+			g.esquemas[nombre] = nil
+			g.esquemas[nombre] = g.objeto(t)
+		}
+		return &Esquema{Ref: "#/components/schemas/" + nombre}
+	default:
+		//interface{}: cualquier valor JSON
+		return &Esquema{}
+	}
+}
+
+func (g *generador) objeto(t reflect.Type) *Esquema {
+	e := &Esquema{Tipo: "object", Propiedades: map[string]*Esquema{}}
+	for i := 0; i < t.NumField(); i++ {
+		campo := t.Field(i)
+		nombre, _, _ := strings.Cut(campo.Tag.Get("json"), ",")
+		if !campo.IsExported() || nombre == "-" {
+			continue
+		}
+		if nombre == "" {
+			nombre = campo.Name
+		}
+
+		propiedad := g.esquemaDe(campo.Type)
+		if requerido := aplicarValidar(propiedad, campo.Tag.Get("validar")); requerido {
+			e.Requeridos = append(e.Requeridos, nombre)
+		}
+		if descripcion := campo.Tag.Get("doc"); descripcion != "" {
+			propiedad.Descripcion = descripcion
+		}
+		e.Propiedades[nombre] = propiedad
+	}
+	return e
+}
+
+// aplicarValidar traslada las reglas de validar al esquema; devuelve si el campo es requerido
+func aplicarValidar(e *Esquema, etiqueta string) bool {
+	requerido := false
+	for _, regla := range strings.Split(etiqueta, ",") {
+		nombre, parametro, _ := strings.Cut(regla, "=")
+		switch nombre {
+		case "requerido":
+			requerido = true
+		case "min", "max":
+			n, _ := strconv.Atoi(parametro)
+			switch {
+			case e.Tipo == "string" && nombre == "min":
+				e.LongitudMinima = &n
+			case e.Tipo == "string":
+				e.LongitudMaxima = &n
+			case nombre == "min":
+				e.Minimo = &n
+			default:
+				e.Maximo = &n
+			}
+		case "uno_de":
+			e.Enum = strings.Split(parametro, "|")
+		default:
+			if formato, ok := formatosValidar[nombre]; ok {
+				e.Formato, e.Patron, e.Ejemplo, e.Descripcion = formato.Formato, formato.Patron, formato.Ejemplo, formato.Descripcion
+			}
+		}
+	}
+	return requerido
+}
+
+// Nombre del componente: el del tipo, y para genericos el tipo seguido de sus argumentos
+// (store.Pagina[models.Empresa] es PaginaEmpresa)
+func nombreComponente(t reflect.Type) string {
+	nombre, argumentos, generico := strings.Cut(t.Name(), "[")
+	if !generico {
+		return nombre
+	}
+	for _, argumento := range strings.Split(strings.TrimSuffix(argumentos, "]"), ",") {
+		argumento = argumento[strings.LastIndex(argumento, ".")+1:]
+		r := []rune(argumento)
+		r[0] = unicode.ToUpper(r[0])
+		nombre += string(r)
+	}
+	return nombre
+}
@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+)
+
+// El documento no cambia mientras el proceso vive: se genera una vez, en la primera solicitud
+var documentoJSON = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(Construir())
+})
+
+// Handler sirve el documento OpenAPI en JSON
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, err := documentoJSON()
+		if err != nil {
+			helpers.ResponderError(w, r, helpers.ErrorInterno("Error generando el documento OpenAPI", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(cuerpo)
+	}
+}
+
+const paginaDocs = `<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>FerryApp API</title>
+</head>
+<body>
+  <redoc spec-url="/openapi.json"></redoc>
+  <script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// Redoc se carga del CDN, aplica estilos en linea y usa un worker; el resto de la API
+// mantiene la politica estricta de CabecerasSeguridad
+const politicaDocs = "default-src 'none'; script-src https://cdn.redoc.ly; worker-src blob:; " +
+	"style-src 'unsafe-inline' https://fonts.googleapis.com; font-src https://fonts.gstatic.com; " +
+	"img-src 'self' data: https://cdn.redoc.ly; connect-src 'self'; frame-ancestors 'none'"
+
+// Docs sirve la documentacion interactiva con Redoc, que lee /openapi.json
+func Docs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", politicaDocs)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(paginaDocs))
+	}
+}
@@ -0,0 +1,741 @@
+package openapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+)
+
+// Todas las rutas del router (router.go y rutas_v1.go) deben declararse aqui: main_test.go
+// compara ambas listas y falla si una ruta queda sin documentar. Cada operacion se declara
+// sobre su ruta de la v2 con g.recurso, que documenta tambien las rutas obsoletas de la v1`
+
+const descripcionAPI = `API de FerryApp para empresas de ferris: empresas, empleados, usuarios, ferris y facturas de pasajes.
+
+Todos los errores usan el mismo sobre JSON (esquema Error) con un codigo estable. Los GET de registros
+devuelven la version en ETag y los PUT/PATCH deben enviarla en If-Match. Los POST marcados aceptan
+Idempotency-Key para reintentar sin duplicar.
+
+La version actual esta en /api/v2. Las rutas de /api (v1) siguen funcionando con los mismos cuerpos,
+pero estan obsoletas: responden con la cabecera Deprecation y un Link rel="successor-version" a su
+equivalente de la v2.`
+
+var etiquetas = []Etiqueta{
+	{"Sistema", "Salud del servicio, metricas y documentacion"},
+	{"Autenticacion", "Inicio de sesion y verificacion en dos pasos"},
+	{"Facturas", "Facturas de pasajes; aceptan JWT o clave API con alcances facturas:*"},
+	{"Empresas", "Empresas navieras"},
+	{"Empleados", "Empleados de las empresas"},
+	{"Usuarios", "Cuentas de acceso y contraseñas"},
+	{"Ferrys", "Ferris de cada empresa"},
+	{"Claves API", "Claves de integracion de una empresa"},
+	{"Auditoria", "Registro de auditoria encadenado"},
+}
+
+// Nombres de los esquemas de seguridad en components.securitySchemes
+const (
+	esquemaJWT      = "jwt"
+	esquemaClaveAPI = "claveAPI"
+	esquemaMetricas = "tokenMetricas"
+)
+
+var (
+	conJWT          = []Requisito{{esquemaJWT: {}}}
+	conJWTOClaveAPI = []Requisito{{esquemaJWT: {}}, {esquemaClaveAPI: {}}}
+)
+
+// Parametros de ruta comunes, por nombre
+var parametrosRuta = map[string]Parametro{
+	"rif":        {Descripcion: "RIF de la empresa", Esquema: &Esquema{Tipo: "string", Ejemplo: "J-12345678-4"}},
+	"cedula":     {Descripcion: "Cedula del empleado", Esquema: &Esquema{Tipo: "string", Ejemplo: "V-12345678"}},
+	"rif_cedula": {Descripcion: "RIF o cedula del usuario", Esquema: &Esquema{Tipo: "string"}},
+	"matricula":  {Descripcion: "Matricula del ferry", Esquema: &Esquema{Tipo: "string"}},
+	"id":         {Descripcion: "Id numerico", Esquema: &Esquema{Tipo: "integer", Minimo: entero(1)}},
+	"accion":     {Descripcion: "activar o desactivar", Esquema: &Esquema{Tipo: "string", Enum: []string{"activar", "desactivar"}}},
+}
+
+// Cuerpos de respuesta que no tienen un modelo propio
+var (
+	soloMensaje = struct {
+		Mensaje string `json:"mensaje"`
+	}{}
+	sesion = struct {
+		Mensaje   string `json:"mensaje"`
+		Token     string `json:"token" doc:"JWT de sesion para Authorization: Bearer"`
+		Tipo      string `json:"tipo" validar:"uno_de=Administrador|empresa|empleado"`
+		RifCedula string `json:"rif_cedula"`
+	}{}
+	cambioEstado = struct {
+		Activo bool `json:"activo" validar:"requerido" doc:"true para activar, false para desactivar"`
+	}{}
+)
+
+func declararRutas(g *generador) {
+	sistema(g)
+	autenticacion(g)
+	facturas(g)
+	empresas(g)
+	empleados(g)
+	usuarios(g)
+	ferrys(g)
+	clavesAPI(g)
+	auditoria(g)
+}
+
+func sistema(g *generador) {
+	texto := func(descripcion, tipo string) *Respuesta {
+		return &Respuesta{Descripcion: descripcion, Contenido: map[string]TipoMedio{tipo: {Esquema: &Esquema{Tipo: "string"}}}}
+	}
+
+	g.operacion(http.MethodGet, "/test", &Operacion{
+		Etiquetas:  []string{"Sistema"},
+		Resumen:    "Comprobacion basica del servidor",
+		Respuestas: map[string]*Respuesta{"200": texto("Texto fijo", "text/plain")},
+	})
+	g.operacion(http.MethodGet, "/healthz", &Operacion{
+		Etiquetas: []string{"Sistema"},
+		Resumen:   "Liveness: el proceso responde",
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Proceso activo", struct {
+			Estado string `json:"estado" validar:"uno_de=ok"`
+		}{})},
+	})
+
+	preparado := struct {
+		Estado         string         `json:"estado" validar:"uno_de=ok|no_preparado"`
+		Comprobaciones map[string]any `json:"comprobaciones" doc:"Estado de base_datos, migraciones y servidor"`
+	}{}
+	g.operacion(http.MethodGet, "/readyz", &Operacion{
+		Etiquetas:   []string{"Sistema"},
+		Resumen:     "Readiness: base de datos y migraciones al dia",
+		Descripcion: "Pasa a 503 al iniciar el apagado para que el balanceador deje de enviar trafico.",
+		Respuestas: map[string]*Respuesta{
+			"200": g.respuesta("Listo para recibir trafico", preparado),
+			"503": g.respuesta("No preparado", preparado),
+		},
+	})
+	g.operacion(http.MethodGet, "/.well-known/jwks.json", &Operacion{
+		Etiquetas:   []string{"Autenticacion"},
+		Resumen:     "Claves publicas de firma de los JWT",
+		Descripcion: "JSON Web Key Set para verificar los tokens en otros servicios; el kid del token indica la clave.",
+		Respuestas: map[string]*Respuesta{
+			"200": g.respuesta("Claves publicas vigentes", security.JWKS{}),
+			"429": {Ref: "#/components/responses/LimiteExcedido"},
+		},
+	})
+	g.operacion(http.MethodGet, "/metrics", &Operacion{
+		Etiquetas: []string{"Sistema"},
+		Resumen:   "Metricas de Prometheus",
+		Seguridad: []Requisito{{}, {esquemaMetricas: {}}},
+		Respuestas: map[string]*Respuesta{
+			"200": texto("Metricas en formato de exposicion de Prometheus", "text/plain"),
+			"401": {Ref: "#/components/responses/NoAutenticado"},
+		},
+	})
+	g.operacion(http.MethodGet, "/openapi.json", &Operacion{
+		Etiquetas: []string{"Sistema"},
+		Resumen:   "Este documento OpenAPI",
+		Respuestas: map[string]*Respuesta{"200": {
+			Descripcion: "Documento OpenAPI 3.0",
+			Contenido:   map[string]TipoMedio{"application/json": {Esquema: &Esquema{Tipo: "object"}}},
+		}},
+	})
+	g.operacion(http.MethodGet, "/docs", &Operacion{
+		Etiquetas:  []string{"Sistema"},
+		Resumen:    "Documentacion interactiva (Redoc)",
+		Respuestas: map[string]*Respuesta{"200": texto("Pagina HTML", "text/html")},
+	})
+}
+
+func autenticacion(g *generador) {
+	login := struct {
+		Usuario struct {
+			Usuario    string `json:"usuario" validar:"requerido"`
+			Contrasena string `json:"contrasena" validar:"requerido"`
+		} `json:"usuario" validar:"requerido"`
+	}{}
+	desafio := struct {
+		Mensaje      string `json:"mensaje"`
+		Requiere2FA  bool   `json:"requiere_2fa"`
+		TokenDesafio string `json:"token_desafio" doc:"Token para POST /api/v2/sesiones/2fa"`
+	}{}
+	inscripcion := struct {
+		Mensaje                string `json:"mensaje"`
+		RequiereInscripcion2FA bool   `json:"requiere_inscripcion_2fa"`
+		Token                  string `json:"token" doc:"Token restringido a la inscripcion en /api/v2/dos-factores"`
+	}{}
+	respuestaLogin := &Respuesta{
+		Descripcion: "Sesion iniciada, o segundo paso requerido",
+		Contenido: map[string]TipoMedio{"application/json": {Esquema: &Esquema{
+			UnoDe: []*Esquema{g.esquema(sesion), g.esquema(desafio), g.esquema(inscripcion)},
+		}}},
+	}
+
+	op := &Operacion{
+		Etiquetas: []string{"Autenticacion"},
+		Resumen:   "Iniciar sesion",
+		Descripcion: "Con 2FA activo responde requiere_2fa y un token de desafio; si el rol exige 2FA y no esta " +
+			"inscrito responde requiere_inscripcion_2fa. Los fallos repetidos bloquean el usuario y la IP.",
+		Cuerpo:     g.json(login),
+		Respuestas: map[string]*Respuesta{"200": respuestaLogin},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests)
+	g.recurso(http.MethodPost, "/api/v2/sesiones", op, "POST /api/login")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Autenticacion"},
+		Resumen:     "Completar el inicio de sesion con el segundo factor",
+		Descripcion: "Se envia codigo (TOTP) o codigo_recuperacion, que se consume al usarlo.",
+		Cuerpo: g.json(struct {
+			TokenDesafio       string `json:"token_desafio" validar:"requerido"`
+			Codigo             string `json:"codigo" doc:"Codigo de 6 digitos de la aplicacion autenticadora"`
+			CodigoRecuperacion string `json:"codigo_recuperacion"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Sesion iniciada", sesion)},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests)
+	g.recurso(http.MethodPost, "/api/v2/sesiones/2fa", op, "POST /api/login/2fa")
+
+	codigo := struct {
+		Codigo string `json:"codigo" validar:"requerido"`
+	}{}
+	op = &Operacion{
+		Etiquetas:   []string{"Autenticacion"},
+		Resumen:     "Iniciar la inscripcion en la verificacion en dos pasos",
+		Descripcion: "Acepta el token de sesion o el de inscripcion obligatoria.",
+		Seguridad:   conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Secreto y URI otpauth:// para el codigo QR", struct {
+			Mensaje string `json:"mensaje"`
+			Secreto string `json:"secreto"`
+			URI     string `json:"uri"`
+		}{})},
+	}
+	g.errores(op, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/dos-factores", op, "POST /api/2fa/inscribir")
+
+	op = &Operacion{
+		Etiquetas: []string{"Autenticacion"},
+		Resumen:   "Confirmar la inscripcion con un primer codigo",
+		Descripcion: "Los codigos de recuperacion solo se muestran en esta respuesta. Los codigos erroneos " +
+			"cuentan para el mismo bloqueo que el segundo paso del login.",
+		Seguridad: conJWT,
+		Cuerpo:    g.json(codigo),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("2FA activado", struct {
+			Mensaje             string   `json:"mensaje"`
+			CodigosRecuperacion []string `json:"codigos_recuperacion"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests)
+	g.recurso(http.MethodPost, "/api/v2/dos-factores/confirmacion", op, "POST /api/2fa/confirmar")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Autenticacion"},
+		Resumen:     "Desactivar la verificacion en dos pasos",
+		Descripcion: "Los codigos erroneos cuentan para el mismo bloqueo que el segundo paso del login.",
+		Seguridad:   conJWT,
+		Cuerpo:      g.json(codigo),
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("2FA desactivado", soloMensaje)},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests)
+	g.recurso(http.MethodDelete, "/api/v2/dos-factores", op, "POST /api/2fa/desactivar")
+}
+
+func facturas(g *generador) {
+	op := &Operacion{
+		Etiquetas:   []string{"Facturas"},
+		Resumen:     "Emitir una factura",
+		Descripcion: "Alcance facturas:crear. Una clave API solo puede facturar a nombre de su empresa.",
+		Seguridad:   conJWTOClaveAPI,
+		Parametros:  []Parametro{claveIdempotencia},
+		Cuerpo:      g.json(models.Factura{}),
+		Respuestas: map[string]*Respuesta{"201": repetible(g.respuesta("Factura creada", struct {
+			Mensaje   string `json:"mensaje"`
+			IDFactura int    `json:"id_factura"`
+		}{}))},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/facturas", op, "POST /api/factura/generar")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Facturas"},
+		Resumen:     "Consultar una factura",
+		Descripcion: "Alcance facturas:leer.",
+		Seguridad:   conJWTOClaveAPI,
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("Factura", models.Factura{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	g.recurso(http.MethodGet, "/api/v2/facturas/{id}", op, "GET /api/factura/obtener/{id}")
+
+	filtros := []Parametro{
+		consulta("rif_empresa", "Empresa (solo administradores; el resto ve la suya)", nil),
+		consulta("estado", "Activas (true) o anuladas (false)", &Esquema{Tipo: "boolean"}),
+		consulta("desde", "Emision desde (AAAA-MM-DD o RFC 3339)", nil),
+		consulta("hasta", "Emision hasta, incluido el dia (AAAA-MM-DD o RFC 3339)", nil),
+		consulta("viaje", "Id del viaje", nil),
+		consulta("ferry", "Matricula del ferry", nil),
+		consulta("empleado", "Cedula del empleado que emitio", nil),
+		consulta("tipo", "Tipo de pasaje", &Esquema{Tipo: "string", Enum: []string{"economica", "vip"}}),
+		consulta("q", "Busca en el nombre del viajero", nil),
+	}
+	op = &Operacion{
+		Etiquetas:   []string{"Facturas"},
+		Resumen:     "Listar facturas",
+		Descripcion: "Alcance facturas:leer. Empresas, empleados y claves API solo ven las de su empresa.",
+		Seguridad:   conJWTOClaveAPI,
+		Parametros:  append(paginacion(store.CamposOrdenFacturas()), filtros...),
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("Pagina de facturas", store.Pagina[models.Factura]{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/facturas", op, "GET /api/facturas")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Facturas"},
+		Resumen:     "Exportar facturas en CSV",
+		Descripcion: "Mismos filtros y orden que el listado, sin paginar.",
+		Seguridad:   conJWTOClaveAPI,
+		Parametros:  append([]Parametro{consulta("orden", "Campo de orden, con - para descendente", nil)}, filtros...),
+		Respuestas: map[string]*Respuesta{"200": {
+			Descripcion: "Archivo facturas.csv",
+			Cabeceras:   map[string]Cabecera{"Content-Disposition": {Esquema: &Esquema{Tipo: "string"}}},
+			Contenido:   map[string]TipoMedio{"text/csv": {Esquema: &Esquema{Tipo: "string"}}},
+		}},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/facturas/exportacion", op, "GET /api/facturas/exportar")
+
+	op = &Operacion{
+		Etiquetas: []string{"Facturas"},
+		Resumen:   "Activar o anular una factura",
+		Seguridad: conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Estado actualizado", struct {
+			Mensaje   string `json:"mensaje"`
+			IDFactura int    `json:"id_factura"`
+			Estado    bool   `json:"estado"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/facturas/{id}/estado", op, "PUT /api/factura/{id}/estado/{accion}")
+	op.Cuerpo = g.json(cambioEstado) //La v1 lleva la accion en la ruta
+}
+
+func empresas(g *generador) {
+	op := &Operacion{
+		Etiquetas:   []string{"Empresas"},
+		Resumen:     "Registrar una empresa con su usuario",
+		Descripcion: "Solo administradores. El usuario se crea con tipo empresa y la cedula/RIF de la empresa.",
+		Seguridad:   conJWT,
+		Parametros:  []Parametro{claveIdempotencia},
+		Cuerpo: g.json(struct {
+			Empresa models.Empresa `json:"empresa" validar:"requerido"`
+			Usuario models.Usuario `json:"usuario" validar:"requerido"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"201": repetible(g.respuesta("Empresa registrada", struct {
+			Mensaje string `json:"mensaje"`
+			RIF     string `json:"rif"`
+			Usuario string `json:"usuario"`
+		}{}))},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/empresas", op, "POST /api/empresas/registrar")
+
+	g.edicion("/api/v2/empresas/{rif}", "/api/empresas/actualizar/{rif}", "Empresas", "la empresa", models.Empresa{}, "El RIF y el estado no se modifican.")
+
+	op = &Operacion{
+		Etiquetas: []string{"Empresas"},
+		Resumen:   "Activar o desactivar una empresa",
+		Seguridad: conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Estado actualizado", struct {
+			Mensaje string `json:"mensaje"`
+			RIF     string `json:"rif"`
+			Estado  string `json:"estado" validar:"uno_de=true|false"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/empresas/{rif}/estado", op, "PUT /api/empresas/{rif}/{accion}")
+	op.Cuerpo = g.json(cambioEstado)
+
+	g.consultaConETag("/api/v2/empresas/{rif}", "/api/empresas/buscar/{rif}", "Empresas", "Consultar una empresa", "", models.Empresa{})
+
+	op = &Operacion{
+		Etiquetas:   []string{"Empresas"},
+		Resumen:     "Listar empresas",
+		Descripcion: "Solo administradores.",
+		Seguridad:   conJWT,
+		Parametros:  append(paginacion(store.CamposOrdenEmpresas()), filtroEstado, consulta("q", "Busca en el nombre", nil)),
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("Pagina de empresas", store.Pagina[models.Empresa]{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/empresas", op, "GET /api/empresas")
+
+	op = &Operacion{
+		Etiquetas:  []string{"Empleados"},
+		Resumen:    "Listar los empleados de una empresa",
+		Seguridad:  conJWT,
+		Parametros: append(paginacion(store.CamposOrdenEmpleados()), filtroEstado, consulta("q", "Busca en nombres y apellidos", nil)),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Pagina de empleados", store.Pagina[models.Empleados]{})},
+	}
+	g.errores(op, http.StatusBadRequest)
+	g.recurso(http.MethodGet, "/api/v2/empresas/{rif}/empleados", op, "GET /api/empresas/{rif}/empleados")
+
+	op = &Operacion{
+		Etiquetas:  []string{"Ferrys"},
+		Resumen:    "Listar los ferris de una empresa",
+		Seguridad:  conJWT,
+		Parametros: append(paginacion(store.CamposOrdenFerrys()), filtroEstado, consulta("q", "Busca en nombre y modelo", nil)),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Pagina de ferris", store.Pagina[models.Ferry]{})},
+	}
+	g.errores(op, http.StatusBadRequest)
+	g.recurso(http.MethodGet, "/api/v2/empresas/{rif}/ferrys", op, "GET /api/empresas/{rif}/ferrys")
+}
+
+func empleados(g *generador) {
+	op := &Operacion{
+		Etiquetas:   []string{"Empleados"},
+		Resumen:     "Registrar un empleado con su usuario",
+		Descripcion: "El usuario se crea con tipo empleado y la cedula del empleado.",
+		Seguridad:   conJWT,
+		Parametros:  []Parametro{claveIdempotencia},
+		Cuerpo: g.json(struct {
+			Empleado models.Empleados `json:"empleado" validar:"requerido"`
+			Usuario  models.Usuario   `json:"usuario" validar:"requerido"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"201": repetible(g.respuesta("Empleado registrado", struct {
+			Mensaje string `json:"mensaje"`
+			Cedula  string `json:"Cedula"`
+			Empresa string `json:"Empresa"`
+			Usuario string `json:"Usuario"`
+		}{}))},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/empleados", op, "POST /api/empleado/registrar")
+
+	g.edicion("/api/v2/empleados/{cedula}", "/api/empleado/actualizar/{cedula}", "Empleados", "el empleado", models.Empleados{}, "La cedula, la empresa y el estado no se modifican.")
+
+	op = &Operacion{
+		Etiquetas: []string{"Empleados"},
+		Resumen:   "Activar o desactivar un empleado",
+		Seguridad: conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Estado actualizado", struct {
+			Mensaje      string `json:"mensaje"`
+			EstadoActual string `json:"Estado actual" validar:"uno_de=true|false"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/empleados/{cedula}/estado", op, "PUT /api/empleado/activar/{cedula}", "PUT /api/empleado/desactivar/{cedula}")
+	op.Cuerpo = g.json(cambioEstado)
+
+	g.consultaConETag("/api/v2/empleados/{cedula}", "/api/empleado/buscar/{cedula}", "Empleados", "Consultar un empleado", "", models.Empleados{})
+}
+
+func usuarios(g *generador) {
+	op := &Operacion{
+		Etiquetas:   []string{"Usuarios"},
+		Resumen:     "Registrar un usuario",
+		Descripcion: "Solo administradores. Los usuarios de empresas y empleados se crean junto con ellos.",
+		Seguridad:   conJWT,
+		Cuerpo: g.json(struct {
+			RifCedula  string `json:"rif_cedula" validar:"requerido,rif_cedula"`
+			Usuario    string `json:"usuario" validar:"requerido,min=4,max=120"`
+			Contrasena string `json:"contrasena" validar:"requerido"`
+			Tipo       string `json:"tipo" validar:"requerido,uno_de=Administrador|empresa|empleado"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"201": g.respuesta("Usuario registrado", soloMensaje)},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/usuarios", op, "POST /api/usuario/registrar")
+
+	//PUT y PATCH solo cambian los campos enviados
+	cambioUsuario := struct {
+		Usuario    string `json:"usuario" validar:"min=4,max=120"`
+		Contrasena string `json:"contrasena" doc:"Nueva contraseña; debe cumplir la politica y no repetir las ultimas"`
+	}{}
+	for _, metodo := range []string{http.MethodPut, http.MethodPatch} {
+		op = &Operacion{
+			Etiquetas:   []string{"Usuarios"},
+			Resumen:     "Cambiar nombre de usuario y/o contraseña",
+			Descripcion: "PUT y PATCH se comportan igual: solo se cambian los campos enviados.",
+			Seguridad:   conJWT,
+			Parametros:  []Parametro{siCoincide},
+			Cuerpo:      g.json(cambioUsuario),
+			Respuestas:  map[string]*Respuesta{"200": conETag(g.respuesta("Usuario actualizado", soloMensaje))},
+		}
+		g.errores(op, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+		g.recurso(metodo, "/api/v2/usuarios/{rif_cedula}", op, metodo+" /api/usuario/{rif_cedula}")
+	}
+
+	g.consultaConETag("/api/v2/usuarios/{rif_cedula}", "/api/usuario/{rif_cedula}", "Usuarios", "Consultar un usuario",
+		"Nunca incluye la contraseña.", models.UsuarioPublico{})
+
+	op = &Operacion{
+		Etiquetas: []string{"Usuarios"},
+		Resumen:   "Cambiar la contraseña propia",
+		Seguridad: conJWT,
+		Cuerpo: g.json(struct {
+			ContrasenaActual string `json:"contrasenaActual" validar:"requerido"`
+			NuevaContrasena  string `json:"nuevaContrasena" validar:"requerido"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Contraseña actualizada", soloMensaje)},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/usuarios/yo/contrasena", op, "PUT /api/usuarios/{rif_cedula}/contrasena-personal")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Usuarios"},
+		Resumen:     "Listar usuarios",
+		Descripcion: "Solo administradores. Nunca incluye la contraseña.",
+		Seguridad:   conJWT,
+		Parametros: append(paginacion(store.CamposOrdenUsuarios()),
+			consulta("tipo", "Tipo de usuario", &Esquema{Tipo: "string", Enum: []string{"Administrador", "empresa", "empleado"}}),
+			filtroEstado, consulta("q", "Busca en el nombre de usuario", nil)),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Pagina de usuarios", store.Pagina[models.UsuarioPublico]{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/usuarios", op, "GET /api/usuarios")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Usuarios"},
+		Resumen:     "Activar o desactivar un usuario",
+		Descripcion: "Solo administradores.",
+		Seguridad:   conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Estado actualizado", struct {
+			Mensaje string `json:"mensaje"`
+			Estado  bool   `json:"estado"`
+			Accion  string `json:"accion" validar:"uno_de=activar|desactivar"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/usuarios/{rif_cedula}/estado", op, "PUT /api/usuarios/{rif_cedula}/{accion}")
+	op.Cuerpo = g.json(cambioEstado)
+
+	op = &Operacion{
+		Etiquetas:   []string{"Usuarios"},
+		Resumen:     "Restablecer la contraseña de un usuario",
+		Descripcion: "Solo administradores.",
+		Seguridad:   conJWT,
+		Cuerpo: g.json(struct {
+			NuevaContrasena string `json:"nuevaContrasena" validar:"requerido"`
+		}{}),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Contraseña actualizada", soloMensaje)},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	g.recurso(http.MethodPut, "/api/v2/usuarios/{rif_cedula}/contrasena", op, "PUT /api/usuario/{rif_cedula}/cambiar-contrasena")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Usuarios"},
+		Resumen:     "Desbloquear un usuario bloqueado por intentos fallidos",
+		Descripcion: "Solo administradores.",
+		Seguridad:   conJWT,
+		Parametros:  []Parametro{consulta("ip", "IP a desbloquear tambien", nil)},
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Usuario desbloqueado", struct {
+			Mensaje string `json:"mensaje"`
+			Usuario string `json:"usuario"`
+		}{})},
+	}
+	g.errores(op, http.StatusForbidden, http.StatusNotFound)
+	g.recurso(http.MethodDelete, "/api/v2/usuarios/{rif_cedula}/bloqueo", op, "PUT /api/usuarios/{rif_cedula}/desbloquear")
+}
+
+func ferrys(g *generador) {
+	op := &Operacion{
+		Etiquetas:  []string{"Ferrys"},
+		Resumen:    "Registrar un ferry",
+		Seguridad:  conJWT,
+		Parametros: []Parametro{claveIdempotencia},
+		Cuerpo:     g.json(models.Ferry{}),
+		Respuestas: map[string]*Respuesta{"201": repetible(g.respuesta("Ferry registrado", struct {
+			Mensaje   string `json:"mensaje"`
+			Matricula string `json:"matricula"`
+		}{}))},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusConflict)
+	g.recurso(http.MethodPost, "/api/v2/ferrys", op, "POST /api/ferry/registrar")
+
+	g.edicion("/api/v2/ferrys/{matricula}", "/api/ferry/actualizar/{matricula}", "Ferrys", "el ferry", models.Ferry{}, "La matricula, la empresa y el estado no se modifican.")
+
+	op = g.operacionConETag("Ferrys", "Consultar un ferry", "Alcance ferrys:leer. Una clave API solo ve los ferrys de su empresa.", models.Ferry{})
+	op.Seguridad = conJWTOClaveAPI
+	g.errores(op, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/ferrys/{matricula}", op, "GET /api/ferry/buscar/{matricula}")
+}
+
+func clavesAPI(g *generador) {
+	descripcion := "Solo usuarios de tipo empresa, sobre sus propias claves."
+
+	cuerpo := g.json(struct {
+		Nombre       string   `json:"nombre" validar:"requerido,max=100"`
+		Alcances     []string `json:"alcances" validar:"requerido"`
+		ExpiraEnDias int      `json:"expira_en_dias" validar:"min=0" doc:"0 o ausente: no expira"`
+	}{})
+	cuerpo.Contenido["application/json"].Esquema.Propiedades["alcances"].Elementos.Enum = security.AlcancesValidos
+
+	op := &Operacion{
+		Etiquetas:   []string{"Claves API"},
+		Resumen:     "Crear una clave API",
+		Descripcion: descripcion + " La clave solo se muestra en esta respuesta.",
+		Seguridad:   conJWT,
+		Cuerpo:      cuerpo,
+		Respuestas: map[string]*Respuesta{"201": g.respuesta("Clave creada", struct {
+			Mensaje  string          `json:"mensaje"`
+			Clave    string          `json:"clave" doc:"Valor para la cabecera X-API-Key"`
+			ClaveAPI models.ClaveAPI `json:"clave_api"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodPost, "/api/v2/claves-api", op, "POST /api/claves-api")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Claves API"},
+		Resumen:     "Listar las claves API de la empresa",
+		Descripcion: descripcion,
+		Seguridad:   conJWT,
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("Claves API", []models.ClaveAPI{})},
+	}
+	g.errores(op, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/claves-api", op, "GET /api/claves-api")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Claves API"},
+		Resumen:     "Revocar una clave API",
+		Descripcion: descripcion,
+		Seguridad:   conJWT,
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Clave revocada", struct {
+			Mensaje string `json:"mensaje"`
+			ID      int    `json:"id"`
+		}{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	g.recurso(http.MethodDelete, "/api/v2/claves-api/{id}", op, "DELETE /api/claves-api/{id}")
+}
+
+func auditoria(g *generador) {
+	op := &Operacion{
+		Etiquetas:   []string{"Auditoria"},
+		Resumen:     "Listar el registro de auditoria",
+		Descripcion: "Solo administradores. Los campos sensibles de los cambios se muestran como [oculto].",
+		Seguridad:   conJWT,
+		Parametros: append(paginacion(store.CamposOrdenAuditoria()),
+			consulta("actor", "Usuario que hizo el cambio", nil),
+			consulta("accion", "Accion (crear, actualizar, activar...)", nil),
+			consulta("entidad", "Tipo de registro (empresa, usuario...)", nil),
+			consulta("entidad_id", "Id del registro", nil),
+			consulta("desde", "Fecha desde (AAAA-MM-DD o RFC 3339)", nil),
+			consulta("hasta", "Fecha hasta, incluido el dia (AAAA-MM-DD o RFC 3339)", nil)),
+		Respuestas: map[string]*Respuesta{"200": g.respuesta("Pagina del registro", store.Pagina[models.RegistroAuditoria]{})},
+	}
+	g.errores(op, http.StatusBadRequest, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/auditoria", op, "GET /api/auditoria")
+
+	op = &Operacion{
+		Etiquetas:   []string{"Auditoria"},
+		Resumen:     "Verificar la cadena de hashes de la auditoria",
+		Descripcion: "Solo administradores. Indica el primer registro alterado, si lo hay.",
+		Seguridad:   conJWT,
+		Respuestas:  map[string]*Respuesta{"200": g.respuesta("Resultado de la verificacion", store.VerificacionAuditoria{})},
+	}
+	g.errores(op, http.StatusForbidden)
+	g.recurso(http.MethodGet, "/api/v2/auditoria/verificacion", op, "GET /api/auditoria/verificar")
+}
+
+// edicion declara el PUT (reemplazo) y el PATCH (JSON Merge Patch) de un registro versionado,
+// con los mismos metodos sobre la ruta de la v1
+func (g *generador) edicion(ruta, rutaV1, etiqueta, registro string, modelo any, inmutables string) {
+	for _, metodo := range []string{http.MethodPut, http.MethodPatch} {
+		op := &Operacion{
+			Etiquetas:   []string{etiqueta},
+			Resumen:     "Reemplazar " + registro,
+			Descripcion: "Requiere If-Match con el ETag del registro. " + inmutables,
+			Seguridad:   conJWT,
+			Parametros:  []Parametro{siCoincide},
+			Cuerpo:      g.json(modelo),
+			Respuestas:  map[string]*Respuesta{"200": conETag(g.respuesta("Registro actualizado", soloMensaje))},
+		}
+		if metodo == http.MethodPatch {
+			op.Resumen = "Modificar " + registro + " (JSON Merge Patch)"
+			op.Descripcion += " Solo se cambian los campos enviados; null los vacia."
+			op.Cuerpo.Contenido["application/merge-patch+json"] = op.Cuerpo.Contenido["application/json"]
+		}
+		g.errores(op, http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+		g.recurso(metodo, ruta, op, metodo+" "+rutaV1)
+	}
+}
+
+// consultaConETag declara el GET de un registro versionado, que admite If-None-Match
+func (g *generador) consultaConETag(ruta, rutaV1, etiqueta, resumen, descripcion string, modelo any) {
+	g.recurso(http.MethodGet, ruta, g.operacionConETag(etiqueta, resumen, descripcion, modelo), "GET "+rutaV1)
+}
+
+// operacionConETag arma la consulta con ETag sin registrarla, para ajustarla antes
+func (g *generador) operacionConETag(etiqueta, resumen, descripcion string, modelo any) *Operacion {
+	op := &Operacion{
+		Etiquetas:   []string{etiqueta},
+		Resumen:     resumen,
+		Descripcion: descripcion,
+		Seguridad:   conJWT,
+		Parametros: []Parametro{{
+			Nombre: "If-None-Match", En: "header", Esquema: &Esquema{Tipo: "string"},
+			Descripcion: "ETag conocido; si sigue vigente se responde 304 sin cuerpo",
+		}},
+		Respuestas: map[string]*Respuesta{
+			"200": conETag(g.respuesta("Registro", modelo)),
+			"304": {Descripcion: "El registro no cambio"},
+		},
+	}
+	g.errores(op, http.StatusNotFound)
+	return op
+}
+
+var (
+	siCoincide = Parametro{
+		Nombre: "If-Match", En: "header", Requerido: true, Esquema: &Esquema{Tipo: "string", Ejemplo: `"3"`},
+		Descripcion: "ETag recibido al consultar el registro, o * para sobrescribir sin comprobar",
+	}
+	claveIdempotencia = Parametro{
+		Nombre: middlewares.CabeceraIdempotencia, En: "header", Esquema: &Esquema{Tipo: "string"},
+		Descripcion: "Identificador unico del intento; los reintentos con la misma clave repiten la respuesta original. " +
+			"Mientras la original se procesa responden 409. La original se cancela al superar su plazo maximo y, pasado el tiempo de abandono, el reintento la reemplaza",
+	}
+	filtroEstado = consulta("estado", "Activos (true) o inactivos (false)", &Esquema{Tipo: "boolean"})
+)
+
+// paginacion devuelve los parametros comunes de los listados (ver handlers/listado.go)
+func paginacion(camposOrden []string) []Parametro {
+	orden := make([]string, 0, 2*len(camposOrden))
+	for _, campo := range camposOrden {
+		orden = append(orden, campo, "-"+campo)
+	}
+	return []Parametro{
+		consulta("limite", "Elementos por pagina (por defecto "+strconv.Itoa(store.LimitePorDefecto)+")",
+			&Esquema{Tipo: "integer", Minimo: entero(1), Maximo: entero(store.LimiteMaximo)}),
+		consulta("desplazamiento", "Elementos a saltar", &Esquema{Tipo: "integer", Minimo: entero(0)}),
+		consulta("cursor", "siguiente_cursor de la pagina anterior; tiene prioridad sobre desplazamiento", nil),
+		consulta("orden", "Campo de orden, con - para descendente", &Esquema{Tipo: "string", Enum: orden}),
+	}
+}
+
+// consulta es un parametro de query opcional; sin esquema se toma como texto
+func consulta(nombre, descripcion string, esquema *Esquema) Parametro {
+	if esquema == nil {
+		esquema = &Esquema{Tipo: "string"}
+	}
+	return Parametro{Nombre: nombre, En: "query", Descripcion: descripcion, Esquema: esquema}
+}
+
+func conETag(r *Respuesta) *Respuesta {
+	r.Cabeceras = map[string]Cabecera{"ETag": {Descripcion: "Version del registro para If-Match", Esquema: &Esquema{Tipo: "string"}}}
+	return r
+}
+
+// repetible documenta la cabecera que marca una respuesta repetida por Idempotency-Key
+func repetible(r *Respuesta) *Respuesta {
+	r.Cabeceras = map[string]Cabecera{middlewares.CabeceraRespuestaRepetida: {
+		Descripcion: "true si la respuesta es la guardada de un intento anterior", Esquema: &Esquema{Tipo: "boolean"},
+	}}
+	return r
+}
+
+func entero(n int) *int {
+	return &n
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/handlers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/helpers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/metrics"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/openapi"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// dependencias del router. ejecutarServidor las arma con Postgres; las pruebas pueden
+// usar el store en memoria
+type dependencias struct {
+	cfg       config.Config
+	logger    *slog.Logger
+	st        store.Store
+	clavesJWT *security.ConjuntoClaves
+	preparado handlers.ComprobacionesPreparado
+}
+
+// api reune lo que comparten las rutas de la v1 y la v2
+type api struct {
+	st        store.Store
+	clavesJWT *security.ConjuntoClaves
+	intentos  *security.ControlIntentos
+	totp      security.ConfigTOTP
+	politica  security.PoliticaContrasena
+	tokens    security.DuracionTokens
+
+	porIP       func(http.Handler) http.Handler
+	porUsuario  func(http.Handler) http.Handler
+	idempotente func(http.Handler) http.Handler
+}
+
+// nuevoRouter arma todas las rutas de la API con sus middlewares. Cada ruta nueva debe
+// documentarse en openapi/rutas.go (lo comprueba main_test.go)
+func nuevoRouter(d dependencias) *chi.Mux {
+	//Limites de solicitudes por IP (rutas publicas) y por usuario o clave API (protegidas)
+	limites := security.NuevoLimitadorMemoria()
+
+	a := api{
+		st:        d.st,
+		clavesJWT: d.clavesJWT,
+		//Control de intentos fallidos de login y del segundo factor
+		intentos: security.NuevoControlIntentos(d.cfg.Login.Bloqueo(), security.NuevoAlmacenIntentosMemoria()),
+		//Configuracion de verificacion en dos pasos
+		totp: d.cfg.TOTP.Config(),
+		//Politica de contraseñas aplicada en todos los registros y cambios
+		politica: d.cfg.Contrasenas.Politica(),
+		//Vigencia de los tokens de sesion y de 2FA
+		tokens: d.cfg.JWT.Tokens(),
+
+		porIP:      middlewares.LimitePorIP(limites, d.cfg.Limites),
+		porUsuario: middlewares.LimitePorUsuario(limites, d.cfg.Limites),
+		//Respuestas guardadas de los POST con Idempotency-Key, con su propio plazo por solicitud
+		idempotente: middlewares.Idempotencia(d.st.Idempotencia, d.cfg.Idempotencia),
+	}
+
+	r := chi.NewRouter()
+
+	//Id de solicitud para correlacionar respuestas de error y logs
+	r.Use(middlewares.IDSolicitud)
+	//IP del cliente detras de los proxies de confianza (logs, limites y bloqueo del login)
+	r.Use(middlewares.ClienteReal(d.cfg.Servidor.Proxies()))
+
+	//Span por solicitud, continuando la traza del cliente (traceparent)
+	r.Use(middlewares.Trazas)
+	//Metricas por ruta (antes del log de acceso para contar tambien los panics como 500)
+	r.Use(middlewares.Metricas)
+	//Log de acceso y logger por solicitud
+	r.Use(middlewares.RegistroAcceso(d.logger))
+	//Cabeceras de seguridad y CORS para el frontend (los preflight se responden aqui)
+	r.Use(middlewares.CabecerasSeguridad(d.cfg.Seguridad))
+	r.Use(middlewares.CORS(d.cfg.CORS))
+
+	//Respuestas JSON para rutas y metodos inexistentes
+	r.NotFound(helpers.NoEncontrado)
+	r.MethodNotAllowed(helpers.MetodoNoPermitido)
+
+	//Ruta publica
+	r.Get("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("¡Funciona!"))
+	})
+
+	//Liveness y readiness para el orquestador
+	r.Get("/healthz", handlers.Salud())
+	r.Get("/readyz", handlers.Preparado(d.preparado))
+
+	r.With(a.porIP).Get("/.well-known/jwks.json", handlers.JWKS(a.clavesJWT))
+
+	//Metricas de Prometheus (protegidas con metricas.token si esta definido)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler(d.cfg.Metricas.Token))
+
+	//Especificacion OpenAPI y documentacion interactiva
+	r.Get("/openapi.json", openapi.Handler())
+	r.Get("/docs", openapi.Docs())
+
+	a.rutasV2(r)
+	a.rutasV1(r)
+
+	return r
+}
+
+// rutasV2 registra la API actual: recursos en plural, sin verbos en la ruta, y el
+// metodo HTTP indica la operacion
+func (a api) rutasV2(r chi.Router) {
+	st := a.st
+
+	r.With(a.porIP).Post("/api/v2/sesiones", handlers.IniciarSesion(st, a.intentos, a.totp, a.tokens, a.politica))
+	r.With(a.porIP).Post("/api/v2/sesiones/2fa", handlers.VerificarSegundoFactor(st, a.intentos, a.tokens))
+
+	//Inscripcion 2FA (acepta tambien el token restringido de inscripcion)
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionInscripcion2FA)
+		r.Use(a.porUsuario)
+
+		r.Post("/api/v2/dos-factores", handlers.InscribirTOTP(st, a.totp))
+		r.Post("/api/v2/dos-factores/confirmacion", handlers.ConfirmarTOTP(st, a.intentos))
+	})
+
+	//Rutas que aceptan JWT o clave API (integraciones de kioscos y agencias)
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionJWTOClaveAPI(st.ClavesAPI))
+		r.Use(a.porUsuario)
+
+		r.With(middlewares.RequiereAlcance(security.AlcanceFacturasCrear), a.idempotente).Post("/api/v2/facturas", handlers.CrearFactura(st))
+		r.With(middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/v2/facturas", handlers.ListarFacturas(st))
+		r.With(middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/v2/facturas/exportacion", handlers.ExportarFacturas(st))
+		r.With(middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/v2/facturas/{id}", handlers.ObtenerFactura(st))
+		r.With(middlewares.RequiereAlcance(security.AlcanceFerrysLeer)).Get("/api/v2/ferrys/{matricula}", handlers.ObtenerFerry(st))
+	})
+
+	//Rutas protegidas con JWT
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionJWT)
+		r.Use(a.porUsuario)
+
+		r.Delete("/api/v2/dos-factores", handlers.DesactivarTOTP(st, a.intentos, a.totp))
+		r.Put("/api/v2/facturas/{id}/estado", handlers.CambiarEstadoFactura(st))
+
+		//PUT reemplaza y PATCH aplica un JSON Merge Patch; ambos exigen If-Match.
+		//El estado de cada registro es un subrecurso: PUT .../estado {"activo": true}
+		r.Get("/api/v2/empresas/{rif}", handlers.ObtenerEmpresa(st))
+		r.Put("/api/v2/empresas/{rif}", handlers.EditarEmpresas(st))
+		r.Patch("/api/v2/empresas/{rif}", handlers.EditarEmpresas(st))
+		r.Put("/api/v2/empresas/{rif}/estado", handlers.EstadoEmpresa(st))
+		r.Get("/api/v2/empresas/{rif}/empleados", handlers.EmpleadosPorEmpresa(st))
+		r.Get("/api/v2/empresas/{rif}/ferrys", handlers.ObtenerFerrysPorEmpresa(st))
+
+		r.With(a.idempotente).Post("/api/v2/empleados", handlers.RegistrarEmpleado(st, a.politica))
+		r.Get("/api/v2/empleados/{cedula}", handlers.ObtenerEmpleado(st))
+		r.Put("/api/v2/empleados/{cedula}", handlers.EditarEmpleado(st))
+		r.Patch("/api/v2/empleados/{cedula}", handlers.EditarEmpleado(st))
+		r.Put("/api/v2/empleados/{cedula}/estado", handlers.EstadoEmpleado(st))
+
+		r.With(a.idempotente).Post("/api/v2/ferrys", handlers.RegistrarFerry(st))
+		r.Put("/api/v2/ferrys/{matricula}", handlers.EditarFerry(st))
+		r.Patch("/api/v2/ferrys/{matricula}", handlers.EditarFerry(st))
+
+		r.Put("/api/v2/usuarios/yo/contrasena", handlers.CambiarContrasenaPersonal(st, a.politica))
+		r.Get("/api/v2/usuarios/{rif_cedula}", handlers.ObtenerUsuario(st))
+		r.Put("/api/v2/usuarios/{rif_cedula}", handlers.EditarUsuario(st, a.politica))
+		r.Patch("/api/v2/usuarios/{rif_cedula}", handlers.EditarUsuario(st, a.politica))
+
+		//Claves API de la empresa
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.SoloEmpresa)
+
+			r.Post("/api/v2/claves-api", handlers.CrearClaveAPI(st))
+			r.Get("/api/v2/claves-api", handlers.ListarClavesAPI(st))
+			r.Delete("/api/v2/claves-api/{id}", handlers.RevocarClaveAPI(st))
+		})
+
+		//Solo administradores
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.SoloAdmin)
+
+			r.Get("/api/v2/empresas", handlers.ListarEmpresas(st))
+			r.With(a.idempotente).Post("/api/v2/empresas", handlers.RegistrarEmpresa(st, a.politica))
+
+			r.Get("/api/v2/usuarios", handlers.ListarUsuarios(st))
+			r.Post("/api/v2/usuarios", handlers.RegistrarUsuario(st, a.politica))
+			r.Put("/api/v2/usuarios/{rif_cedula}/estado", handlers.EstadoUsuario(st))
+			r.Put("/api/v2/usuarios/{rif_cedula}/contrasena", handlers.CambiarContrasena(st, a.politica))
+			r.Delete("/api/v2/usuarios/{rif_cedula}/bloqueo", handlers.DesbloquearUsuario(st, a.intentos))
+
+			r.Get("/api/v2/auditoria", handlers.ListarAuditoria(st))
+			r.Get("/api/v2/auditoria/verificacion", handlers.VerificarAuditoria(st))
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/handlers"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/middlewares"
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/security"
+	"github.com/go-chi/chi/v5"
+)
+
+// Fecha desde la que la v1 esta obsoleta (publicacion de la v2)
+var obsoletaV1 = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// rutasV1 mantiene las rutas originales de /api para los clientes existentes. Usan los
+// mismos handlers que la v2 y responden con Deprecation y un Link a la ruta que las reemplaza
+func (a api) rutasV1(r chi.Router) {
+	st := a.st
+	v2 := func(sucesora string) func(http.Handler) http.Handler {
+		return middlewares.Obsoleta(obsoletaV1, sucesora)
+	}
+
+	r.With(a.porIP, v2("/api/v2/sesiones")).Post("/api/login", handlers.IniciarSesion(st, a.intentos, a.totp, a.tokens, a.politica))
+	r.With(a.porIP, v2("/api/v2/sesiones/2fa")).Post("/api/login/2fa", handlers.VerificarSegundoFactor(st, a.intentos, a.tokens))
+
+	//Inscripcion 2FA (acepta tambien el token restringido de inscripcion)
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionInscripcion2FA)
+		r.Use(a.porUsuario)
+
+		r.With(v2("/api/v2/dos-factores")).Post("/api/2fa/inscribir", handlers.InscribirTOTP(st, a.totp))
+		r.With(v2("/api/v2/dos-factores/confirmacion")).Post("/api/2fa/confirmar", handlers.ConfirmarTOTP(st, a.intentos))
+	})
+
+	//Rutas que aceptan JWT o clave API
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionJWTOClaveAPI(st.ClavesAPI))
+		r.Use(a.porUsuario)
+
+		r.With(v2("/api/v2/facturas"), middlewares.RequiereAlcance(security.AlcanceFacturasCrear), a.idempotente).Post("/api/factura/generar", handlers.CrearFactura(st))
+		r.With(v2("/api/v2/facturas/{id}"), middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/factura/obtener/{id}", handlers.ObtenerFactura(st))
+		r.With(v2("/api/v2/facturas"), middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/facturas", handlers.ListarFacturas(st))
+		r.With(v2("/api/v2/facturas/exportacion"), middlewares.RequiereAlcance(security.AlcanceFacturasLeer)).Get("/api/facturas/exportar", handlers.ExportarFacturas(st))
+		r.With(v2("/api/v2/ferrys/{matricula}"), middlewares.RequiereAlcance(security.AlcanceFerrysLeer)).Get("/api/ferry/buscar/{matricula}", handlers.ObtenerFerry(st))
+	})
+
+	//Grupo de rutas protegidas
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AutenticacionJWT)
+		r.Use(a.porUsuario)
+
+		r.With(v2("/api/v2/empresas/{rif}")).Put("/api/empresas/actualizar/{rif}", handlers.EditarEmpresas(st))
+		r.With(v2("/api/v2/empresas/{rif}")).Patch("/api/empresas/actualizar/{rif}", handlers.EditarEmpresas(st))
+		r.With(v2("/api/v2/empresas/{rif}/estado")).Put("/api/empresas/{rif}/{accion}", handlers.EstadoEmpresa(st))
+		r.With(v2("/api/v2/empresas/{rif}")).Get("/api/empresas/buscar/{rif}", handlers.ObtenerEmpresa(st))
+		r.With(v2("/api/v2/empresas/{rif}/empleados")).Get("/api/empresas/{rif}/empleados", handlers.EmpleadosPorEmpresa(st))
+		r.With(v2("/api/v2/empresas/{rif}/ferrys")).Get("/api/empresas/{rif}/ferrys", handlers.ObtenerFerrysPorEmpresa(st))
+
+		r.With(v2("/api/v2/empleados"), a.idempotente).Post("/api/empleado/registrar", handlers.RegistrarEmpleado(st, a.politica))
+		r.With(v2("/api/v2/empleados/{cedula}")).Put("/api/empleado/actualizar/{cedula}", handlers.EditarEmpleado(st))
+		r.With(v2("/api/v2/empleados/{cedula}")).Patch("/api/empleado/actualizar/{cedula}", handlers.EditarEmpleado(st))
+		r.With(v2("/api/v2/empleados/{cedula}/estado"), conAccion("activar")).Put("/api/empleado/activar/{cedula}", handlers.EstadoEmpleado(st))
+		r.With(v2("/api/v2/empleados/{cedula}/estado"), conAccion("desactivar")).Put("/api/empleado/desactivar/{cedula}", handlers.EstadoEmpleado(st))
+		r.With(v2("/api/v2/empleados/{cedula}")).Get("/api/empleado/buscar/{cedula}", handlers.ObtenerEmpleado(st))
+
+		r.With(v2("/api/v2/usuarios/{rif_cedula}")).Get("/api/usuario/{rif_cedula}", handlers.ObtenerUsuario(st))
+		r.With(v2("/api/v2/usuarios/{rif_cedula}")).Put("/api/usuario/{rif_cedula}", handlers.EditarUsuario(st, a.politica))
+		r.With(v2("/api/v2/usuarios/{rif_cedula}")).Patch("/api/usuario/{rif_cedula}", handlers.EditarUsuario(st, a.politica))
+		r.With(v2("/api/v2/usuarios/yo/contrasena")).Put("/api/usuarios/{rif_cedula}/contrasena-personal", handlers.CambiarContrasenaPersonal(st, a.politica))
+		r.With(v2("/api/v2/dos-factores")).Post("/api/2fa/desactivar", handlers.DesactivarTOTP(st, a.intentos, a.totp))
+
+		r.With(v2("/api/v2/ferrys"), a.idempotente).Post("/api/ferry/registrar", handlers.RegistrarFerry(st))
+		r.With(v2("/api/v2/ferrys/{matricula}")).Put("/api/ferry/actualizar/{matricula}", handlers.EditarFerry(st))
+		r.With(v2("/api/v2/ferrys/{matricula}")).Patch("/api/ferry/actualizar/{matricula}", handlers.EditarFerry(st))
+
+		r.With(v2("/api/v2/facturas/{id}/estado")).Put("/api/factura/{id}/estado/{accion}", handlers.CambiarEstadoFactura(st))
+
+		//Claves API de la empresa
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.SoloEmpresa)
+
+			r.With(v2("/api/v2/claves-api")).Post("/api/claves-api", handlers.CrearClaveAPI(st))
+			r.With(v2("/api/v2/claves-api")).Get("/api/claves-api", handlers.ListarClavesAPI(st))
+			r.With(v2("/api/v2/claves-api/{id}")).Delete("/api/claves-api/{id}", handlers.RevocarClaveAPI(st))
+		})
+
+		//Subgrupo solo para administradores
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.SoloAdmin)
+
+			r.With(v2("/api/v2/empresas"), a.idempotente).Post("/api/empresas/registrar", handlers.RegistrarEmpresa(st, a.politica))
+			r.With(v2("/api/v2/usuarios")).Post("/api/usuario/registrar", handlers.RegistrarUsuario(st, a.politica))
+
+			r.With(v2("/api/v2/empresas")).Get("/api/empresas", handlers.ListarEmpresas(st))
+			r.With(v2("/api/v2/usuarios")).Get("/api/usuarios", handlers.ListarUsuarios(st))
+
+			r.With(v2("/api/v2/auditoria")).Get("/api/auditoria", handlers.ListarAuditoria(st))
+			r.With(v2("/api/v2/auditoria/verificacion")).Get("/api/auditoria/verificar", handlers.VerificarAuditoria(st))
+
+			r.With(v2("/api/v2/usuarios/{rif_cedula}/estado")).Put("/api/usuarios/{rif_cedula}/{accion}", handlers.EstadoUsuario(st))
+			r.With(v2("/api/v2/usuarios/{rif_cedula}/contrasena")).Put("/api/usuario/{rif_cedula}/cambiar-contrasena", handlers.CambiarContrasena(st, a.politica))
+			r.With(v2("/api/v2/usuarios/{rif_cedula}/bloqueo")).Put("/api/usuarios/{rif_cedula}/desbloquear", handlers.DesbloquearUsuario(st, a.intentos))
+		})
+	})
+}
+
+// conAccion adapta las rutas de la v1 que llevan la accion fija en la ruta
+// (/api/empleado/activar/{cedula}) al parametro {accion} que leen los handlers de estado
+func conAccion(accion string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chi.RouteContext(r.Context()).URLParams.Add("accion", accion)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
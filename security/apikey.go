@@ -0,0 +1,79 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Las claves tienen la forma fak_<prefijo>_<secreto>. El prefijo se guarda en claro para
+// identificar la clave en listados y logs; del secreto solo se guarda su hash
+const prefijoClaveAPI = "fak_"
+
+// Alcances que puede tener una clave API
+const (
+	AlcanceFacturasCrear = "facturas:crear"
+	AlcanceFacturasLeer  = "facturas:leer"
+	AlcanceFerrysLeer    = "ferrys:leer"
+)
+
+var AlcancesValidos = []string{AlcanceFacturasCrear, AlcanceFacturasLeer, AlcanceFerrysLeer}
+
+// ClaveAPIGenerada contiene la clave completa (se muestra una sola vez) y lo que se persiste
+type ClaveAPIGenerada struct {
+	Clave   string
+	Prefijo string
+	Hash    string
+}
+
+// GenerarClaveAPI crea una clave aleatoria con un prefijo identificable
+func GenerarClaveAPI() (ClaveAPIGenerada, error) {
+	prefijo := make([]byte, 4)
+	secreto := make([]byte, 24)
+	if _, err := rand.Read(prefijo); err != nil {
+		return ClaveAPIGenerada{}, fmt.Errorf("error generando clave API: %v", err)
+	}
+	if _, err := rand.Read(secreto); err != nil {
+		return ClaveAPIGenerada{}, fmt.Errorf("error generando clave API: %v", err)
+	}
+
+	p := hex.EncodeToString(prefijo)
+	clave := prefijoClaveAPI + p + "_" + hex.EncodeToString(secreto)
+	return ClaveAPIGenerada{
+		Clave:   clave,
+		Prefijo: p,
+		Hash:    HashClaveAPI(clave),
+	}, nil
+}
+
+// PrefijoClaveAPI extrae el prefijo de una clave con el formato esperado
+func PrefijoClaveAPI(clave string) (string, bool) {
+	if !strings.HasPrefix(clave, prefijoClaveAPI) {
+		return "", false
+	}
+	partes := strings.Split(strings.TrimPrefix(clave, prefijoClaveAPI), "_")
+	if len(partes) != 2 || partes[0] == "" || partes[1] == "" {
+		return "", false
+	}
+	return partes[0], true
+}
+
+// HashClaveAPI devuelve el SHA-256 de la clave completa
+func HashClaveAPI(clave string) string {
+	suma := sha256.Sum256([]byte(clave))
+	return hex.EncodeToString(suma[:])
+}
+
+// AlcancesInvalidos devuelve los alcances que no existen
+func AlcancesInvalidos(alcances []string) []string {
+	var invalidos []string
+	for _, a := range alcances {
+		if !slices.Contains(AlcancesValidos, a) {
+			invalidos = append(invalidos, a)
+		}
+	}
+	return invalidos
+}
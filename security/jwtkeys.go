@@ -0,0 +1,281 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaveFirma es una clave del conjunto, identificada por su kid. Las claves retiradas
+// pueden cargarse solo con la parte publica para seguir verificando tokens emitidos
+type ClaveFirma struct {
+	Kid     string
+	Metodo  jwt.SigningMethod
+	Privada crypto.Signer // nil si solo se usa para verificar
+	Publica crypto.PublicKey
+}
+
+// ConjuntoClaves firma con la clave activa y verifica con cualquiera de las cargadas
+type ConjuntoClaves struct {
+	mu         sync.RWMutex
+	directorio string
+	kidActivo  string
+	activa     *ClaveFirma
+	claves     map[string]*ClaveFirma
+}
+
+// CargarConjuntoClaves lee las claves PEM de un directorio. Cada archivo <kid>.pem contiene
+// una clave privada (RSA o Ed25519, PKCS#8 o PKCS#1) y cada <kid>.pub.pem una clave publica.
+// Si hay ambas para el mismo kid, la publica debe corresponder a la privada. La clave activa
+// es kidActivo o, si esta vacio, la clave privada con el kid mayor (por ejemplo con kids
+// fechados: 2026-01, 2026-07)
+func CargarConjuntoClaves(directorio, kidActivo string) (*ConjuntoClaves, error) {
+	c := &ConjuntoClaves{directorio: directorio, kidActivo: kidActivo}
+	if err := c.Recargar(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ConjuntoClavesEfimero genera una clave Ed25519 en memoria. Solo para desarrollo:
+// los tokens dejan de ser validos al reiniciar y no se comparten entre instancias
+func ConjuntoClavesEfimero() (*ConjuntoClaves, error) {
+	publica, privada, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error generando clave efimera: %v", err)
+	}
+	clave := &ClaveFirma{Kid: "efimera", Metodo: jwt.SigningMethodEdDSA, Privada: privada, Publica: publica}
+	return &ConjuntoClaves{
+		activa: clave,
+		claves: map[string]*ClaveFirma{clave.Kid: clave},
+	}, nil
+}
+
+// Recargar vuelve a leer el directorio, permitiendo rotar claves sin reiniciar
+func (c *ConjuntoClaves) Recargar() error {
+	if c.directorio == "" {
+		return nil
+	}
+
+	archivos, err := filepath.Glob(filepath.Join(c.directorio, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("error listando claves: %v", err)
+	}
+
+	claves := make(map[string]*ClaveFirma)
+	for _, archivo := range archivos {
+		clave, err := leerClavePEM(archivo)
+		if err != nil {
+			return err
+		}
+		if anterior, repetida := claves[clave.Kid]; repetida {
+			if clave, err = combinarClaves(anterior, clave); err != nil {
+				return err
+			}
+		}
+		claves[clave.Kid] = clave
+	}
+
+	activa, err := elegirClaveActiva(claves, c.kidActivo)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.claves = claves
+	c.activa = activa
+	return nil
+}
+
+// Une el <kid>.pem y el <kid>.pub.pem de un mismo kid: se queda con la privada, de la que
+// se deriva la publica, y comprueba que el .pub.pem no sea de otra clave
+func combinarClaves(a, b *ClaveFirma) (*ClaveFirma, error) {
+	privada, publica := a, b
+	if privada.Privada == nil {
+		privada, publica = b, a
+	}
+	if privada.Privada == nil || publica.Privada != nil {
+		return nil, fmt.Errorf("kid duplicado: %s", a.Kid)
+	}
+	comparable, ok := privada.Publica.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !comparable.Equal(publica.Publica) {
+		return nil, fmt.Errorf("la clave publica del kid %s no corresponde a su clave privada", a.Kid)
+	}
+	return privada, nil
+}
+
+func elegirClaveActiva(claves map[string]*ClaveFirma, kidActivo string) (*ClaveFirma, error) {
+	if kidActivo != "" {
+		clave, ok := claves[kidActivo]
+		if !ok || clave.Privada == nil {
+			return nil, fmt.Errorf("no hay clave privada para el kid activo %q", kidActivo)
+		}
+		return clave, nil
+	}
+
+	var kids []string
+	for kid, clave := range claves {
+		if clave.Privada != nil {
+			kids = append(kids, kid)
+		}
+	}
+	if len(kids) == 0 {
+		return nil, errors.New("no se encontro ninguna clave privada para firmar tokens")
+	}
+	sort.Strings(kids)
+	return claves[kids[len(kids)-1]], nil
+}
+
+func leerClavePEM(archivo string) (*ClaveFirma, error) {
+	datos, err := os.ReadFile(archivo)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %v", archivo, err)
+	}
+	bloque, _ := pem.Decode(datos)
+	if bloque == nil {
+		return nil, fmt.Errorf("%s no contiene un bloque PEM", archivo)
+	}
+
+	nombre := filepath.Base(archivo)
+	if kid, ok := strings.CutSuffix(nombre, ".pub.pem"); ok {
+		publica, err := x509.ParsePKIXPublicKey(bloque.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("clave publica invalida en %s: %v", archivo, err)
+		}
+		metodo, err := metodoParaClave(publica)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", archivo, err)
+		}
+		return &ClaveFirma{Kid: kid, Metodo: metodo, Publica: publica}, nil
+	}
+
+	kid := strings.TrimSuffix(nombre, ".pem")
+	var privada any
+	switch bloque.Type {
+	case "RSA PRIVATE KEY":
+		privada, err = x509.ParsePKCS1PrivateKey(bloque.Bytes)
+	default:
+		privada, err = x509.ParsePKCS8PrivateKey(bloque.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("clave privada invalida en %s: %v", archivo, err)
+	}
+
+	firmante, ok := privada.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: tipo de clave no soportado", archivo)
+	}
+	metodo, err := metodoParaClave(firmante.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", archivo, err)
+	}
+	return &ClaveFirma{Kid: kid, Metodo: metodo, Privada: firmante, Publica: firmante.Public()}, nil
+}
+
+func metodoParaClave(publica crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := publica.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("las claves RSA deben tener al menos 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, errors.New("solo se admiten claves RSA y Ed25519")
+	}
+}
+
+// Firmar emite un token con la clave activa e incluye su kid en la cabecera
+func (c *ConjuntoClaves) Firmar(claims jwt.Claims) (string, error) {
+	c.mu.RLock()
+	activa := c.activa
+	c.mu.RUnlock()
+
+	token := jwt.NewWithClaims(activa.Metodo, claims)
+	token.Header["kid"] = activa.Kid
+	return token.SignedString(activa.Privada)
+}
+
+// FuncionClave se pasa a jwt.Parse: busca la clave por kid y exige que el algoritmo coincida
+func (c *ConjuntoClaves) FuncionClave(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.RLock()
+	clave, ok := c.claves[kid]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("kid desconocido: %q", kid)
+	}
+	if token.Method.Alg() != clave.Metodo.Alg() {
+		return nil, fmt.Errorf("algoritmo %s no corresponde a la clave %s", token.Method.Alg(), kid)
+	}
+	return clave.Publica, nil
+}
+
+// Metodos devuelve los algoritmos aceptados al verificar
+func (c *ConjuntoClaves) Metodos() []string {
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWK publica en formato RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS devuelve las claves publicas para que otros servicios verifiquen los tokens
+func (c *ConjuntoClaves) JWKS() JWKS {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	kids := make([]string, 0, len(c.claves))
+	for kid := range c.claves {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		clave := c.claves[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: clave.Metodo.Alg()}
+
+		switch k := clave.Publica.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,87 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func escribirPEM(t *testing.T, ruta, tipo string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(ruta, pem.EncodeToMemory(&pem.Block{Type: tipo, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Genera una clave Ed25519 y escribe <kid>.pem y, si publica, <kid>.pub.pem
+func escribirClave(t *testing.T, dir, kid string, publica bool) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escribirPEM(t, filepath.Join(dir, kid+".pem"), "PRIVATE KEY", der)
+	if publica {
+		escribirPublica(t, dir, kid, pub)
+	}
+}
+
+func escribirPublica(t *testing.T, dir, kid string, pub ed25519.PublicKey) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escribirPEM(t, filepath.Join(dir, kid+".pub.pem"), "PUBLIC KEY", der)
+}
+
+func TestCargarConjuntoClaves(t *testing.T) {
+	t.Run("privada y publica del mismo kid", func(t *testing.T) {
+		dir := t.TempDir()
+		escribirClave(t, dir, "2026-01", true)
+		escribirClave(t, dir, "2026-07", true)
+		//Retirada: solo la publica
+		retirada, _, _ := ed25519.GenerateKey(nil)
+		escribirPublica(t, dir, "2025-07", retirada)
+
+		c, err := CargarConjuntoClaves(dir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.activa.Kid != "2026-07" {
+			t.Errorf("clave activa %s, se esperaba 2026-07", c.activa.Kid)
+		}
+		if len(c.JWKS().Keys) != 3 {
+			t.Errorf("JWKS con %d claves, se esperaban 3", len(c.JWKS().Keys))
+		}
+	})
+
+	t.Run("publica de otra clave", func(t *testing.T) {
+		dir := t.TempDir()
+		escribirClave(t, dir, "2026-01", false)
+		otra, _, _ := ed25519.GenerateKey(nil)
+		escribirPublica(t, dir, "2026-01", otra)
+
+		if _, err := CargarConjuntoClaves(dir, ""); err == nil || !strings.Contains(err.Error(), "no corresponde") {
+			t.Errorf("se esperaba un error por la clave publica que no corresponde, se obtuvo %v", err)
+		}
+	})
+
+	t.Run("sin clave privada", func(t *testing.T) {
+		dir := t.TempDir()
+		pub, _, _ := ed25519.GenerateKey(nil)
+		escribirPublica(t, dir, "2026-01", pub)
+
+		if _, err := CargarConjuntoClaves(dir, ""); err == nil {
+			t.Error("se esperaba un error sin ninguna clave privada")
+		}
+	})
+}
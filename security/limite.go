@@ -0,0 +1,118 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tasa es un limite de solicitudes por periodo, escrito como 10/s, 60/m o 1000/h. Se
+// aplica como una cubeta de tokens: se permiten rafagas de hasta Solicitudes y la
+// cubeta se rellena de forma continua a lo largo del periodo
+type Tasa struct {
+	Solicitudes int
+	Periodo     time.Duration
+}
+
+var periodosTasa = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+func (t *Tasa) UnmarshalText(texto []byte) error {
+	cantidad, unidad, ok := strings.Cut(strings.TrimSpace(string(texto)), "/")
+	n, err := strconv.Atoi(strings.TrimSpace(cantidad))
+	periodo, unidadValida := periodosTasa[strings.TrimSpace(unidad)]
+	if !ok || err != nil || n <= 0 || !unidadValida {
+		return fmt.Errorf("tasa invalida %q (use por ejemplo 10/s, 60/m o 1000/h)", texto)
+	}
+	*t = Tasa{Solicitudes: n, Periodo: periodo}
+	return nil
+}
+
+func (t Tasa) String() string {
+	for unidad, periodo := range periodosTasa {
+		if periodo == t.Periodo {
+			return fmt.Sprintf("%d/%s", t.Solicitudes, unidad)
+		}
+	}
+	return fmt.Sprintf("%d/%s", t.Solicitudes, t.Periodo)
+}
+
+// ResultadoLimite indica si se permitio la solicitud y, si no, cuanto esperar
+type ResultadoLimite struct {
+	Permitido bool
+	Restantes int           // Solicitudes que aun caben en la rafaga
+	Espera    time.Duration // Tiempo hasta que haya un token disponible
+}
+
+// AlmacenLimites guarda las cubetas de tokens por clave. LimitadorMemoria sirve para una
+// sola instancia; con varias instancias se implementa sobre un almacen compartido (por
+// ejemplo Redis) para que todas consuman de la misma cubeta
+type AlmacenLimites interface {
+	Tomar(ctx context.Context, clave string, tasa Tasa) (ResultadoLimite, error)
+}
+
+type cubeta struct {
+	tokens  float64
+	ultima  time.Time
+	periodo time.Duration
+}
+
+// LimitadorMemoria guarda las cubetas en memoria del proceso
+type LimitadorMemoria struct {
+	mu      sync.Mutex
+	cubetas map[string]*cubeta
+	ahora   func() time.Time
+}
+
+func NuevoLimitadorMemoria() *LimitadorMemoria {
+	return &LimitadorMemoria{
+		cubetas: make(map[string]*cubeta),
+		ahora:   time.Now,
+	}
+}
+
+// Tomar consume un token de la cubeta de la clave si hay alguno disponible
+func (l *LimitadorMemoria) Tomar(_ context.Context, clave string, tasa Tasa) (ResultadoLimite, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ahora := l.ahora()
+	capacidad := float64(tasa.Solicitudes)
+	porSegundo := capacidad / tasa.Periodo.Seconds()
+
+	c, ok := l.cubetas[clave]
+	if !ok {
+		l.limpiar(ahora)
+		c = &cubeta{tokens: capacidad, ultima: ahora}
+		l.cubetas[clave] = c
+	}
+	c.tokens = min(capacidad, c.tokens+ahora.Sub(c.ultima).Seconds()*porSegundo)
+	c.ultima = ahora
+	c.periodo = tasa.Periodo
+
+	if c.tokens < 1 {
+		espera := time.Duration((1 - c.tokens) / porSegundo * float64(time.Second))
+		return ResultadoLimite{Espera: espera}, nil
+	}
+	c.tokens--
+	return ResultadoLimite{Permitido: true, Restantes: int(c.tokens)}, nil
+}
+
+// Elimina las cubetas que ya se habrian rellenado, equivalentes a una nueva, para que
+// el mapa no crezca sin limite
+func (l *LimitadorMemoria) limpiar(ahora time.Time) {
+	if len(l.cubetas) < 1024 {
+		return
+	}
+	for clave, c := range l.cubetas {
+		if ahora.Sub(c.ultima) >= c.periodo {
+			delete(l.cubetas, clave)
+		}
+	}
+}
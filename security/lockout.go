@@ -0,0 +1,200 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigBloqueo define los umbrales de proteccion contra fuerza bruta en el login
+type ConfigBloqueo struct {
+	MaxIntentosUsuario int           // Fallos permitidos por usuario antes del bloqueo
+	MaxIntentosIP      int           // Fallos permitidos por IP antes del bloqueo
+	RetrasoBase        time.Duration // Retraso aplicado tras el primer fallo
+	RetrasoMaximo      time.Duration // Tope del retraso progresivo
+	DuracionBloqueo    time.Duration // Tiempo que dura un bloqueo temporal
+	Ventana            time.Duration // Tiempo sin fallos tras el cual se olvida el contador
+}
+
+// ConfigBloqueoPorDefecto devuelve los umbrales usados si no se configuran otros
+func ConfigBloqueoPorDefecto() ConfigBloqueo {
+	return ConfigBloqueo{
+		MaxIntentosUsuario: 5,
+		MaxIntentosIP:      20,
+		RetrasoBase:        250 * time.Millisecond,
+		RetrasoMaximo:      4 * time.Second,
+		DuracionBloqueo:    15 * time.Minute,
+		Ventana:            15 * time.Minute,
+	}
+}
+
+// AlmacenIntentos guarda los fallos y bloqueos por clave. AlmacenIntentosMemoria sirve para
+// una sola instancia; con varias se implementa sobre un almacen compartido para que un
+// bloqueo valga en todas y no se reinicie al desplegar
+type AlmacenIntentos interface {
+	// BloqueadoHasta devuelve el fin del bloqueo de la clave (cero si nunca se bloqueo)
+	BloqueadoHasta(ctx context.Context, clave string) (time.Time, error)
+	// SumarFallo suma un fallo a la clave, olvidando los anteriores si el ultimo fue hace mas
+	// de ventana. Al llegar a maxIntentos, si no estaba bloqueada, la bloquea durante
+	// duracion y pone la cuenta a cero. Devuelve los fallos acumulados y si se bloqueo
+	SumarFallo(ctx context.Context, clave string, maxIntentos int, ventana, duracion time.Duration) (int, bool, error)
+	// Reiniciar borra los fallos y el bloqueo de la clave
+	Reiniciar(ctx context.Context, clave string) error
+}
+
+// ControlIntentos aplica los umbrales de ConfigBloqueo sobre un AlmacenIntentos
+type ControlIntentos struct {
+	cfg     ConfigBloqueo
+	almacen AlmacenIntentos
+	ahora   func() time.Time
+}
+
+func NuevoControlIntentos(cfg ConfigBloqueo, almacen AlmacenIntentos) *ControlIntentos {
+	return &ControlIntentos{
+		cfg:     cfg,
+		almacen: almacen,
+		ahora:   time.Now,
+	}
+}
+
+// Resultado de registrar un fallo
+type ResultadoFallo struct {
+	Retraso      time.Duration // Tiempo que debe esperar la respuesta
+	NuevoBloqueo bool          // True si este fallo provoco el bloqueo
+}
+
+// Claves para el control de intentos. El usuario se normaliza para que
+// variaciones de mayusculas no permitan saltarse el limite
+func ClaveUsuario(usuario string) string {
+	return "usuario:" + strings.ToLower(strings.TrimSpace(usuario))
+}
+
+func ClaveIP(ip string) string {
+	return "ip:" + ip
+}
+
+// Bloqueado devuelve cuanto falta para liberar la clave bloqueada por mas tiempo, o cero
+// si ninguna lo esta
+func (c *ControlIntentos) Bloqueado(ctx context.Context, claves ...string) (time.Duration, error) {
+	ahora := c.ahora()
+	var restante time.Duration
+	for _, clave := range claves {
+		hasta, err := c.almacen.BloqueadoHasta(ctx, clave)
+		if err != nil {
+			return 0, fmt.Errorf("error consultando bloqueo de %s: %w", clave, err)
+		}
+		if r := hasta.Sub(ahora); r > restante {
+			restante = r
+		}
+	}
+	return restante, nil
+}
+
+// RegistrarFallo suma un fallo a la clave y devuelve el retraso progresivo a aplicar
+func (c *ControlIntentos) RegistrarFallo(ctx context.Context, clave string, maxIntentos int) (ResultadoFallo, error) {
+	fallos, bloqueo, err := c.almacen.SumarFallo(ctx, clave, maxIntentos, c.cfg.Ventana, c.cfg.DuracionBloqueo)
+	if err != nil {
+		return ResultadoFallo{Retraso: c.cfg.RetrasoMaximo}, fmt.Errorf("error registrando fallo de %s: %w", clave, err)
+	}
+
+	//Retraso exponencial: base, 2*base, 4*base ... hasta el maximo
+	retraso := c.cfg.RetrasoBase
+	for i := 1; i < fallos && retraso < c.cfg.RetrasoMaximo; i++ {
+		retraso *= 2
+	}
+	if retraso > c.cfg.RetrasoMaximo {
+		retraso = c.cfg.RetrasoMaximo
+	}
+	return ResultadoFallo{Retraso: retraso, NuevoBloqueo: bloqueo}, nil
+}
+
+// Reiniciar borra los fallos y el bloqueo de una clave
+func (c *ControlIntentos) Reiniciar(ctx context.Context, clave string) error {
+	return c.almacen.Reiniciar(ctx, clave)
+}
+
+// Config devuelve los umbrales con los que se creo el control
+func (c *ControlIntentos) Config() ConfigBloqueo {
+	return c.cfg
+}
+
+type registroIntentos struct {
+	fallos         int
+	ultimoFallo    time.Time
+	bloqueadoHasta time.Time
+	ventana        time.Duration
+}
+
+// AlmacenIntentosMemoria guarda los fallos en memoria del proceso
+type AlmacenIntentosMemoria struct {
+	mu        sync.Mutex
+	registros map[string]*registroIntentos
+	ahora     func() time.Time
+}
+
+func NuevoAlmacenIntentosMemoria() *AlmacenIntentosMemoria {
+	return &AlmacenIntentosMemoria{
+		registros: make(map[string]*registroIntentos),
+		ahora:     time.Now,
+	}
+}
+
+func (a *AlmacenIntentosMemoria) BloqueadoHasta(_ context.Context, clave string) (time.Time, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if reg, ok := a.registros[clave]; ok {
+		return reg.bloqueadoHasta, nil
+	}
+	return time.Time{}, nil
+}
+
+func (a *AlmacenIntentosMemoria) SumarFallo(_ context.Context, clave string, maxIntentos int, ventana, duracion time.Duration) (int, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ahora := a.ahora()
+	reg, ok := a.registros[clave]
+	if !ok || ahora.Sub(reg.ultimoFallo) > ventana {
+		//Los fallos vencidos se olvidan, pero no un bloqueo que siga vigente
+		nuevo := &registroIntentos{}
+		if ok {
+			nuevo.bloqueadoHasta = reg.bloqueadoHasta
+		}
+		a.limpiar(ahora)
+		reg = nuevo
+		a.registros[clave] = reg
+	}
+
+	reg.fallos++
+	reg.ultimoFallo = ahora
+	reg.ventana = ventana
+
+	bloqueo := false
+	if reg.fallos >= maxIntentos && !ahora.Before(reg.bloqueadoHasta) {
+		reg.bloqueadoHasta = ahora.Add(duracion)
+		reg.fallos = 0
+		bloqueo = true
+	}
+	return reg.fallos, bloqueo, nil
+}
+
+func (a *AlmacenIntentosMemoria) Reiniciar(_ context.Context, clave string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.registros, clave)
+	return nil
+}
+
+// Elimina registros vencidos para que el mapa no crezca sin limite
+func (a *AlmacenIntentosMemoria) limpiar(ahora time.Time) {
+	if len(a.registros) < 1024 {
+		return
+	}
+	for clave, reg := range a.registros {
+		if ahora.Sub(reg.ultimoFallo) > reg.ventana && !ahora.Before(reg.bloqueadoHasta) {
+			delete(a.registros, clave)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestControlIntentos(t *testing.T) {
+	ctx := context.Background()
+	ahora := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	reloj := func() time.Time { return ahora }
+
+	almacen := NuevoAlmacenIntentosMemoria()
+	almacen.ahora = reloj
+	c := NuevoControlIntentos(ConfigBloqueo{
+		RetrasoBase:     100 * time.Millisecond,
+		RetrasoMaximo:   300 * time.Millisecond,
+		DuracionBloqueo: 30 * time.Minute,
+		Ventana:         10 * time.Minute,
+	}, almacen)
+	c.ahora = reloj
+	clave := ClaveUsuario(" Naviera ")
+
+	fallar := func() ResultadoFallo {
+		t.Helper()
+		resultado, err := c.RegistrarFallo(ctx, clave, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resultado
+	}
+	bloqueo := func() time.Duration {
+		t.Helper()
+		restante, err := c.Bloqueado(ctx, clave, ClaveIP("203.0.113.7"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return restante
+	}
+
+	//Retraso exponencial con tope
+	for i, esperado := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		if r := fallar(); r.Retraso != esperado || r.NuevoBloqueo {
+			t.Errorf("fallo %d: %+v, se esperaba retraso %v sin bloqueo", i+1, r, esperado)
+		}
+	}
+	if bloqueo() != 0 {
+		t.Fatal("bloqueado antes de llegar al maximo de intentos")
+	}
+	if r := fallar(); !r.NuevoBloqueo {
+		t.Fatalf("el tercer fallo no bloqueo: %+v", r)
+	}
+	if restante := bloqueo(); restante != 30*time.Minute {
+		t.Errorf("restante %v, se esperaban 30m", restante)
+	}
+
+	//Pasada la ventana los fallos se olvidan, pero el bloqueo sigue vigente
+	ahora = ahora.Add(15 * time.Minute)
+	if r := fallar(); r.NuevoBloqueo || r.Retraso != 100*time.Millisecond {
+		t.Errorf("fallo tras la ventana: %+v", r)
+	}
+	if restante := bloqueo(); restante != 15*time.Minute {
+		t.Errorf("restante %v, se esperaban 15m", restante)
+	}
+
+	//Mayusculas y espacios no crean otra clave; Reiniciar libera
+	if err := c.Reiniciar(ctx, ClaveUsuario("naviera")); err != nil {
+		t.Fatal(err)
+	}
+	if bloqueo() != 0 {
+		t.Error("sigue bloqueado despues de Reiniciar")
+	}
+}
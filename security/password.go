@@ -0,0 +1,165 @@
+package security
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Lista offline de contraseñas comunes, una por linea y en minusculas
+//
+//go:embed contrasenas_comunes.txt
+var listaContrasenasComunes string
+
+var contrasenasComunes = cargarContrasenasComunes(listaContrasenasComunes)
+
+func cargarContrasenasComunes(lista string) map[string]struct{} {
+	comunes := make(map[string]struct{})
+	for _, linea := range strings.Split(lista, "\n") {
+		if linea = strings.TrimSpace(linea); linea != "" {
+			comunes[linea] = struct{}{}
+		}
+	}
+	return comunes
+}
+
+// bcrypt solo usa los primeros 72 bytes, por lo que no se aceptan contraseñas mas largas
+const longitudMaximaBcrypt = 72
+
+// PoliticaContrasena reune las reglas que debe cumplir toda contraseña antes de hashearla
+type PoliticaContrasena struct {
+	LongitudMinima    int
+	RequiereMayuscula bool
+	RequiereMinuscula bool
+	RequiereDigito    bool
+	RequiereSimbolo   bool
+	Historial         int  // Cantidad de contraseñas anteriores que no se pueden reutilizar
+	RechazarComunes   bool // Rechazar contraseñas de la lista de contraseñas comunes
+	CostoBcrypt       int  // Costo de bcrypt al hashear las contraseñas aceptadas
+}
+
+// Violacion describe una regla incumplida con un codigo estable para el frontend
+type Violacion struct {
+	Codigo  string `json:"codigo"`
+	Mensaje string `json:"mensaje"`
+}
+
+// Codigos de violacion de la politica
+const (
+	ViolacionLongitudMinima  = "longitud_minima"
+	ViolacionLongitudMaxima  = "longitud_maxima"
+	ViolacionMayuscula       = "requiere_mayuscula"
+	ViolacionMinuscula       = "requiere_minuscula"
+	ViolacionDigito          = "requiere_digito"
+	ViolacionSimbolo         = "requiere_simbolo"
+	ViolacionComun           = "contrasena_comun"
+	ViolacionContieneUsuario = "contiene_usuario"
+	ViolacionReutilizada     = "contrasena_reutilizada"
+)
+
+func PoliticaContrasenaPorDefecto() PoliticaContrasena {
+	return PoliticaContrasena{
+		LongitudMinima:    8,
+		RequiereMayuscula: true,
+		RequiereMinuscula: true,
+		RequiereDigito:    true,
+		RequiereSimbolo:   false,
+		Historial:         5,
+		RechazarComunes:   true,
+		CostoBcrypt:       bcrypt.DefaultCost,
+	}
+}
+
+// Hashear devuelve el hash bcrypt de una contraseña ya validada
+func (p PoliticaContrasena) Hashear(contrasena string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(contrasena), p.CostoBcrypt)
+	return string(hash), err
+}
+
+// Validar devuelve todas las reglas incumplidas. El usuario (si se conoce) no puede
+// formar parte de la contraseña. La reutilizacion se comprueba aparte contra el historial
+func (p PoliticaContrasena) Validar(contrasena, usuario string) []Violacion {
+	var violaciones []Violacion
+
+	if utf8.RuneCountInString(contrasena) < p.LongitudMinima {
+		violaciones = append(violaciones, Violacion{
+			Codigo:  ViolacionLongitudMinima,
+			Mensaje: fmt.Sprintf("La contraseña debe tener al menos %d caracteres", p.LongitudMinima),
+		})
+	}
+	if len(contrasena) > longitudMaximaBcrypt {
+		violaciones = append(violaciones, Violacion{
+			Codigo:  ViolacionLongitudMaxima,
+			Mensaje: fmt.Sprintf("La contraseña no puede superar %d bytes", longitudMaximaBcrypt),
+		})
+	}
+
+	var mayuscula, minuscula, digito, simbolo bool
+	for _, c := range contrasena {
+		switch {
+		case unicode.IsUpper(c):
+			mayuscula = true
+		case unicode.IsLower(c):
+			minuscula = true
+		case unicode.IsDigit(c):
+			digito = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			simbolo = true
+		}
+	}
+
+	if p.RequiereMayuscula && !mayuscula {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionMayuscula, Mensaje: "La contraseña debe incluir al menos una letra mayúscula"})
+	}
+	if p.RequiereMinuscula && !minuscula {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionMinuscula, Mensaje: "La contraseña debe incluir al menos una letra minúscula"})
+	}
+	if p.RequiereDigito && !digito {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionDigito, Mensaje: "La contraseña debe incluir al menos un número"})
+	}
+	if p.RequiereSimbolo && !simbolo {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionSimbolo, Mensaje: "La contraseña debe incluir al menos un símbolo"})
+	}
+
+	if p.RechazarComunes && EsContrasenaComun(contrasena) {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionComun, Mensaje: "La contraseña es demasiado común"})
+	}
+
+	usuario = strings.ToLower(strings.TrimSpace(usuario))
+	if len(usuario) >= 3 && strings.Contains(strings.ToLower(contrasena), usuario) {
+		violaciones = append(violaciones, Violacion{Codigo: ViolacionContieneUsuario, Mensaje: "La contraseña no puede contener el nombre de usuario"})
+	}
+
+	return violaciones
+}
+
+// EsContrasenaComun compara sin distinguir mayusculas y tambien sin los digitos o
+// simbolos finales, para atrapar variantes como "Password1!"
+func EsContrasenaComun(contrasena string) bool {
+	normalizada := strings.ToLower(strings.TrimSpace(contrasena))
+	if _, ok := contrasenasComunes[normalizada]; ok {
+		return true
+	}
+
+	base := strings.TrimRightFunc(normalizada, func(c rune) bool {
+		return unicode.IsDigit(c) || unicode.IsPunct(c) || unicode.IsSymbol(c)
+	})
+	if len(base) >= 4 {
+		if _, ok := contrasenasComunes[base]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ViolacionReutilizacion se devuelve cuando la contraseña coincide con el historial
+func (p PoliticaContrasena) ViolacionReutilizacion() Violacion {
+	return Violacion{
+		Codigo:  ViolacionReutilizada,
+		Mensaje: fmt.Sprintf("La contraseña no puede ser igual a las últimas %d utilizadas", p.Historial),
+	}
+}
@@ -0,0 +1,44 @@
+package security
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPoliticaContrasenaValidar(t *testing.T) {
+	estricta := PoliticaContrasenaPorDefecto()
+	estricta.RequiereSimbolo = true
+
+	casos := []struct {
+		nombre     string
+		politica   PoliticaContrasena
+		contrasena string
+		usuario    string
+		esperadas  []string
+	}{
+		{"valida", PoliticaContrasenaPorDefecto(), "Travesia-Margarita7", "naviera", nil},
+		{"corta", PoliticaContrasenaPorDefecto(), "Ab1xyz", "", []string{ViolacionLongitudMinima}},
+		{"longitud en runas", PoliticaContrasenaPorDefecto(), "Ñandú1ñé", "", nil},
+		{"supera 72 bytes", PoliticaContrasenaPorDefecto(), "Aa1" + strings.Repeat("x", 70), "", []string{ViolacionLongitudMaxima}},
+		{"sin mayuscula ni digito", PoliticaContrasenaPorDefecto(), "travesiamargarita", "", []string{ViolacionMayuscula, ViolacionDigito}},
+		{"sin minuscula", PoliticaContrasenaPorDefecto(), "TRAVESIA-7", "", []string{ViolacionMinuscula}},
+		{"sin simbolo", estricta, "TravesiaMargarita7", "", []string{ViolacionSimbolo}},
+		{"comun", PoliticaContrasenaPorDefecto(), "Password1", "", []string{ViolacionComun}},
+		{"comun con sufijo", PoliticaContrasenaPorDefecto(), "Password123!", "", []string{ViolacionComun}},
+		{"contiene el usuario", PoliticaContrasenaPorDefecto(), "Xx-NAVIERA-2026", " Naviera ", []string{ViolacionContieneUsuario}},
+		{"usuario corto no cuenta", PoliticaContrasenaPorDefecto(), "Travesia-ab7", "ab", nil},
+		{"politica vacia", PoliticaContrasena{}, "a", "", nil},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			var codigos []string
+			for _, v := range c.politica.Validar(c.contrasena, c.usuario) {
+				codigos = append(codigos, v.Codigo)
+			}
+			if !slices.Equal(codigos, c.esperadas) {
+				t.Errorf("violaciones %v, se esperaban %v", codigos, c.esperadas)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package security
+
+import "time"
+
+// DuracionTokens define la vigencia del JWT de sesion y de los tokens restringidos de 2FA
+type DuracionTokens struct {
+	Sesion         time.Duration
+	Desafio2FA     time.Duration // Token entre la contraseña y el codigo TOTP
+	Inscripcion2FA time.Duration // Token que solo permite inscribir el 2FA obligatorio
+}
+
+func DuracionTokensPorDefecto() DuracionTokens {
+	return DuracionTokens{
+		Sesion:         24 * time.Hour,
+		Desafio2FA:     5 * time.Minute,
+		Inscripcion2FA: 15 * time.Minute,
+	}
+}
@@ -0,0 +1,162 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parametros TOTP segun RFC 6238 (compatibles con Google Authenticator, Authy, etc.)
+const (
+	PeriodoTOTP = 30 * time.Second
+	DigitosTOTP = 6
+	// Pasos de tolerancia hacia atras y adelante por desfase de reloj
+	toleranciaTOTP = 1
+)
+
+var codificacionBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerarSecretoTOTP crea un secreto aleatorio de 160 bits codificado en base32
+func GenerarSecretoTOTP() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generando secreto TOTP: %v", err)
+	}
+	return codificacionBase32.EncodeToString(buf), nil
+}
+
+// URIProvisionamiento construye la URI otpauth:// que el frontend convierte en codigo QR
+func URIProvisionamiento(emisor, cuenta, secreto string) string {
+	etiqueta := url.PathEscape(emisor + ":" + cuenta)
+	params := url.Values{}
+	params.Set("secret", secreto)
+	params.Set("issuer", emisor)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", DigitosTOTP))
+	params.Set("period", fmt.Sprintf("%d", int(PeriodoTOTP/time.Second)))
+	return "otpauth://totp/" + etiqueta + "?" + params.Encode()
+}
+
+// Paso de tiempo TOTP correspondiente a un instante
+func PasoTOTP(t time.Time) int64 {
+	return t.Unix() / int64(PeriodoTOTP/time.Second)
+}
+
+// CodigoTOTP calcula el codigo para un paso concreto (HOTP de RFC 4226)
+func CodigoTOTP(secreto string, paso int64) (string, error) {
+	clave, err := codificacionBase32.DecodeString(strings.ToUpper(strings.TrimSpace(secreto)))
+	if err != nil {
+		return "", fmt.Errorf("secreto TOTP invalido: %v", err)
+	}
+
+	var contador [8]byte
+	binary.BigEndian.PutUint64(contador[:], uint64(paso))
+
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(contador[:])
+	suma := mac.Sum(nil)
+
+	desplazamiento := suma[len(suma)-1] & 0x0f
+	binario := binary.BigEndian.Uint32(suma[desplazamiento:desplazamiento+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < DigitosTOTP; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", DigitosTOTP, binario%modulo), nil
+}
+
+// VerificarTOTP comprueba el codigo dentro de la ventana de tolerancia.
+// Devuelve el paso aceptado, que debe guardarse para rechazar reutilizaciones:
+// solo se aceptan pasos posteriores a ultimoPaso
+func VerificarTOTP(secreto, codigo string, t time.Time, ultimoPaso int64) (int64, bool) {
+	codigo = strings.TrimSpace(codigo)
+	if len(codigo) != DigitosTOTP {
+		return 0, false
+	}
+
+	actual := PasoTOTP(t)
+	for i := -toleranciaTOTP; i <= toleranciaTOTP; i++ {
+		paso := actual + int64(i)
+		if paso <= ultimoPaso {
+			continue
+		}
+		esperado, err := CodigoTOTP(secreto, paso)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			return paso, true
+		}
+	}
+	return 0, false
+}
+
+// GenerarCodigosRecuperacion crea n codigos de un solo uso con formato xxxxx-xxxxx
+func GenerarCodigosRecuperacion(n int) ([]string, error) {
+	const alfabeto = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codigos := make([]string, 0, n)
+	buf := make([]byte, 10)
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("error generando codigos de recuperacion: %v", err)
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(alfabeto[int(b)%len(alfabeto)])
+		}
+		codigos = append(codigos, sb.String())
+	}
+	return codigos, nil
+}
+
+// NormalizarCodigoRecuperacion permite que el usuario escriba el codigo con mayusculas o espacios
+func NormalizarCodigoRecuperacion(codigo string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(codigo), " ", ""))
+}
+
+// ConfigTOTP define el emisor mostrado en la app autenticadora y los roles obligados a usar 2FA
+type ConfigTOTP struct {
+	Emisor            string
+	RolesObligatorios []string
+}
+
+// ConfigTOTPPorDefecto usa FerryApp como emisor y no obliga a ningun rol
+func ConfigTOTPPorDefecto() ConfigTOTP {
+	return ConfigTOTP{Emisor: "FerryApp"}
+}
+
+// Obligatorio indica si el rol debe tener 2FA activo para iniciar sesion
+func (c ConfigTOTP) Obligatorio(rol string) bool {
+	for _, r := range c.RolesObligatorios {
+		if strings.EqualFold(r, rol) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashCodigoRecuperacion guarda los codigos de recuperacion como SHA-256: tienen
+// suficiente entropia para no necesitar bcrypt y asi se pueden buscar directamente
+func HashCodigoRecuperacion(codigo string) string {
+	suma := sha256.Sum256([]byte(NormalizarCodigoRecuperacion(codigo)))
+	return hex.EncodeToString(suma[:])
+}
+
+// Clave de control de intentos para el segundo factor de un usuario
+func ClaveSegundoFactor(rifCedula string) string {
+	return "2fa:" + rifCedula
+}
@@ -0,0 +1,113 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+// Secreto de los vectores de RFC 4226 y RFC 6238 ("12345678901234567890") en base32
+const secretoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodigoTOTPVectoresHOTP(t *testing.T) {
+	//RFC 4226, apendice D
+	esperados := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for contador, esperado := range esperados {
+		codigo, err := CodigoTOTP(secretoRFC, int64(contador))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codigo != esperado {
+			t.Errorf("contador %d: codigo %s, se esperaba %s", contador, codigo, esperado)
+		}
+	}
+}
+
+func TestCodigoTOTPVectoresTOTP(t *testing.T) {
+	//RFC 6238, apendice B (SHA1). Los codigos del RFC tienen 8 digitos: se comparan los 6 ultimos
+	casos := []struct {
+		unix     int64
+		esperado string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range casos {
+		codigo, err := CodigoTOTP(secretoRFC, PasoTOTP(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codigo != c.esperado[2:] {
+			t.Errorf("T=%d: codigo %s, se esperaba %s", c.unix, codigo, c.esperado[2:])
+		}
+	}
+
+	//Minusculas y espacios en el secreto se aceptan; base32 invalido no
+	if codigo, err := CodigoTOTP(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", 1); err != nil || codigo != "287082" {
+		t.Errorf("secreto en minusculas: %s (%v)", codigo, err)
+	}
+	if _, err := CodigoTOTP("no-es-base32!", 1); err == nil {
+		t.Error("se esperaba un error con un secreto invalido")
+	}
+}
+
+func TestVerificarTOTP(t *testing.T) {
+	ahora := time.Unix(1111111111, 0)
+	actual := PasoTOTP(ahora)
+	codigo := func(paso int64) string {
+		t.Helper()
+		c, err := CodigoTOTP(secretoRFC, paso)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	casos := []struct {
+		nombre     string
+		codigo     string
+		ultimoPaso int64
+		paso       int64
+		valido     bool
+	}{
+		{"paso actual", codigo(actual), 0, actual, true},
+		{"un paso atras", codigo(actual - 1), 0, actual - 1, true},
+		{"un paso adelante", codigo(actual + 1), 0, actual + 1, true},
+		{"fuera de la ventana", codigo(actual - 2), 0, 0, false},
+		{"fuera de la ventana adelante", codigo(actual + 2), 0, 0, false},
+		{"con espacios", " " + codigo(actual) + " ", 0, actual, true},
+		{"longitud incorrecta", codigo(actual)[:5], 0, 0, false},
+		{"codigo incorrecto", "000000", 0, 0, false},
+
+		//Reutilizacion: solo se aceptan pasos posteriores al ultimo usado
+		{"mismo paso ya usado", codigo(actual), actual, 0, false},
+		{"paso anterior al ultimo usado", codigo(actual - 1), actual, 0, false},
+		{"paso posterior al ultimo usado", codigo(actual + 1), actual, actual + 1, true},
+	}
+	for _, c := range casos {
+		paso, ok := VerificarTOTP(secretoRFC, c.codigo, ahora, c.ultimoPaso)
+		if ok != c.valido || paso != c.paso {
+			t.Errorf("%s: paso %d valido %v, se esperaba paso %d valido %v", c.nombre, paso, ok, c.paso, c.valido)
+		}
+	}
+}
+
+func TestCodigosRecuperacion(t *testing.T) {
+	codigos, err := GenerarCodigosRecuperacion(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vistos := map[string]bool{}
+	for _, c := range codigos {
+		if len(c) != 11 || c[5] != '-' || vistos[c] {
+			t.Errorf("codigo %q con formato invalido o repetido", c)
+		}
+		vistos[c] = true
+	}
+	if HashCodigoRecuperacion(" ABCDE-FGHJK ") != HashCodigoRecuperacion("abcde-fghjk") {
+		t.Error("el hash deberia ignorar mayusculas y espacios")
+	}
+}
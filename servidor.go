@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+)
+
+// servir atiende solicitudes hasta que ctx se cancele (SIGINT/SIGTERM) y luego apaga el
+// servidor esperando las solicitudes en curso. antesDeApagar se llama al recibir la señal
+func servir(ctx context.Context, cfg config.Servidor, handler http.Handler, antesDeApagar func()) error {
+	servidor := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Puerto),
+		Handler:           handler,
+		ReadTimeout:       cfg.Lectura,
+		ReadHeaderTimeout: cfg.Cabeceras,
+		WriteTimeout:      cfg.Escritura,
+		IdleTimeout:       cfg.Inactividad,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	errores := make(chan error, 1)
+	go func() {
+		slog.Info("Servidor escuchando", slog.Int("puerto", cfg.Puerto))
+		errores <- servidor.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errores:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Señal de apagado recibida, terminando solicitudes en curso")
+	antesDeApagar()
+	time.Sleep(cfg.EsperaApagado)
+
+	ctxApagado, cancel := context.WithTimeout(context.Background(), cfg.Apagado)
+	defer cancel()
+	if err := servidor.Shutdown(ctxApagado); err != nil {
+		return err
+	}
+	if err := <-errores; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
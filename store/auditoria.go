@@ -0,0 +1,82 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+)
+
+// VerificacionAuditoria es el resultado de recorrer la cadena de hashes de la auditoria.
+// PrimerAlterado es el id del primer registro cuyo hash no coincide (0 si la cadena es valida)
+type VerificacionAuditoria struct {
+	Valida         bool   `json:"valida"`
+	Registros      int    `json:"registros"`
+	PrimerAlterado int    `json:"primer_alterado,omitempty"`
+	Motivo         string `json:"motivo,omitempty"`
+	UltimoHash     string `json:"ultimo_hash,omitempty"`
+}
+
+// HashAuditoria calcula el hash de un registro encadenado al hash del anterior. No incluye
+// el id, que asigna la base de datos, ni el propio hash
+func HashAuditoria(registro models.RegistroAuditoria) string {
+	contenido, _ := json.Marshal(struct {
+		HashAnterior string                        `json:"hash_anterior"`
+		Actor        string                        `json:"actor"`
+		TipoActor    string                        `json:"tipo_actor"`
+		Accion       string                        `json:"accion"`
+		Entidad      string                        `json:"entidad"`
+		EntidadID    string                        `json:"entidad_id"`
+		Cambios      map[string]models.CambioCampo `json:"cambios"`
+		IP           string                        `json:"ip"`
+		IDSolicitud  string                        `json:"id_solicitud"`
+		Fecha        string                        `json:"fecha"`
+	}{
+		registro.HashAnterior, registro.Actor, registro.TipoActor, registro.Accion, registro.Entidad,
+		registro.EntidadID, registro.Cambios, registro.IP, registro.IDSolicitud,
+		registro.Fecha.UTC().Format(time.RFC3339Nano),
+	})
+	suma := sha256.Sum256(contenido)
+	return hex.EncodeToString(suma[:])
+}
+
+// encadenar completa el registro que se va a agregar despues de anterior. La fecha se
+// redondea a microsegundos, la precision con la que Postgres la guarda
+func encadenar(registro models.RegistroAuditoria, anterior string) models.RegistroAuditoria {
+	registro.Fecha = registro.Fecha.UTC().Truncate(time.Microsecond)
+	registro.HashAnterior = anterior
+	registro.Hash = HashAuditoria(registro)
+	return registro
+}
+
+// verificadorCadena comprueba los registros en orden de id. Borrar los ultimos registros no
+// rompe la cadena; por eso la tabla ademas rechaza UPDATE y DELETE
+type verificadorCadena struct {
+	resultado VerificacionAuditoria
+}
+
+func nuevoVerificador() *verificadorCadena {
+	return &verificadorCadena{resultado: VerificacionAuditoria{Valida: true}}
+}
+
+// agregar devuelve false en el primer registro alterado
+func (v *verificadorCadena) agregar(registro models.RegistroAuditoria) bool {
+	motivo := ""
+	switch {
+	case registro.HashAnterior != v.resultado.UltimoHash:
+		motivo = "el hash anterior no coincide: falta o se modifico un registro previo"
+	case HashAuditoria(registro) != registro.Hash:
+		motivo = "el contenido del registro no coincide con su hash"
+	}
+	if motivo != "" {
+		v.resultado.Valida = false
+		v.resultado.PrimerAlterado = registro.ID
+		v.resultado.Motivo = motivo
+		return false
+	}
+	v.resultado.Registros++
+	v.resultado.UltimoHash = registro.Hash
+	return true
+}
@@ -0,0 +1,401 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+)
+
+// Errores de los parametros de listado
+var (
+	ErrCursorInvalido = errors.New("cursor invalido")
+	ErrOrdenInvalido  = errors.New("campo de orden invalido")
+)
+
+// Limites de tamaño de pagina
+const (
+	LimitePorDefecto = 20
+	LimiteMaximo     = 100
+)
+
+// Consulta describe la pagina pedida de un listado. Si Cursor no esta vacio se usa en
+// lugar de Desplazamiento (paginacion por clave, estable ante inserciones). Orden es
+// el nombre JSON del campo; vacio usa el orden por defecto del listado
+type Consulta struct {
+	Limite         int
+	Desplazamiento int
+	Cursor         string
+	Orden          string
+	Descendente    bool
+}
+
+// Pagina es el resultado de un listado. Total cuenta todos los registros que cumplen
+// el filtro, no solo los de esta pagina. SiguienteCursor esta vacio en la ultima pagina
+type Pagina[T any] struct {
+	Elementos       []T    `json:"elementos"`
+	Total           int    `json:"total"`
+	SiguienteCursor string `json:"siguiente_cursor,omitempty"`
+}
+
+// Filtros por listado. Los campos vacios (o nil) no filtran. Texto busca sin distinguir
+// mayusculas en los nombres del registro
+type FiltroEmpresas struct {
+	Estado *bool
+	Texto  string
+}
+
+type FiltroEmpleados struct {
+	RifEmpresa string
+	Estado     *bool
+	Texto      string
+}
+
+type FiltroUsuarios struct {
+	Tipo   string
+	Estado *bool
+	Texto  string
+}
+
+type FiltroFerrys struct {
+	RifEmpresa string
+	Estado     *bool
+	Texto      string
+}
+
+type FiltroFacturas struct {
+	RifEmpresa     string
+	Estado         *bool
+	Desde          *time.Time // Emision >= Desde
+	Hasta          *time.Time // Emision < Hasta
+	IDViaje        string
+	MatriculaFerry string
+	CedulaEmpleado string
+	Tipo           string
+	Texto          string
+}
+
+type FiltroAuditoria struct {
+	Actor     string
+	Accion    string
+	Entidad   string
+	EntidadID string
+	Desde     *time.Time // Fecha >= Desde
+	Hasta     *time.Time // Fecha < Hasta
+}
+
+// Tipos de columna, usados para convertir el valor guardado en el cursor
+const (
+	tipoTexto  = "text"
+	tipoEntero = "integer"
+	tipoFecha  = "timestamptz"
+	tipoBool   = "boolean"
+)
+
+// campoOrden relaciona un campo ordenable con su columna y su valor en el modelo
+type campoOrden[T any] struct {
+	columna string
+	tipo    string
+	valor   func(T) any
+}
+
+// especListado describe un listado para ambas implementaciones: los campos por los
+// que se puede ordenar y la clave primaria que desempata y sirve de cursor
+type especListado[T any] struct {
+	clave      campoOrden[T]
+	porDefecto string
+	campos     map[string]campoOrden[T]
+}
+
+// Campos ordenables de cada listado (por su nombre JSON)
+func CamposOrdenEmpresas() []string  { return nombresCampos(especEmpresas) }
+func CamposOrdenEmpleados() []string { return nombresCampos(especEmpleados) }
+func CamposOrdenUsuarios() []string  { return nombresCampos(especUsuarios) }
+func CamposOrdenFerrys() []string    { return nombresCampos(especFerrys) }
+func CamposOrdenFacturas() []string  { return nombresCampos(especFacturas) }
+func CamposOrdenAuditoria() []string { return nombresCampos(especAuditoria) }
+
+func nombresCampos[T any](e especListado[T]) []string {
+	return clavesOrdenadas(e.campos)
+}
+
+var especEmpresas = especListado[models.Empresa]{
+	clave:      campoOrden[models.Empresa]{"rif", tipoTexto, func(e models.Empresa) any { return e.RIF }},
+	porDefecto: "rif",
+	campos: map[string]campoOrden[models.Empresa]{
+		"rif":    {"rif", tipoTexto, func(e models.Empresa) any { return e.RIF }},
+		"nombre": {"nombre", tipoTexto, func(e models.Empresa) any { return e.Nombre }},
+		"estado": {"estado", tipoBool, func(e models.Empresa) any { return e.Estado }},
+	},
+}
+
+var especEmpleados = especListado[models.Empleados]{
+	clave:      campoOrden[models.Empleados]{"cedula", tipoTexto, func(e models.Empleados) any { return e.Cedula }},
+	porDefecto: "cedula",
+	campos: map[string]campoOrden[models.Empleados]{
+		"cedula":    {"cedula", tipoTexto, func(e models.Empleados) any { return e.Cedula }},
+		"nombres":   {"nombres", tipoTexto, func(e models.Empleados) any { return e.Nombres }},
+		"apellidos": {"apellidos", tipoTexto, func(e models.Empleados) any { return e.Apellidos }},
+		"cargo":     {"cargo", tipoTexto, func(e models.Empleados) any { return e.Cargo }},
+		"estado":    {"estado", tipoBool, func(e models.Empleados) any { return e.Estado }},
+	},
+}
+
+var especUsuarios = especListado[models.Usuario]{
+	clave:      campoOrden[models.Usuario]{"rif_cedula", tipoTexto, func(u models.Usuario) any { return u.Rif_Cedula }},
+	porDefecto: "rif_cedula",
+	campos: map[string]campoOrden[models.Usuario]{
+		"rif_cedula": {"rif_cedula", tipoTexto, func(u models.Usuario) any { return u.Rif_Cedula }},
+		"usuario":    {"usuario", tipoTexto, func(u models.Usuario) any { return u.Usuario }},
+		"tipo":       {"tipo", tipoTexto, func(u models.Usuario) any { return u.Tipo }},
+		"estado":     {"estado", tipoBool, func(u models.Usuario) any { return u.Estado }},
+	},
+}
+
+var especFerrys = especListado[models.Ferry]{
+	clave:      campoOrden[models.Ferry]{"matricula", tipoTexto, func(f models.Ferry) any { return f.Matricula }},
+	porDefecto: "matricula",
+	campos: map[string]campoOrden[models.Ferry]{
+		"matricula":           {"matricula", tipoTexto, func(f models.Ferry) any { return f.Matricula }},
+		"nombre":              {"nombre", tipoTexto, func(f models.Ferry) any { return f.Nombre }},
+		"modelo":              {"modelo", tipoTexto, func(f models.Ferry) any { return f.Modelo }},
+		"capacidad_economica": {"capacidad_economica", tipoEntero, func(f models.Ferry) any { return f.CapacidadEconomica }},
+		"capacidad_vip":       {"capacidad_vip", tipoEntero, func(f models.Ferry) any { return f.CapacidadVIP }},
+		"estado":              {"estado", tipoBool, func(f models.Ferry) any { return f.Estado }},
+	},
+}
+
+var especFacturas = especListado[models.Factura]{
+	clave:      campoOrden[models.Factura]{"id_factura", tipoEntero, func(f models.Factura) any { return f.IDFactura }},
+	porDefecto: "id_factura",
+	campos: map[string]campoOrden[models.Factura]{
+		"id_factura":        {"id_factura", tipoEntero, func(f models.Factura) any { return f.IDFactura }},
+		"emision":           {"emision", tipoFecha, func(f models.Factura) any { return f.Emision }},
+		"nombres_viajero":   {"nombres_viajero", tipoTexto, func(f models.Factura) any { return f.NombresViajero }},
+		"apellidos_viajero": {"apellidos_viajero", tipoTexto, func(f models.Factura) any { return f.ApellidosViajero }},
+		"matricula_ferry":   {"matricula_ferry", tipoTexto, func(f models.Factura) any { return f.MatriculaFerry }},
+		"tipo":              {"tipo", tipoTexto, func(f models.Factura) any { return f.Tipo }},
+	},
+}
+
+var especAuditoria = especListado[models.RegistroAuditoria]{
+	clave:      campoOrden[models.RegistroAuditoria]{"id", tipoEntero, func(a models.RegistroAuditoria) any { return a.ID }},
+	porDefecto: "id",
+	campos: map[string]campoOrden[models.RegistroAuditoria]{
+		"id":    {"id", tipoEntero, func(a models.RegistroAuditoria) any { return a.ID }},
+		"fecha": {"fecha", tipoFecha, func(a models.RegistroAuditoria) any { return a.Fecha }},
+	},
+}
+
+// Resuelve el campo de orden pedido (o el por defecto)
+func (e especListado[T]) orden(c Consulta) (string, campoOrden[T], error) {
+	nombre := c.Orden
+	if nombre == "" {
+		nombre = e.porDefecto
+	}
+	campo, ok := e.campos[nombre]
+	if !ok {
+		return "", campoOrden[T]{}, ErrOrdenInvalido
+	}
+	return nombre, campo, nil
+}
+
+// cursor guarda el orden con el que se genero y los valores del ultimo registro entregado
+type cursor struct {
+	Orden string `json:"o"`
+	Desc  bool   `json:"d,omitempty"`
+	Valor string `json:"v"`
+	Clave string `json:"k"`
+}
+
+func codificarCursor(c cursor) string {
+	datos, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(datos)
+}
+
+// Decodifica el cursor y comprueba que corresponda al mismo orden de la consulta
+func decodificarCursor(texto, orden string, desc bool) (cursor, error) {
+	datos, err := base64.RawURLEncoding.DecodeString(texto)
+	if err != nil {
+		return cursor{}, ErrCursorInvalido
+	}
+	var c cursor
+	if err := json.Unmarshal(datos, &c); err != nil || c.Orden != orden || c.Desc != desc {
+		return cursor{}, ErrCursorInvalido
+	}
+	return c, nil
+}
+
+// Representacion en texto de un valor de orden; es lo que se guarda en el cursor
+func textoValor(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	default:
+		panic(fmt.Sprintf("store: tipo de orden no soportado %T", v))
+	}
+}
+
+// Convierte el texto del cursor al tipo de la columna
+func valorDesdeTexto(texto, tipo string) (any, error) {
+	switch tipo {
+	case tipoEntero:
+		n, err := strconv.Atoi(texto)
+		if err != nil {
+			return nil, ErrCursorInvalido
+		}
+		return n, nil
+	case tipoBool:
+		b, err := strconv.ParseBool(texto)
+		if err != nil {
+			return nil, ErrCursorInvalido
+		}
+		return b, nil
+	case tipoFecha:
+		t, err := time.Parse(time.RFC3339Nano, texto)
+		if err != nil {
+			return nil, ErrCursorInvalido
+		}
+		return t, nil
+	default:
+		return texto, nil
+	}
+}
+
+// Compara dos valores de orden del mismo tipo
+func compararValores(a, b any) int {
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case int:
+		y := b.(int)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	default:
+		panic(fmt.Sprintf("store: tipo de orden no soportado %T", a))
+	}
+}
+
+// Genera el cursor que apunta despues del registro indicado
+func (e especListado[T]) cursorDespuesDe(nombre string, campo campoOrden[T], desc bool, ultimo T) string {
+	return codificarCursor(cursor{
+		Orden: nombre,
+		Desc:  desc,
+		Valor: textoValor(campo.valor(ultimo)),
+		Clave: textoValor(e.clave.valor(ultimo)),
+	})
+}
+
+// Normaliza el limite pedido a [1, LimiteMaximo]
+func limiteConsulta(c Consulta) int {
+	switch {
+	case c.Limite <= 0:
+		return LimitePorDefecto
+	case c.Limite > LimiteMaximo:
+		return LimiteMaximo
+	}
+	return c.Limite
+}
+
+// contieneTexto es la busqueda de texto de la implementacion en memoria
+func contieneTexto(texto string, campos ...string) bool {
+	if texto == "" {
+		return true
+	}
+	texto = strings.ToLower(texto)
+	for _, c := range campos {
+		if strings.Contains(strings.ToLower(c), texto) {
+			return true
+		}
+	}
+	return false
+}
+
+// paginarMemoria ordena, aplica el cursor o desplazamiento y corta la pagina de una
+// lista ya filtrada, con la misma semantica que la consulta en Postgres
+func paginarMemoria[T any](e especListado[T], elementos []T, c Consulta) (Pagina[T], error) {
+	nombre, campo, err := e.orden(c)
+	if err != nil {
+		return Pagina[T]{}, err
+	}
+
+	comparar := func(a, b T) int {
+		r := compararValores(campo.valor(a), campo.valor(b))
+		if r == 0 {
+			r = compararValores(e.clave.valor(a), e.clave.valor(b))
+		}
+		if c.Descendente {
+			r = -r
+		}
+		return r
+	}
+	slices.SortFunc(elementos, comparar)
+
+	pagina := Pagina[T]{Total: len(elementos), Elementos: []T{}}
+	inicio := 0
+	if c.Cursor != "" {
+		cur, err := decodificarCursor(c.Cursor, nombre, c.Descendente)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		valor, err := valorDesdeTexto(cur.Valor, campo.tipo)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		clave, err := valorDesdeTexto(cur.Clave, e.clave.tipo)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		inicio = len(elementos)
+		for i, el := range elementos {
+			r := compararValores(campo.valor(el), valor)
+			if r == 0 {
+				r = compararValores(e.clave.valor(el), clave)
+			}
+			if c.Descendente {
+				r = -r
+			}
+			if r > 0 {
+				inicio = i
+				break
+			}
+		}
+	} else if c.Desplazamiento > 0 {
+		inicio = min(c.Desplazamiento, len(elementos))
+	}
+
+	fin := min(inicio+limiteConsulta(c), len(elementos))
+	pagina.Elementos = append(pagina.Elementos, elementos[inicio:fin]...)
+	if fin < len(elementos) && fin > inicio {
+		pagina.SiguienteCursor = e.cursorDespuesDe(nombre, campo, c.Descendente, elementos[fin-1])
+	}
+	return pagina, nil
+}
@@ -0,0 +1,777 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+)
+
+// datosMemoria guarda todos los agregados bajo un mismo mutex para poder comprobar
+// las mismas restricciones (unicidad y claves foraneas) que impone el esquema en Postgres
+type datosMemoria struct {
+	mu sync.Mutex
+
+	empresas    map[string]models.Empresa
+	empleados   map[string]models.Empleados
+	usuarios    map[string]models.Usuario
+	historial   map[string][]string
+	ferrys      map[string]models.Ferry
+	facturas    map[int]models.Factura
+	totp        map[string]models.TOTP
+	claves      map[int]claveMemoria
+	eventos     []models.EventoSeguridad
+	solicitudes map[[2]string]models.SolicitudIdempotente
+	auditoria   []models.RegistroAuditoria
+
+	siguienteFactura int
+	siguienteClave   int
+}
+
+type claveMemoria struct {
+	clave models.ClaveAPI
+	hash  string
+}
+
+// NuevoMemoria crea stores en memoria, pensados para pruebas de handlers sin base de datos
+func NuevoMemoria() Store {
+	d := &datosMemoria{
+		empresas:  make(map[string]models.Empresa),
+		empleados: make(map[string]models.Empleados),
+		usuarios:  make(map[string]models.Usuario),
+		historial: make(map[string][]string),
+		ferrys:    make(map[string]models.Ferry),
+		facturas:  make(map[int]models.Factura),
+		totp:      make(map[string]models.TOTP),
+		claves:    make(map[int]claveMemoria),
+
+		solicitudes: make(map[[2]string]models.SolicitudIdempotente),
+	}
+	//Sin transaccion: cada operacion se aplica al momento y no se deshace si fn falla; las
+	//pruebas de handlers no dependen del rollback
+	return Store{
+		Empresas:  &memEmpresas{d},
+		Empleados: &memEmpleados{d},
+		Usuarios:  &memUsuarios{d},
+		Ferrys:    &memFerrys{d},
+		Facturas:  &memFacturas{d},
+		TOTP:      &memTOTP{d},
+		ClavesAPI: &memClavesAPI{d},
+		Eventos:   &memEventos{d},
+
+		Idempotencia: &memIdempotencia{d},
+		Auditoria:    &memAuditoria{d},
+	}
+}
+
+// Ordena las claves de un mapa para devolver listados deterministas
+func clavesOrdenadas[K string | int, V any](m map[K]V) []K {
+	claves := make([]K, 0, len(m))
+	for k := range m {
+		claves = append(claves, k)
+	}
+	sort.Slice(claves, func(i, j int) bool { return claves[i] < claves[j] })
+	return claves
+}
+
+// Comprueba las restricciones de usuarios antes de insertar (llamar con el mutex tomado)
+func (d *datosMemoria) validarUsuarioNuevo(usuario models.Usuario) error {
+	if _, ok := d.usuarios[usuario.Rif_Cedula]; ok {
+		return ErrDuplicado
+	}
+	for _, u := range d.usuarios {
+		if u.Usuario == usuario.Usuario {
+			return ErrDuplicado
+		}
+	}
+	return nil
+}
+
+func (d *datosMemoria) insertarUsuario(usuario models.Usuario, historial int) {
+	usuario.Version = 1
+	d.usuarios[usuario.Rif_Cedula] = usuario
+	d.guardarHistorial(usuario.Rif_Cedula, usuario.Contrasena, historial)
+}
+
+func (d *datosMemoria) guardarHistorial(rifCedula, hash string, historial int) {
+	if historial <= 0 {
+		return
+	}
+	hashes := append([]string{hash}, d.historial[rifCedula]...)
+	if len(hashes) > historial {
+		hashes = hashes[:historial]
+	}
+	d.historial[rifCedula] = hashes
+}
+
+// Misma regla que en Postgres: la version 0 no se comprueba
+func comprobarVersion(actual, esperada int) error {
+	if esperada != 0 && actual != esperada {
+		return ErrVersion
+	}
+	return nil
+}
+
+type memEmpresas struct{ d *datosMemoria }
+
+func (s *memEmpresas) Crear(ctx context.Context, empresa models.Empresa, usuario models.Usuario, historial int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.empresas[empresa.RIF]; ok {
+		return ErrDuplicado
+	}
+	if err := s.d.validarUsuarioNuevo(usuario); err != nil {
+		return err
+	}
+	empresa.Version = 1
+	s.d.empresas[empresa.RIF] = empresa
+	s.d.insertarUsuario(usuario, historial)
+	return nil
+}
+
+func (s *memEmpresas) Obtener(ctx context.Context, rif string) (models.Empresa, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empresas[rif]
+	if !ok {
+		return models.Empresa{}, ErrNoEncontrado
+	}
+	return e, nil
+}
+
+func (s *memEmpresas) Actualizar(ctx context.Context, empresa models.Empresa, version int) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empresas[empresa.RIF]
+	if !ok {
+		return 0, ErrNoEncontrado
+	}
+	if err := comprobarVersion(e.Version, version); err != nil {
+		return 0, err
+	}
+	e.Nombre, e.Email, e.Direccion = empresa.Nombre, empresa.Email, empresa.Direccion
+	e.Version++
+	s.d.empresas[empresa.RIF] = e
+	return e.Version, nil
+}
+
+func (s *memEmpresas) CambiarEstado(ctx context.Context, rif string, estado bool) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empresas[rif]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	e.Estado = estado
+	e.Version++
+	s.d.empresas[rif] = e
+	return nil
+}
+
+func (s *memEmpresas) Listar(ctx context.Context, filtro FiltroEmpresas, consulta Consulta) (Pagina[models.Empresa], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var empresas []models.Empresa
+	for _, e := range s.d.empresas {
+		if (filtro.Estado == nil || e.Estado == *filtro.Estado) && contieneTexto(filtro.Texto, e.Nombre, e.RIF) {
+			empresas = append(empresas, e)
+		}
+	}
+	return paginarMemoria(especEmpresas, empresas, consulta)
+}
+
+type memEmpleados struct{ d *datosMemoria }
+
+func (s *memEmpleados) Crear(ctx context.Context, empleado models.Empleados, usuario models.Usuario, historial int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.empleados[empleado.Cedula]; ok {
+		return ErrDuplicado
+	}
+	if _, ok := s.d.empresas[empleado.Rif_empresa]; !ok {
+		return ErrReferencia
+	}
+	if err := s.d.validarUsuarioNuevo(usuario); err != nil {
+		return err
+	}
+	empleado.Version = 1
+	s.d.empleados[empleado.Cedula] = empleado
+	s.d.insertarUsuario(usuario, historial)
+	return nil
+}
+
+func (s *memEmpleados) Obtener(ctx context.Context, cedula string) (models.Empleados, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empleados[cedula]
+	if !ok {
+		return models.Empleados{}, ErrNoEncontrado
+	}
+	return e, nil
+}
+
+func (s *memEmpleados) Actualizar(ctx context.Context, empleado models.Empleados, version int) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empleados[empleado.Cedula]
+	if !ok {
+		return 0, ErrNoEncontrado
+	}
+	if err := comprobarVersion(e.Version, version); err != nil {
+		return 0, err
+	}
+	e.Nombres, e.Apellidos, e.Email, e.Cargo, e.Numero_tlf = empleado.Nombres, empleado.Apellidos, empleado.Email, empleado.Cargo, empleado.Numero_tlf
+	e.Version++
+	s.d.empleados[empleado.Cedula] = e
+	return e.Version, nil
+}
+
+func (s *memEmpleados) CambiarEstado(ctx context.Context, cedula string, estado bool) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e, ok := s.d.empleados[cedula]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	e.Estado = estado
+	e.Version++
+	s.d.empleados[cedula] = e
+	return nil
+}
+
+func (s *memEmpleados) Listar(ctx context.Context, filtro FiltroEmpleados, consulta Consulta) (Pagina[models.Empleados], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var empleados []models.Empleados
+	for _, e := range s.d.empleados {
+		if (filtro.RifEmpresa == "" || e.Rif_empresa == filtro.RifEmpresa) &&
+			(filtro.Estado == nil || e.Estado == *filtro.Estado) &&
+			contieneTexto(filtro.Texto, e.Nombres, e.Apellidos) {
+			empleados = append(empleados, e)
+		}
+	}
+	return paginarMemoria(especEmpleados, empleados, consulta)
+}
+
+type memUsuarios struct{ d *datosMemoria }
+
+func (s *memUsuarios) Crear(ctx context.Context, usuario models.Usuario, historial int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if err := s.d.validarUsuarioNuevo(usuario); err != nil {
+		return err
+	}
+	s.d.insertarUsuario(usuario, historial)
+	return nil
+}
+
+func (s *memUsuarios) Obtener(ctx context.Context, rifCedula string) (models.Usuario, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.usuarios[rifCedula]
+	if !ok {
+		return models.Usuario{}, ErrNoEncontrado
+	}
+	return u, nil
+}
+
+func (s *memUsuarios) ObtenerPorUsuario(ctx context.Context, usuario string) (models.Usuario, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.usuarios {
+		if u.Usuario == usuario {
+			return u, nil
+		}
+	}
+	return models.Usuario{}, ErrNoEncontrado
+}
+
+func (s *memUsuarios) Actualizar(ctx context.Context, rifCedula, nuevoUsuario, nuevoHash string, historial, version int) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.usuarios[rifCedula]
+	if !ok {
+		return 0, ErrNoEncontrado
+	}
+	if err := comprobarVersion(u.Version, version); err != nil {
+		return 0, err
+	}
+	if nuevoUsuario != "" && nuevoUsuario != u.Usuario {
+		for _, otro := range s.d.usuarios {
+			if otro.Usuario == nuevoUsuario {
+				return 0, ErrDuplicado
+			}
+		}
+		u.Usuario = nuevoUsuario
+	}
+	if nuevoHash != "" {
+		u.Contrasena = nuevoHash
+		s.d.guardarHistorial(rifCedula, nuevoHash, historial)
+	}
+	u.Version++
+	s.d.usuarios[rifCedula] = u
+	return u.Version, nil
+}
+
+func (s *memUsuarios) CambiarEstado(ctx context.Context, rifCedula string, estado bool) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.usuarios[rifCedula]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	u.Estado = estado
+	u.Version++
+	s.d.usuarios[rifCedula] = u
+	return nil
+}
+
+func (s *memUsuarios) CambiarContrasena(ctx context.Context, rifCedula, hash string, historial int) error {
+	_, err := s.Actualizar(ctx, rifCedula, "", hash, historial, 0)
+	return err
+}
+
+func (s *memUsuarios) HistorialContrasenas(ctx context.Context, rifCedula string, n int) ([]string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	hashes := s.d.historial[rifCedula]
+	if len(hashes) > n {
+		hashes = hashes[:n]
+	}
+	return slices.Clone(hashes), nil
+}
+
+func (s *memUsuarios) Listar(ctx context.Context, filtro FiltroUsuarios, consulta Consulta) (Pagina[models.Usuario], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var usuarios []models.Usuario
+	for _, u := range s.d.usuarios {
+		if (filtro.Tipo == "" || u.Tipo == filtro.Tipo) &&
+			(filtro.Estado == nil || u.Estado == *filtro.Estado) &&
+			contieneTexto(filtro.Texto, u.Usuario, u.Rif_Cedula) {
+			u.Contrasena = ""
+			usuarios = append(usuarios, u)
+		}
+	}
+	return paginarMemoria(especUsuarios, usuarios, consulta)
+}
+
+type memFerrys struct{ d *datosMemoria }
+
+func (s *memFerrys) Crear(ctx context.Context, ferry models.Ferry) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.ferrys[ferry.Matricula]; ok {
+		return ErrDuplicado
+	}
+	if _, ok := s.d.empresas[ferry.RifEmpresa]; !ok {
+		return ErrReferencia
+	}
+	ferry.Version = 1
+	s.d.ferrys[ferry.Matricula] = ferry
+	return nil
+}
+
+func (s *memFerrys) Obtener(ctx context.Context, matricula string) (models.Ferry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	f, ok := s.d.ferrys[matricula]
+	if !ok {
+		return models.Ferry{}, ErrNoEncontrado
+	}
+	return f, nil
+}
+
+func (s *memFerrys) Actualizar(ctx context.Context, ferry models.Ferry, version int) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	f, ok := s.d.ferrys[ferry.Matricula]
+	if !ok {
+		return 0, ErrNoEncontrado
+	}
+	if err := comprobarVersion(f.Version, version); err != nil {
+		return 0, err
+	}
+	f.Nombre, f.Modelo, f.CapacidadEconomica, f.CapacidadVIP, f.Estado = ferry.Nombre, ferry.Modelo, ferry.CapacidadEconomica, ferry.CapacidadVIP, ferry.Estado
+	f.Version++
+	s.d.ferrys[ferry.Matricula] = f
+	return f.Version, nil
+}
+
+func (s *memFerrys) Listar(ctx context.Context, filtro FiltroFerrys, consulta Consulta) (Pagina[models.Ferry], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var ferrys []models.Ferry
+	for _, f := range s.d.ferrys {
+		if (filtro.RifEmpresa == "" || f.RifEmpresa == filtro.RifEmpresa) &&
+			(filtro.Estado == nil || f.Estado == *filtro.Estado) &&
+			contieneTexto(filtro.Texto, f.Nombre, f.Modelo) {
+			ferrys = append(ferrys, f)
+		}
+	}
+	return paginarMemoria(especFerrys, ferrys, consulta)
+}
+
+type memFacturas struct{ d *datosMemoria }
+
+func (s *memFacturas) Crear(ctx context.Context, factura models.Factura) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.empresas[factura.RIFEmpresa]; !ok {
+		return 0, ErrReferencia
+	}
+	if _, ok := s.d.ferrys[factura.MatriculaFerry]; !ok {
+		return 0, ErrReferencia
+	}
+
+	s.d.siguienteFactura++
+	factura.IDFactura = s.d.siguienteFactura
+	s.d.facturas[factura.IDFactura] = factura
+	return factura.IDFactura, nil
+}
+
+func (s *memFacturas) Obtener(ctx context.Context, id int) (models.Factura, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	f, ok := s.d.facturas[id]
+	if !ok {
+		return models.Factura{}, ErrNoEncontrado
+	}
+	return f, nil
+}
+
+func (s *memFacturas) Listar(ctx context.Context, filtro FiltroFacturas, consulta Consulta) (Pagina[models.Factura], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var facturas []models.Factura
+	for _, f := range s.d.facturas {
+		if (filtro.RifEmpresa == "" || f.RIFEmpresa == filtro.RifEmpresa) &&
+			(filtro.Estado == nil || f.Estado == *filtro.Estado) &&
+			(filtro.Desde == nil || !f.Emision.Before(*filtro.Desde)) &&
+			(filtro.Hasta == nil || f.Emision.Before(*filtro.Hasta)) &&
+			(filtro.IDViaje == "" || f.IDViaje == filtro.IDViaje) &&
+			(filtro.MatriculaFerry == "" || f.MatriculaFerry == filtro.MatriculaFerry) &&
+			(filtro.CedulaEmpleado == "" || f.CedulaEmpleado == filtro.CedulaEmpleado) &&
+			(filtro.Tipo == "" || strings.EqualFold(f.Tipo, filtro.Tipo)) &&
+			contieneTexto(filtro.Texto, f.NombresViajero, f.ApellidosViajero, f.NombreEmpleado) {
+			facturas = append(facturas, f)
+		}
+	}
+	return paginarMemoria(especFacturas, facturas, consulta)
+}
+
+func (s *memFacturas) CambiarEstado(ctx context.Context, id int, estado bool) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	f, ok := s.d.facturas[id]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	f.Estado = estado
+	s.d.facturas[id] = f
+	return nil
+}
+
+type memTOTP struct{ d *datosMemoria }
+
+func (s *memTOTP) Obtener(ctx context.Context, rifCedula string) (models.TOTP, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.totp[rifCedula]
+	if !ok {
+		return models.TOTP{}, ErrNoEncontrado
+	}
+	t.CodigosRecuperacion = slices.Clone(t.CodigosRecuperacion)
+	return t, nil
+}
+
+func (s *memTOTP) GuardarPendiente(ctx context.Context, rifCedula, secreto string, creado time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.usuarios[rifCedula]; !ok {
+		return ErrReferencia
+	}
+	if t, ok := s.d.totp[rifCedula]; ok && t.Activo {
+		return ErrDuplicado
+	}
+	s.d.totp[rifCedula] = models.TOTP{RifCedula: rifCedula, Secreto: secreto, Creado: creado}
+	return nil
+}
+
+func (s *memTOTP) Activar(ctx context.Context, rifCedula string, paso int64, codigosRecuperacion []string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.totp[rifCedula]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	t.Activo = true
+	t.UltimoPaso = paso
+	t.CodigosRecuperacion = slices.Clone(codigosRecuperacion)
+	s.d.totp[rifCedula] = t
+	return nil
+}
+
+func (s *memTOTP) AvanzarPaso(ctx context.Context, rifCedula string, paso int64) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.totp[rifCedula]
+	if !ok || t.UltimoPaso >= paso {
+		return false, nil
+	}
+	t.UltimoPaso = paso
+	s.d.totp[rifCedula] = t
+	return true, nil
+}
+
+func (s *memTOTP) ConsumirCodigoRecuperacion(ctx context.Context, rifCedula, hash string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.totp[rifCedula]
+	if !ok {
+		return false, nil
+	}
+	i := slices.Index(t.CodigosRecuperacion, hash)
+	if i < 0 {
+		return false, nil
+	}
+	t.CodigosRecuperacion = slices.Delete(slices.Clone(t.CodigosRecuperacion), i, i+1)
+	s.d.totp[rifCedula] = t
+	return true, nil
+}
+
+func (s *memTOTP) Eliminar(ctx context.Context, rifCedula string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.totp[rifCedula]; !ok {
+		return ErrNoEncontrado
+	}
+	delete(s.d.totp, rifCedula)
+	return nil
+}
+
+type memClavesAPI struct{ d *datosMemoria }
+
+func (s *memClavesAPI) Crear(ctx context.Context, clave models.ClaveAPI, hash, creadaPor string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.empresas[clave.RifEmpresa]; !ok {
+		return 0, ErrReferencia
+	}
+	for _, c := range s.d.claves {
+		if c.clave.Prefijo == clave.Prefijo {
+			return 0, ErrDuplicado
+		}
+	}
+
+	s.d.siguienteClave++
+	clave.ID = s.d.siguienteClave
+	clave.Alcances = slices.Clone(clave.Alcances)
+	s.d.claves[clave.ID] = claveMemoria{clave: clave, hash: hash}
+	return clave.ID, nil
+}
+
+func (s *memClavesAPI) ObtenerPorPrefijo(ctx context.Context, prefijo string) (models.ClaveAPI, string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, c := range s.d.claves {
+		if c.clave.Prefijo == prefijo {
+			return c.clave, c.hash, nil
+		}
+	}
+	return models.ClaveAPI{}, "", ErrNoEncontrado
+}
+
+func (s *memClavesAPI) Listar(ctx context.Context, rifEmpresa string) ([]models.ClaveAPI, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	claves := []models.ClaveAPI{}
+	ids := clavesOrdenadas(s.d.claves)
+	//Mas recientes primero, igual que en Postgres
+	for i := len(ids) - 1; i >= 0; i-- {
+		if c := s.d.claves[ids[i]]; c.clave.RifEmpresa == rifEmpresa {
+			claves = append(claves, c.clave)
+		}
+	}
+	return claves, nil
+}
+
+func (s *memClavesAPI) Revocar(ctx context.Context, id int, rifEmpresa string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	c, ok := s.d.claves[id]
+	if !ok || c.clave.RifEmpresa != rifEmpresa {
+		return ErrNoEncontrado
+	}
+	c.clave.Revocada = true
+	s.d.claves[id] = c
+	return nil
+}
+
+func (s *memClavesAPI) RegistrarUso(ctx context.Context, id int, fecha time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	c, ok := s.d.claves[id]
+	if !ok {
+		return nil
+	}
+	c.clave.UltimoUso = &fecha
+	s.d.claves[id] = c
+	return nil
+}
+
+type memEventos struct{ d *datosMemoria }
+
+func (s *memEventos) Registrar(ctx context.Context, evento models.EventoSeguridad) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.eventos = append(s.d.eventos, evento)
+	return nil
+}
+
+type memIdempotencia struct{ d *datosMemoria }
+
+func (s *memIdempotencia) Reservar(ctx context.Context, registro models.SolicitudIdempotente, abandonadaAntes time.Time) (models.SolicitudIdempotente, bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	id := [2]string{registro.Alcance, registro.Clave}
+	if existente, ok := s.d.solicitudes[id]; ok && existente.Expira.After(registro.Creada) {
+		abandonada := existente.Estado == 0 && !existente.Reservada.After(abandonadaAntes) && existente.HashSolicitud == registro.HashSolicitud
+		if !abandonada {
+			existente.Cuerpo = slices.Clone(existente.Cuerpo)
+			return existente, false, nil
+		}
+	}
+	registro.Estado, registro.TipoContenido, registro.Cuerpo = 0, "", nil
+	s.d.solicitudes[id] = registro
+	return registro, true, nil
+}
+
+func (s *memIdempotencia) Completar(ctx context.Context, alcance, clave string, reservada time.Time, estado int, tipoContenido string, cuerpo []byte) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	id := [2]string{alcance, clave}
+	registro, ok := s.d.solicitudes[id]
+	if !ok || registro.Estado != 0 || !registro.Reservada.Equal(reservada) {
+		return ErrNoEncontrado
+	}
+	registro.Estado, registro.TipoContenido, registro.Cuerpo = estado, tipoContenido, slices.Clone(cuerpo)
+	registro.Reservada = time.Time{}
+	s.d.solicitudes[id] = registro
+	return nil
+}
+
+func (s *memIdempotencia) Liberar(ctx context.Context, alcance, clave string, reservada time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	id := [2]string{alcance, clave}
+	if registro, ok := s.d.solicitudes[id]; ok && registro.Estado == 0 && registro.Reservada.Equal(reservada) {
+		delete(s.d.solicitudes, id)
+	}
+	return nil
+}
+
+func (s *memIdempotencia) Purgar(ctx context.Context, antes time.Time) (int64, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var eliminados int64
+	for id, registro := range s.d.solicitudes {
+		if !registro.Expira.After(antes) {
+			delete(s.d.solicitudes, id)
+			eliminados++
+		}
+	}
+	return eliminados, nil
+}
+
+type memAuditoria struct{ d *datosMemoria }
+
+func (s *memAuditoria) Registrar(ctx context.Context, registro models.RegistroAuditoria) (models.RegistroAuditoria, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	anterior := ""
+	if n := len(s.d.auditoria); n > 0 {
+		anterior = s.d.auditoria[n-1].Hash
+	}
+	registro = encadenar(registro, anterior)
+	registro.ID = len(s.d.auditoria) + 1
+	s.d.auditoria = append(s.d.auditoria, registro)
+	return registro, nil
+}
+
+func (s *memAuditoria) Listar(ctx context.Context, filtro FiltroAuditoria, consulta Consulta) (Pagina[models.RegistroAuditoria], error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var registros []models.RegistroAuditoria
+	for _, a := range s.d.auditoria {
+		if (filtro.Actor == "" || a.Actor == filtro.Actor) &&
+			(filtro.Accion == "" || a.Accion == filtro.Accion) &&
+			(filtro.Entidad == "" || a.Entidad == filtro.Entidad) &&
+			(filtro.EntidadID == "" || a.EntidadID == filtro.EntidadID) &&
+			(filtro.Desde == nil || !a.Fecha.Before(*filtro.Desde)) &&
+			(filtro.Hasta == nil || a.Fecha.Before(*filtro.Hasta)) {
+			registros = append(registros, a)
+		}
+	}
+	return paginarMemoria(especAuditoria, registros, consulta)
+}
+
+func (s *memAuditoria) Verificar(ctx context.Context) (VerificacionAuditoria, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	v := nuevoVerificador()
+	for _, a := range s.d.auditoria {
+		if !v.agregar(a) {
+			break
+		}
+	}
+	return v.resultado, nil
+}
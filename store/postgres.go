@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier abstrae el pool y las transacciones para reutilizar consultas
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// conexion es el pool o una transaccion en curso. Dentro de una transaccion, Begin
+// abre un punto de guardado, asi enTransaccion se puede anidar
+type conexion interface {
+	querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NuevoPostgres crea los stores respaldados por PostgreSQL
+func NuevoPostgres(pool *pgxpool.Pool) Store {
+	return nuevoPostgres(pool)
+}
+
+func nuevoPostgres(db conexion) Store {
+	return Store{
+		Empresas:  &pgEmpresas{db: db},
+		Empleados: &pgEmpleados{db: db},
+		Usuarios:  &pgUsuarios{db: db},
+		Ferrys:    &pgFerrys{db: db},
+		Facturas:  &pgFacturas{db: db},
+		TOTP:      &pgTOTP{db: db},
+		ClavesAPI: &pgClavesAPI{db: db},
+		Eventos:   &pgEventos{db: db},
+
+		Idempotencia: &pgIdempotencia{db: db},
+		Auditoria:    &pgAuditoria{db: db},
+
+		transaccion: func(ctx context.Context, fn func(Store) error) error {
+			return enTransaccion(ctx, db, func(tx pgx.Tx) error { return fn(nuevoPostgres(tx)) })
+		},
+	}
+}
+
+// traducirError convierte los errores de pgx y los codigos de Postgres en los errores del paquete
+func traducirError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoEncontrado
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return fmt.Errorf("%w: %s", ErrDuplicado, pgErr.ConstraintName)
+		case "23503":
+			return fmt.Errorf("%w: %s", ErrReferencia, pgErr.ConstraintName)
+		case "23514":
+			return fmt.Errorf("%w: %s", ErrRestriccion, pgErr.ConstraintName)
+		}
+	}
+	return err
+}
+
+// Ejecuta fn dentro de una transaccion, confirmando solo si no hay error
+func enTransaccion(ctx context.Context, db conexion, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error iniciando transaccion: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error confirmando transaccion: %w", err)
+	}
+	return nil
+}
+
+// Ejecuta un UPDATE ... RETURNING version que ya incrementa y comprueba la version.
+// Si no afecta filas distingue entre registro inexistente y version desactualizada
+func actualizarConVersion(ctx context.Context, q querier, tabla, columnaClave string, clave any, sql string, args ...any) (int, error) {
+	var nueva int
+	err := q.QueryRow(ctx, sql, args...).Scan(&nueva)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nueva, traducirError(err)
+	}
+
+	var existe bool
+	if err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+tabla+` WHERE `+columnaClave+` = $1)`, clave).Scan(&existe); err != nil {
+		return 0, traducirError(err)
+	}
+	if existe {
+		return 0, ErrVersion
+	}
+	return 0, ErrNoEncontrado
+}
+
+// Exige que la sentencia haya afectado al menos una fila
+func filaAfectada(tag pgconn.CommandTag, err error) error {
+	if err != nil {
+		return traducirError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoEncontrado
+	}
+	return nil
+}
+
+// Agrega el hash al historial de contraseñas y conserva solo los ultimos indicados
+func guardarHistorial(ctx context.Context, q querier, rifCedula, hash string, historial int) error {
+	if historial <= 0 {
+		return nil
+	}
+
+	_, err := q.Exec(ctx,
+		`INSERT INTO historial_contrasenas (rif_cedula, hash, fecha) VALUES ($1, $2, $3)`,
+		rifCedula, hash, time.Now().UTC())
+	if err != nil {
+		return traducirError(err)
+	}
+
+	_, err = q.Exec(ctx,
+		`DELETE FROM historial_contrasenas
+		 WHERE rif_cedula = $1 AND id NOT IN (
+			SELECT id FROM historial_contrasenas WHERE rif_cedula = $1 ORDER BY fecha DESC LIMIT $2
+		 )`,
+		rifCedula, historial)
+	return traducirError(err)
+}
+
+// Inserta el usuario asociado a una empresa, empleado o administrador
+func insertarUsuario(ctx context.Context, q querier, usuario models.Usuario, historial int) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO usuarios (rif_cedula, usuario, contrasena, tipo, estado) VALUES ($1, $2, $3, $4, $5)`,
+		usuario.Rif_Cedula, usuario.Usuario, usuario.Contrasena, usuario.Tipo, usuario.Estado)
+	if err != nil {
+		return traducirError(err)
+	}
+	return guardarHistorial(ctx, q, usuario.Rif_Cedula, usuario.Contrasena, historial)
+}
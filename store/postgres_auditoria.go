@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgAuditoria struct {
+	db conexion
+}
+
+const columnasAuditoria = `id, actor, tipo_actor, accion, entidad, entidad_id, cambios, ip, id_solicitud, fecha, hash_anterior, hash`
+
+func escanearAuditoria(row pgx.Row) (models.RegistroAuditoria, error) {
+	var a models.RegistroAuditoria
+	err := row.Scan(&a.ID, &a.Actor, &a.TipoActor, &a.Accion, &a.Entidad, &a.EntidadID, &a.Cambios,
+		&a.IP, &a.IDSolicitud, &a.Fecha, &a.HashAnterior, &a.Hash)
+	return a, err
+}
+
+// El bloqueo de la tabla serializa los registros para que dos no tomen el mismo hash anterior
+func (s *pgAuditoria) Registrar(ctx context.Context, registro models.RegistroAuditoria) (models.RegistroAuditoria, error) {
+	err := enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `LOCK TABLE auditoria IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return traducirError(err)
+		}
+
+		var anterior string
+		err := tx.QueryRow(ctx, `SELECT hash FROM auditoria ORDER BY id DESC LIMIT 1`).Scan(&anterior)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return traducirError(err)
+		}
+
+		registro = encadenar(registro, anterior)
+		return traducirError(tx.QueryRow(ctx,
+			`INSERT INTO auditoria (actor, tipo_actor, accion, entidad, entidad_id, cambios, ip, id_solicitud, fecha, hash_anterior, hash)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+			registro.Actor, registro.TipoActor, registro.Accion, registro.Entidad, registro.EntidadID, registro.Cambios,
+			registro.IP, registro.IDSolicitud, registro.Fecha, registro.HashAnterior, registro.Hash).Scan(&registro.ID))
+	})
+	return registro, err
+}
+
+func (s *pgAuditoria) Listar(ctx context.Context, filtro FiltroAuditoria, consulta Consulta) (Pagina[models.RegistroAuditoria], error) {
+	var f filtroSQL
+	if filtro.Actor != "" {
+		f.agregar("actor = ?", filtro.Actor)
+	}
+	if filtro.Accion != "" {
+		f.agregar("accion = ?", filtro.Accion)
+	}
+	if filtro.Entidad != "" {
+		f.agregar("entidad = ?", filtro.Entidad)
+	}
+	if filtro.EntidadID != "" {
+		f.agregar("entidad_id = ?", filtro.EntidadID)
+	}
+	if filtro.Desde != nil {
+		f.agregar("fecha >= ?", *filtro.Desde)
+	}
+	if filtro.Hasta != nil {
+		f.agregar("fecha < ?", *filtro.Hasta)
+	}
+	return listarPostgres(ctx, s.db, especAuditoria, "auditoria", columnasAuditoria, f, consulta, escanearAuditoria)
+}
+
+func (s *pgAuditoria) Verificar(ctx context.Context) (VerificacionAuditoria, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+columnasAuditoria+` FROM auditoria ORDER BY id`)
+	if err != nil {
+		return VerificacionAuditoria{}, traducirError(err)
+	}
+	defer rows.Close()
+
+	v := nuevoVerificador()
+	for rows.Next() {
+		registro, err := escanearAuditoria(rows)
+		if err != nil {
+			return VerificacionAuditoria{}, traducirError(err)
+		}
+		if !v.agregar(registro) {
+			break
+		}
+	}
+	return v.resultado, traducirError(rows.Err())
+}
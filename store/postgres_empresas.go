@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgEmpresas struct {
+	db conexion
+}
+
+func (s *pgEmpresas) Crear(ctx context.Context, empresa models.Empresa, usuario models.Usuario, historial int) error {
+	return enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO empresa (rif, nombre, email, direccion, estado) VALUES ($1, $2, $3, $4, $5)`,
+			empresa.RIF, empresa.Nombre, empresa.Email, empresa.Direccion, empresa.Estado)
+		if err != nil {
+			return traducirError(err)
+		}
+		return insertarUsuario(ctx, tx, usuario, historial)
+	})
+}
+
+func (s *pgEmpresas) Obtener(ctx context.Context, rif string) (models.Empresa, error) {
+	var e models.Empresa
+	err := s.db.QueryRow(ctx,
+		`SELECT rif, nombre, email, direccion, estado, version FROM empresa WHERE rif = $1`,
+		rif).Scan(&e.RIF, &e.Nombre, &e.Email, &e.Direccion, &e.Estado, &e.Version)
+	return e, traducirError(err)
+}
+
+func (s *pgEmpresas) Actualizar(ctx context.Context, empresa models.Empresa, version int) (int, error) {
+	return actualizarConVersion(ctx, s.db, "empresa", "rif", empresa.RIF,
+		`UPDATE empresa SET nombre = $1, email = $2, direccion = $3, version = version + 1
+		 WHERE rif = $4 AND ($5::int = 0 OR version = $5) RETURNING version`,
+		empresa.Nombre, empresa.Email, empresa.Direccion, empresa.RIF, version)
+}
+
+func (s *pgEmpresas) CambiarEstado(ctx context.Context, rif string, estado bool) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE empresa SET estado = $1, version = version + 1 WHERE rif = $2`, estado, rif))
+}
+
+func (s *pgEmpresas) Listar(ctx context.Context, filtro FiltroEmpresas, consulta Consulta) (Pagina[models.Empresa], error) {
+	var f filtroSQL
+	if filtro.Estado != nil {
+		f.agregar("estado = ?", *filtro.Estado)
+	}
+	f.texto(filtro.Texto, "nombre", "rif")
+	return listarPostgres(ctx, s.db, especEmpresas, "empresa", `rif, nombre, email, direccion, estado, version`, f, consulta,
+		func(row pgx.Row) (models.Empresa, error) {
+			var e models.Empresa
+			err := row.Scan(&e.RIF, &e.Nombre, &e.Email, &e.Direccion, &e.Estado, &e.Version)
+			return e, err
+		})
+}
+
+type pgEmpleados struct {
+	db conexion
+}
+
+const columnasEmpleado = `cedula, nombres, apellidos, rif_empresa, email, cargo, estado, numero_tlf, version`
+
+func escanearEmpleado(row pgx.Row) (models.Empleados, error) {
+	var e models.Empleados
+	err := row.Scan(&e.Cedula, &e.Nombres, &e.Apellidos, &e.Rif_empresa, &e.Email, &e.Cargo, &e.Estado, &e.Numero_tlf, &e.Version)
+	return e, err
+}
+
+func (s *pgEmpleados) Crear(ctx context.Context, empleado models.Empleados, usuario models.Usuario, historial int) error {
+	return enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO empleados (cedula, nombres, apellidos, rif_empresa, email, cargo, numero_tlf, estado)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			empleado.Cedula, empleado.Nombres, empleado.Apellidos, empleado.Rif_empresa,
+			empleado.Email, empleado.Cargo, empleado.Numero_tlf, empleado.Estado)
+		if err != nil {
+			return traducirError(err)
+		}
+		return insertarUsuario(ctx, tx, usuario, historial)
+	})
+}
+
+func (s *pgEmpleados) Obtener(ctx context.Context, cedula string) (models.Empleados, error) {
+	e, err := escanearEmpleado(s.db.QueryRow(ctx,
+		`SELECT `+columnasEmpleado+` FROM empleados WHERE cedula = $1`, cedula))
+	return e, traducirError(err)
+}
+
+func (s *pgEmpleados) Actualizar(ctx context.Context, empleado models.Empleados, version int) (int, error) {
+	return actualizarConVersion(ctx, s.db, "empleados", "cedula", empleado.Cedula,
+		`UPDATE empleados SET nombres = $1, apellidos = $2, email = $3, cargo = $4, numero_tlf = $5, version = version + 1
+		 WHERE cedula = $6 AND ($7::int = 0 OR version = $7) RETURNING version`,
+		empleado.Nombres, empleado.Apellidos, empleado.Email, empleado.Cargo, empleado.Numero_tlf, empleado.Cedula, version)
+}
+
+func (s *pgEmpleados) CambiarEstado(ctx context.Context, cedula string, estado bool) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE empleados SET estado = $1, version = version + 1 WHERE cedula = $2`, estado, cedula))
+}
+
+func (s *pgEmpleados) Listar(ctx context.Context, filtro FiltroEmpleados, consulta Consulta) (Pagina[models.Empleados], error) {
+	var f filtroSQL
+	if filtro.RifEmpresa != "" {
+		f.agregar("rif_empresa = ?", filtro.RifEmpresa)
+	}
+	if filtro.Estado != nil {
+		f.agregar("estado = ?", *filtro.Estado)
+	}
+	f.texto(filtro.Texto, "nombres", "apellidos")
+	return listarPostgres(ctx, s.db, especEmpleados, "empleados", columnasEmpleado, f, consulta, escanearEmpleado)
+}
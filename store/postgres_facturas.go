@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgFacturas struct {
+	db conexion
+}
+
+// Columnas y escaneo compartidos por todas las consultas de facturas
+const columnasFactura = `id_factura, nombres_viajero, apellidos_viajero, rif_empresa, cedula_empleado,
+	nombre_empleado, id_viaje, tipo, estado, nota, emision, matricula_ferry`
+
+func escanearFactura(row pgx.Row) (models.Factura, error) {
+	var f models.Factura
+	err := row.Scan(
+		&f.IDFactura,
+		&f.NombresViajero,
+		&f.ApellidosViajero,
+		&f.RIFEmpresa,
+		&f.CedulaEmpleado,
+		&f.NombreEmpleado,
+		&f.IDViaje,
+		&f.Tipo,
+		&f.Estado,
+		&f.Nota,
+		&f.Emision,
+		&f.MatriculaFerry,
+	)
+	return f, err
+}
+
+func (s *pgFacturas) Crear(ctx context.Context, factura models.Factura) (int, error) {
+	var id int
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO facturas (
+			nombres_viajero, apellidos_viajero, rif_empresa, cedula_empleado, nombre_empleado,
+			id_viaje, tipo, estado, nota, emision, matricula_ferry
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id_factura`,
+		factura.NombresViajero,
+		factura.ApellidosViajero,
+		factura.RIFEmpresa,
+		factura.CedulaEmpleado,
+		factura.NombreEmpleado,
+		factura.IDViaje,
+		factura.Tipo,
+		factura.Estado,
+		factura.Nota,
+		factura.Emision,
+		factura.MatriculaFerry,
+	).Scan(&id)
+	return id, traducirError(err)
+}
+
+func (s *pgFacturas) Obtener(ctx context.Context, id int) (models.Factura, error) {
+	f, err := escanearFactura(s.db.QueryRow(ctx,
+		`SELECT `+columnasFactura+` FROM facturas WHERE id_factura = $1`, id))
+	return f, traducirError(err)
+}
+
+func (s *pgFacturas) Listar(ctx context.Context, filtro FiltroFacturas, consulta Consulta) (Pagina[models.Factura], error) {
+	var f filtroSQL
+	if filtro.RifEmpresa != "" {
+		f.agregar("rif_empresa = ?", filtro.RifEmpresa)
+	}
+	if filtro.Estado != nil {
+		f.agregar("estado = ?", *filtro.Estado)
+	}
+	if filtro.Desde != nil {
+		f.agregar("emision >= ?", *filtro.Desde)
+	}
+	if filtro.Hasta != nil {
+		f.agregar("emision < ?", *filtro.Hasta)
+	}
+	if filtro.IDViaje != "" {
+		f.agregar("id_viaje = ?", filtro.IDViaje)
+	}
+	if filtro.MatriculaFerry != "" {
+		f.agregar("matricula_ferry = ?", filtro.MatriculaFerry)
+	}
+	if filtro.CedulaEmpleado != "" {
+		f.agregar("cedula_empleado = ?", filtro.CedulaEmpleado)
+	}
+	if filtro.Tipo != "" {
+		f.agregar("lower(tipo) = lower(?)", filtro.Tipo)
+	}
+	f.texto(filtro.Texto, "nombres_viajero", "apellidos_viajero", "nombre_empleado")
+	return listarPostgres(ctx, s.db, especFacturas, "facturas", columnasFactura, f, consulta, escanearFactura)
+}
+
+func (s *pgFacturas) CambiarEstado(ctx context.Context, id int, estado bool) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE facturas SET estado = $1 WHERE id_factura = $2`, estado, id))
+}
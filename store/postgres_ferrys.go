@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgFerrys struct {
+	db conexion
+}
+
+const columnasFerry = `matricula, rif_empresa, nombre, modelo, capacidad_economica, capacidad_vip, estado, version`
+
+func escanearFerry(row pgx.Row) (models.Ferry, error) {
+	var f models.Ferry
+	err := row.Scan(&f.Matricula, &f.RifEmpresa, &f.Nombre, &f.Modelo, &f.CapacidadEconomica, &f.CapacidadVIP, &f.Estado, &f.Version)
+	return f, err
+}
+
+func (s *pgFerrys) Crear(ctx context.Context, ferry models.Ferry) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO ferrys (matricula, rif_empresa, nombre, modelo, capacidad_economica, capacidad_vip, estado)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		ferry.Matricula, ferry.RifEmpresa, ferry.Nombre, ferry.Modelo,
+		ferry.CapacidadEconomica, ferry.CapacidadVIP, ferry.Estado)
+	return traducirError(err)
+}
+
+func (s *pgFerrys) Obtener(ctx context.Context, matricula string) (models.Ferry, error) {
+	f, err := escanearFerry(s.db.QueryRow(ctx,
+		`SELECT `+columnasFerry+` FROM ferrys WHERE matricula = $1`, matricula))
+	return f, traducirError(err)
+}
+
+// Actualiza los campos permitidos (excluyendo matrícula y rif_empresa)
+func (s *pgFerrys) Actualizar(ctx context.Context, ferry models.Ferry, version int) (int, error) {
+	return actualizarConVersion(ctx, s.db, "ferrys", "matricula", ferry.Matricula,
+		`UPDATE ferrys SET nombre = $1, modelo = $2, capacidad_economica = $3, capacidad_vip = $4, estado = $5,
+		 version = version + 1
+		 WHERE matricula = $6 AND ($7::int = 0 OR version = $7) RETURNING version`,
+		ferry.Nombre, ferry.Modelo, ferry.CapacidadEconomica, ferry.CapacidadVIP, ferry.Estado, ferry.Matricula, version)
+}
+
+func (s *pgFerrys) Listar(ctx context.Context, filtro FiltroFerrys, consulta Consulta) (Pagina[models.Ferry], error) {
+	var f filtroSQL
+	if filtro.RifEmpresa != "" {
+		f.agregar("rif_empresa = ?", filtro.RifEmpresa)
+	}
+	if filtro.Estado != nil {
+		f.agregar("estado = ?", *filtro.Estado)
+	}
+	f.texto(filtro.Texto, "nombre", "modelo")
+	return listarPostgres(ctx, s.db, especFerrys, "ferrys", columnasFerry, f, consulta, escanearFerry)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+)
+
+type pgIdempotencia struct {
+	db conexion
+}
+
+// Un registro vencido o una reserva abandonada se reemplazan como si no existieran
+func (s *pgIdempotencia) Reservar(ctx context.Context, registro models.SolicitudIdempotente, abandonadaAntes time.Time) (models.SolicitudIdempotente, bool, error) {
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO solicitudes_idempotentes (alcance, clave, hash_solicitud, estado, creada, expira, reservada)
+		 VALUES ($1, $2, $3, 0, $4, $5, $6)
+		 ON CONFLICT (alcance, clave) DO UPDATE SET
+			hash_solicitud = EXCLUDED.hash_solicitud, estado = 0, tipo_contenido = '', cuerpo = NULL,
+			creada = EXCLUDED.creada, expira = EXCLUDED.expira, reservada = EXCLUDED.reservada
+		 WHERE solicitudes_idempotentes.expira <= EXCLUDED.creada
+			OR (solicitudes_idempotentes.estado = 0 AND solicitudes_idempotentes.reservada <= $7
+				AND solicitudes_idempotentes.hash_solicitud = EXCLUDED.hash_solicitud)`,
+		registro.Alcance, registro.Clave, registro.HashSolicitud, registro.Creada, registro.Expira, registro.Reservada, abandonadaAntes)
+	if err != nil {
+		return models.SolicitudIdempotente{}, false, traducirError(err)
+	}
+	if tag.RowsAffected() == 1 {
+		registro.Estado, registro.TipoContenido, registro.Cuerpo = 0, "", nil
+		return registro, true, nil
+	}
+
+	var existente models.SolicitudIdempotente
+	err = s.db.QueryRow(ctx,
+		`SELECT alcance, clave, hash_solicitud, estado, tipo_contenido, cuerpo, creada, expira
+		 FROM solicitudes_idempotentes WHERE alcance = $1 AND clave = $2`,
+		registro.Alcance, registro.Clave).Scan(
+		&existente.Alcance, &existente.Clave, &existente.HashSolicitud, &existente.Estado,
+		&existente.TipoContenido, &existente.Cuerpo, &existente.Creada, &existente.Expira)
+	return existente, false, traducirError(err)
+}
+
+func (s *pgIdempotencia) Completar(ctx context.Context, alcance, clave string, reservada time.Time, estado int, tipoContenido string, cuerpo []byte) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE solicitudes_idempotentes SET estado = $1, tipo_contenido = $2, cuerpo = $3, reservada = NULL
+		 WHERE alcance = $4 AND clave = $5 AND estado = 0 AND reservada = $6`,
+		estado, tipoContenido, cuerpo, alcance, clave, reservada))
+}
+
+func (s *pgIdempotencia) Liberar(ctx context.Context, alcance, clave string, reservada time.Time) error {
+	_, err := s.db.Exec(ctx,
+		`DELETE FROM solicitudes_idempotentes WHERE alcance = $1 AND clave = $2 AND estado = 0 AND reservada = $3`,
+		alcance, clave, reservada)
+	return traducirError(err)
+}
+
+func (s *pgIdempotencia) Purgar(ctx context.Context, antes time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM solicitudes_idempotentes WHERE expira <= $1`, antes)
+	if err != nil {
+		return 0, traducirError(err)
+	}
+	return tag.RowsAffected(), nil
+}
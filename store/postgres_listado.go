@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// filtroSQL acumula condiciones WHERE numerando los parametros en orden
+type filtroSQL struct {
+	condiciones []string
+	args        []any
+}
+
+// agregar recibe una condicion con "?" en lugar del parametro, p. ej. "estado = ?"
+func (f *filtroSQL) agregar(condicion string, args ...any) {
+	for _, arg := range args {
+		f.args = append(f.args, arg)
+		condicion = strings.Replace(condicion, "?", fmt.Sprintf("$%d", len(f.args)), 1)
+	}
+	f.condiciones = append(f.condiciones, condicion)
+}
+
+// texto agrega una busqueda ILIKE sobre varias columnas
+func (f *filtroSQL) texto(texto string, columnas ...string) {
+	if texto == "" {
+		return
+	}
+	patron := "%" + escaparLike(texto) + "%"
+	partes := make([]string, len(columnas))
+	for i, c := range columnas {
+		partes[i] = c + " ILIKE ?"
+	}
+	args := make([]any, len(columnas))
+	for i := range args {
+		args[i] = patron
+	}
+	f.agregar("("+strings.Join(partes, " OR ")+")", args...)
+}
+
+func (f *filtroSQL) where() string {
+	if len(f.condiciones) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.condiciones, " AND ")
+}
+
+// Escapa los comodines de LIKE para buscar el texto literal
+func escaparLike(texto string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(texto)
+}
+
+// listarPostgres cuenta los registros que cumplen el filtro y trae la pagina pedida,
+// ordenada por el campo de la consulta con la clave primaria como desempate
+func listarPostgres[T any](ctx context.Context, q querier, e especListado[T], tabla, columnas string,
+	filtro filtroSQL, c Consulta, escanear func(pgx.Row) (T, error)) (Pagina[T], error) {
+	nombre, campo, err := e.orden(c)
+	if err != nil {
+		return Pagina[T]{}, err
+	}
+
+	pagina := Pagina[T]{Elementos: []T{}}
+	if err := q.QueryRow(ctx, `SELECT count(*) FROM `+tabla+filtro.where(), filtro.args...).Scan(&pagina.Total); err != nil {
+		return Pagina[T]{}, traducirError(err)
+	}
+
+	direccion, comparador := "ASC", ">"
+	if c.Descendente {
+		direccion, comparador = "DESC", "<"
+	}
+
+	desplazamiento := 0
+	if c.Cursor != "" {
+		cur, err := decodificarCursor(c.Cursor, nombre, c.Descendente)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		valor, err := valorDesdeTexto(cur.Valor, campo.tipo)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		clave, err := valorDesdeTexto(cur.Clave, e.clave.tipo)
+		if err != nil {
+			return Pagina[T]{}, err
+		}
+		filtro.agregar(fmt.Sprintf("(%s, %s) %s (?::%s, ?::%s)",
+			campo.columna, e.clave.columna, comparador, campo.tipo, e.clave.tipo), valor, clave)
+	} else if c.Desplazamiento > 0 {
+		desplazamiento = c.Desplazamiento
+	}
+
+	limite := limiteConsulta(c)
+	consulta := fmt.Sprintf(`SELECT %s FROM %s%s ORDER BY %s %s, %s %s LIMIT %d OFFSET %d`,
+		columnas, tabla, filtro.where(), campo.columna, direccion, e.clave.columna, direccion, limite+1, desplazamiento)
+	rows, err := q.Query(ctx, consulta, filtro.args...)
+	if err != nil {
+		return Pagina[T]{}, traducirError(err)
+	}
+	elementos, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (T, error) {
+		return escanear(row)
+	})
+	if err != nil {
+		return Pagina[T]{}, traducirError(err)
+	}
+
+	//Se pide un registro extra para saber si hay otra pagina
+	if len(elementos) > limite {
+		elementos = elementos[:limite]
+		pagina.SiguienteCursor = e.cursorDespuesDe(nombre, campo, c.Descendente, elementos[limite-1])
+	}
+	pagina.Elementos = append(pagina.Elementos, elementos...)
+	return pagina, nil
+}
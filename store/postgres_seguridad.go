@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgTOTP struct {
+	db conexion
+}
+
+func (s *pgTOTP) Obtener(ctx context.Context, rifCedula string) (models.TOTP, error) {
+	var t models.TOTP
+	err := s.db.QueryRow(ctx,
+		`SELECT rif_cedula, secreto, activo, ultimo_paso, codigos_recuperacion, creado
+		 FROM usuarios_totp WHERE rif_cedula = $1`,
+		rifCedula).Scan(&t.RifCedula, &t.Secreto, &t.Activo, &t.UltimoPaso, &t.CodigosRecuperacion, &t.Creado)
+	return t, traducirError(err)
+}
+
+// Solo se reemplaza el secreto si la inscripcion anterior no fue confirmada
+func (s *pgTOTP) GuardarPendiente(ctx context.Context, rifCedula, secreto string, creado time.Time) error {
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO usuarios_totp (rif_cedula, secreto, activo, ultimo_paso, codigos_recuperacion, creado)
+		 VALUES ($1, $2, false, 0, '{}', $3)
+		 ON CONFLICT (rif_cedula) DO UPDATE SET secreto = EXCLUDED.secreto, creado = EXCLUDED.creado
+		 WHERE NOT usuarios_totp.activo`,
+		rifCedula, secreto, creado)
+	if err != nil {
+		return traducirError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDuplicado
+	}
+	return nil
+}
+
+func (s *pgTOTP) Activar(ctx context.Context, rifCedula string, paso int64, codigosRecuperacion []string) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE usuarios_totp SET activo = true, ultimo_paso = $1, codigos_recuperacion = $2 WHERE rif_cedula = $3`,
+		paso, codigosRecuperacion, rifCedula))
+}
+
+func (s *pgTOTP) AvanzarPaso(ctx context.Context, rifCedula string, paso int64) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE usuarios_totp SET ultimo_paso = $1 WHERE rif_cedula = $2 AND ultimo_paso < $1`,
+		paso, rifCedula)
+	if err != nil {
+		return false, traducirError(err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *pgTOTP) ConsumirCodigoRecuperacion(ctx context.Context, rifCedula, hash string) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE usuarios_totp SET codigos_recuperacion = array_remove(codigos_recuperacion, $1)
+		 WHERE rif_cedula = $2 AND $1 = ANY(codigos_recuperacion)`,
+		hash, rifCedula)
+	if err != nil {
+		return false, traducirError(err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *pgTOTP) Eliminar(ctx context.Context, rifCedula string) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`DELETE FROM usuarios_totp WHERE rif_cedula = $1`, rifCedula))
+}
+
+type pgClavesAPI struct {
+	db conexion
+}
+
+const columnasClaveAPI = `id, prefijo, rif_empresa, nombre, alcances, expira, revocada, creada, ultimo_uso`
+
+func escanearClaveAPI(row pgx.Row, extra ...any) (models.ClaveAPI, error) {
+	var c models.ClaveAPI
+	destinos := append([]any{&c.ID, &c.Prefijo, &c.RifEmpresa, &c.Nombre, &c.Alcances, &c.Expira, &c.Revocada, &c.Creada, &c.UltimoUso}, extra...)
+	err := row.Scan(destinos...)
+	return c, err
+}
+
+func (s *pgClavesAPI) Crear(ctx context.Context, clave models.ClaveAPI, hash, creadaPor string) (int, error) {
+	var id int
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO claves_api (prefijo, hash, rif_empresa, nombre, alcances, expira, revocada, creada, creada_por)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING id`,
+		clave.Prefijo, hash, clave.RifEmpresa, clave.Nombre, clave.Alcances, clave.Expira, clave.Revocada, clave.Creada, creadaPor,
+	).Scan(&id)
+	return id, traducirError(err)
+}
+
+func (s *pgClavesAPI) ObtenerPorPrefijo(ctx context.Context, prefijo string) (models.ClaveAPI, string, error) {
+	var hash string
+	c, err := escanearClaveAPI(s.db.QueryRow(ctx,
+		`SELECT `+columnasClaveAPI+`, hash FROM claves_api WHERE prefijo = $1`, prefijo), &hash)
+	return c, hash, traducirError(err)
+}
+
+func (s *pgClavesAPI) Listar(ctx context.Context, rifEmpresa string) ([]models.ClaveAPI, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columnasClaveAPI+` FROM claves_api WHERE rif_empresa = $1 ORDER BY creada DESC`, rifEmpresa)
+	if err != nil {
+		return nil, traducirError(err)
+	}
+	claves, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ClaveAPI, error) {
+		return escanearClaveAPI(row)
+	})
+	return claves, traducirError(err)
+}
+
+func (s *pgClavesAPI) Revocar(ctx context.Context, id int, rifEmpresa string) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE claves_api SET revocada = true WHERE id = $1 AND rif_empresa = $2`, id, rifEmpresa))
+}
+
+func (s *pgClavesAPI) RegistrarUso(ctx context.Context, id int, fecha time.Time) error {
+	_, err := s.db.Exec(ctx, `UPDATE claves_api SET ultimo_uso = $1 WHERE id = $2`, fecha, id)
+	return traducirError(err)
+}
+
+type pgEventos struct {
+	db conexion
+}
+
+func (s *pgEventos) Registrar(ctx context.Context, evento models.EventoSeguridad) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO eventos_seguridad (tipo, usuario, ip, detalle, fecha) VALUES ($1, $2, $3, $4, $5)`,
+		evento.Tipo, evento.Usuario, evento.IP, evento.Detalle, evento.Fecha)
+	return traducirError(err)
+}
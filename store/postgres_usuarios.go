@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgUsuarios struct {
+	db conexion
+}
+
+func (s *pgUsuarios) Crear(ctx context.Context, usuario models.Usuario, historial int) error {
+	return enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		return insertarUsuario(ctx, tx, usuario, historial)
+	})
+}
+
+func (s *pgUsuarios) Obtener(ctx context.Context, rifCedula string) (models.Usuario, error) {
+	var u models.Usuario
+	err := s.db.QueryRow(ctx,
+		`SELECT rif_cedula, usuario, contrasena, tipo, estado, version FROM usuarios WHERE rif_cedula = $1`,
+		rifCedula).Scan(&u.Rif_Cedula, &u.Usuario, &u.Contrasena, &u.Tipo, &u.Estado, &u.Version)
+	return u, traducirError(err)
+}
+
+func (s *pgUsuarios) ObtenerPorUsuario(ctx context.Context, usuario string) (models.Usuario, error) {
+	var u models.Usuario
+	err := s.db.QueryRow(ctx,
+		`SELECT rif_cedula, usuario, contrasena, tipo, estado, version FROM usuarios WHERE usuario = $1`,
+		usuario).Scan(&u.Rif_Cedula, &u.Usuario, &u.Contrasena, &u.Tipo, &u.Estado, &u.Version)
+	return u, traducirError(err)
+}
+
+func (s *pgUsuarios) Actualizar(ctx context.Context, rifCedula, nuevoUsuario, nuevoHash string, historial, version int) (int, error) {
+	// Construcción dinámica de la consulta
+	updates := []string{"version = version + 1"}
+	params := []interface{}{}
+
+	if nuevoUsuario != "" {
+		params = append(params, nuevoUsuario)
+		updates = append(updates, fmt.Sprintf("usuario = $%d", len(params)))
+	}
+	if nuevoHash != "" {
+		params = append(params, nuevoHash)
+		updates = append(updates, fmt.Sprintf("contrasena = $%d", len(params)))
+	}
+
+	params = append(params, rifCedula, version)
+	query := "UPDATE usuarios SET " + strings.Join(updates, ", ") +
+		fmt.Sprintf(" WHERE rif_cedula = $%d AND ($%d::int = 0 OR version = $%d) RETURNING version", len(params)-1, len(params), len(params))
+
+	var nueva int
+	err := enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		if nueva, err = actualizarConVersion(ctx, tx, "usuarios", "rif_cedula", rifCedula, query, params...); err != nil {
+			return err
+		}
+		if nuevoHash != "" {
+			return guardarHistorial(ctx, tx, rifCedula, nuevoHash, historial)
+		}
+		return nil
+	})
+	return nueva, err
+}
+
+func (s *pgUsuarios) CambiarEstado(ctx context.Context, rifCedula string, estado bool) error {
+	return filaAfectada(s.db.Exec(ctx,
+		`UPDATE usuarios SET estado = $1, version = version + 1 WHERE rif_cedula = $2`, estado, rifCedula))
+}
+
+func (s *pgUsuarios) CambiarContrasena(ctx context.Context, rifCedula, hash string, historial int) error {
+	return enTransaccion(ctx, s.db, func(tx pgx.Tx) error {
+		if err := filaAfectada(tx.Exec(ctx,
+			`UPDATE usuarios SET contrasena = $1, version = version + 1 WHERE rif_cedula = $2`, hash, rifCedula)); err != nil {
+			return err
+		}
+		return guardarHistorial(ctx, tx, rifCedula, hash, historial)
+	})
+}
+
+func (s *pgUsuarios) HistorialContrasenas(ctx context.Context, rifCedula string, n int) ([]string, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT hash FROM historial_contrasenas WHERE rif_cedula = $1 ORDER BY fecha DESC LIMIT $2`,
+		rifCedula, n)
+	if err != nil {
+		return nil, traducirError(err)
+	}
+	hashes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	return hashes, traducirError(err)
+}
+
+// El listado no lee la columna de contraseña
+func (s *pgUsuarios) Listar(ctx context.Context, filtro FiltroUsuarios, consulta Consulta) (Pagina[models.Usuario], error) {
+	var f filtroSQL
+	if filtro.Tipo != "" {
+		f.agregar("tipo = ?", filtro.Tipo)
+	}
+	if filtro.Estado != nil {
+		f.agregar("estado = ?", *filtro.Estado)
+	}
+	f.texto(filtro.Texto, "usuario", "rif_cedula")
+	return listarPostgres(ctx, s.db, especUsuarios, "usuarios", `rif_cedula, usuario, tipo, estado, version`, f, consulta,
+		func(row pgx.Row) (models.Usuario, error) {
+			var u models.Usuario
+			err := row.Scan(&u.Rif_Cedula, &u.Usuario, &u.Tipo, &u.Estado, &u.Version)
+			return u, err
+		})
+}
@@ -0,0 +1,150 @@
+// Package store define el acceso a datos por agregado. Los handlers dependen de estas
+// interfaces: en produccion se usa la implementacion Postgres y en pruebas la de memoria
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/models"
+)
+
+// Errores comunes a todas las implementaciones
+var (
+	ErrNoEncontrado = errors.New("registro no encontrado")
+	ErrDuplicado    = errors.New("registro duplicado")
+	ErrReferencia   = errors.New("referencia a un registro inexistente")
+	ErrRestriccion  = errors.New("restriccion de datos violada")
+	// La version enviada ya no es la actual del registro (otro cambio se guardo antes)
+	ErrVersion = errors.New("la version del registro cambio")
+)
+
+type EmpresaStore interface {
+	// Crea la empresa junto a su usuario en una sola operacion
+	Crear(ctx context.Context, empresa models.Empresa, usuario models.Usuario, historial int) error
+	Obtener(ctx context.Context, rif string) (models.Empresa, error)
+	// Los metodos Actualizar reciben la version esperada del registro (0 no la comprueba)
+	// y devuelven la nueva version
+	Actualizar(ctx context.Context, empresa models.Empresa, version int) (int, error)
+	CambiarEstado(ctx context.Context, rif string, estado bool) error
+	Listar(ctx context.Context, filtro FiltroEmpresas, consulta Consulta) (Pagina[models.Empresa], error)
+}
+
+type EmpleadoStore interface {
+	// Crea el empleado junto a su usuario en una sola operacion
+	Crear(ctx context.Context, empleado models.Empleados, usuario models.Usuario, historial int) error
+	Obtener(ctx context.Context, cedula string) (models.Empleados, error)
+	Actualizar(ctx context.Context, empleado models.Empleados, version int) (int, error)
+	CambiarEstado(ctx context.Context, cedula string, estado bool) error
+	Listar(ctx context.Context, filtro FiltroEmpleados, consulta Consulta) (Pagina[models.Empleados], error)
+}
+
+// Los metodos que guardan un hash de contraseña lo agregan al historial y conservan
+// solo los ultimos `historial` (0 desactiva el historial)
+type UsuarioStore interface {
+	Crear(ctx context.Context, usuario models.Usuario, historial int) error
+	Obtener(ctx context.Context, rifCedula string) (models.Usuario, error)
+	ObtenerPorUsuario(ctx context.Context, usuario string) (models.Usuario, error)
+	// Actualiza el nombre de usuario y/o el hash; los valores vacios no se modifican
+	Actualizar(ctx context.Context, rifCedula, nuevoUsuario, nuevoHash string, historial, version int) (int, error)
+	CambiarEstado(ctx context.Context, rifCedula string, estado bool) error
+	CambiarContrasena(ctx context.Context, rifCedula, hash string, historial int) error
+	// Ultimos n hashes anteriores, del mas reciente al mas antiguo
+	HistorialContrasenas(ctx context.Context, rifCedula string, n int) ([]string, error)
+	// Los usuarios listados no incluyen el hash de la contraseña
+	Listar(ctx context.Context, filtro FiltroUsuarios, consulta Consulta) (Pagina[models.Usuario], error)
+}
+
+type FerryStore interface {
+	Crear(ctx context.Context, ferry models.Ferry) error
+	Obtener(ctx context.Context, matricula string) (models.Ferry, error)
+	Actualizar(ctx context.Context, ferry models.Ferry, version int) (int, error)
+	Listar(ctx context.Context, filtro FiltroFerrys, consulta Consulta) (Pagina[models.Ferry], error)
+}
+
+type FacturaStore interface {
+	// Crea la factura y devuelve su id
+	Crear(ctx context.Context, factura models.Factura) (int, error)
+	Obtener(ctx context.Context, id int) (models.Factura, error)
+	Listar(ctx context.Context, filtro FiltroFacturas, consulta Consulta) (Pagina[models.Factura], error)
+	CambiarEstado(ctx context.Context, id int, estado bool) error
+}
+
+type TOTPStore interface {
+	Obtener(ctx context.Context, rifCedula string) (models.TOTP, error)
+	// Guarda un secreto pendiente de confirmar. Devuelve ErrDuplicado si ya hay uno activo
+	GuardarPendiente(ctx context.Context, rifCedula, secreto string, creado time.Time) error
+	Activar(ctx context.Context, rifCedula string, paso int64, codigosRecuperacion []string) error
+	// Registra el paso usado solo si es posterior al ultimo; false si ya se habia usado
+	AvanzarPaso(ctx context.Context, rifCedula string, paso int64) (bool, error)
+	// Elimina el codigo de recuperacion si existe; false si no existia
+	ConsumirCodigoRecuperacion(ctx context.Context, rifCedula, hash string) (bool, error)
+	Eliminar(ctx context.Context, rifCedula string) error
+}
+
+type ClaveAPIStore interface {
+	// Crea la clave y devuelve su id
+	Crear(ctx context.Context, clave models.ClaveAPI, hash, creadaPor string) (int, error)
+	// Devuelve la clave y el hash del secreto
+	ObtenerPorPrefijo(ctx context.Context, prefijo string) (models.ClaveAPI, string, error)
+	Listar(ctx context.Context, rifEmpresa string) ([]models.ClaveAPI, error)
+	Revocar(ctx context.Context, id int, rifEmpresa string) error
+	RegistrarUso(ctx context.Context, id int, fecha time.Time) error
+}
+
+type EventoSeguridadStore interface {
+	Registrar(ctx context.Context, evento models.EventoSeguridad) error
+}
+
+type IdempotenciaStore interface {
+	// Reserva la clave para una solicitud nueva (con Estado 0 y registro.Reservada). Si ya
+	// existe un registro vigente no lo modifica y lo devuelve junto a false. Una reserva sin
+	// completar hecha antes de abandonadaAntes, con el mismo hash, se toma como si no existiera
+	Reservar(ctx context.Context, registro models.SolicitudIdempotente, abandonadaAntes time.Time) (models.SolicitudIdempotente, bool, error)
+	// Guarda la respuesta de la solicitud que tiene la reserva. ErrNoEncontrado si otra la tomo
+	Completar(ctx context.Context, alcance, clave string, reservada time.Time, estado int, tipoContenido string, cuerpo []byte) error
+	// Libera una reserva para que la solicitud se pueda reintentar, si sigue siendo suya
+	Liberar(ctx context.Context, alcance, clave string, reservada time.Time) error
+	// Elimina los registros que vencieron antes de la fecha indicada
+	Purgar(ctx context.Context, antes time.Time) (int64, error)
+}
+
+// AuditoriaStore es el registro de auditoria de solo agregado
+type AuditoriaStore interface {
+	// Agrega el registro al final de la cadena y lo devuelve con su id y hash
+	Registrar(ctx context.Context, registro models.RegistroAuditoria) (models.RegistroAuditoria, error)
+	Listar(ctx context.Context, filtro FiltroAuditoria, consulta Consulta) (Pagina[models.RegistroAuditoria], error)
+	// Recorre toda la cadena comprobando los hashes
+	Verificar(ctx context.Context) (VerificacionAuditoria, error)
+}
+
+// Los metodos Listar devuelven ErrOrdenInvalido o ErrCursorInvalido si la consulta
+// pide un campo de orden desconocido o trae un cursor que no corresponde
+
+// Store agrupa los stores de todos los agregados
+type Store struct {
+	Empresas  EmpresaStore
+	Empleados EmpleadoStore
+	Usuarios  UsuarioStore
+	Ferrys    FerryStore
+	Facturas  FacturaStore
+	TOTP      TOTPStore
+	ClavesAPI ClaveAPIStore
+	Eventos   EventoSeguridadStore
+
+	Idempotencia IdempotenciaStore
+	Auditoria    AuditoriaStore
+
+	transaccion func(ctx context.Context, fn func(tx Store) error) error
+}
+
+// EnTransaccion ejecuta fn con stores que comparten una transaccion: los cambios hechos
+// con tx se confirman juntos solo si fn no devuelve error. Sin transaccion (stores en
+// memoria) fn recibe el mismo store, incluidos los stores que una prueba haya sustituido
+func (s Store) EnTransaccion(ctx context.Context, fn func(tx Store) error) error {
+	if s.transaccion == nil {
+		return fn(s)
+	}
+	return s.transaccion(ctx, fn)
+}
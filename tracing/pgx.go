@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TrazadorPgx crea un span por cada consulta de pgx (incluidos BEGIN y COMMIT de las
+// transacciones) y por cada lote. No registra los argumentos para no exponer datos personales
+type TrazadorPgx struct{}
+
+var (
+	_ pgx.QueryTracer = TrazadorPgx{}
+	_ pgx.BatchTracer = TrazadorPgx{}
+)
+
+func (TrazadorPgx) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db "+operacion(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(data.SQL),
+			semconv.DBOperationName(operacion(data.SQL)),
+		),
+	)
+	return ctx
+}
+
+func (TrazadorPgx) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	terminar(ctx, data.CommandTag.RowsAffected(), data.Err)
+}
+
+func (TrazadorPgx) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db batch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, attribute.Int("db.batch.size", data.Batch.Len())),
+	)
+	return ctx
+}
+
+func (TrazadorPgx) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if data.Err != nil {
+		trace.SpanFromContext(ctx).RecordError(data.Err)
+	}
+}
+
+func (TrazadorPgx) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	terminar(ctx, -1, data.Err)
+}
+
+func terminar(ctx context.Context, filas int64, err error) {
+	span := trace.SpanFromContext(ctx)
+	if filas >= 0 {
+		span.SetAttributes(attribute.Int64("db.filas_afectadas", filas))
+	}
+	//Que no haya filas no es un fallo de la consulta
+	if err != nil && err != pgx.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// operacion es la primera palabra de la sentencia (SELECT, INSERT, BEGIN...)
+func operacion(sql string) string {
+	campos := strings.Fields(sql)
+	if len(campos) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(campos[0])
+}
@@ -0,0 +1,61 @@
+// Package tracing configura OpenTelemetry: el proveedor de trazas con exportador OTLP,
+// la propagacion W3C (traceparent/tracestate) y el trazador de consultas de pgx.
+//
+// El exportador, el muestreo y el nombre del servicio vienen de config.Trazas. El
+// destino se lee de OTEL_EXPORTER_OTLP_ENDPOINT (p. ej. http://localhost:4318)
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Nombre del instrumentador usado en los spans propios
+const instrumentacion = "github.com/DiegoMaes17/BACKEND-FERRYAPP-GOLANG"
+
+// Tracer devuelve el tracer del servicio (no-op si las trazas estan desactivadas)
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentacion)
+}
+
+// Configurar instala el propagador W3C y, si el exportador es otlp, el proveedor que
+// exporta las trazas. La funcion devuelta envia los spans pendientes al terminar
+func Configurar(ctx context.Context, cfg config.Trazas) (func(context.Context) error, error) {
+	//La propagacion se instala siempre para mantener el trace id de quien llama en los logs
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	apagar := func(context.Context) error { return nil }
+	if !strings.EqualFold(cfg.Exportador, "otlp") {
+		return apagar, nil
+	}
+
+	exportador, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return apagar, fmt.Errorf("error creando exportador OTLP: %w", err)
+	}
+
+	recurso, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.NombreServicio)))
+	if err != nil {
+		return apagar, fmt.Errorf("error creando recurso de trazas: %w", err)
+	}
+
+	proveedor := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exportador),
+		sdktrace.WithResource(recurso),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Muestreo))),
+	)
+	otel.SetTracerProvider(proveedor)
+	return proveedor.Shutdown, nil
+}
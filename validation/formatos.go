@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	patronRIF      = regexp.MustCompile(`^([JGVE])-?(\d{8})-?(\d)$`)
+	patronCedula   = regexp.MustCompile(`^([VE]-?)?\d{6,9}$`)
+	patronTelefono = regexp.MustCompile(`^(\+58|0)[24]\d{9}$`)
+)
+
+// Peso de la letra inicial del RIF en el calculo del digito verificador (SENIAT)
+var pesoLetraRIF = map[byte]int{'V': 1, 'E': 2, 'J': 3, 'G': 5}
+
+// Pesos de los ocho digitos del RIF
+var pesosRIF = [8]int{3, 2, 7, 6, 5, 4, 3, 2}
+
+// RIFValido comprueba el formato (J-/G-/V-/E- seguido de 8 digitos) y el digito verificador
+func RIFValido(rif string) bool {
+	partes := patronRIF.FindStringSubmatch(rif)
+	if partes == nil {
+		return false
+	}
+
+	suma := pesoLetraRIF[partes[1][0]] * 4
+	for i, pesos := range pesosRIF {
+		suma += int(partes[2][i]-'0') * pesos
+	}
+	verificador := 11 - suma%11
+	if verificador >= 10 {
+		verificador = 0
+	}
+	return int(partes[3][0]-'0') == verificador
+}
+
+// CedulaValida acepta cedulas venezolanas o de extranjeros, con o sin prefijo V-/E-
+func CedulaValida(cedula string) bool {
+	return patronCedula.MatchString(cedula)
+}
+
+// TelefonoValido acepta numeros fijos y moviles venezolanos en formato nacional
+// (0414-1234567) o internacional (+584141234567). Se ignoran espacios y guiones
+func TelefonoValido(telefono string) bool {
+	limpio := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(telefono)
+	return patronTelefono.MatchString(limpio)
+}
+
+// EmailValido comprueba que sea una direccion simple (sin nombre ni corchetes)
+func EmailValido(email string) bool {
+	direccion, err := mail.ParseAddress(email)
+	return err == nil && direccion.Address == email && strings.Contains(email[strings.LastIndex(email, "@"):], ".")
+}
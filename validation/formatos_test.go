@@ -0,0 +1,99 @@
+package validation
+
+import "testing"
+
+func TestRIFValido(t *testing.T) {
+	casos := []struct {
+		rif    string
+		valido bool
+	}{
+		//RIF publicados: CANTV, SENIAT y Banco de Venezuela
+		{"J-00124134-5", true},
+		{"G-20000303-0", true},
+		{"J-00002961-0", true},
+		{"J001241345", true},
+		{"J-12345678-4", true},
+		{"V-12345678-1", true},
+		{"E-84123456-4", true},
+
+		//Digito verificador incorrecto
+		{"J-00124134-4", false},
+		{"G-20000303-1", false},
+		{"J-12345678-9", false},
+		{"V-12345678-4", false},
+
+		//Formato
+		{"j-00124134-5", false},
+		{"P-00124134-5", false},
+		{"J-0012413-5", false},
+		{"J-001241345-5", false},
+		{"J-00124134", false},
+		{" J-00124134-5", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if got := RIFValido(c.rif); got != c.valido {
+			t.Errorf("RIFValido(%q) = %v, se esperaba %v", c.rif, got, c.valido)
+		}
+	}
+}
+
+func TestCedulaValida(t *testing.T) {
+	casos := []struct {
+		cedula string
+		valida bool
+	}{
+		{"V-12345678", true},
+		{"E-84123456", true},
+		{"V12345678", true},
+		{"123456", true},
+		{"123456789", true},
+		{"12345", false},
+		{"1234567890", false},
+		{"J-12345678", false},
+		{"V-1234567a", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if got := CedulaValida(c.cedula); got != c.valida {
+			t.Errorf("CedulaValida(%q) = %v, se esperaba %v", c.cedula, got, c.valida)
+		}
+	}
+}
+
+func TestTelefonoValido(t *testing.T) {
+	casos := []struct {
+		telefono string
+		valido   bool
+	}{
+		{"0414-1234567", true},
+		{"+584141234567", true},
+		{"(0212) 555-1234", true},
+		{"0314-1234567", false},
+		{"0414-123456", false},
+		{"584141234567", false},
+	}
+	for _, c := range casos {
+		if got := TelefonoValido(c.telefono); got != c.valido {
+			t.Errorf("TelefonoValido(%q) = %v, se esperaba %v", c.telefono, got, c.valido)
+		}
+	}
+}
+
+func TestEmailValido(t *testing.T) {
+	casos := []struct {
+		email  string
+		valido bool
+	}{
+		{"naviera@ejemplo.com", true},
+		{"Naviera <naviera@ejemplo.com>", false},
+		{"naviera@localhost", false},
+		{"naviera.ejemplo.com", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if got := EmailValido(c.email); got != c.valido {
+			t.Errorf("EmailValido(%q) = %v, se esperaba %v", c.email, got, c.valido)
+		}
+	}
+}
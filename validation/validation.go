@@ -0,0 +1,202 @@
+// Package validation revisa los cuerpos de las solicitudes a partir de la etiqueta
+// `validar` de los campos, por ejemplo:
+//
+//	Email string `json:"email" validar:"requerido,email,max=150"`
+//
+// Reglas disponibles: requerido, min=N y max=N (longitud en textos, valor en numeros),
+// email, rif, cedula, rif_cedula, telefono y uno_de=a|b|c. uno_de distingue mayusculas,
+// porque el valor se guarda tal cual y los roles se comparan exactos. Salvo requerido, las
+// reglas no se aplican a campos vacios. Se devuelven todas las violaciones de una vez.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Violacion describe un campo que no cumple una regla. Campo usa los nombres JSON,
+// con punto para las estructuras anidadas (p. ej. "empresa.rif")
+type Violacion struct {
+	Campo   string `json:"campo"`
+	Mensaje string `json:"mensaje"`
+}
+
+// Validar aplica todas las reglas, incluidas las de campos requeridos. omitir lista
+// campos (por su nombre JSON) que no se revisan, p. ej. claves que no se pueden editar
+func Validar(v interface{}, omitir ...string) []Violacion {
+	return filtrar(validarValor(reflect.ValueOf(v), "", false), omitir)
+}
+
+// ValidarParcial es para actualizaciones: los campos con valor cero se consideran
+// no enviados y se omiten, el resto debe cumplir sus reglas
+func ValidarParcial(v interface{}, omitir ...string) []Violacion {
+	return filtrar(validarValor(reflect.ValueOf(v), "", true), omitir)
+}
+
+func filtrar(violaciones []Violacion, omitir []string) []Violacion {
+	if len(omitir) == 0 {
+		return violaciones
+	}
+	var resultado []Violacion
+	for _, v := range violaciones {
+		if !slices.Contains(omitir, v.Campo) {
+			resultado = append(resultado, v)
+		}
+	}
+	return resultado
+}
+
+var tipoTiempo = reflect.TypeOf(time.Time{})
+
+func validarValor(valor reflect.Value, prefijo string, parcial bool) []Violacion {
+	for valor.Kind() == reflect.Pointer || valor.Kind() == reflect.Interface {
+		if valor.IsNil() {
+			return nil
+		}
+		valor = valor.Elem()
+	}
+	if valor.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var violaciones []Violacion
+	tipo := valor.Type()
+	for i := 0; i < tipo.NumField(); i++ {
+		campo := tipo.Field(i)
+		if !campo.IsExported() {
+			continue
+		}
+		nombre := nombreJSON(campo)
+		if nombre == "-" {
+			continue
+		}
+		if prefijo != "" {
+			nombre = prefijo + "." + nombre
+		}
+
+		actual := valor.Field(i)
+		if campo.Type.Kind() == reflect.Struct && campo.Type != tipoTiempo {
+			violaciones = append(violaciones, validarValor(actual, nombre, parcial)...)
+			continue
+		}
+
+		etiqueta := campo.Tag.Get("validar")
+		if etiqueta == "" {
+			continue
+		}
+		if mensaje := aplicarReglas(etiqueta, actual, parcial); mensaje != "" {
+			violaciones = append(violaciones, Violacion{Campo: nombre, Mensaje: mensaje})
+		}
+	}
+	return violaciones
+}
+
+func nombreJSON(campo reflect.StructField) string {
+	nombre, _, _ := strings.Cut(campo.Tag.Get("json"), ",")
+	if nombre == "" {
+		return campo.Name
+	}
+	return nombre
+}
+
+// Devuelve el mensaje de la primera regla que falla o "" si el valor es valido
+func aplicarReglas(etiqueta string, valor reflect.Value, parcial bool) string {
+	vacio := valor.IsZero()
+	switch valor.Kind() {
+	case reflect.String:
+		vacio = strings.TrimSpace(valor.String()) == ""
+	case reflect.Slice, reflect.Map:
+		vacio = valor.Len() == 0
+	}
+
+	for _, regla := range strings.Split(etiqueta, ",") {
+		nombre, parametro, _ := strings.Cut(regla, "=")
+		if nombre == "requerido" {
+			if vacio && !parcial {
+				return "Campo requerido"
+			}
+			continue
+		}
+		if vacio {
+			continue
+		}
+		if mensaje := aplicarRegla(nombre, parametro, valor); mensaje != "" {
+			return mensaje
+		}
+	}
+	return ""
+}
+
+func aplicarRegla(nombre, parametro string, valor reflect.Value) string {
+	switch nombre {
+	case "min", "max":
+		limite, err := strconv.Atoi(parametro)
+		if err != nil {
+			panic(fmt.Sprintf("validation: limite invalido en %s=%s", nombre, parametro))
+		}
+		return validarLimite(nombre, limite, valor)
+	case "uno_de":
+		opciones := strings.Split(parametro, "|")
+		if slices.Contains(opciones, valor.String()) {
+			return ""
+		}
+		return "Debe ser uno de: " + strings.Join(opciones, ", ")
+	case "email":
+		if !EmailValido(valor.String()) {
+			return "Correo electrónico inválido"
+		}
+	case "rif":
+		if !RIFValido(valor.String()) {
+			return "RIF inválido, use el formato J-12345678-4"
+		}
+	case "cedula":
+		if !CedulaValida(valor.String()) {
+			return "Cédula inválida, use el formato V-12345678"
+		}
+	case "rif_cedula":
+		if !RIFValido(valor.String()) && !CedulaValida(valor.String()) {
+			return "Debe ser un RIF o una cédula válidos"
+		}
+	case "telefono":
+		if !TelefonoValido(valor.String()) {
+			return "Teléfono inválido, use el formato 0414-1234567 o +584141234567"
+		}
+	default:
+		panic("validation: regla desconocida " + nombre)
+	}
+	return ""
+}
+
+func validarLimite(nombre string, limite int, valor reflect.Value) string {
+	var (
+		medida int64
+		texto  bool
+	)
+	switch valor.Kind() {
+	case reflect.String:
+		medida, texto = int64(utf8.RuneCountInString(valor.String())), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		medida = valor.Int()
+	case reflect.Slice, reflect.Map:
+		medida = int64(valor.Len())
+	default:
+		panic("validation: " + nombre + " no aplica a " + valor.Kind().String())
+	}
+
+	switch {
+	case nombre == "min" && medida < int64(limite) && texto:
+		return fmt.Sprintf("Debe tener al menos %d caracteres", limite)
+	case nombre == "min" && medida < int64(limite):
+		return fmt.Sprintf("Debe ser al menos %d", limite)
+	case nombre == "max" && medida > int64(limite) && texto:
+		return fmt.Sprintf("Debe tener como máximo %d caracteres", limite)
+	case nombre == "max" && medida > int64(limite):
+		return fmt.Sprintf("Debe ser como máximo %d", limite)
+	}
+	return ""
+}
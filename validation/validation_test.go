@@ -0,0 +1,29 @@
+package validation
+
+import "testing"
+
+func TestUnoDe(t *testing.T) {
+	type usuario struct {
+		Tipo string `json:"tipo" validar:"requerido,uno_de=Administrador|empresa|empleado"`
+	}
+	casos := []struct {
+		tipo   string
+		valido bool
+	}{
+		{"Administrador", true},
+		{"empresa", true},
+		{"empleado", true},
+		//Se guardaria tal cual y no coincidiria con los roles, que se comparan exactos
+		{"administrador", false},
+		{"EMPRESA", false},
+		{"Empleado", false},
+		{"cliente", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		violaciones := Validar(usuario{Tipo: c.tipo})
+		if (len(violaciones) == 0) != c.valido {
+			t.Errorf("tipo %q: violaciones %v, valido esperado %v", c.tipo, violaciones, c.valido)
+		}
+	}
+}